@@ -0,0 +1,56 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"sync"
+	"time"
+)
+
+// aimdController adapts the concurrency of a host with an additive
+// increase, multiplicative decrease policy, like TCP congestion control:
+// starting from a single fetch, the limit grows by one for every round of
+// healthy responses and is halved on every degraded one, e.g. an error, a
+// 5xx or 429 response or a response slower than the latency target. The
+// limit never exceeds the concurrency set, keeping the crawl polite.
+type aimdController struct {
+	mutex sync.Mutex
+	limit float64
+	// latencyTarget is the response time above which a response is
+	// degraded, 0 means only errors are
+	latencyTarget time.Duration
+}
+
+func newAIMDController(latencyTarget time.Duration) *aimdController {
+	return &aimdController{limit: 1, latencyTarget: latencyTarget}
+}
+
+// Observe records a response, err is the error of the fetch if it failed
+func (a *aimdController) Observe(latency time.Duration, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if degrading(err) || (a.latencyTarget > 0 && latency > a.latencyTarget) {
+		a.limit /= 2
+		if a.limit < 1 {
+			a.limit = 1
+		}
+		return
+	}
+	// One more fetch once as many healthy responses as the limit arrived
+	a.limit += 1 / a.limit
+}
+
+// Limit returns the number of concurrent fetches allowed out of a maximum,
+// at least one
+func (a *aimdController) Limit(max int) int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	// Growing past the maximum would delay the reaction to a degradation
+	if a.limit > float64(max) {
+		a.limit = float64(max)
+	}
+	if a.limit < 1 {
+		return 1
+	}
+	return int(a.limit)
+}
@@ -0,0 +1,39 @@
+package crawler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+func TestAIMDController(t *testing.T) {
+	a := newAIMDController(100 * time.Millisecond)
+	if limit := a.Limit(8); limit != 1 {
+		t.Errorf("aimdController#Limit failed: expected to start from 1 got %d", limit)
+	}
+	// 1 + 1/1 + 1/2 + 1/2.5 ... reaches 4 after a few rounds
+	for i := 0; i < 10; i++ {
+		a.Observe(10*time.Millisecond, nil)
+	}
+	if limit := a.Limit(8); limit != 4 {
+		t.Errorf("aimdController#Observe failed: expected additive increase to 4 got %d", limit)
+	}
+	a.Observe(10*time.Millisecond, errors.New("connection reset"))
+	if limit := a.Limit(8); limit != 2 {
+		t.Errorf("aimdController#Observe failed: expected halving to 2 got %d", limit)
+	}
+	a.Observe(time.Second, nil)
+	if limit := a.Limit(8); limit != 1 {
+		t.Errorf("aimdController#Observe failed: expected halving on slow response got %d", limit)
+	}
+	// Client errors are not a sign of trouble
+	a.Observe(10*time.Millisecond, &fetcher.StatusError{Code: 404, Status: "404 Not Found"})
+	for i := 0; i < 100; i++ {
+		a.Observe(10*time.Millisecond, nil)
+	}
+	if limit := a.Limit(3); limit != 3 {
+		t.Errorf("aimdController#Limit failed: expected the maximum 3 got %d", limit)
+	}
+}
@@ -0,0 +1,43 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"net/url"
+)
+
+// Metadata key of the AMP version of a page
+const ampMetadataKey string = "amphtml"
+
+// ampMirror tests if a page is the AMP mirror of another one, an AMP page
+// with a canonical URL other than its own
+func ampMirror(link *url.URL, page *Page) bool {
+	return page.AMP && page.Canonical != nil && page.Canonical.String() != link.String()
+}
+
+// ampLinks returns the links of a page to crawl given its AMP version: the
+// AMP version is crawled, for its links, only if FollowAMP is set,
+// otherwise it's recorded as an alias of the page and never crawled, even if
+// linked by other pages
+func (c *WebCrawler) ampLinks(h *hostCrawl, page *Page, links []*url.URL) []*url.URL {
+	if page.AMPHTML == nil {
+		return links
+	}
+	amp := page.AMPHTML.String()
+	if !c.settings.FollowAMP {
+		h.aliases.Store(amp, struct{}{})
+		filtered := make([]*url.URL, 0, len(links))
+		for _, link := range links {
+			if link.String() != amp {
+				filtered = append(filtered, link)
+			}
+		}
+		return filtered
+	}
+	for _, link := range links {
+		if link.String() == amp {
+			return links
+		}
+	}
+	return append(links, page.AMPHTML)
+}
@@ -0,0 +1,53 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCrawlAMP(t *testing.T) {
+	for _, follow := range []bool{false, true} {
+		var amp int32
+		handler := http.NewServeMux()
+		handler.HandleFunc("/", resourceMock(`<a href="/post">`))
+		handler.HandleFunc("/post", resourceMock(`<head><link rel="amphtml" href="/amp/post"></head><a href="/amp/post">`))
+		handler.HandleFunc("/amp/post", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&amp, 1)
+			_, _ = w.Write([]byte(`<html amp><head><link rel="canonical" href="/post"></head><a href="/about"></html>`))
+		})
+		handler.HandleFunc("/about", resourceMock(""))
+		server := httptest.NewServer(handler)
+		testbus := testQueue{make(chan []byte)}
+		results := make(chan []ParsedResult)
+		go func() { results <- consumeEvents(&testbus) }()
+		crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+			withPolitenessDelay(0), func(s *CrawlerSettings) {
+				s.Concurrency = 1
+				s.FollowAMP = follow
+			})
+		crawler.Crawl(server.URL + "/")
+		testbus.Close()
+		res := <-results
+		server.Close()
+		urls := make(map[string]ParsedResult)
+		for _, r := range res {
+			urls[r.URL] = r
+		}
+		if _, ok := urls[server.URL+"/amp/post"]; ok || len(urls) != 2 {
+			t.Errorf("Crawler#Crawl failed: follow %v expected no result for the AMP mirror got %v", follow, res)
+		}
+		if post := urls[server.URL+"/post"]; post.Metadata["amphtml"] != server.URL+"/amp/post" {
+			t.Errorf("Crawler#Crawl failed: expected the AMP version in the metadata got %v", post.Metadata)
+		}
+		expected := int32(0)
+		if follow {
+			expected = 1
+		}
+		if fetched := atomic.LoadInt32(&amp); fetched != expected {
+			t.Errorf("Crawler#Crawl failed: follow %v expected AMP page fetched %d times got %d", follow, expected, fetched)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+// DefaultAssetExtensions contains the extensions of the links pointing to
+// documents and media to download instead of crawling them
+var DefaultAssetExtensions = []string{
+	".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".ico",
+	".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".odt",
+	".zip", ".mp3", ".mp4", ".webm",
+}
+
+// splitAssets separates the assets of a page, embedded resources and links
+// pointing to documents or media, from the links to crawl
+func (c *WebCrawler) splitAssets(page *fetcher.Page) ([]*url.URL, []*url.URL) {
+	assets := append([]*url.URL{}, page.Assets...)
+	links := []*url.URL{}
+	for _, link := range page.Links {
+		if c.isAsset(link) {
+			assets = append(assets, link)
+		} else {
+			links = append(links, link)
+		}
+	}
+	return assets, links
+}
+
+// isAsset tests if a link points to a document or media by its extension
+func (c *WebCrawler) isAsset(link *url.URL) bool {
+	ext := strings.ToLower(filepath.Ext(link.Path))
+	for _, assetExt := range c.settings.AssetExtensions {
+		if ext == assetExt {
+			return true
+		}
+	}
+	return false
+}
+
+// assetDownloads gathers the downloads of the assets of a page, done is
+// called with the URLs of the assets downloaded once the last one ends
+type assetDownloads struct {
+	mutex      sync.Mutex
+	pending    int
+	downloaded []string
+	done       func([]string)
+}
+
+// End records the end of the download of an asset, empty if it failed
+func (d *assetDownloads) End(asset string) {
+	d.mutex.Lock()
+	if asset != "" {
+		d.downloaded = append(d.downloaded, asset)
+	}
+	d.pending--
+	last := d.pending == 0
+	d.mutex.Unlock()
+	if last && d.done != nil {
+		d.done(d.downloaded)
+	}
+}
+
+// queuedAsset is an asset waiting for a slot of the fetch stage
+type queuedAsset struct {
+	link      *url.URL
+	downloads *assetDownloads
+}
+
+// assetQueue holds the assets found by the parse stage till the fetch stage
+// downloads them, they're dispatched ahead of the links of the frontier
+type assetQueue struct {
+	mutex  sync.Mutex
+	assets []queuedAsset
+}
+
+// Push queues the assets of a page
+func (q *assetQueue) Push(assets []*url.URL, done func([]string)) {
+	downloads := &assetDownloads{pending: len(assets), done: done}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, asset := range assets {
+		q.assets = append(q.assets, queuedAsset{asset, downloads})
+	}
+}
+
+// Pop returns the first asset queued, false if there's none
+func (q *assetQueue) Pop() (queuedAsset, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.assets) == 0 {
+		return queuedAsset{}, false
+	}
+	asset := q.assets[0]
+	q.assets[0] = queuedAsset{}
+	q.assets = q.assets[1:]
+	return asset, true
+}
+
+// Abandon drops the assets still queued, the pages waiting for them are
+// produced with the ones downloaded so far
+func (q *assetQueue) Abandon() {
+	q.mutex.Lock()
+	assets := q.assets
+	q.assets = nil
+	q.mutex.Unlock()
+	for _, asset := range assets {
+		asset.downloads.End("")
+	}
+}
+
+// allowedAssets returns the assets of a page to download, skipping the
+// ones already downloaded, on blocked hosts or not allowed by the crawling
+// rules
+func (c *WebCrawler) allowedAssets(h *hostCrawl, assets []*url.URL) []*url.URL {
+	if c.settings.BodyStore == nil {
+		h.logger.Error("Unable to download assets: no BodyStore set")
+		return nil
+	}
+	allowed := []*url.URL{}
+	for _, asset := range assets {
+		if c.hostAllowed(asset.Hostname()) && h.rules.Allowed(asset) {
+			allowed = append(allowed, asset)
+		}
+	}
+	return allowed
+}
+
+// queueAssets hands the assets of a page to the fetch stage, they count as
+// links in flight till downloaded
+func (c *WebCrawler) queueAssets(h *hostCrawl, assets []*url.URL, done func([]string)) {
+	atomic.AddInt32(&h.inflight, int32(len(assets)))
+	h.assets.Push(assets, done)
+	h.wake()
+}
+
+// assetStage downloads an asset storing it in the BodyStore, the fetch slot
+// is held for the politeness delay like the one of a page
+func (c *WebCrawler) assetStage(ctx context.Context, h *hostCrawl, asset queuedAsset) {
+	defer h.done()
+	defer func() {
+		delay := h.health.Delay(h.rules.Delay())
+		h.stats.Delayed(delay)
+		sleep(ctx, delay)
+		h.health.Ended()
+		h.semaphore.Release()
+	}()
+	if err := c.downloadAsset(h.work, asset.link); err != nil {
+		h.logger.Error("Asset download failed", "url", asset.link, "err", err)
+		asset.downloads.End("")
+		return
+	}
+	asset.downloads.End(asset.link.String())
+}
+
+// downloadAsset fetches a single asset storing it in the BodyStore, assets
+// bigger than MaxAssetSize are discarded
+func (c *WebCrawler) downloadAsset(ctx context.Context, asset *url.URL) error {
+	_, res, err := fetchContext(ctx, c.linkFetcher, asset.String())
+	if err != nil {
+		return fmt.Errorf("downloading asset %s failed: %w", asset, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("downloading asset %s failed: %s", asset, res.Status)
+	}
+	maxSize := c.settings.MaxAssetSize
+	if res.ContentLength > maxSize {
+		return fmt.Errorf("downloading asset %s failed: size exceeds %d bytes", asset, maxSize)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return fmt.Errorf("downloading asset %s failed: %w", asset, err)
+	}
+	if int64(len(body)) > maxSize {
+		return fmt.Errorf("downloading asset %s failed: size exceeds %d bytes", asset, maxSize)
+	}
+	return c.settings.BodyStore.Store(asset, res.Header.Get("Content-Type"), bytes.NewReader(body))
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	mutex    sync.Mutex
+	contents map[string]string
+}
+
+func (s *memoryStore) Store(link *url.URL, contentType string, body io.Reader) error {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.contents[link.Path] = string(content)
+	s.mutex.Unlock()
+	return nil
+}
+
+func withAssets(store BodyStore, maxSize int64) CrawlerOpt {
+	return func(s *CrawlerSettings) {
+		s.DownloadAssets = true
+		s.BodyStore = store
+		s.MaxAssetSize = maxSize
+	}
+}
+
+func TestCrawlPagesDownloadingAssets(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/foo", resourceMock(
+		`<body>
+			<img src="/logo.png">
+			<img src="/big.png">
+			<a href="/doc.pdf">doc</a>
+		</body>`,
+	))
+	handler.HandleFunc("/logo.png", resourceMock("png"))
+	handler.HandleFunc("/doc.pdf", resourceMock("pdf"))
+	handler.HandleFunc("/big.png", resourceMock(strings.Repeat("png", 16)))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	store := &memoryStore{contents: map[string]string{}}
+	crawler := New("test-agent", &testbus,
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0), withAssets(store, 16))
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	res := <-results
+	expected := map[string]string{"/logo.png": "png", "/doc.pdf": "pdf"}
+	if !reflect.DeepEqual(store.contents, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, store.contents)
+	}
+	if len(res) != 1 {
+		t.Fatalf("Crawler#Crawl failed: expected 1 result got %v", res)
+	}
+	sort.Strings(res[0].Assets)
+	expectedAssets := []string{server.URL + "/doc.pdf", server.URL + "/logo.png"}
+	if !reflect.DeepEqual(res[0].Assets, expectedAssets) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expectedAssets, res[0].Assets)
+	}
+}
+
+func TestCrawlPagesDownloadingAssetsPastPagesLimit(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/foo", resourceMock(
+		`<body>
+			<img src="/logo.png">
+			<a href="/bar">bar</a>
+		</body>`,
+	))
+	handler.HandleFunc("/bar", resourceMock(`<body></body>`))
+	handler.HandleFunc("/logo.png", resourceMock("png"))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	store := &memoryStore{contents: map[string]string{}}
+	crawler := New("test-agent", &testbus,
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0), withAssets(store, 16),
+		func(s *CrawlerSettings) { s.MaxPages = 1 })
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	res := <-results
+	expected := map[string]string{"/logo.png": "png"}
+	if !reflect.DeepEqual(store.contents, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, store.contents)
+	}
+	if len(res) != 1 || !reflect.DeepEqual(res[0].Assets, []string{server.URL + "/logo.png"}) {
+		t.Errorf("Crawler#Crawl failed: expected the assets of /foo got %v", res)
+	}
+}
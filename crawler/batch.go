@@ -0,0 +1,80 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// resultBatches accumulates the results of each type till a batch is full
+type resultBatches struct {
+	mutex   sync.Mutex
+	size    int
+	pending map[ResultType][]any
+}
+
+func newResultBatches(size int) *resultBatches {
+	return &resultBatches{size: size, pending: make(map[ResultType][]any)}
+}
+
+// Add adds a result to the batch of its type, returns the batch once full,
+// nil otherwise
+func (b *resultBatches) Add(resultType ResultType, result any) []any {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.pending[resultType] = append(b.pending[resultType], result)
+	if len(b.pending[resultType]) < b.size {
+		return nil
+	}
+	batch := b.pending[resultType]
+	delete(b.pending, resultType)
+	return batch
+}
+
+// Flush empties the batches not full yet, calling fn with each one
+func (b *resultBatches) Flush(fn func(ResultType, []any)) {
+	b.mutex.Lock()
+	pending := b.pending
+	b.pending = make(map[ResultType][]any)
+	b.mutex.Unlock()
+	for resultType, batch := range pending {
+		fn(resultType, batch)
+	}
+}
+
+// emitBatch encodes a batch of results and sends it to the queue of its type
+func (c *WebCrawler) emitBatch(run *crawlRun, resultType ResultType, batch []any) {
+	logger := c.logger.With("job", run.job, "batch", len(batch))
+	payload, err := marshalBatch(c.resultEncoding(resultType), batch)
+	if err != nil {
+		logger.Error("Unable to encode result", "err", err)
+		return
+	}
+	c.emit(run, resultType, payload, logger)
+}
+
+// emitResult produces a result of a type other than the page one, added to
+// the batch of its type if batching is enabled
+func (c *WebCrawler) emitResult(run *crawlRun, resultType ResultType, result any,
+	logger *slog.Logger) {
+	if run.batches != nil {
+		if batch := run.batches.Add(resultType, result); batch != nil {
+			c.emitBatch(run, resultType, batch)
+		}
+		return
+	}
+	payload, err := marshalResult(c.resultEncoding(resultType), result)
+	if err != nil {
+		logger.Error("Unable to encode result", "err", err)
+		return
+	}
+	c.emit(run, resultType, payload, logger)
+}
+
+// flushBatches sends the batches not full yet at the end of a crawl
+func (c *WebCrawler) flushBatches(run *crawlRun) {
+	run.batches.Flush(func(resultType ResultType, batch []any) {
+		c.emitBatch(run, resultType, batch)
+	})
+}
@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestResultBatches(t *testing.T) {
+	b := newResultBatches(2)
+	if batch := b.Add(PageResult, "a"); batch != nil {
+		t.Errorf("resultBatches#Add failed: unexpected batch %v", batch)
+	}
+	if batch := b.Add(PageResult, "b"); fmt.Sprint(batch) != "[a b]" {
+		t.Errorf("resultBatches#Add failed: unexpected batch %v", batch)
+	}
+	b.Add(PageResult, "c")
+	flushed := [][]any{}
+	b.Flush(func(resultType ResultType, batch []any) {
+		flushed = append(flushed, batch)
+	})
+	if fmt.Sprint(flushed) != "[[c]]" {
+		t.Errorf("resultBatches#Flush failed: unexpected batches %v", flushed)
+	}
+}
+
+func TestCrawlPagesInBatches(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	for _, size := range []int{3, 10} {
+		testbus := testQueue{make(chan []byte)}
+		messages := make(chan [][]ParsedResult)
+		go func() {
+			batches := [][]ParsedResult{}
+			for e := range testbus.bus {
+				var batch []ParsedResult
+				if err := json.Unmarshal(e, &batch); err != nil {
+					t.Errorf("Crawler#Crawl failed: invalid batch %s", e)
+				}
+				batches = append(batches, batch)
+			}
+			messages <- batches
+		}()
+		crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+			withPolitenessDelay(0), func(s *CrawlerSettings) { s.BatchSize = size })
+		crawler.Crawl(server.URL + "/foo")
+		testbus.Close()
+		// Full or not, the only batch is sent by the end of the crawl
+		if batches := <-messages; len(batches) != 1 || len(batches[0]) != 3 {
+			t.Errorf("Crawler#Crawl failed: expected 1 batch of 3 results got %v", batches)
+		}
+	}
+}
+
+func TestConcurrentCrawlsInBatches(t *testing.T) {
+	first, second := serverMockWithoutRobotsTxt(), serverMockWithoutRobotsTxt()
+	defer first.Close()
+	defer second.Close()
+	testbus := testQueue{make(chan []byte)}
+	messages := make(chan [][]ParsedResult)
+	go func() {
+		batches := [][]ParsedResult{}
+		for e := range testbus.bus {
+			var batch []ParsedResult
+			if err := json.Unmarshal(e, &batch); err != nil {
+				t.Errorf("Crawler#Crawl failed: invalid batch %s", e)
+			}
+			batches = append(batches, batch)
+		}
+		messages <- batches
+	}()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.BatchSize = 3 })
+	// Each crawl has its own batches
+	done := make(chan struct{})
+	go func() {
+		crawler.Crawl(first.URL + "/foo")
+		close(done)
+	}()
+	crawler.Crawl(second.URL + "/foo")
+	<-done
+	testbus.Close()
+	batches := <-messages
+	if len(batches) != 2 {
+		t.Fatalf("Crawler#Crawl failed: expected 2 batches got %v", batches)
+	}
+	for _, batch := range batches {
+		if len(batch) != 3 {
+			t.Errorf("Crawler#Crawl failed: expected 3 results got %v", batch)
+		}
+		for _, result := range batch[1:] {
+			if result.URL[:len(first.URL)] != batch[0].URL[:len(first.URL)] {
+				t.Errorf("Crawler#Crawl failed: expected a batch per crawl got %v", batch)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// BodyStore defines the behavior expected by a storage of raw contents
+// downloaded during the crawl, e.g. images and documents
+type BodyStore interface {
+	// Store persists the content of a resource identified by its URL
+	Store(link *url.URL, contentType string, body io.Reader) error
+}
+
+// fileStore is a `BodyStore` saving each content in a file on disk, under a
+// directory for each host
+type fileStore struct {
+	dir string
+}
+
+// NewFileStore creates a new `BodyStore` saving contents in a directory,
+// every file is named after the hash of its URL, keeping its extension
+func NewFileStore(dir string) BodyStore {
+	return fileStore{dir}
+}
+
+// Store writes the content of a resource in a file
+// <dir>/<host>/<sha1 of URL><ext>
+func (s fileStore) Store(link *url.URL, contentType string, body io.Reader) error {
+	hostDir := filepath.Join(s.dir, link.Hostname())
+	if err := os.MkdirAll(hostDir, 0o755); err != nil {
+		return fmt.Errorf("storing %s failed: %w", link, err)
+	}
+	hash := sha1.Sum([]byte(link.String()))
+	name := hex.EncodeToString(hash[:]) + filepath.Ext(link.Path)
+	file, err := os.Create(filepath.Join(hostDir, name))
+	if err != nil {
+		return fmt.Errorf("storing %s failed: %w", link, err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, body); err != nil {
+		return fmt.Errorf("storing %s failed: %w", link, err)
+	}
+	return nil
+}
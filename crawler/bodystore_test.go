@@ -0,0 +1,26 @@
+package crawler
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStoreStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+	link, _ := url.Parse("http://localhost:8787/images/logo.png")
+	if err := store.Store(link, "image/png", bytes.NewBufferString("png")); err != nil {
+		t.Errorf("fileStore#Store failed: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "localhost", "*.png"))
+	if len(files) != 1 {
+		t.Fatalf("fileStore#Store failed: expected 1 file got %v", files)
+	}
+	content, _ := os.ReadFile(files[0])
+	if string(content) != "png" {
+		t.Errorf("fileStore#Store failed: expected png got %s", content)
+	}
+}
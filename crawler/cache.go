@@ -4,39 +4,83 @@ package crawler
 
 import "sync"
 
-// memoryCache is just a simple in-memory thread-safe map to track multiple
-// sets of keys
-type memoryCache struct {
+// Default number of shards of the in-memory cache, enough to make the lock
+// contention negligible with hundreds of workers
+const defaultCacheShards int = 64
+
+// cacheShard is a portion of the memoryCache keys, with its own lock
+type cacheShard struct {
 	mutex sync.RWMutex
 	cache map[string]map[string]bool
 }
 
-// newMemoryCache creates and return a pointer to a memoryCache object, it
-// also inits the outer map, each new key inserted will lazily init the set it
-// refers to
+// memoryCache is just a simple in-memory thread-safe map to track multiple
+// sets of keys. Keys are spread by hash across shards with independent
+// locks, so that concurrent workers rarely contend the same lock.
+type memoryCache struct {
+	shards []*cacheShard
+}
+
+// newMemoryCache creates and return a pointer to a memoryCache object with
+// the default number of shards
 func newMemoryCache() *memoryCache {
-	return &memoryCache{cache: make(map[string]map[string]bool)}
+	return newShardedMemoryCache(defaultCacheShards)
+}
+
+// newShardedMemoryCache creates and return a pointer to a memoryCache object
+// with a number of shards, at least one, it also inits the outer map of each
+// shard, each new key inserted will lazily init the set it refers to
+func newShardedMemoryCache(shards int) *memoryCache {
+	if shards < 1 {
+		shards = 1
+	}
+	c := &memoryCache{shards: make([]*cacheShard, shards)}
+	for i := range c.shards {
+		c.shards[i] = &cacheShard{cache: make(map[string]map[string]bool)}
+	}
+	return c
+}
+
+// shard returns the shard of a key of a namespace, hashing both with FNV-1a
+func (c *memoryCache) shard(namespace, key string) *cacheShard {
+	const (
+		offset uint64 = 14695981039346656037
+		prime  uint64 = 1099511628211
+	)
+	hash := offset
+	for i := 0; i < len(namespace); i++ {
+		hash = (hash ^ uint64(namespace[i])) * prime
+	}
+	// Separator, so that moving characters between the namespace and the
+	// key changes the hash
+	hash *= prime
+	for i := 0; i < len(key); i++ {
+		hash = (hash ^ uint64(key[i])) * prime
+	}
+	return c.shards[hash%uint64(len(c.shards))]
 }
 
 // Set add a new entry to the map and, if it's a new key it also init the set
 // it points to, otherwise just add the key to the set
 func (c *memoryCache) Set(namespace, key string) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	_, ok := c.cache[namespace]
+	s := c.shard(namespace, key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.cache[namespace]
 	if !ok {
-		c.cache[namespace] = make(map[string]bool)
+		s.cache[namespace] = make(map[string]bool)
 	}
-	c.cache[namespace][key] = true
+	s.cache[namespace][key] = true
 }
 
 // Contains check if a key is already stored in the cache, to be true the
 // cache must contain the namespace key on the outer map and also the key in
 // the set referred.
 func (c *memoryCache) Contains(namespace, key string) bool {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-	inner, ok := c.cache[namespace]
+	s := c.shard(namespace, key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	inner, ok := s.cache[namespace]
 	if !ok {
 		return false
 	}
@@ -1,6 +1,11 @@
 package crawler
 
-import "testing"
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+)
 
 func TestCacheSet(t *testing.T) {
 	cache := newMemoryCache()
@@ -20,3 +25,55 @@ func TestCacheContains(t *testing.T) {
 		t.Errorf("TestCacheSet#Set failed: expected false got true")
 	}
 }
+
+func TestCacheSharding(t *testing.T) {
+	cache := newShardedMemoryCache(8)
+	for i := 0; i < 1000; i++ {
+		cache.Set("test", fmt.Sprintf("https://example.com/%d", i))
+	}
+	for i, shard := range cache.shards {
+		if len(shard.cache["test"]) == 0 {
+			t.Errorf("TestCacheSharding failed: shard %d is empty", i)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if !cache.Contains("test", fmt.Sprintf("https://example.com/%d", i)) {
+			t.Errorf("TestCacheSharding failed: key %d not found", i)
+		}
+	}
+	if cache.Contains("other", "https://example.com/0") {
+		t.Errorf("TestCacheSharding failed: key found in another namespace")
+	}
+}
+
+func TestCacheConcurrentAccess(t *testing.T) {
+	cache := newMemoryCache()
+	wg := sync.WaitGroup{}
+	for w := 0; w < 100; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("https://example.com/%d/%d", w, i)
+				cache.Set("test", key)
+				if !cache.Contains("test", key) {
+					t.Errorf("TestCacheConcurrentAccess failed: %s not found", key)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func BenchmarkCacheParallel(b *testing.B) {
+	cache := newMemoryCache()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := "https://example.com/" + strconv.Itoa(i)
+			cache.Set("test", key)
+			cache.Contains("test", key)
+			i++
+		}
+	})
+}
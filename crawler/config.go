@@ -0,0 +1,328 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+	"github.com/codepr/webcrawler/env"
+)
+
+// Validate checks the consistency of the settings, returning an error for
+// each invalid value found
+func (s *CrawlerSettings) Validate() error {
+	errs := []error{}
+	if s.UserAgent == "" {
+		errs = append(errs, errors.New("user agent is required"))
+	}
+	nonNegatives := map[string]int64{
+		"fetch timeout":          int64(s.FetchTimeout),
+		"crawl timeout":          int64(s.CrawlTimeout),
+		"max retry after":        int64(s.MaxRetryAfter),
+		"shutdown timeout":       int64(s.ShutdownTimeout),
+		"concurrency":            int64(s.Concurrency),
+		"max concurrent domains": int64(s.MaxConcurrentDomains),
+		"adaptive latency":       int64(s.AdaptiveLatencyTarget),
+		"parse concurrency":      int64(s.ParseConcurrency),
+		"max depth":              int64(s.MaxDepth),
+		"max pages":              int64(s.MaxPages),
+		"max listing pages":      int64(s.MaxListingPages),
+		"frontier memory limit":  int64(s.FrontierMemoryLimit),
+		"politeness delay":       int64(s.PolitenessFixedDelay),
+		"max URL length":         int64(s.URLLimits.MaxLength),
+		"max query params":       int64(s.URLLimits.MaxQueryParams),
+		"max path segments":      int64(s.URLLimits.MaxPathSegments),
+		"max repeated segments":  int64(s.MaxRepeatedSegments),
+		"max asset size":         s.MaxAssetSize,
+		"compress threshold":     int64(s.CompressThreshold),
+		"batch size":             int64(s.BatchSize),
+		"excerpt length":         int64(s.ExcerptLength),
+	}
+	for name, value := range nonNegatives {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %d", name, value))
+		}
+	}
+	if s.MinRelevance < 0 || s.MinRelevance > 1 {
+		errs = append(errs, fmt.Errorf("min relevance must be between 0 and 1, got %f", s.MinRelevance))
+	}
+	if s.LogLevel < LogDebug || s.LogLevel > LogError {
+		errs = append(errs, fmt.Errorf("invalid log level %s", s.LogLevel))
+	}
+	if !validResultEncoding(s.ResultEncoding) {
+		errs = append(errs, fmt.Errorf("unknown result encoding %q", s.ResultEncoding))
+	}
+	if _, err := newGrepper(s.GrepPatterns); err != nil {
+		errs = append(errs, err)
+	}
+	if s.Parser == nil {
+		errs = append(errs, errors.New("parser is required"))
+	}
+	if s.Cache == nil {
+		errs = append(errs, errors.New("cache is required"))
+	}
+	for _, patterns := range [][]string{s.AllowedHosts, s.BlockedHosts, s.AllowedDomains} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs,
+					fmt.Errorf("invalid host pattern %q: %w", pattern, err))
+			}
+		}
+	}
+	if s.FollowExternalLinks && len(s.AllowedDomains) == 0 {
+		errs = append(errs, errors.New("following external links requires allowed domains"))
+	}
+	if len(s.Dialer.SourceIPs) > 0 && s.Dialer.Interface != "" {
+		errs = append(errs, errors.New("source IPs and bind interface are mutually exclusive"))
+	}
+	if s.DownloadAssets && s.BodyStore == nil {
+		errs = append(errs, errors.New("downloading assets requires a body store"))
+	}
+	return errors.Join(errs...)
+}
+
+// parserFromEnv sets the parser by name reading PARSER
+func parserFromEnv(r *env.Reader, s *CrawlerSettings) {
+	parser, err := parserByName(r.String("PARSER", "goquery"))
+	if err != nil {
+		r.Invalid("PARSER", err)
+		return
+	}
+	s.Parser = parser
+}
+
+// parserByName returns a new parser by its name, only "goquery" is
+// supported for now
+func parserByName(name string) (fetcher.Parser, error) {
+	switch name {
+	case "goquery":
+		return fetcher.NewGoqueryParser(), nil
+	default:
+		return nil, fmt.Errorf("unknown parser %q", name)
+	}
+}
+
+// cacheFromEnv sets the cache backend by name reading CACHE
+func cacheFromEnv(r *env.Reader, s *CrawlerSettings) {
+	cache, err := cacheByName(r.String("CACHE", "memory"))
+	if err != nil {
+		r.Invalid("CACHE", err)
+		return
+	}
+	s.Cache = cache
+}
+
+// cacheByName returns a new cache backend by its name, only "memory" is
+// supported for now
+func cacheByName(name string) (Cachable, error) {
+	switch name {
+	case "memory":
+		return newMemoryCache(), nil
+	default:
+		return nil, fmt.Errorf("unknown cache %q", name)
+	}
+}
+
+// proxyRulesFromEnv sets the proxy rules reading PROXY_RULES, a semicolon
+// separated list of host-pattern=proxy-url pairs, and PROXY, the proxy for
+// all the other hosts
+func proxyRulesFromEnv(r *env.Reader, s *CrawlerSettings) {
+	rules, err := parseProxyRules(env.GetEnvAsMap("PROXY_RULES", ";", nil), r.String("PROXY", ""))
+	if err != nil {
+		r.Invalid("PROXY_RULES", err)
+		return
+	}
+	if len(rules) > 0 {
+		s.ProxyRules = rules
+	}
+}
+
+// fetchTimeoutsFromEnv sets the timeouts of specific hosts reading
+// FETCHING_TIMEOUTS, a semicolon separated list of host-pattern=timeout
+// pairs, see parseHostTimeouts
+func fetchTimeoutsFromEnv(r *env.Reader, s *CrawlerSettings) {
+	timeouts, err := parseHostTimeouts(env.GetEnvAsMap("FETCHING_TIMEOUTS", ";", nil))
+	if err != nil {
+		r.Invalid("FETCHING_TIMEOUTS", err)
+		return
+	}
+	if len(timeouts) > 0 {
+		s.FetchTimeouts = timeouts
+	}
+}
+
+// parseHostTimeouts parses a map of host patterns to timeouts, either a
+// number of seconds or a duration, e.g. 1m30s, nil if empty
+func parseHostTimeouts(values map[string]string) (fetcher.HostTimeouts, error) {
+	var timeouts fetcher.HostTimeouts
+	for host, value := range values {
+		timeout, err := time.ParseDuration(value)
+		if seconds, serr := strconv.Atoi(value); serr == nil {
+			timeout, err = time.Duration(seconds)*time.Second, nil
+		}
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid timeout %q of %s", value, host)
+		}
+		if timeouts == nil {
+			timeouts = make(fetcher.HostTimeouts)
+		}
+		timeouts[host] = timeout
+	}
+	return timeouts, nil
+}
+
+// parseProxyRules builds a list of proxy rules from a map of host patterns
+// to proxy URLs, where "direct" means no proxy, and a default proxy for all
+// the other hosts. Most specific, e.g. longest, patterns are checked first.
+func parseProxyRules(hostProxies map[string]string, defaultProxy string) ([]fetcher.ProxyRule, error) {
+	rules := []fetcher.ProxyRule{}
+	for host, proxy := range hostProxies {
+		proxyURL, err := parseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, fetcher.ProxyRule{Host: host, Proxy: proxyURL})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if len(rules[i].Host) == len(rules[j].Host) {
+			return rules[i].Host < rules[j].Host
+		}
+		return len(rules[i].Host) > len(rules[j].Host)
+	})
+	if defaultProxy != "" {
+		proxyURL, err := parseProxy(defaultProxy)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, fetcher.ProxyRule{Host: "*", Proxy: proxyURL})
+	}
+	return rules, nil
+}
+
+// parseProxy parses a proxy URL, "direct" means no proxy and returns nil
+func parseProxy(proxy string) (*url.URL, error) {
+	if proxy == "direct" {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return proxyURL, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+}
+
+// dialerFromEnv sets the dialer options reading IP_PREFERENCE,
+// HAPPY_EYEBALLS_DELAY in milliseconds, SOURCE_IPS, a comma separated list
+// of addresses, and BIND_INTERFACE
+func dialerFromEnv(r *env.Reader, s *CrawlerSettings) {
+	preference, err := fetcher.ParseIPPreference(r.String("IP_PREFERENCE", s.Dialer.IPPreference.String()))
+	if err != nil {
+		r.Invalid("IP_PREFERENCE", err)
+	}
+	s.Dialer.IPPreference = preference
+	s.Dialer.FallbackDelay = time.Duration(r.Int("HAPPY_EYEBALLS_DELAY",
+		int(s.Dialer.FallbackDelay/time.Millisecond))) * time.Millisecond
+	if s.Dialer.SourceIPs, err = parseSourceIPs(env.GetEnvAsSlice("SOURCE_IPS", ",", nil)); err != nil {
+		r.Invalid("SOURCE_IPS", err)
+	}
+	s.Dialer.Interface = r.String("BIND_INTERFACE", s.Dialer.Interface)
+}
+
+// parseSourceIPs parses the source addresses of the connections, nil if
+// there are none
+func parseSourceIPs(addrs []string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source IP %q", addr)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// clientCertificatesFromEnv loads a client certificate for mutual TLS from
+// the files at TLS_CLIENT_CERT and TLS_CLIENT_KEY
+func clientCertificatesFromEnv(r *env.Reader, s *CrawlerSettings) {
+	certs, err := loadClientCertificates(r.String("TLS_CLIENT_CERT", ""), r.String("TLS_CLIENT_KEY", ""))
+	if err != nil {
+		r.Invalid("TLS_CLIENT_CERT", err)
+		return
+	}
+	s.ClientCertificates = append(s.ClientCertificates, certs...)
+}
+
+// loadClientCertificates loads a client certificate from a pair of files,
+// no files means no certificates
+func loadClientCertificates(certFile, keyFile string) ([]tls.Certificate, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both certificate and key files are required")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// scopeFromEnv loads the scope of the crawl from the file set by SCOPE_FILE
+func scopeFromEnv(r *env.Reader, s *CrawlerSettings) {
+	file := r.String("SCOPE_FILE", "")
+	if file == "" {
+		return
+	}
+	scope, err := LoadScope(file)
+	if err != nil {
+		r.Invalid("SCOPE_FILE", err)
+		return
+	}
+	s.Scope = scope
+}
+
+// extractorsFromEnv loads the WASM extractors of the directory set by
+// WASM_EXTRACTORS_DIR, after the ones already set
+func extractorsFromEnv(r *env.Reader, s *CrawlerSettings) {
+	dir := r.String("WASM_EXTRACTORS_DIR", "")
+	if dir == "" {
+		return
+	}
+	extractors, err := LoadWASMExtractors(context.Background(), dir)
+	if err != nil {
+		r.Invalid("WASM_EXTRACTORS_DIR", err)
+		return
+	}
+	s.Extractors = append(s.Extractors, extractors...)
+}
+
+// logLevelFromEnv reads the verbosity of the logs from LOG_LEVEL
+func logLevelFromEnv(r *env.Reader, s *CrawlerSettings) {
+	name := r.String("LOG_LEVEL", "")
+	if name == "" {
+		return
+	}
+	level, err := ParseLogLevel(name)
+	if err != nil {
+		r.Invalid("LOG_LEVEL", err)
+		return
+	}
+	s.LogLevel = level
+}
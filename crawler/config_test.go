@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv("USERAGENT", "env-agent")
+	t.Setenv("CONCURRENCY", "4")
+	t.Setenv("POLITENESS_DELAY", "100")
+	t.Setenv("IGNORE_ROBOTSTXT", "true")
+	t.Setenv("PROXY_RULES", "*.internal=socks5://localhost:1080;*.example.com=direct")
+	t.Setenv("PROXY", "http://localhost:3128")
+	t.Setenv("IP_PREFERENCE", "prefer-ipv6")
+	t.Setenv("HAPPY_EYEBALLS_DELAY", "-1")
+	t.Setenv("SOURCE_IPS", "192.0.2.1, 2001:db8::1")
+	t.Setenv("FETCHING_TIMEOUTS", "*.example.com=30;slow.example.com=1m30s")
+	crawler, err := NewFromEnv(testQueue{})
+	if err != nil {
+		t.Fatalf("NewFromEnv failed: %v", err)
+	}
+	s := crawler.settings
+	if s.UserAgent != "env-agent" || s.Concurrency != 4 ||
+		s.PolitenessFixedDelay != 100*time.Millisecond || !s.IgnoreRobotsTxt {
+		t.Errorf("NewFromEnv failed: unexpected settings %#v", s)
+	}
+	if len(s.ProxyRules) != 3 || s.ProxyRules[0].Host != "*.example.com" ||
+		s.ProxyRules[0].Proxy != nil || s.ProxyRules[2].Proxy.String() != "http://localhost:3128" {
+		t.Errorf("NewFromEnv failed: unexpected proxy rules %v", s.ProxyRules)
+	}
+	if s.Dialer.IPPreference != fetcher.PreferIPv6 || s.Dialer.FallbackDelay != -time.Millisecond ||
+		len(s.Dialer.SourceIPs) != 2 {
+		t.Errorf("NewFromEnv failed: unexpected dialer options %+v", s.Dialer)
+	}
+	if s.FetchTimeouts["*.example.com"] != 30*time.Second ||
+		s.FetchTimeouts["slow.example.com"] != 90*time.Second {
+		t.Errorf("NewFromEnv failed: unexpected fetch timeouts %v", s.FetchTimeouts)
+	}
+}
+
+func TestNewFromEnvErrors(t *testing.T) {
+	tests := []map[string]string{
+		{},
+		{"USERAGENT": "env-agent", "CONCURRENCY": "four"},
+		{"USERAGENT": "env-agent", "MAX_DEPTH": "-1"},
+		{"USERAGENT": "env-agent", "PARSER": "regex"},
+		{"USERAGENT": "env-agent", "PROXY": "ftp://localhost"},
+		{"USERAGENT": "env-agent", "DOWNLOAD_ASSETS": "true"},
+		{"USERAGENT": "env-agent", "TLS_CLIENT_CERT": "cert.pem"},
+		{"USERAGENT": "env-agent", "BLOCKED_HOSTS": "[cdn"},
+		{"USERAGENT": "env-agent", "LOG_LEVEL": "verbose"},
+		{"USERAGENT": "env-agent", "COMPRESS_THRESHOLD": "-1"},
+		{"USERAGENT": "env-agent", "RESULT_ENCODING": "xml"},
+		{"USERAGENT": "env-agent", "PARSE_CONCURRENCY": "-2"},
+		{"USERAGENT": "env-agent", "IP_PREFERENCE": "ipv5"},
+		{"USERAGENT": "env-agent", "SOURCE_IPS": "localhost"},
+		{"USERAGENT": "env-agent", "SOURCE_IPS": "192.0.2.1", "BIND_INTERFACE": "eth1"},
+		{"USERAGENT": "env-agent", "FETCHING_TIMEOUTS": "*.example.com=slow"},
+		{"USERAGENT": "env-agent", "FOLLOW_EXTERNAL_LINKS": "true"},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			for key, value := range test {
+				t.Setenv(key, value)
+			}
+			if _, err := NewFromEnv(testQueue{}); err == nil {
+				t.Errorf("NewFromEnv failed: expected error for %v", test)
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@ package crawler
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -26,13 +28,31 @@ const (
 	// Default crawling timeout, time to wait to stop the crawl after no links are
 	// found
 	defaultCrawlTimeout time.Duration = 30 * time.Second
+	// Default time to wait for the in-flight fetches to end on shutdown
+	defaultShutdownTimeout time.Duration = 10 * time.Second
 	// Default politeness delay, fixed delay to calculate a randomized wait time
 	// for subsequent HTTP calls to a domain
 	defaultPolitenessDelay time.Duration = 500 * time.Millisecond
-	// Default depth to crawl for each domain
-	defaultDepth int = 16
+	// Default distance in links from the seeds to crawl for each domain
+	defaultDepth int = 5
 	// Default number of concurrent goroutines to crawl
 	defaultConcurrency int = 8
+	// Default maximum length of an URL to crawl
+	defaultMaxURLLength int = 2048
+	// Default maximum number of query parameters of an URL to crawl
+	defaultMaxQueryParams int = 16
+	// Default maximum number of path segments of an URL to crawl
+	defaultMaxPathSegments int = 32
+	// Default maximum number of consecutive repetitions of the same path
+	// segments in an URL to crawl
+	defaultMaxRepeatedSegments int = 2
+	// Default maximum number of pages of a paginated listing crawled at the
+	// depth of its first page
+	defaultMaxListingPages int = 100
+	// Default maximum size of an asset to download
+	defaultMaxAssetSize int64 = 10 << 20
+	// Default time the addresses of a host are cached for
+	defaultDNSCacheTTL time.Duration = 5 * time.Minute
 	// Default user agent to use
 	defaultUserAgent string = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
 )
@@ -40,9 +60,9 @@ const (
 // Fetcher is an interface exposing a method to fetch resources, Fetch enable
 // raw contents download.
 type Fetcher interface {
-	// Fetch makes an HTTP GET request to an URL returning a `*http.Response` or
-	// any error occured
-	Fetch(string) (time.Duration, *http.Response, error)
+	// Fetch makes an HTTP GET request to an URL returning the timings of the
+	// call, a `*http.Response` or any error occured
+	Fetch(string) (fetcher.Timings, *http.Response, error)
 }
 
 // LinkFetcher is an interface exposing a methdo to download raw contents and
@@ -50,15 +70,96 @@ type Fetcher interface {
 type LinkFetcher interface {
 	Fetcher
 	// FetchLinks makes an HTTP GET request to an URL, parse the HTML in the
-	// response and returns an array of URLs or any error occured
-	FetchLinks(string) (time.Duration, []*url.URL, error)
+	// response and returns the timings of the call, the parsed page with all
+	// the URLs found or any error occured
+	FetchLinks(string) (fetcher.Timings, *fetcher.Page, error)
 }
 
-// ParsedResult contains the URL crawled and an array of links found, json
-// serializable to be sent on message queues
+// Parser, Page and Timings are the types of the `fetcher` package found in
+// the settings and the `RulesEngine` of the crawler, aliased so that
+// custom parsers and rules engines can be written against this package
+type (
+	Parser  = fetcher.Parser
+	Page    = fetcher.Page
+	Timings = fetcher.Timings
+)
+
+// contextFetcher is implemented by the fetchers able to abort a request
+// once a context is done
+type contextFetcher interface {
+	FetchContext(context.Context, string) (fetcher.Timings, *http.Response, error)
+}
+
+// fetchContext fetches an URL through a fetcher, aborting the request once
+// the context is done if the fetcher supports it, otherwise the request
+// runs to completion
+func fetchContext(ctx context.Context, f Fetcher, url string) (fetcher.Timings, *http.Response, error) {
+	if cf, ok := f.(contextFetcher); ok {
+		return cf.FetchContext(ctx, url)
+	}
+	if err := ctx.Err(); err != nil {
+		return fetcher.Timings{}, nil, err
+	}
+	return f.Fetch(url)
+}
+
+// sessionClient is implemented by the fetchers exposing their
+// `*http.Client`, required to establish sessions
+type sessionClient interface {
+	Client() *http.Client
+}
+
+// dnsPrefetcher is implemented by the fetchers able to resolve a host ahead
+// of the first request to it
+type dnsPrefetcher interface {
+	PrefetchDNS(string)
+}
+
+// extensionExcluder is implemented by the parsers able to leave out the
+// links with some extensions, e.g. `fetcher.GoqueryParser`
+type extensionExcluder interface {
+	ExcludeExtensions(...string)
+}
+
+// ResultType is the kind of a result produced by the crawler, results can
+// be routed to different queues by type
+type ResultType string
+
+// PageResult is the type of the `ParsedResult` of each page crawled
+const PageResult ResultType = "page"
+
+// ParsedResult contains the URL crawled, an array of links found, the
+// assets downloaded, the timings of the fetch, the relevance of the page if
+// a focused crawl is running and the metadata of the seed the page was
+// reached from, json serializable to be sent on message queues. The links
+// are classified in order as internal, subdomain or external ones. On a
+// headers-only crawl it also contains the status, the headers and the
+// redirect chain of the response. The hrefs of the page not being valid
+// URLs are listed apart, an excerpt of its text and the fields scraped by
+// the extractors are added if enabled. The trace ID of the fetch matches
+// the one of its log records and its events.
 type ParsedResult struct {
-	URL   string   `json:"url"`
-	Links []string `json:"links"`
+	URL          string            `json:"url"`
+	Links        []string          `json:"links"`
+	LinkClasses  []LinkClass       `json:"link_classes,omitempty"`
+	InvalidLinks []string          `json:"invalid_links,omitempty"`
+	Assets       []string          `json:"assets,omitempty"`
+	Timings      fetcher.Timings   `json:"timings"`
+	Relevance    float64           `json:"relevance,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Status       int               `json:"status,omitempty"`
+	Header       http.Header       `json:"header,omitempty"`
+	Redirects    []string          `json:"redirects,omitempty"`
+	Excerpt      string            `json:"excerpt,omitempty"`
+	Extracted    map[string]any    `json:"extracted,omitempty"`
+	TraceID      string            `json:"trace_id,omitempty"`
+}
+
+// Seed is a starting URL of a crawl, with arbitrary metadata (e.g. labels,
+// customer ID, campaign) attached to every result produced by its crawl
+type Seed struct {
+	URL      string
+	Metadata map[string]string
 }
 
 // CrawlerSettings represents general settings for the crawler and his
@@ -67,23 +168,283 @@ type CrawlerSettings struct {
 	// FetchTimeout is the time to wait before closing a connection that does not
 	// respond
 	FetchTimeout time.Duration
+	// FetchTimeouts maps host patterns to the FetchTimeout of their fetches,
+	// overriding the default one, e.g. longer for slow legacy hosts
+	FetchTimeouts fetcher.HostTimeouts
+	// MaxRetryAfter caps the wait before retrying a fetch answered with a
+	// 429 or a 503 and a Retry-After header, the wait counts in the
+	// FetchTimeout. 0 means the default of the fetcher, 5 seconds
+	MaxRetryAfter time.Duration
 	// CrawlTimeout is the number of second to wait before exiting the crawling
 	// in case of no links found
 	CrawlTimeout time.Duration
+	// ShutdownTimeout is the time to wait for the fetches in flight to end,
+	// and their results to be produced, when the crawl is interrupted, the
+	// ones still running are aborted afterwards
+	ShutdownTimeout time.Duration
 	// Concurrency is the number of concurrent goroutine to run while fetching
 	// a page. 0 means unbounded
 	Concurrency int
+	// MaxConcurrentDomains is the number of domains crawled at once, the
+	// others wait in the order of the seeds, so that memory and sockets
+	// scale predictably with hundreds of seeds. 0 means unbounded
+	MaxConcurrentDomains int
+	// AdaptiveConcurrency enables an AIMD controller for each domain,
+	// starting from a single fetch and growing the concurrency additively up
+	// to Concurrency while the responses are healthy, halving it on errors
+	AdaptiveConcurrency bool
+	// AdaptiveLatencyTarget, if set, is the response time above which the
+	// adaptive concurrency is halved as on errors
+	AdaptiveLatencyTarget time.Duration
+	// ParseConcurrency is the number of concurrent goroutine parsing the
+	// pages fetched from a domain, independent from Concurrency. 0 means one
+	// per CPU
+	ParseConcurrency int
 	// Parser is a `fetcher.Parser` instance object used to parse fetched pages
 	Parser fetcher.Parser
 	// Cachable to be used as visit tracker for each domain crawled
 	Cache Cachable
-	// MaxDepth represents a limit on the number of pages recursively fetched.
-	// 0 means unlimited
+	// MaxDepth represents a limit on the distance of the pages fetched from
+	// the seeds, at depth 0, the links found on a page are one level deeper,
+	// a link found again by a shorter path before being crawled takes its
+	// depth. 0 means unlimited
 	MaxDepth int
+	// MaxPages represents a limit on the number of pages fetched per domain.
+	// 0 means unlimited
+	MaxPages int
 	// UserAgent is the user-agent header set in each GET request, most of the
 	// times it also defines which robots.txt rules to follow while crawling a
 	// domain, depending on the directives specified by the site admin
 	UserAgent string
+	// UserAgents maps host patterns to the user agent to present to them
+	// instead of UserAgent, the robots.txt rules followed are the ones of the
+	// agent presented
+	UserAgents fetcher.UserAgents
+	// Keywords enables a focused crawl, the text of each page is scored
+	// against them and only links found on relevant pages are crawled. The
+	// links of the root URL are always crawled
+	Keywords []string
+	// MinRelevance is the minimum fraction of Keywords a page must contain to
+	// be considered relevant, a page must contain at least one of them
+	MinRelevance float64
+	// ExcerptLength, if set, adds the first ExcerptLength characters of the
+	// visible text of each page to its result, for previews and filtering
+	// downstream without storing the bodies
+	ExcerptLength int
+	// GrepPatterns turns the crawl into a grep of the sites: the body of
+	// each page is scanned against these regular expressions and their
+	// matches, with a snippet and the offset, are produced as `PageMatches`
+	// results instead of the page ones. The links are crawled as usual
+	GrepPatterns []string
+	// URLLimits sets caps on length, number of query parameters and number
+	// of path segments of the URLs to crawl
+	URLLimits URLLimits
+	// TrapPatterns is a list of URL shapes to refuse as they usually are
+	// crawler traps, by default `DefaultTrapPatterns`
+	TrapPatterns []TrapPattern
+	// SchemeAgnosticDedup makes the http and https versions of an URL count
+	// as the same visit, it's enabled anyway for domains redirecting from
+	// http to https. The two versions of a host share their robots.txt only
+	// if set, each scheme has its own otherwise
+	SchemeAgnosticDedup bool
+	// HostAliases declares the aliases or mirrors of the hosts, e.g.
+	// cdn.example.com for example.com, crawled as the same logical host: the
+	// politeness delays and the concurrency are shared and an URL on an alias
+	// is the same visit of the one on the canonical host
+	HostAliases HostAliases
+	// MaxRepeatedSegments is the maximum number of consecutive repetitions
+	// of the same sequence of path segments, e.g. /a/b/a/b, URLs exceeding
+	// it are refused as spider traps. 0 means no limit
+	MaxRepeatedSegments int
+	// RequestHook, if set, is called on every request right before it's
+	// sent, e.g. to sign it or to inject dynamic headers
+	RequestHook fetcher.RequestHook
+	// VerifyTLS enables the verification of the certificates of the servers,
+	// by default any certificate is accepted
+	VerifyTLS bool
+	// ClientCertificates are presented to the servers requiring mutual TLS
+	// authentication
+	ClientCertificates []tls.Certificate
+	// ProxyRules maps host patterns to the proxies to use, the first rule
+	// matching a host applies, hosts matching no rules are contacted directly
+	ProxyRules []fetcher.ProxyRule
+	// DownloadAssets enables the download of the images and documents found
+	// in the pages, storing them in the BodyStore
+	DownloadAssets bool
+	// AssetExtensions are the extensions of the links to download as assets
+	// instead of crawling them, by default `DefaultAssetExtensions`
+	AssetExtensions []string
+	// MaxAssetSize is the maximum size in bytes of an asset to download
+	MaxAssetSize int64
+	// BodyStore is the storage of the downloaded assets
+	BodyStore BodyStore
+	// SessionInitializer, if set, is run before crawling each domain to
+	// establish a session, e.g. logging in to reach protected areas
+	SessionInitializer SessionInitializer
+	// Scorer is used to prioritize the links waiting to be crawled, by
+	// default links with more in-links and closer to the root URL go first
+	Scorer Scorer
+	// Prioritizer, if set, splits the links waiting to be crawled in
+	// priority classes, the links of a higher class are crawled first, the
+	// Scorer orders the ones of the same class
+	Prioritizer Prioritizer
+	// FrontierMemoryLimit is the number of links waiting to be crawled held
+	// in memory for each domain, the ones beyond are spilled to a temporary
+	// file and read back later, keeping the memory flat on domains with an
+	// enormous fan-out. 0 means unbounded
+	FrontierMemoryLimit int
+	// FrontierSpillDir is the directory of the spilled links, the default
+	// temporary directory if empty
+	FrontierSpillDir string
+	// PrioritizePagination puts the links to the pages of paginated
+	// listings, declared by rel=next and rel=prev or looking like ?page=2,
+	// before the others and at the depth of the page linking them, so that
+	// listings are traversed completely before the limits hit
+	PrioritizePagination bool
+	// MaxListingPages is the number of pages of a paginated listing crawled
+	// at the depth of its first page if PrioritizePagination is set, the
+	// ones beyond are one level deeper than the page linking them as any
+	// link, so that endless listings are still bounded by the depth limits.
+	// 0 means unbounded
+	MaxListingPages int
+	// FollowHreflang crawls the translations of the pages, declared by
+	// their rel=alternate hreflang links, they're only listed in the
+	// metadata of the results as hreflang:<lang> otherwise
+	FollowHreflang bool
+	// FollowAMP crawls the AMP versions of the pages, declared by their
+	// rel=amphtml links, to explore their links, the AMP pages mirroring a
+	// canonical one are not produced anyway. They're only listed in the
+	// metadata of the results as amphtml otherwise
+	FollowAMP bool
+	// SiteMetadata produces a `SiteMetadata` result for each domain, with
+	// the favicons and the web app manifest declared by its root page
+	SiteMetadata bool
+	// EmitSkipped produces a `SkippedURL` result for every link skipped,
+	// with the reason, to find out why sections of a site are missed. The
+	// PageSkipped events carry the reason anyway
+	EmitSkipped bool
+	// FetchManifest fetches the web app manifest of each domain, adding
+	// its name, colors and icons to the `SiteMetadata`
+	FetchManifest bool
+	// OrderedResults produces the results of each domain in the order their
+	// links are dispatched, a page is always produced before the pages it
+	// links to. The results of the pages fetched faster are buffered, for
+	// consumers rebuilding the site trees incrementally. Up to 1024 links
+	// are dispatched past a page not produced yet, the next ones wait for it
+	OrderedResults bool
+	// RandomSeed, if not 0, makes the crawls reproducible: the random
+	// politeness delays of each domain are drawn from a source seeded with
+	// it and the links of each domain are crawled one at a time, the next
+	// one popped once the links found by the previous one are pushed
+	RandomSeed int64
+	// Recrawl enables the freshness-aware recrawl: the Cache-Control,
+	// Expires and Last-Modified headers of the pages fetched are recorded,
+	// the following crawls fetch the stale pages first and skip the fresh
+	// ones
+	Recrawl bool
+	// SitemapOnly enumerates the URLs of each domain from its sitemaps
+	// alone, the ones listed in the robots.txt or /sitemap.xml, with no
+	// page fetched nor link followed. Each URL is produced as a result with
+	// its lastmod, changefreq and priority in the metadata
+	SitemapOnly bool
+	// HeadersOnly records the status, the headers and the redirect chain
+	// of every page, the body is downloaded and parsed only for the HTML
+	// pages, needed to discover the links. Every page is produced as a
+	// result, the ones with an error status too
+	HeadersOnly bool
+	// RulesEngine, if set, creates the rules to follow while crawling each
+	// domain in place of the default `CrawlingRules`, deciding which links
+	// are crawled and the delay between the requests
+	RulesEngine RulesEngineFactory
+	// AllowedHosts are the host patterns, e.g. *.example.com, of the only
+	// hosts to fetch from, no patterns means any host
+	AllowedHosts []string
+	// BlockedHosts are the host patterns of the hosts never to fetch from,
+	// e.g. CDNs or login subdomains, they take precedence over AllowedHosts
+	BlockedHosts []string
+	// FollowExternalLinks crawls the links to the other domains matching
+	// AllowedDomains too, each domain is crawled apart following its own
+	// robots.txt. The depth of a link is still its distance from the seeds.
+	FollowExternalLinks bool
+	// IncludeSubdomains crawls the links to the other hosts of the
+	// registered domain of each seed too, e.g. docs.example.com and
+	// example.com for a seed of www.example.com, each host is crawled apart
+	// following its own robots.txt
+	IncludeSubdomains bool
+	// AllowedDomains are the host patterns, e.g. *.example.com, of the
+	// domains a crawl following external links can span, required by
+	// FollowExternalLinks to keep the crawl off the open web
+	AllowedDomains []string
+	// Scope, if set, restricts the crawl to the links and the pages in scope,
+	// see `ScopeConfig`
+	Scope *Scope
+	// IgnoreRobotsTxt disables the robots.txt directives, meant only to crawl
+	// owned sites, e.g. staging environments disallowing everything
+	IgnoreRobotsTxt bool
+	// DNSPrefetch enables the resolution of the hosts as they are met,
+	// ahead of their first fetch, caching their addresses, so that the first
+	// request to a host doesn't pay the resolution latency
+	DNSPrefetch bool
+	// Dialer sets how the connections to the servers are established: the
+	// IP versions to use or to prefer, the happy eyeballs race between them
+	// and the source addresses or the network interface to connect from
+	Dialer fetcher.DialerOptions
+	// CompressThreshold, if set, enables the compression of the results,
+	// every payload produced is prefixed by a flag byte and the ones larger
+	// than the threshold in bytes are gzipped, see `DecodePayload`. 0 means
+	// payloads are produced as they are
+	CompressThreshold int
+	// OutboxPath, if set, is the path of a write-ahead log of the results,
+	// each result is written there before being produced and the ones not
+	// produced, e.g. because of a crash or of a failure of the queue, are
+	// produced again at the start of the next crawl
+	OutboxPath string
+	// ExcludedExtensions are the extensions, e.g. .pdf or zip, of the links
+	// never to crawl, case insensitive, left out by the parser if supported,
+	// the ones found otherwise, e.g. in sitemaps, are refused on admission
+	// and reported as skipped
+	ExcludedExtensions []string
+	// URLFilters are evaluated in order on every link before it enters the
+	// frontier and on the targets of the redirects, see `URLFilter`
+	URLFilters []URLFilter
+	// ResultFilter, if set, is evaluated on every result before producing
+	// it, results for which it returns false are dropped, e.g. pages with no
+	// links or off-topic ones. Links of the pages dropped are still crawled
+	ResultFilter func(ParsedResult) bool
+	// Extractors scrape domain-specific data from the body of each page
+	// downloaded, their fields are merged in the `Extracted` map of its
+	// result
+	Extractors []Extractor
+	// ResultTransformers are applied in order on every result right before
+	// encoding it, after the ResultFilter
+	ResultTransformers []ResultTransformer
+	// ResultEncoding is the serialization format of the results, by default
+	// JSONEncoding
+	ResultEncoding ResultEncoding
+	// BatchSize, if greater than 1, is the number of results sent in each
+	// message, encoded as a JSON array, the last batch of each type is sent
+	// at the end of the crawl even if not full
+	BatchSize int
+	// ResultRoutes maps result types to the producers of the queues to send
+	// them to in place of the crawler queue, results of types with no route
+	// are sent to the crawler queue, as a topic if it's a
+	// `messaging.TopicProducer`
+	ResultRoutes map[ResultType]messaging.Producer
+	// Notifiers are sent the summary of every crawl job once it finishes or
+	// fails, see `NewWebhookNotifier`, `NewSlackNotifier` and
+	// `NewEmailNotifier`
+	Notifiers []Notifier
+	// ReloadFile, if set, is a JSON file of settings to reload on SIGHUP
+	// while crawling, see `WebCrawler.LoadReloadable`
+	ReloadFile string
+	// DebugAddr, if set, is the address to serve the pprof endpoints on
+	// while crawling, see `NewDebugHandler`
+	DebugAddr string
+	// LogLevel is the verbosity of the logs, by default LogInfo
+	LogLevel LogLevel
+	// LogHandler, if set, receives the log records in place of the default
+	// text handler writing on stderr, LogLevel is not applied
+	LogHandler slog.Handler
 	// PolitenessFixedDelay represents the delay to wait between subsequent
 	// calls to the same domain, it'll taken into consideration against a
 	// robots.txt if present and against the last response time, taking always
@@ -97,8 +458,8 @@ type CrawlerOpt func(*CrawlerSettings)
 
 // WebCrawler is the main object representing a crawler
 type WebCrawler struct {
-	// logger is a private logger instance
-	logger *log.Logger
+	// logger is a private structured logger instance
+	logger *slog.Logger
 	// queue is a simple message queue to forward crawling results to other
 	// components of the architecture, decoupling business logic from processing,
 	// storage or presentation layers
@@ -108,6 +469,54 @@ type WebCrawler struct {
 	// settings is a pointer to `CrawlerSettings` containing some crawler
 	// specifications
 	settings *CrawlerSettings
+	// excludedExts is the set of the ExcludedExtensions normalized, see
+	// `extensionSet`
+	excludedExts map[string]bool
+	// lastReport is the report of the last crawl
+	lastReport atomic.Pointer[CrawlReport]
+	// stats tracks the counters of every host crawled
+	stats *crawlStats
+	// events dispatches the lifecycle events of the crawls to the
+	// subscribers
+	events *eventBus
+	// reloadMutex guards the settings that can be reloaded while crawling,
+	// see `Reloadable`
+	reloadMutex sync.RWMutex
+	// crawls tracks the domains being crawled, as *hostCrawl keys
+	crawls sync.Map
+	// freshness tracks the freshness of the pages fetched, if recrawl is
+	// enabled
+	freshness *freshnessTracker
+	// freshCache wraps the cache of the settings to crawl again the stale
+	// pages, if recrawl is enabled
+	freshCache *freshnessCache
+	// lastRun is the state of the last crawl started
+	lastRun atomic.Pointer[crawlRun]
+}
+
+// crawlRun is the state of a crawl of a set of seeds, shared by the crawls
+// of its domains. Each crawl has its own, the crawls running at once on the
+// same crawler don't share it.
+type crawlRun struct {
+	// job is the identifier of the crawl, attached to the logs
+	job string
+	// traps is the crawler traps detector, tracking the suppressed URLs
+	traps *trapDetector
+	// hosts tracks the hosts met
+	hosts *sync.Map
+	// outbox is the write-ahead log of the results, if enabled
+	outbox *outbox
+	// batches accumulates the results to send in batches, if enabled
+	batches *resultBatches
+	// politeness tracks the politeness state of the registered domains met
+	politeness *politenessRegistry
+	// grep scans the pages against the grep patterns, if any
+	grep *grepper
+	// external aggregates the links to external hosts found
+	external *externalInventory
+	// span tracks the crawls of the domains spanned, if following external
+	// links or including the subdomains
+	span *domainSpan
 }
 
 // New create a new Crawler instance, accepting a maximum level of depth during
@@ -116,16 +525,7 @@ type WebCrawler struct {
 // timeout for each HTTP call.
 func New(userAgent string,
 	queue messaging.Producer, opts ...CrawlerOpt) *WebCrawler {
-	// Default crawler settings
-	settings := &CrawlerSettings{
-		FetchTimeout:         defaultFetchTimeout,
-		Parser:               fetcher.NewGoqueryParser(),
-		Cache:                newMemoryCache(),
-		UserAgent:            userAgent,
-		CrawlTimeout:         defaultCrawlTimeout,
-		PolitenessFixedDelay: defaultPolitenessDelay,
-		Concurrency:          defaultConcurrency,
-	}
+	settings := defaultSettings(userAgent)
 
 	// Mix in all optionals
 	for _, opt := range opts {
@@ -133,201 +533,876 @@ func New(userAgent string,
 	}
 
 	crawler := &WebCrawler{
-		logger:      log.New(os.Stderr, "crawler: ", log.LstdFlags),
-		queue:       queue,
-		linkFetcher: fetcher.New(userAgent, settings.Parser, settings.FetchTimeout),
-		settings:    settings,
+		logger:       newLogger(settings),
+		queue:        queue,
+		linkFetcher:  newFetcher(settings),
+		settings:     settings,
+		stats:        newCrawlStats(),
+		events:       newEventBus(),
+		excludedExts: extensionSet(settings.ExcludedExtensions),
 	}
 
 	return crawler
 }
 
-// NewFromEnv create a new webCrawler by reading values from environment
-func NewFromEnv(queue messaging.Producer, opts ...CrawlerOpt) *WebCrawler {
-	crawler := New(env.GetEnv("USERAGENT", defaultUserAgent), queue,
-		func(s *CrawlerSettings) {
-			s.MaxDepth = env.GetEnvAsInt("MAX_DEPTH", defaultDepth)
-			s.FetchTimeout = time.Duration(env.GetEnvAsInt("FETCHING_TIMEOUT", 10)) * time.Second
-			s.Concurrency = env.GetEnvAsInt("CONCURRENCY", 1)
-			s.CrawlTimeout = time.Duration(env.GetEnvAsInt("CRAWLING_TIMEOUT", 30)) * time.Second
-			s.PolitenessFixedDelay = time.Duration(env.GetEnvAsInt("POLITENESS_DELAY", 500)) * time.Millisecond
-		})
-	// Mix in all optionals
-	for _, opt := range opts {
-		opt(crawler.settings)
+// defaultSettings returns the default crawler settings
+func defaultSettings(userAgent string) *CrawlerSettings {
+	return &CrawlerSettings{
+		FetchTimeout:         defaultFetchTimeout,
+		Parser:               fetcher.NewGoqueryParser(),
+		Cache:                newMemoryCache(),
+		UserAgent:            userAgent,
+		CrawlTimeout:         defaultCrawlTimeout,
+		ShutdownTimeout:      defaultShutdownTimeout,
+		PolitenessFixedDelay: defaultPolitenessDelay,
+		Concurrency:          defaultConcurrency,
+		Scorer:               inLinksScorer{},
+		TrapPatterns:         DefaultTrapPatterns,
+		MaxRepeatedSegments:  defaultMaxRepeatedSegments,
+		AssetExtensions:      DefaultAssetExtensions,
+		MaxAssetSize:         defaultMaxAssetSize,
+		MaxListingPages:      defaultMaxListingPages,
+		URLLimits: URLLimits{
+			MaxLength:       defaultMaxURLLength,
+			MaxQueryParams:  defaultMaxQueryParams,
+			MaxPathSegments: defaultMaxPathSegments,
+		},
 	}
-	return crawler
+}
+
+// NewFromEnv create a new webCrawler by reading values from environment,
+// returns an error if any value is invalid or if the settings resulting
+// are not valid. USERAGENT is required.
+func NewFromEnv(queue messaging.Producer, opts ...CrawlerOpt) (*WebCrawler, error) {
+	r := &env.Reader{}
+	envOpt := func(s *CrawlerSettings) {
+		s.MaxDepth = r.Int("MAX_DEPTH", defaultDepth)
+		s.MaxPages = r.Int("MAX_PAGES", s.MaxPages)
+		s.FrontierMemoryLimit = r.Int("FRONTIER_MEMORY_LIMIT", s.FrontierMemoryLimit)
+		s.FrontierSpillDir = r.String("FRONTIER_SPILL_DIR", s.FrontierSpillDir)
+		s.FetchTimeout = time.Duration(r.Int("FETCHING_TIMEOUT", 10)) * time.Second
+		s.Concurrency = r.Int("CONCURRENCY", 1)
+		s.MaxConcurrentDomains = r.Int("MAX_CONCURRENT_DOMAINS", s.MaxConcurrentDomains)
+		s.ParseConcurrency = r.Int("PARSE_CONCURRENCY", s.ParseConcurrency)
+		s.AdaptiveConcurrency = r.Bool("ADAPTIVE_CONCURRENCY", s.AdaptiveConcurrency)
+		s.AdaptiveLatencyTarget = time.Duration(r.Int("ADAPTIVE_LATENCY_TARGET", 0)) * time.Millisecond
+		s.CrawlTimeout = time.Duration(r.Int("CRAWLING_TIMEOUT", 30)) * time.Second
+		s.MaxRetryAfter = time.Duration(r.Int("MAX_RETRY_AFTER", int(s.MaxRetryAfter/time.Second))) * time.Second
+		s.ShutdownTimeout = time.Duration(r.Int("SHUTDOWN_TIMEOUT", 10)) * time.Second
+		s.PolitenessFixedDelay = time.Duration(r.Int("POLITENESS_DELAY", 500)) * time.Millisecond
+		s.Keywords = env.GetEnvAsSlice("KEYWORDS", ",", s.Keywords)
+		s.MinRelevance = r.Float("MIN_RELEVANCE", s.MinRelevance)
+		s.ExcerptLength = r.Int("EXCERPT_LENGTH", s.ExcerptLength)
+		s.GrepPatterns = env.GetEnvAsSlice("GREP_PATTERNS", ";", s.GrepPatterns)
+		s.UserAgents = env.GetEnvAsMap("USERAGENTS", ";", s.UserAgents)
+		s.URLLimits.MaxLength = r.Int("MAX_URL_LENGTH", s.URLLimits.MaxLength)
+		s.URLLimits.MaxQueryParams = r.Int("MAX_QUERY_PARAMS", s.URLLimits.MaxQueryParams)
+		s.URLLimits.MaxPathSegments = r.Int("MAX_PATH_SEGMENTS", s.URLLimits.MaxPathSegments)
+		s.MaxRepeatedSegments = r.Int("MAX_REPEATED_SEGMENTS", s.MaxRepeatedSegments)
+		s.SchemeAgnosticDedup = r.Bool("SCHEME_AGNOSTIC_DEDUP", s.SchemeAgnosticDedup)
+		s.HostAliases = env.GetEnvAsMap("HOST_ALIASES", ";", s.HostAliases)
+		s.IgnoreRobotsTxt = r.Bool("IGNORE_ROBOTSTXT", s.IgnoreRobotsTxt)
+		s.DownloadAssets = r.Bool("DOWNLOAD_ASSETS", s.DownloadAssets)
+		s.AssetExtensions = env.GetEnvAsSlice("ASSET_EXTENSIONS", ",", s.AssetExtensions)
+		s.MaxAssetSize = int64(r.Int("MAX_ASSET_SIZE", int(s.MaxAssetSize)))
+		if dir := r.String("ASSETS_DIR", ""); dir != "" {
+			s.BodyStore = NewFileStore(dir)
+		}
+		s.AllowedHosts = env.GetEnvAsSlice("ALLOWED_HOSTS", ",", s.AllowedHosts)
+		s.BlockedHosts = env.GetEnvAsSlice("BLOCKED_HOSTS", ",", s.BlockedHosts)
+		s.FollowExternalLinks = r.Bool("FOLLOW_EXTERNAL_LINKS", s.FollowExternalLinks)
+		s.IncludeSubdomains = r.Bool("INCLUDE_SUBDOMAINS", s.IncludeSubdomains)
+		s.ExcludedExtensions = env.GetEnvAsSlice("EXCLUDED_EXTENSIONS", ",", s.ExcludedExtensions)
+		s.AllowedDomains = env.GetEnvAsSlice("ALLOWED_DOMAINS", ",", s.AllowedDomains)
+		s.VerifyTLS = r.Bool("TLS_VERIFY", s.VerifyTLS)
+		s.DNSPrefetch = r.Bool("DNS_PREFETCH", s.DNSPrefetch)
+		s.Recrawl = r.Bool("RECRAWL", s.Recrawl)
+		s.PrioritizePagination = r.Bool("PRIORITIZE_PAGINATION", s.PrioritizePagination)
+		s.MaxListingPages = r.Int("MAX_LISTING_PAGES", s.MaxListingPages)
+		s.FollowHreflang = r.Bool("FOLLOW_HREFLANG", s.FollowHreflang)
+		s.FollowAMP = r.Bool("FOLLOW_AMP", s.FollowAMP)
+		s.SiteMetadata = r.Bool("SITE_METADATA", s.SiteMetadata)
+		s.EmitSkipped = r.Bool("EMIT_SKIPPED", s.EmitSkipped)
+		s.FetchManifest = r.Bool("FETCH_MANIFEST", s.FetchManifest)
+		s.OrderedResults = r.Bool("ORDERED_RESULTS", s.OrderedResults)
+		s.RandomSeed = int64(r.Int("RANDOM_SEED", int(s.RandomSeed)))
+		s.SitemapOnly = r.Bool("SITEMAP_ONLY", s.SitemapOnly)
+		s.HeadersOnly = r.Bool("HEADERS_ONLY", s.HeadersOnly)
+		s.CompressThreshold = r.Int("COMPRESS_THRESHOLD", s.CompressThreshold)
+		s.OutboxPath = r.String("OUTBOX_PATH", s.OutboxPath)
+		s.ReloadFile = r.String("RELOAD_FILE", s.ReloadFile)
+		s.DebugAddr = r.String("DEBUG_ADDR", s.DebugAddr)
+		s.BatchSize = r.Int("BATCH_SIZE", s.BatchSize)
+		if url := r.String("NOTIFY_WEBHOOK_URL", ""); url != "" {
+			s.Notifiers = append(s.Notifiers, NewWebhookNotifier(url))
+		}
+		if url := r.String("NOTIFY_SLACK_URL", ""); url != "" {
+			s.Notifiers = append(s.Notifiers, NewSlackNotifier(url))
+		}
+		s.ResultEncoding = ResultEncoding(r.String("RESULT_ENCODING", string(s.ResultEncoding)))
+		logLevelFromEnv(r, s)
+		parserFromEnv(r, s)
+		cacheFromEnv(r, s)
+		proxyRulesFromEnv(r, s)
+		fetchTimeoutsFromEnv(r, s)
+		dialerFromEnv(r, s)
+		scopeFromEnv(r, s)
+		extractorsFromEnv(r, s)
+		clientCertificatesFromEnv(r, s)
+	}
+	// Mix in all optionals after the environment ones, they must be applied
+	// before the creation of the fetcher
+	crawler := New(r.RequiredString("USERAGENT"), queue,
+		append([]CrawlerOpt{envOpt}, opts...)...)
+	if err := r.Err(); err != nil {
+		return nil, fmt.Errorf("reading settings from env failed: %w", err)
+	}
+	if err := crawler.settings.Validate(); err != nil {
+		return nil, fmt.Errorf("reading settings from env failed: %w", err)
+	}
+	return crawler, nil
 }
 
 // NewFromSettings create a new webCrawler with the settings passed in
 func NewFromSettings(queue messaging.ChannelQueue, settings *CrawlerSettings) *WebCrawler {
 	return &WebCrawler{
-		queue:       queue,
-		logger:      log.New(os.Stderr, "crawler: ", log.LstdFlags),
-		linkFetcher: fetcher.New(settings.UserAgent, settings.Parser, settings.FetchTimeout),
-		settings:    settings,
+		queue:        queue,
+		logger:       newLogger(settings),
+		linkFetcher:  newFetcher(settings),
+		settings:     settings,
+		stats:        newCrawlStats(),
+		events:       newEventBus(),
+		excludedExts: extensionSet(settings.ExcludedExtensions),
+	}
+}
+
+// newFetcher creates the `LinkFetcher` used by the crawler, configured by
+// the settings
+func newFetcher(settings *CrawlerSettings) LinkFetcher {
+	if excluder, ok := settings.Parser.(extensionExcluder); ok {
+		for ext := range extensionSet(settings.ExcludedExtensions) {
+			excluder.ExcludeExtensions(ext)
+		}
+	}
+	opts := []fetcher.Option{
+		fetcher.WithUserAgent(settings.UserAgent),
+		fetcher.WithParser(settings.Parser),
+		fetcher.WithTimeout(settings.FetchTimeout),
+	}
+	if settings.MaxRetryAfter > 0 {
+		opts = append(opts, fetcher.WithMaxRetryAfter(settings.MaxRetryAfter))
+	}
+	if settings.RequestHook != nil {
+		opts = append(opts, fetcher.WithRequestHook(settings.RequestHook))
+	}
+	if len(settings.UserAgents) > 0 {
+		opts = append(opts, fetcher.WithUserAgents(settings.UserAgents))
+	}
+	if len(settings.FetchTimeouts) > 0 {
+		opts = append(opts, fetcher.WithHostTimeouts(settings.FetchTimeouts))
 	}
+	if settings.VerifyTLS {
+		opts = append(opts, fetcher.WithTLSVerification())
+	}
+	if len(settings.ClientCertificates) > 0 {
+		opts = append(opts, fetcher.WithClientCertificates(settings.ClientCertificates...))
+	}
+	if len(settings.ProxyRules) > 0 {
+		opts = append(opts, fetcher.WithProxyRules(settings.ProxyRules...))
+	}
+	if settings.DNSPrefetch {
+		opts = append(opts, fetcher.WithDNSCache(defaultDNSCacheTTL))
+	}
+	if !settings.Dialer.IsZero() {
+		opts = append(opts, fetcher.WithDialer(settings.Dialer))
+	}
+	return fetcher.New(opts...)
+}
+
+// hostSeed is a seed of a crawl with its URL parsed
+type hostSeed struct {
+	url      *url.URL
+	metadata map[string]string
+	// depth is the distance from the seeds of the crawl of a link handed
+	// by the crawl of another domain spanned, 0 for the seeds
+	depth int
 }
 
 // Crawl a single page by fetching the starting URL, extracting all anchors
 // and exploring each one of them applying the same steps. Every image link
 // found is forwarded into a dedicated channel, as well as errors.
+// The seeds of the same host are crawled together, sharing the frontier and
+// the visited links, the first one is the root URL of the crawl.
 //
-// A waitgroup is used to synchronize it's execution, enabling the caller to
-// wait for completion.
-func (c *WebCrawler) crawlPage(rootURL *url.URL, wg *sync.WaitGroup, ctx context.Context) {
-	// First we wanna make sure we decrease the waitgroup counter at the end of
-	// the crawling
-	defer wg.Done()
+// Returns an error if the domain couldn't be crawled at all.
+func (c *WebCrawler) crawlPage(run *crawlRun, seeds []hostSeed, ctx context.Context) error {
+	rootURL, metadata := seeds[0].url, seeds[0].metadata
+	c.discover(run, rootURL.Host)
+	defer c.events.Publish(Event{Type: HostExhausted, Host: rootURL.Host})
+	// The concurrency and the health are shared with the crawls of the
+	// other hosts of the registered domain, the concurrency can be changed
+	// while crawling, see SetConcurrency
+	politeness := run.politeness.Domain(c.settings.HostAliases.Canonical(rootURL.Hostname()),
+		c.Reloadable().Concurrency)
+	h := &hostCrawl{
+		run:       run,
+		rootURL:   rootURL,
+		metadata:  metadata,
+		health:    politeness.health,
+		logger:    c.hostLogger(run, rootURL.Host),
+		wakeup:    make(chan struct{}, 1),
+		semaphore: politeness.semaphore,
+	}
+	started := time.Now()
+	defer func() {
+		if h.stats != nil {
+			h.stats.Crawled(time.Since(started))
+		}
+	}()
+	// The crawl of the domain can be cancelled alone, see CancelHost
+	ctx, h.cancel = context.WithCancel(ctx)
+	defer h.cancel()
+	h.work, h.abort = context.WithCancel(context.WithoutCancel(ctx))
+	defer h.abort()
+	c.crawls.Store(h, struct{}{})
+	defer c.crawls.Delete(h)
+	// The crawl of a domain spanned is forgotten once over, whatever the
+	// reason, the links handed afterwards spawn a new one
+	key := c.rulesKey(rootURL)
+	if run.span != nil {
+		defer run.span.Forget(key, h)
+	}
 	var (
-		// semaphore is just a value-less channel used to limit the number of
-		// concurrent goroutine workers fetching links
-		semaphore chan struct{}
-		// New found links channel
-		linksCh chan []*url.URL
-		stop    bool
-		depth   int
+		fetched int
 		fetchWg sync.WaitGroup = sync.WaitGroup{}
-		// An atomic counter to make sure that we've already crawled all remaining
-		// links if a timeout occur. Initialized at 1 as it's counting the start URL
-		// before crawling all subdomains.
-		linkCounter int32 = 1
+		parseWg sync.WaitGroup = sync.WaitGroup{}
 	)
 
-	// Set the concurrency level by using a buffered channel as semaphore
-	if c.settings.Concurrency > 0 {
-		semaphore = make(chan struct{}, c.settings.Concurrency)
-		linksCh = make(chan []*url.URL, c.settings.Concurrency)
-	} else {
-		// we want to disallow the unlimited concurrency, to avoid being banned from
-		// the ccurrent crawled domain and also to avoid running OOM or running out
-		// of unix file descriptors, as each HTTP call is built upon a  socket
-		// connection, which is in-fact an opened descriptor.
-		semaphore = make(chan struct{}, 1)
-		linksCh = make(chan []*url.URL, 1)
-	}
-
-	// Just a kickstart for the first URL to scrape
-	linksCh <- []*url.URL{rootURL}
-	// We try to fetch a robots.txt rule to follow, being polite to the
-	// domain
-	crawlingRules := NewCrawlingRules(rootURL,
-		c.settings.Cache, c.settings.PolitenessFixedDelay)
-	if crawlingRules.GetRobotsTxtGroup(c.linkFetcher, c.settings.UserAgent, rootURL) {
-		c.logger.Printf("Found a valid %s/robots.txt", rootURL.Host)
-	} else {
-		c.logger.Printf("No valid %s/robots.txt found", rootURL.Host)
-	}
-
-	// Every cycle represents a single page crawling, when new anchors are
-	// found, the counter is increased, making the loop continue till the
-	// end of links
-	for !stop {
-		select {
-		case links := <-linksCh:
-			for _, link := range links {
-				// Skip already visited links or disallowed ones by the robots.txt rules
-				if !crawlingRules.Allowed(link) {
-					atomic.AddInt32(&linkCounter, -1)
-					continue
-				}
-				// Spawn a goroutine to fetch the link, throttling by
-				// concurrency argument on the semaphore will take care of the
-				// concurrent number of goroutine.
-				fetchWg.Add(1)
-				go func(link *url.URL, stopSentinel bool, w *sync.WaitGroup) {
-					defer w.Done()
-					defer atomic.AddInt32(&linkCounter, -1)
-					// 0 concurrency level means we serialize calls as
-					// goroutines are cheap but not that cheap (around 2-5 kb
-					// each, 1 million links = ~4/5 GB ram), by allowing for
-					// unlimited number of workers, potentially we could run
-					// OOM (or banned from the website) really fast
-					semaphore <- struct{}{}
-					defer func() {
-						time.Sleep(crawlingRules.CrawlDelay())
-						<-semaphore
-					}()
-					// We fetch the current link here and parse HTML for children links
-					responseTime, foundLinks, err := c.linkFetcher.FetchLinks(link.String())
-					crawlingRules.UpdateLastDelay(responseTime)
-					if err != nil {
-						c.logger.Println(err)
-						return
-					}
-					// No errors occured, we want to enqueue all scraped links
-					// to the link queue
-					if stopSentinel || foundLinks == nil || len(foundLinks) == 0 {
-						return
-					}
-					atomic.AddInt32(&linkCounter, int32(len(foundLinks)))
-					// Send results from fetch process to the processing queue
-					c.enqueueResults(link, foundLinks)
-					// Enqueue found links for the next cycle
-					linksCh <- foundLinks
-
-				}(link, stop, &fetchWg)
-				// We want to check if a level limit is set and in case, check if
-				// it's reached as every explored link count as a level
-				if c.settings.MaxDepth == 0 || !stop {
-					depth++
-					stop = c.settings.MaxDepth > 0 && depth >= c.settings.MaxDepth
+	// The rules to follow while crawling the domain, by default the ones of
+	// the robots.txt, shared with the other crawls of the same host and
+	// scheme, or of its aliases
+	c.setRules(h, politeness.Rules(ctx, key, func() RulesEngine {
+		return c.rulesEngine(ctx, h)
+	}))
+
+	// Establish a session if required, a domain can't be crawled without it
+	if c.settings.SessionInitializer != nil {
+		if err := c.initSession(ctx, rootURL); err != nil {
+			h.logger.Error("Session initialization failed", "err", err)
+			return fmt.Errorf("session initialization of %s failed: %w", rootURL.Host, err)
+		}
+	}
+
+	// A sitemap-only crawl enumerates the URLs of the domain without
+	// fetching any page
+	if c.settings.SitemapOnly {
+		h.stats = c.stats.Track(rootURL.Host, nil, h.health)
+		h.stats.Honoring(h.rules)
+		c.crawlSitemaps(ctx, h)
+		return nil
+	}
+
+	// The frontier holds all the links yet to be crawled, already visited
+	// links, disallowed ones by the robots.txt rules, out of scope or
+	// looking like crawler traps are skipped on push
+	h.frontier = newFrontier(c.scorer(h), func(link *url.URL, depth int) SkipReason {
+		if _, alias := h.aliases.Load(link.String()); alias {
+			return SkipVisited
+		}
+		reason := c.refusal(h, link, depth)
+		if reason == "" {
+			h.stats.Discovered()
+			c.prefetchDNS(link.Hostname())
+		}
+		return reason
+	})
+	if len(c.settings.URLFilters) > 0 {
+		h.frontier.FilterBy(c.filterRefusal)
+	}
+	h.frontier.OnRefused(func(link *url.URL, depth int, reason SkipReason) {
+		c.skip(h, link, depth, reason, "")
+		h.logger.Debug("Skipped", "url", link, "depth", depth, "reason", reason)
+	})
+	if c.settings.Prioritizer != nil {
+		h.frontier.PrioritizeBy(c.settings.Prioritizer)
+	}
+	if c.settings.FrontierMemoryLimit > 0 {
+		h.frontier.SpillBeyond(c.settings.FrontierMemoryLimit, c.settings.FrontierSpillDir)
+		defer h.frontier.Close()
+	}
+	h.stats = c.stats.Track(rootURL.Host, h.frontier, h.health)
+	h.stats.Honoring(h.rules)
+	if c.settings.AdaptiveConcurrency {
+		h.aimd = politeness.AIMD(c.settings.AdaptiveLatencyTarget)
+	}
+	if c.settings.OrderedResults {
+		h.order = newResultSequencer(func(result ParsedResult) {
+			c.enqueueResults(run, result)
+		})
+		defer h.order.Flush()
+	}
+	// Just a kickstart for the first URLs to scrape, along the ones handed
+	// by the crawls of the other domains spanned so far
+	if run.span != nil {
+		seeds = append(seeds, run.span.Join(key, h)...)
+	}
+	for _, seed := range seeds {
+		h.frontier.PushFrom(seed.url, seed.depth, seed.metadata)
+	}
+	c.pushStale(h)
+
+	// Pages downloaded are parsed by a separate pool of workers, so that
+	// the CPU-bound parsing doesn't hold the fetch slots
+	parsed := make(chan *fetchedPage, h.semaphore.Size())
+	for i := 0; i < c.parseConcurrency(); i++ {
+		parseWg.Add(1)
+		go func() {
+			defer parseWg.Done()
+			c.parseStage(ctx, h, parsed)
+		}()
+	}
+
+	// Every cycle represents a single page crawling, the link with the
+	// highest priority is popped from the frontier and fetched, the loop
+	// continues till the end of links or till the pages limit is reached,
+	// the links deeper than the depth limit never enter the frontier
+	// On shutdown the dispatch stops, the in-flight work is drained
+dispatch:
+	for {
+		// Throttling by concurrency argument on the semaphore will take care
+		// of the concurrent number of goroutine. The slot is acquired before
+		// popping a link so that it's chosen with the most up to date
+		// priorities.
+		// 0 concurrency level means we serialize calls as goroutines are
+		// cheap but not that cheap (around 2-5 kb each, 1 million links =
+		// ~4/5 GB ram), by allowing for unlimited number of workers,
+		// potentially we could run OOM (or banned from the website) really
+		// fast
+		if !h.semaphore.Acquire(ctx) {
+			break dispatch
+		}
+		// A free slot and a cancellation may be ready at once
+		if ctx.Err() != nil {
+			h.semaphore.Release()
+			break dispatch
+		}
+		// A degraded host gets fewer concurrent fetches, the slot is given
+		// back till a fetch of the domain ends
+		released := h.health.Released()
+		if h.overloaded() {
+			h.semaphore.Release()
+			select {
+			case <-released:
+			case <-ctx.Done():
+				break dispatch
+			}
+			continue
+		}
+		// The assets of the pages parsed go first, they count as links in
+		// flight
+		if asset, ok := h.assets.Pop(); ok {
+			h.health.Started()
+			fetchWg.Add(1)
+			go func() {
+				defer fetchWg.Done()
+				c.assetStage(ctx, h, asset)
+			}()
+			continue
+		}
+		// A reproducible crawl fetches a link at a time, the frontier is
+		// popped once the links found by the previous one are pushed
+		if c.settings.RandomSeed != 0 && atomic.LoadInt32(&h.inflight) > 0 {
+			h.semaphore.Release()
+			select {
+			case <-h.wakeup:
+			case <-ctx.Done():
+				break dispatch
+			}
+			continue
+		}
+		// With ordered results the links dispatched ahead of the oldest one
+		// not produced yet are bounded, the next one is popped once it is
+		if h.order != nil && h.order.Full() && atomic.LoadInt32(&h.inflight) > 0 {
+			h.semaphore.Release()
+			select {
+			case <-h.wakeup:
+			case <-ctx.Done():
+				break dispatch
+			}
+			continue
+		}
+		// Once the pages limit is reached only the assets of the pages in
+		// flight are still fetched
+		limited := c.settings.MaxPages > 0 && fetched >= c.settings.MaxPages
+		var (
+			link         *url.URL
+			linkDepth    int
+			linkMetadata map[string]string
+			ok           bool
+		)
+		if !limited {
+			link, linkDepth, linkMetadata, ok = h.frontier.Pop()
+		}
+		if !ok {
+			h.semaphore.Release()
+			// No links to crawl and no workers that could find new ones,
+			// the order of the checks matters, workers push new links
+			// before leaving
+			if atomic.LoadInt32(&h.inflight) == 0 && (limited || h.frontier.Len() == 0) {
+				// Links may be handed by the crawls of the other domains
+				// spanned till the crawl is forgotten
+				if limited || run.span == nil || run.span.Exhausted(key, h) {
+					break
 				}
+				continue
 			}
-		case <-time.After(c.settings.CrawlTimeout):
-			// c.settings.CrawlTimeout seconds without any new link found, check
-			// that the remaining links have been processed and stop the iteration
-			if atomic.LoadInt32(&linkCounter) <= 0 {
-				stop = true
+			select {
+			case <-h.wakeup:
+			case <-time.After(c.settings.CrawlTimeout):
+			case <-ctx.Done():
+				break dispatch
 			}
-		case <-ctx.Done():
-			return
+			continue
 		}
+		fetched++
+		atomic.AddInt32(&h.inflight, 1)
+		h.health.Started()
+		fetchWg.Add(1)
+		job := &fetchedPage{link: link, depth: linkDepth, metadata: linkMetadata, trace: newTraceID()}
+		job.logger = h.logger.With("trace", job.trace)
+		if job.metadata == nil {
+			job.metadata = h.metadata
+		}
+		if h.order != nil {
+			job.seq = h.order.Next()
+		}
+		// Spawn a goroutine to fetch the link
+		go func(job *fetchedPage) {
+			defer fetchWg.Done()
+			c.fetchStage(ctx, h, job, parsed)
+		}(job)
+	}
+	c.drain(ctx, h, &fetchWg, &parseWg, parsed)
+	return nil
+}
+
+// rulesEngine creates the `RulesEngine` of a domain, by default a
+// `CrawlingRules` trying to fetch the robots.txt rules to follow, being
+// polite to the domain
+func (c *WebCrawler) rulesEngine(ctx context.Context, h *hostCrawl) RulesEngine {
+	rootURL := h.rootURL
+	if c.settings.RulesEngine != nil {
+		return c.settings.RulesEngine(rootURL)
+	}
+	rulesOpts := []CrawlingRulesOpt{WithURLLimits(c.settings.URLLimits)}
+	if c.settings.SchemeAgnosticDedup {
+		rulesOpts = append(rulesOpts, WithSchemeAgnosticDedup())
+	}
+	if c.settings.RandomSeed != 0 {
+		rulesOpts = append(rulesOpts, WithRandomSeed(c.settings.RandomSeed))
+	}
+	if len(c.settings.HostAliases) > 0 {
+		rulesOpts = append(rulesOpts, WithHostAliases(c.settings.HostAliases))
+	}
+	crawlingRules := NewCrawlingRules(rootURL,
+		c.cache(), c.Reloadable().PolitenessFixedDelay, rulesOpts...)
+	logger := h.logger
+	if c.settings.IgnoreRobotsTxt {
+		logger.Warn("Ignoring robots.txt directives, make sure you own the domain")
+	} else if crawlingRules.GetRobotsTxtGroupContext(ctx, c.linkFetcher,
+		c.settings.UserAgents.For(rootURL.Hostname(), c.settings.UserAgent), rootURL) {
+		logger.Info("Found a valid robots.txt")
+	} else {
+		logger.Info("No valid robots.txt found")
+	}
+	return crawlingRules
+}
+
+// prefetchDNS resolves a host entering a frontier ahead of its first fetch,
+// so that the resolution doesn't take place inside the politeness window,
+// no-op if the fetcher doesn't support it. Hosts already resolved are not
+// resolved again.
+func (c *WebCrawler) prefetchDNS(host string) {
+	if prefetcher, ok := c.linkFetcher.(dnsPrefetcher); ok {
+		prefetcher.PrefetchDNS(host)
+	}
+}
+
+// initSession runs the SessionInitializer on a domain using the client of
+// the fetcher, so that the cookies of the session are sent on every fetch
+func (c *WebCrawler) initSession(ctx context.Context, rootURL *url.URL) error {
+	sc, ok := c.linkFetcher.(sessionClient)
+	if !ok {
+		return fmt.Errorf("session on %s failed: fetcher exposes no client", rootURL.Host)
+	}
+	return c.settings.SessionInitializer.InitSession(ctx, sc.Client(), rootURL)
+}
+
+// relevance returns the score of a page against the keywords of a focused
+// crawl, 0 if no keywords are set
+func (c *WebCrawler) relevance(page *fetcher.Page) float64 {
+	if len(c.settings.Keywords) == 0 {
+		return 0
+	}
+	return relevance(page.Text, c.settings.Keywords)
+}
+
+// relevant tests if a relevance score is enough for the links of a page to
+// be explored, always true if no keywords are set
+func (c *WebCrawler) relevant(score float64) bool {
+	if len(c.settings.Keywords) == 0 {
+		return true
+	}
+	return score > 0 && score >= c.settings.MinRelevance
+}
+
+// hostAllowed tests if a host can be fetched from according to the allowed
+// and blocked host patterns
+func (c *WebCrawler) hostAllowed(host string) bool {
+	r := c.Reloadable()
+	if matchAnyHost(r.BlockedHosts, host) {
+		return false
 	}
-	fetchWg.Wait()
+	return len(r.AllowedHosts) == 0 || matchAnyHost(r.AllowedHosts, host)
 }
 
 // enqueueResults enqueue fetched links through the Producer queue in order to
 // be processed (in this case, printe to stdout)
-func (c *WebCrawler) enqueueResults(link *url.URL, foundLinks []*url.URL) {
-	foundLinksStr := []string{}
-	for _, l := range foundLinks {
-		foundLinksStr = append(foundLinksStr, l.String())
+func (c *WebCrawler) enqueueResults(run *crawlRun, result ParsedResult) {
+	if c.settings.ResultFilter != nil && !c.settings.ResultFilter(result) {
+		c.logger.Debug("Result filtered out", "job", run.job, "url", result.URL)
+		return
 	}
-	payload, _ := json.Marshal(ParsedResult{link.String(), foundLinksStr})
-	if err := c.queue.Produce(payload); err != nil {
-		c.logger.Println("Unable to communicate with message queue:", err)
+	for _, transformer := range c.settings.ResultTransformers {
+		result = transformer.Transform(result)
 	}
+	if run.batches != nil {
+		if batch := run.batches.Add(PageResult, result); batch != nil {
+			c.emitBatch(run, PageResult, batch)
+		}
+		return
+	}
+	logger := c.logger.With("job", run.job, "url", result.URL, "trace", result.TraceID)
+	payload, err := marshalResult(c.settings.ResultEncoding, result)
+	if err != nil {
+		logger.Error("Unable to encode result", "err", err)
+		return
+	}
+	c.emit(run, PageResult, payload, logger)
+}
+
+// emit encodes a payload of results and sends it to the queue of its type,
+// writing it to the outbox first if enabled
+func (c *WebCrawler) emit(run *crawlRun, resultType ResultType, payload []byte,
+	logger *slog.Logger) {
+	payload, err := encodePayload(payload, c.settings.CompressThreshold)
+	if err != nil {
+		logger.Error("Unable to encode result", "err", err)
+		return
+	}
+	if run.outbox == nil {
+		if err := c.produce(resultType, payload); err != nil {
+			logger.Error("Unable to communicate with message queue", "err", err)
+		}
+		return
+	}
+	// The result is produced even if it can't be logged, without the
+	// guarantee of being produced again
+	id, logErr := run.outbox.Append(resultType, payload)
+	if logErr != nil {
+		logger.Error("Unable to write result to outbox", "err", logErr)
+	}
+	if err := c.produce(resultType, payload); err != nil {
+		logger.Error("Unable to communicate with message queue, result left in outbox", "err", err)
+		return
+	}
+	if logErr == nil {
+		if err := run.outbox.Commit(id); err != nil {
+			logger.Error("Unable to commit result to outbox", "err", err)
+		}
+	}
+}
+
+// produce sends a result payload to the queue of its type
+func (c *WebCrawler) produce(resultType ResultType, payload []byte) error {
+	if producer, ok := c.settings.ResultRoutes[resultType]; ok {
+		return producer.Produce(payload)
+	}
+	if producer, ok := c.queue.(messaging.TopicProducer); ok {
+		return producer.ProduceTo(string(resultType), payload)
+	}
+	return c.queue.Produce(payload)
+}
+
+// stringifyLinks converts a slice of `*url.URL` into a slice of strings
+func stringifyLinks(links []*url.URL) []string {
+	linksStr := []string{}
+	for _, l := range links {
+		linksStr = append(linksStr, l.String())
+	}
+	return linksStr
 }
 
 // Crawl will walk through a list of URLs spawning a goroutine for each one of
-// them
-func (c *WebCrawler) Crawl(URLs ...string) {
-	wg := sync.WaitGroup{}
-	ctx, cancel := context.WithCancel(context.Background())
+// them, till interrupted by SIGINT or SIGTERM, see CrawlContext. Returns the
+// report of the crawl.
+func (c *WebCrawler) Crawl(URLs ...string) CrawlReport {
+	return c.CrawlSeeds(urlSeeds(URLs)...)
+}
+
+// CrawlSeeds will walk through a list of seeds spawning a goroutine for each
+// one of them, the metadata of each seed is carried through every result
+// of its crawl. On SIGINT or SIGTERM no more links are fetched, the ones in
+// flight are drained and their results produced, see CrawlSeedsContext.
+// Returns the report of the crawl.
+func (c *WebCrawler) CrawlSeeds(seeds ...Seed) CrawlReport {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Failures are already logged and notified, and part of the report
+	report, _ := c.crawlSeeds(ctx, seeds...)
+	return report
+}
+
+// CrawlContext will walk through a list of URLs spawning a goroutine for each
+// one of them, till done or till the context is cancelled, see
+// CrawlSeedsContext
+func (c *WebCrawler) CrawlContext(ctx context.Context, URLs ...string) error {
+	return c.CrawlSeedsContext(ctx, urlSeeds(URLs)...)
+}
+
+// CrawlSeedsContext will walk through a list of seeds spawning a goroutine
+// for each one of them, the metadata of each seed is carried through every
+// result of its crawl. Once the context is cancelled no more links are
+// fetched, the ones in flight are drained and their results produced. No
+// signal is handled, making it fit to embed the crawler in a larger service.
+//
+// Returns an error joining the ones of the invalid seeds, none is crawled
+// then, of the domains that couldn't be crawled at all and of the context
+// if the crawl was cut short. The report of the crawl is kept, see Report.
+func (c *WebCrawler) CrawlSeedsContext(ctx context.Context, seeds ...Seed) error {
+	_, err := c.crawlSeeds(ctx, seeds...)
+	return err
+}
+
+// crawlSeeds crawls a list of seeds till done or till the context is
+// cancelled, see CrawlSeedsContext, returning the report of the crawl
+func (c *WebCrawler) crawlSeeds(ctx context.Context, seeds ...Seed) (CrawlReport, error) {
+	run := &crawlRun{
+		job:        newJobID(),
+		traps:      newTrapDetector(c.settings.TrapPatterns, c.settings.MaxRepeatedSegments),
+		hosts:      new(sync.Map),
+		external:   newExternalInventory(),
+		politeness: newPolitenessRegistry(),
+	}
+	c.lastRun.Store(run)
+	c.prepareRecrawl()
+	started, before := time.Now(), c.stats.Snapshot()
+	var err error
+	if run.grep, err = newGrepper(c.settings.GrepPatterns); err != nil {
+		c.logger.Error("Invalid grep pattern, crawl aborted", "job", run.job, "err", err)
+		return c.finish(run, seeds, started, before, err)
+	}
+	// The extractors run on the bodies downloaded before the parsing, a
+	// fetcher downloading and parsing the pages at once leaves none
+	if _, ok := c.linkFetcher.(pageDownloader); !ok && len(c.settings.Extractors) > 0 {
+		c.logger.Error("Extractors unsupported by the fetcher, crawl aborted", "job", run.job)
+		err := errors.New("extractors require a fetcher downloading the pages apart from parsing them")
+		return c.finish(run, seeds, started, before, err)
+	}
+	defer c.acquireExtractors()()
+	if c.settings.OutboxPath != "" {
+		if err := c.openOutbox(run); err != nil {
+			c.logger.Error("Outbox unavailable, crawl aborted", "job", run.job, "err", err)
+			err = fmt.Errorf("outbox unavailable: %w", err)
+			return c.finish(run, seeds, started, before, err)
+		}
+		defer c.closeOutbox(run)
+	}
+	if c.settings.DebugAddr != "" {
+		defer c.serveDebug()()
+	}
+	if c.settings.BatchSize > 1 {
+		run.batches = newResultBatches(c.settings.BatchSize)
+	}
 	// Sanity check for URLs passed, check that they're in the form
 	// scheme://host:port/path, adding missing fields
-	for _, href := range URLs {
-		url, err := url.Parse(href)
+	var (
+		hosts   []string
+		invalid []error
+	)
+	hostSeeds := make(map[string][]hostSeed)
+	for _, seed := range seeds {
+		url, err := url.Parse(seed.URL)
 		if err != nil {
-			c.logger.Fatal(err)
+			c.logger.Error("Invalid seed", "job", run.job, "url", seed.URL, "err", err)
+			invalid = append(invalid, fmt.Errorf("invalid seed %s: %w", seed.URL, err))
+			continue
 		}
 		if url.Scheme == "" {
 			url.Scheme = "https"
 		}
-		// Spawn a goroutine for each URLs to crawl, a waitgroup is used to wait
-		// for completion
-		wg.Add(1)
-		go c.crawlPage(url, &wg, ctx)
+		// The seeds of the same host and scheme, or of its aliases, are
+		// merged in a single crawl instead of competing with each other, the
+		// seeds over http and https too with SchemeAgnosticDedup
+		key := c.rulesKey(url)
+		if _, ok := hostSeeds[key]; !ok {
+			hosts = append(hosts, key)
+		}
+		hostSeeds[key] = append(hostSeeds[key], hostSeed{url: url, metadata: seed.Metadata})
+	}
+	if len(invalid) > 0 {
+		err := errors.Join(invalid...)
+		return c.finish(run, seeds, started, before, err)
+	}
+	c.events.Publish(Event{Type: CrawlStarted})
+	wg := sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(ctx)
+	var (
+		errsMutex sync.Mutex
+		errs      []error
+	)
+	// Up to MaxConcurrentDomains hosts are crawled at once, the others are
+	// queued in the order of the seeds, a crawl cancelled drops the hosts
+	// still queued
+	var domains *semaphore
+	if c.settings.MaxConcurrentDomains > 0 {
+		domains = newSemaphore(c.settings.MaxConcurrentDomains)
+	}
+	// The waitgroup is decreased last, once the error of the crawl is
+	// recorded and its domain slot released
+	crawl := func(seeds []hostSeed) {
+		defer wg.Done()
+		if domains != nil {
+			defer domains.Release()
+		}
+		if err := c.crawlPage(run, seeds, ctx); err != nil {
+			errsMutex.Lock()
+			errs = append(errs, err)
+			errsMutex.Unlock()
+		}
+	}
+	// Following external links or including the subdomains, the domains
+	// met during the crawl are crawled too, queued like the ones of the seeds
+	if c.settings.FollowExternalLinks || c.settings.IncludeSubdomains {
+		run.span = newDomainSpan(func(seeds []hostSeed) {
+			wg.Add(1)
+			go func() {
+				if ctx.Err() != nil || (domains != nil && !domains.Acquire(ctx)) {
+					wg.Done()
+					return
+				}
+				crawl(seeds)
+			}()
+		})
+		for _, host := range hosts {
+			run.span.Starting(host)
+		}
 	}
-	// Graceful shutdown of workers
-	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	wg.Add(len(hosts))
 	go func() {
-		<-signalCh
-		cancel()
-		os.Exit(1)
+		for _, host := range hosts {
+			if domains != nil && !domains.Acquire(ctx) {
+				wg.Done()
+				continue
+			}
+			c.prefetchDNS(hostSeeds[host][0].url.Hostname())
+			// Spawn a goroutine for each host to crawl, a waitgroup is used
+			// to wait for completion
+			go crawl(hostSeeds[host])
+		}
+	}()
+	// Live reload of the settings on SIGHUP
+	reloadCh := make(chan os.Signal, 1)
+	if c.settings.ReloadFile != "" {
+		signal.Notify(reloadCh, syscall.SIGHUP)
+		defer signal.Stop(reloadCh)
+	}
+	// The watcher is done before the context is cancelled at the end of the
+	// crawl, so that only an interruption is logged as such
+	crawled, watched := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(watched)
+		for {
+			select {
+			case <-ctx.Done():
+				c.logger.Info("Interrupted, shutting down", "job", run.job)
+				return
+			case <-reloadCh:
+				c.reloadFile(run)
+			case <-crawled:
+				return
+			}
+		}
 	}()
 	wg.Wait()
-	c.logger.Println("Crawling done")
+	close(crawled)
+	<-watched
+	interrupted := ctx.Err() != nil
+	cancel()
+	if run.batches != nil {
+		c.flushBatches(run)
+	}
+	c.flushProducers(run)
+	for name, count := range run.traps.Suppressed() {
+		c.logger.Info("Suppressed URLs suspected of trap", "job", run.job,
+			"trap", name, "count", count)
+	}
+	c.events.Publish(Event{Type: CrawlFinished})
+	c.logger.Info("Crawling done", "job", run.job)
+	if interrupted {
+		errs = append(errs, fmt.Errorf("crawl interrupted: %w", context.Cause(ctx)))
+	}
+	return c.finish(run, seeds, started, before, errors.Join(errs...))
+}
+
+// urlSeeds returns the seeds of a list of URLs, with no metadata
+func urlSeeds(URLs []string) []Seed {
+	seeds := make([]Seed, len(URLs))
+	for i, href := range URLs {
+		seeds[i] = Seed{URL: href}
+	}
+	return seeds
+}
+
+// flushProducers flushes the crawler queue and the producers of the result
+// routes buffering results, so that the crawl returns once all its results
+// are sent
+func (c *WebCrawler) flushProducers(run *crawlRun) {
+	producers := []messaging.Producer{c.queue}
+	for _, producer := range c.settings.ResultRoutes {
+		producers = append(producers, producer)
+	}
+	for _, producer := range producers {
+		if err := messaging.Flush(producer); err != nil {
+			c.logger.Error("Unable to flush results", "job", run.job, "err", err)
+		}
+	}
+}
+
+// CancelHost aborts the crawl of a domain, by host with or without port,
+// while the crawl of the other domains goes on. The links left in its
+// frontier are dropped, the fetches in flight are drained. Returns false if
+// the domain is not being crawled.
+func (c *WebCrawler) CancelHost(host string) bool {
+	cancelled := false
+	c.crawls.Range(func(key, _ any) bool {
+		h := key.(*hostCrawl)
+		if h.rootURL.Host == host || h.rootURL.Hostname() == host {
+			h.logger.Info("Cancelling crawl")
+			h.cancel()
+			cancelled = true
+		}
+		return true
+	})
+	return cancelled
+}
+
+// SuppressedURLs returns the number of URLs refused during the last crawl
+// for each trap pattern they matched
+func (c *WebCrawler) SuppressedURLs() map[string]int {
+	run := c.lastRun.Load()
+	if run == nil {
+		return map[string]int{}
+	}
+	return run.traps.Suppressed()
 }
@@ -4,15 +4,22 @@ package crawler
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+	"github.com/codepr/webcrawler/messaging"
 )
 
 type testQueue struct {
@@ -45,6 +52,9 @@ func consumeEvents(queue *testQueue) []ParsedResult {
 		for e := range events {
 			var res ParsedResult
 			if err := json.Unmarshal(e, &res); err == nil {
+				// Timings and trace IDs are not deterministic, they're
+				// tested apart
+				res.Timings, res.TraceID = fetcher.Timings{}, ""
 				results = append(results, res)
 			}
 		}
@@ -153,6 +163,12 @@ func withCrawlTimeout(timeout time.Duration) CrawlerOpt {
 	}
 }
 
+func withPolitenessDelay(delay time.Duration) CrawlerOpt {
+	return func(s *CrawlerSettings) {
+		s.PolitenessFixedDelay = delay
+	}
+}
+
 func TestCrawlPages(t *testing.T) {
 	server := serverMockWithoutRobotsTxt()
 	defer server.Close()
@@ -166,12 +182,19 @@ func TestCrawlPages(t *testing.T) {
 	close(results)
 	expected := []ParsedResult{
 		{
-			server.URL + "/foo",
-			[]string{"https://example-page.com/sample-page/", server.URL + "/foo/bar/baz"},
+			URL:         server.URL + "/foo",
+			Links:       []string{"https://example-page.com/sample-page/", server.URL + "/foo/bar/baz"},
+			LinkClasses: []LinkClass{ExternalLink, InternalLink},
 		},
 		{
-			server.URL + "/foo/bar/baz",
-			[]string{server.URL + "/foo/bar/test"},
+			URL:         server.URL + "/foo/bar/baz",
+			Links:       []string{"https://example-page.com/sample-page/", server.URL + "/foo/bar/test"},
+			LinkClasses: []LinkClass{ExternalLink, InternalLink},
+		},
+		{
+			URL:         server.URL + "/foo/bar/test",
+			Links:       []string{"https://example-page.com/sample-page/"},
+			LinkClasses: []LinkClass{ExternalLink},
 		},
 	}
 	if !reflect.DeepEqual(res, expected) {
@@ -191,12 +214,14 @@ func TestCrawlPagesRespectingRobotsTxt(t *testing.T) {
 	res := <-results
 	expected := []ParsedResult{
 		{
-			server.URL,
-			[]string{"https://example-page.com/sample-page/", server.URL + "/foo/bar/baz"},
+			URL:         server.URL,
+			Links:       []string{"https://example-page.com/sample-page/", server.URL + "/foo/bar/baz"},
+			LinkClasses: []LinkClass{ExternalLink, InternalLink},
 		},
 		{
-			server.URL + "/foo/bar/baz",
-			[]string{server.URL + "/foo/bar/test"},
+			URL:         server.URL + "/foo/bar/baz",
+			Links:       []string{"https://example-page.com/sample-page/", server.URL + "/foo/bar/test"},
+			LinkClasses: []LinkClass{ExternalLink, InternalLink},
 		},
 	}
 	if !reflect.DeepEqual(res, expected) {
@@ -216,15 +241,667 @@ func TestCrawlPagesRespectingMaxDepth(t *testing.T) {
 	res := <-results
 	expected := []ParsedResult{
 		{
-			server.URL + "/foo",
-			[]string{"https://example-page.com/sample-page/", server.URL + "/foo/bar/baz"},
+			URL:         server.URL + "/foo",
+			Links:       []string{"https://example-page.com/sample-page/", server.URL + "/foo/bar/baz"},
+			LinkClasses: []LinkClass{ExternalLink, InternalLink},
+		},
+		{
+			URL:         server.URL + "/foo/bar/baz",
+			Links:       []string{"https://example-page.com/sample-page/", server.URL + "/foo/bar/test"},
+			LinkClasses: []LinkClass{ExternalLink, InternalLink},
 		},
 		{
-			server.URL + "/foo/bar/baz",
-			[]string{server.URL + "/foo/bar/test"},
+			URL:         server.URL + "/foo/bar/test",
+			Links:       []string{"https://example-page.com/sample-page/"},
+			LinkClasses: []LinkClass{ExternalLink},
 		},
 	}
 	if !reflect.DeepEqual(res, expected) {
 		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, res)
 	}
 }
+
+func TestCrawlWidePagesRespectingMaxDepth(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/foo", resourceMock(`<a href="/a"><a href="/b"><a href="/c"><a href="/d">`))
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		handler.HandleFunc(path, resourceMock(`<a href="`+path+`/deeper">`))
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), withMaxDepth(1))
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	// Every link of the root page is one level deep, their links are not
+	// fetched
+	if res := <-results; len(res) != 5 {
+		t.Errorf("Crawler#Crawl failed: expected 5 results got %v", res)
+	}
+	if stats := crawler.Stats(); stats[strings.TrimPrefix(server.URL, "http://")].Fetched != 5 {
+		t.Errorf("Crawler#Crawl failed: expected 5 pages fetched got %+v", stats)
+	}
+}
+
+func TestCrawlPagesRespectingMaxPages(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		func(s *CrawlerSettings) { s.MaxPages = 2 })
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	var crawled []string
+	for _, r := range <-results {
+		crawled = append(crawled, r.URL)
+	}
+	expected := []string{server.URL + "/foo", server.URL + "/foo/bar/baz"}
+	if !reflect.DeepEqual(crawled, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, crawled)
+	}
+}
+
+func withKeywords(minRelevance float64, keywords ...string) CrawlerOpt {
+	return func(s *CrawlerSettings) {
+		s.Keywords = keywords
+		s.MinRelevance = minRelevance
+	}
+}
+
+func serverMockWithTopics() *httptest.Server {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/foo", resourceMock(
+		`<body>
+			<a href="/relevant">relevant</a>
+			<a href="/offtopic">offtopic</a>
+		</body>`,
+	))
+	handler.HandleFunc("/relevant", resourceMock(
+		`<body>
+			<p>All about goroutines and channels</p>
+			<a href="/relevant/child">child</a>
+		</body>`,
+	))
+	handler.HandleFunc("/relevant/child", resourceMock(
+		`<body><a href="https://example-page.com/sample-page/">external</a></body>`,
+	))
+	handler.HandleFunc("/offtopic", resourceMock(
+		`<body>
+			<p>Nothing to see here</p>
+			<a href="/offtopic/child">child</a>
+		</body>`,
+	))
+	handler.HandleFunc("/offtopic/child", resourceMock(
+		`<body><a href="https://example-page.com/other-page/">external</a></body>`,
+	))
+
+	server := httptest.NewServer(handler)
+	return server
+}
+
+func TestCrawlPagesFocused(t *testing.T) {
+	server := serverMockWithTopics()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus,
+		withCrawlTimeout(100*time.Millisecond), withKeywords(0.5, "goroutines", "generics"))
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	res := <-results
+	crawled := map[string]float64{}
+	for _, r := range res {
+		crawled[r.URL] = r.Relevance
+	}
+	expected := map[string]float64{
+		server.URL + "/foo":            0,
+		server.URL + "/relevant":       0.5,
+		server.URL + "/relevant/child": 0,
+		server.URL + "/offtopic":       0,
+	}
+	if !reflect.DeepEqual(crawled, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, crawled)
+	}
+}
+
+func TestCrawlSeedsWithMetadata(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond))
+	metadata := map[string]string{"customer": "acme", "campaign": "spring"}
+	crawler.CrawlSeeds(Seed{URL: server.URL + "/foo", Metadata: metadata})
+	testbus.Close()
+	res := <-results
+	if len(res) != 3 {
+		t.Errorf("Crawler#CrawlSeeds failed: expected 3 results got %d", len(res))
+	}
+	for _, r := range res {
+		if !reflect.DeepEqual(r.Metadata, metadata) {
+			t.Errorf("Crawler#CrawlSeeds failed: expected %v got %v", metadata, r.Metadata)
+		}
+	}
+}
+
+func TestCrawlSeedsSharingHost(t *testing.T) {
+	var robots int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&robots, 1)
+		http.NotFound(w, r)
+	})
+	handler.HandleFunc("/foo", resourceMock(`<body><a href="/foo/child">child</a></body>`))
+	handler.HandleFunc("/bar", resourceMock(`<body><a href="/bar/child">child</a></body>`))
+	handler.HandleFunc("/foo/child", resourceMock(`<body><a href="/bar">bar</a></body>`))
+	handler.HandleFunc("/bar/child", resourceMock(`<body><a href="/foo">foo</a></body>`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0))
+	crawler.CrawlSeeds(
+		Seed{URL: server.URL + "/foo", Metadata: map[string]string{"seed": "foo"}},
+		Seed{URL: server.URL + "/bar", Metadata: map[string]string{"seed": "bar"}},
+	)
+	testbus.Close()
+	res := <-results
+	if n := atomic.LoadInt32(&robots); n != 1 {
+		t.Errorf("Crawler#CrawlSeeds failed: expected robots.txt fetched once got %d", n)
+	}
+	// Every page carries the metadata of the seed it was found from
+	crawled := make(map[string]string)
+	for _, r := range res {
+		crawled[strings.TrimPrefix(r.URL, server.URL)] = r.Metadata["seed"]
+	}
+	expected := map[string]string{"/foo": "foo", "/foo/child": "foo", "/bar": "bar", "/bar/child": "bar"}
+	if !reflect.DeepEqual(crawled, expected) {
+		t.Errorf("Crawler#CrawlSeeds failed: expected %v got %v", expected, crawled)
+	}
+}
+
+func TestCrawlPagesWithRandomSeed(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/foo", resourceMock(`<body><a href="/a">a</a><a href="/b">b</a><a href="/c">c</a></body>`))
+	handler.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write([]byte(`<body><a href="/a/child">child</a></body>`))
+	})
+	handler.HandleFunc("/b", resourceMock(`<body><a href="/b/child">child</a></body>`))
+	handler.HandleFunc("/c", resourceMock(`<body><a href="/c/child">child</a></body>`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.RandomSeed = 42
+		})
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	res := <-results
+	var crawled []string
+	for _, r := range res {
+		crawled = append(crawled, strings.TrimPrefix(r.URL, server.URL))
+	}
+	// The slow page is crawled first anyway, a link at a time
+	expected := []string{"/foo", "/a", "/b", "/c"}
+	if !reflect.DeepEqual(crawled, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, crawled)
+	}
+}
+
+func TestCrawlPagesSuppressingTraps(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/foo", resourceMock(
+		`<body>
+			<a href="/calendar/2020/10/12">calendar</a>
+			<a href="/foo/bar?sessionid=abcd">session</a>
+			<a href="/foo/baz">baz</a>
+		</body>`,
+	))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond))
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	<-results
+	expected := map[string]int{"calendar": 1, "session": 1}
+	if !reflect.DeepEqual(crawler.SuppressedURLs(), expected) {
+		t.Errorf("Crawler#SuppressedURLs failed: expected %v got %v", expected, crawler.SuppressedURLs())
+	}
+}
+
+func TestCrawlPagesIgnoringRobotsTxt(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", resourceMock("User-agent: *\nDisallow: /"))
+	handler.HandleFunc("/foo", resourceMock(`<body><a href="/foo/bar">bar</a></body>`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	for _, ignore := range []bool{false, true} {
+		testbus := testQueue{make(chan []byte)}
+		results := make(chan []ParsedResult)
+		go func() { results <- consumeEvents(&testbus) }()
+		crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+			withPolitenessDelay(0), func(s *CrawlerSettings) { s.IgnoreRobotsTxt = ignore })
+		crawler.Crawl(server.URL + "/foo")
+		testbus.Close()
+		if res := <-results; (len(res) == 1) != ignore {
+			t.Errorf("Crawler#Crawl failed: ignoring robots.txt %v got %v", ignore, res)
+		}
+	}
+}
+
+// denyRules is a RulesEngine allowing only the root URL and counting the
+// responses received
+type denyRules struct {
+	root      *url.URL
+	responses int32
+}
+
+func (r *denyRules) Allowed(link *url.URL) bool          { return link.String() == r.root.String() }
+func (r *denyRules) Delay() time.Duration                { return 0 }
+func (r *denyRules) OnResponse(*url.URL, *Page, Timings) { atomic.AddInt32(&r.responses, 1) }
+
+func TestCrawlPagesWithRulesEngine(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	rules := &denyRules{}
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		func(s *CrawlerSettings) {
+			s.RulesEngine = func(rootURL *url.URL) RulesEngine {
+				rules.root = rootURL
+				return rules
+			}
+		})
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	if res := <-results; len(res) != 1 || res[0].URL != server.URL+"/foo" {
+		t.Errorf("Crawler#Crawl failed: expected only the root URL got %v", res)
+	}
+	if n := atomic.LoadInt32(&rules.responses); n != 1 {
+		t.Errorf("Crawler#Crawl failed: expected 1 response got %d", n)
+	}
+}
+
+func TestCrawlPagesWithScope(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	scope, err := NewScope(ScopeConfig{Deny: []string{"/foo/bar/**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.Scope = scope })
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	if res := <-results; len(res) != 1 || res[0].URL != server.URL+"/foo" {
+		t.Errorf("Crawler#Crawl failed: expected only the root URL got %v", res)
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	crawler := New("test-agent", &testQueue{}, func(s *CrawlerSettings) {
+		s.AllowedHosts = []string{"*.example.com", "example.com"}
+		s.BlockedHosts = []string{"cdn.example.com", "login.*"}
+	})
+	testCases := map[string]bool{
+		"example.com":       true,
+		"www.example.com":   true,
+		"cdn.example.com":   false,
+		"login.example.com": false,
+		"example.org":       false,
+	}
+	for host, allowed := range testCases {
+		if got := crawler.hostAllowed(host); got != allowed {
+			t.Errorf("Crawler#hostAllowed(%s) failed: expected %v got %v",
+				host, allowed, got)
+		}
+	}
+}
+
+func TestCrawlPagesBlockedHost(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus,
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0),
+		func(s *CrawlerSettings) { s.BlockedHosts = []string{"127.0.0.*"} })
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	if res := <-results; len(res) != 0 {
+		t.Errorf("Crawler#Crawl failed: expected no results got %v", res)
+	}
+}
+
+// serverMockWithHighFanout returns a server with a root page linking to a
+// number of pages, each one linking to fanout other pages
+func serverMockWithHighFanout(pages, fanout int) *httptest.Server {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		b.WriteString("<body>")
+		if r.URL.Path == "/" {
+			for i := 0; i < pages; i++ {
+				fmt.Fprintf(&b, `<a href="/item/%d">page</a>`, i)
+			}
+		} else {
+			var n int
+			fmt.Sscanf(r.URL.Path, "/item/%d", &n)
+			for i := 1; i <= fanout; i++ {
+				fmt.Fprintf(&b, `<a href="/item/%d">page</a>`, (n+i)%pages)
+			}
+		}
+		b.WriteString("</body>")
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, b.String())
+	})
+	return httptest.NewServer(handler)
+}
+
+func TestCrawlPagesHighFanout(t *testing.T) {
+	const pages = 300
+	server := serverMockWithHighFanout(pages, 50)
+	defer server.Close()
+	for _, concurrency := range []int{1, 8} {
+		testbus := testQueue{make(chan []byte)}
+		results := make(chan []ParsedResult)
+		go func() { results <- consumeEvents(&testbus) }()
+		crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+			withPolitenessDelay(0), func(s *CrawlerSettings) { s.Concurrency = concurrency })
+		done := make(chan struct{})
+		go func() {
+			crawler.Crawl(server.URL + "/")
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(20 * time.Second):
+			t.Fatalf("Crawler#Crawl failed: crawl with concurrency %d stuck", concurrency)
+		}
+		testbus.Close()
+		<-results
+		host, _ := url.Parse(server.URL)
+		if fetched := crawler.Stats()[host.Host].Fetched; fetched != pages+1 {
+			t.Errorf("Crawler#Crawl failed: concurrency %d expected %d pages fetched got %d",
+				concurrency, pages+1, fetched)
+		}
+	}
+}
+
+// linkFetcherOnly hides the two-step download of the fetcher, forcing the
+// crawler to fetch and parse in the fetch stage
+type linkFetcherOnly struct {
+	LinkFetcher
+}
+
+func TestCrawlPagesWithLinkFetcherOnly(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0))
+	crawler.linkFetcher = linkFetcherOnly{crawler.linkFetcher}
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	if res := <-results; len(res) != 3 {
+		t.Errorf("Crawler#Crawl failed: expected 3 results got %v", res)
+	}
+}
+
+// dnsRecorder records the hosts prefetched by the crawler
+type dnsRecorder struct {
+	LinkFetcher
+	hosts sync.Map
+}
+
+func (r *dnsRecorder) PrefetchDNS(host string) {
+	r.hosts.Store(host, struct{}{})
+}
+
+func TestCrawlPagesPrefetchingDNS(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0))
+	recorder := &dnsRecorder{LinkFetcher: crawler.linkFetcher}
+	crawler.linkFetcher = recorder
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	<-results
+	serverURL, _ := url.Parse(server.URL)
+	if _, ok := recorder.hosts.Load(serverURL.Hostname()); !ok {
+		t.Errorf("Crawler#Crawl failed: %s not prefetched", serverURL.Hostname())
+	}
+}
+
+func TestCrawlPagesCompressingResults(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() {
+		res := []ParsedResult{}
+		for e := range testbus.bus {
+			payload, err := DecodePayload(e)
+			if err != nil {
+				t.Errorf("DecodePayload failed: %v", err)
+				continue
+			}
+			var r ParsedResult
+			if err := json.Unmarshal(payload, &r); err == nil {
+				res = append(res, r)
+			}
+		}
+		results <- res
+	}()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.CompressThreshold = 1 })
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	if res := <-results; len(res) != 3 {
+		t.Errorf("Crawler#Crawl failed: expected 3 results got %v", res)
+	}
+}
+
+// topicQueue records the topics of the payloads produced
+type topicQueue struct {
+	mutex  sync.Mutex
+	topics []string
+}
+
+func (q *topicQueue) Produce([]byte) error {
+	return q.ProduceTo("", nil)
+}
+
+func (q *topicQueue) ProduceTo(topic string, _ []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.topics = append(q.topics, topic)
+	return nil
+}
+
+func TestCrawlPagesRoutingResults(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	queue := &topicQueue{}
+	crawler := New("test-agent", queue,
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0))
+	crawler.Crawl(server.URL + "/foo")
+	if fmt.Sprint(queue.topics) != "[page page page]" {
+		t.Errorf("Crawler#Crawl failed: expected [page page page] got %v",
+			queue.topics)
+	}
+	// Routes take precedence over the topics of the crawler queue
+	routed := &topicQueue{}
+	routes := map[ResultType]messaging.Producer{PageResult: routed}
+	crawler = New("test-agent", queue,
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0),
+		func(s *CrawlerSettings) { s.ResultRoutes = routes })
+	crawler.Crawl(server.URL + "/foo")
+	if len(routed.topics) != 3 || len(queue.topics) != 3 {
+		t.Errorf("Crawler#Crawl failed: expected 3 results routed got %v",
+			routed.topics)
+	}
+}
+
+func TestCrawlPagesFilteringResults(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.ResultFilter = func(r ParsedResult) bool { return strings.HasSuffix(r.URL, "/foo") }
+		})
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	res := <-results
+	if len(res) != 1 || res[0].URL != server.URL+"/foo" {
+		t.Errorf("Crawler#Crawl failed: expected 1 result got %v", res)
+	}
+	if fetched := crawler.Stats()[strings.TrimPrefix(server.URL, "http://")].Fetched; fetched != 3 {
+		t.Errorf("Crawler#Crawl failed: expected 3 pages fetched got %d", fetched)
+	}
+}
+
+func TestCrawlCancelHost(t *testing.T) {
+	other := serverMockWithoutRobotsTxt()
+	defer other.Close()
+	// An endless chain of pages
+	fetching := make(chan struct{}, 1)
+	endless := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case fetching <- struct{}{}:
+		default:
+		}
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(w, `<a href="%s/next">`, r.URL.Path)
+	}))
+	defer endless.Close()
+	crawler := New("test-agent", &testQueue{make(chan []byte, 64)},
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0))
+	host := strings.TrimPrefix(endless.URL, "http://")
+	go func() {
+		<-fetching
+		if !crawler.CancelHost(host) {
+			t.Errorf("Crawler#CancelHost failed: expected %s cancelled", host)
+		}
+	}()
+	crawler.Crawl(endless.URL+"/foo", other.URL+"/foo")
+	stats := crawler.Stats()
+	if fetched := stats[host].Fetched; fetched > 5 {
+		t.Errorf("Crawler#CancelHost failed: expected the crawl aborted got %d pages", fetched)
+	}
+	if fetched := stats[strings.TrimPrefix(other.URL, "http://")].Fetched; fetched != 3 {
+		t.Errorf("Crawler#CancelHost failed: expected 3 pages fetched got %d", fetched)
+	}
+	if crawler.CancelHost(host) {
+		t.Errorf("Crawler#CancelHost failed: expected false once the crawl is done")
+	}
+}
+
+func TestCrawlHeadersOnly(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/", resourceMock(`<a href="/doc.pdf"><a href="/missing"><a href="/old">`))
+	handler.HandleFunc("/doc.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write([]byte(`<a href="/hidden">`))
+	})
+	handler.HandleFunc("/missing", http.NotFound)
+	handler.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/doc.pdf", http.StatusMovedPermanently)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.HeadersOnly = true })
+	crawler.Crawl(server.URL + "/")
+	testbus.Close()
+	statuses := make(map[string]ParsedResult)
+	for _, res := range <-results {
+		statuses[strings.TrimPrefix(res.URL, server.URL)] = res
+	}
+	if len(statuses) != 4 {
+		t.Fatalf("Crawler#Crawl failed: expected 4 pages got %v", statuses)
+	}
+	for path, status := range map[string]int{"/": 200, "/doc.pdf": 200, "/missing": 404, "/old": 200} {
+		if statuses[path].Status != status {
+			t.Errorf("Crawler#Crawl failed: expected %s status %d got %d", path, status, statuses[path].Status)
+		}
+	}
+	if pdf := statuses["/doc.pdf"]; len(pdf.Links) != 0 || pdf.Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("Crawler#Crawl failed: expected the headers of the pdf only got %v", pdf)
+	}
+	if old := statuses["/old"]; !reflect.DeepEqual(old.Redirects, []string{server.URL + "/old"}) {
+		t.Errorf("Crawler#Crawl failed: expected a redirect from /old got %v", old.Redirects)
+	}
+}
+
+func TestCrawlMaxConcurrentDomains(t *testing.T) {
+	var (
+		mutex    sync.Mutex
+		requests []string
+	)
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests = append(requests, r.Host)
+		mutex.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write([]byte(`<a href="/foo"><a href="/bar">`))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.MaxConcurrentDomains = 1 })
+	crawler.Crawl(server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	testbus.Close()
+	<-results
+	// The second domain is crawled once the first one is done
+	switches := 0
+	for i := 1; i < len(requests); i++ {
+		if requests[i] != requests[i-1] {
+			switches++
+		}
+	}
+	if len(requests) != 6 || switches != 1 {
+		t.Errorf("Crawler#Crawl failed: expected the domains crawled one at a time got %v", requests)
+	}
+}
@@ -3,10 +3,15 @@
 package crawler
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
 	"math"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,18 +27,97 @@ type Cachable interface {
 	Contains(string, string) bool
 }
 
+// RulesEngine decides which links of a domain are crawled and how long to
+// wait between the requests, `CrawlingRules` is the default one following
+// the robots.txt directives. An engine is created for each domain crawled
+// and shared among its workers, so it must be thread-safe.
+type RulesEngine interface {
+	// Allowed tests if a link can be crawled, links already visited should
+	// be refused
+	Allowed(*url.URL) bool
+	// Delay returns the time to wait before the next request to the domain
+	Delay() time.Duration
+	// OnResponse is called after every fetch with the link fetched, the
+	// page, nil if the fetch failed, and the timings of the call. The page
+	// may not be parsed yet, only its URL and ContentType are always set
+	OnResponse(link *url.URL, page *Page, timings Timings)
+}
+
+// RulesEngineFactory creates the `RulesEngine` of a domain given its root URL
+type RulesEngineFactory func(rootURL *url.URL) RulesEngine
+
 // Default /robots.txt path on server
 const robotsTxtPath string = "/robots.txt"
 
+// URLLimits defines caps on the shape of the URLs to crawl, pathological
+// URLs generated by some sites would otherwise keep a crawl alive forever.
+// 0 means no limit.
+type URLLimits struct {
+	// MaxLength is the maximum length of an URL
+	MaxLength int
+	// MaxQueryParams is the maximum number of query parameters of an URL
+	MaxQueryParams int
+	// MaxPathSegments is the maximum number of segments of an URL path
+	MaxPathSegments int
+}
+
+// Exceeded tests if an URL exceeds any of the limits
+func (l URLLimits) Exceeded(link *url.URL) bool {
+	if l.MaxLength > 0 && len(link.String()) > l.MaxLength {
+		return true
+	}
+	if l.MaxQueryParams > 0 && link.RawQuery != "" &&
+		len(strings.Split(link.RawQuery, "&")) > l.MaxQueryParams {
+		return true
+	}
+	segments := strings.FieldsFunc(link.Path, func(r rune) bool { return r == '/' })
+	return l.MaxPathSegments > 0 && len(segments) > l.MaxPathSegments
+}
+
+// CrawlingRulesOpt is a type definition for option pattern while creating a
+// new CrawlingRules
+type CrawlingRulesOpt func(*CrawlingRules)
+
+// WithURLLimits sets the caps on the shape of the URLs allowed
+func WithURLLimits(limits URLLimits) CrawlingRulesOpt {
+	return func(r *CrawlingRules) {
+		r.limits = limits
+	}
+}
+
+// WithSchemeAgnosticDedup makes the http and https versions of an URL count
+// as the same visit
+func WithSchemeAgnosticDedup() CrawlingRulesOpt {
+	return func(r *CrawlingRules) {
+		r.schemeAgnostic = true
+	}
+}
+
+// WithRandomSeed seeds the source of the random delays, the same seed
+// draws the same sequence of delays, making crawls reproducible
+func WithRandomSeed(seed int64) CrawlingRulesOpt {
+	return func(r *CrawlingRules) {
+		r.rng = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithHostAliases makes the aliases of the hosts part of the domain, their
+// URLs being the same visits of the ones on the canonical host
+func WithHostAliases(aliases HostAliases) CrawlingRulesOpt {
+	return func(r *CrawlingRules) {
+		r.aliases = aliases
+	}
+}
+
 // CrawlingRules contains the rules to be obeyed during the crawling of a single
 // domain, including allowances and delays to respect.
 //
 // There are a total of 3 different delays for each domain, the robots.txt has
-// always the precedence over the fixedDelay and the lastDelay.
+// always the precedence over the fixedDelay and the median response time.
 // If no robots.txt is found during the crawl, a random delay will be calculated
-// based on the response time of the last request, if a fixedDelay is set, the
+// based on the response times of the requests, if a fixedDelay is set, the
 // major between a random value between 1.5 * fixedDelay and 0.5 * fixedDelay
-// and the lastDelay will be chosen.
+// and the median response time will be chosen.
 type CrawlingRules struct {
 	// baseDomain represents the domain where we start the crawling process
 	baseDomain *url.URL
@@ -42,51 +126,236 @@ type CrawlingRules struct {
 	// temoto/robotstxt backend is used to fetch the robotsGroup from the
 	// robots.txt file
 	robotsGroup *robotstxt.Group
+	// The sitemaps listed in the robots.txt file
+	sitemaps []string
+	// The summary of the group of the robots.txt followed
+	robotsSummary RobotsSummary
 	// A fixed delay to respect on each request if no valid robots.txt is found
 	fixedDelay time.Duration
-	// The delay of the last request, useful to calculate a new delay for the
-	// next request
-	lastDelay time.Duration
+	// The distribution of the response times, the delay of the next request
+	// respects the median
+	latencies latencyHistogram
+	// Caps on the shape of the URLs allowed
+	limits URLLimits
+	// If true the http and https versions of an URL are the same visit, set
+	// when the domain redirects from http to https
+	schemeAgnostic bool
+	// The aliases of the hosts, an URL on an alias is the same visit of the
+	// one on its canonical host, the robots.txt of the base domain applies
+	aliases HostAliases
+	// The source of the random delays, the global one if nil, guarded by
+	// its own mutex as the delays are drawn under the read lock
+	rng      *rand.Rand
+	rngMutex sync.Mutex
 	// A RWmutex is needed to make the delya calculation threadsafe as this
 	// struct will be shared among multiple goroutines
 	rwMutex sync.RWMutex
 }
 
+// RobotsSummary describes the group of the robots.txt of a domain followed
+// by the crawler, to confirm which directives are honored
+type RobotsSummary struct {
+	// Group is the user agent of the group matched, * for the catch-all
+	// one, empty if the robots.txt has no group for the crawler
+	Group string `json:"group"`
+	// CrawlDelay is the Crawl-delay directive of the group, 0 if missing
+	CrawlDelay time.Duration `json:"crawl_delay"`
+	// Allow and Disallow are the number of rules of the group
+	Allow    int `json:"allow"`
+	Disallow int `json:"disallow"`
+	// Sitemaps is the number of sitemaps listed
+	Sitemaps int `json:"sitemaps"`
+}
+
+// robotsSummarizer is implemented by the rules engines following a
+// robots.txt, to report the directives honored
+type robotsSummarizer interface {
+	RobotsSummary() (RobotsSummary, bool)
+}
+
+// summarizeRobotsGroup summarizes the group of a robots.txt matched by a
+// user agent, the same way `robotstxt.RobotsData.FindGroup` does: the
+// longest user agent prefixing it, or the catch-all one. The rules of a
+// record apply to every user agent listed on the lines leading it, empty
+// rules are not counted as they allow everything.
+func summarizeRobotsGroup(body []byte, userAgent string, group *robotstxt.Group) RobotsSummary {
+	type rules struct{ allow, disallow int }
+	groups := make(map[string]*rules)
+	var record []*rules
+	agents := false
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.ToLower(strings.TrimSpace(value))
+		switch key {
+		case "user-agent":
+			// A new record starts
+			if !agents {
+				record = nil
+			}
+			agents = true
+			if groups[value] == nil {
+				groups[value] = &rules{}
+			}
+			record = append(record, groups[value])
+		case "allow", "disallow":
+			agents = false
+			if value == "" {
+				continue
+			}
+			for _, r := range record {
+				if key == "allow" {
+					r.allow++
+				} else {
+					r.disallow++
+				}
+			}
+		default:
+			agents = false
+		}
+	}
+	summary := RobotsSummary{CrawlDelay: group.CrawlDelay}
+	userAgent = strings.ToLower(userAgent)
+	var matched *rules
+	if matched = groups["*"]; matched != nil {
+		summary.Group = "*"
+	}
+	for agent, r := range groups {
+		if agent != "*" && strings.HasPrefix(userAgent, agent) && len(agent) > len(summary.Group) {
+			summary.Group, matched = agent, r
+		}
+	}
+	if matched != nil {
+		summary.Allow, summary.Disallow = matched.allow, matched.disallow
+	}
+	return summary
+}
+
 // NewCrawlingRules creates a new CrawlingRules struct
 func NewCrawlingRules(baseDomain *url.URL, cache Cachable,
-	fixedDelay time.Duration) *CrawlingRules {
-	return &CrawlingRules{
+	fixedDelay time.Duration, opts ...CrawlingRulesOpt) *CrawlingRules {
+	rules := &CrawlingRules{
 		baseDomain: baseDomain,
 		cache:      cache,
 		fixedDelay: fixedDelay,
 	}
+	for _, opt := range opts {
+		opt(rules)
+	}
+	return rules
 }
 
 // Allowed tests for eligibility of an URL to be crawled, based on the rules
 // of the robots.txt file on the server. If no valid robots.txt is found all
-// URLs in the domain are assumed to be allowed, returning true.
+// URLs in the domain are assumed to be allowed, returning true. URLs
+// exceeding the limits set are never allowed.
 func (r *CrawlingRules) Allowed(url *url.URL) bool {
-	if r.cache.Contains(r.baseDomain.String(), url.String()) {
+	return r.Refusal(url) == ""
+}
+
+// Refusal is `Allowed` telling why an URL is refused, empty if allowed
+func (r *CrawlingRules) Refusal(url *url.URL) SkipReason {
+	if r.limits.Exceeded(url) {
+		return SkipLimits
+	}
+	key := r.cacheKey(url)
+	if r.visited(url, key) {
+		return SkipVisited
+	}
+	defer r.cache.Set(r.baseDomain.String(), key)
+	return r.Forbidden(url)
+}
+
+// Permitted tests if an URL belongs to the domain and is allowed by the
+// rules of the robots.txt, whether it was visited or not, e.g. the target
+// of a redirect
+func (r *CrawlingRules) Permitted(url *url.URL) bool {
+	return r.Forbidden(url) == ""
+}
+
+// Forbidden is `Permitted` telling why an URL is not permitted, empty if
+// permitted
+func (r *CrawlingRules) Forbidden(url *url.URL) SkipReason {
+	base, link := r.aliases.URL(r.baseDomain), r.aliases.URL(url)
+	if !subdomain(base, link) {
+		return SkipDomain
+	}
+	if r.robotsGroup != nil && !r.robotsGroup.Test(url.RequestURI()) {
+		return SkipRobots
+	}
+	return ""
+}
+
+// Redirected records a redirect of a fetched URL, marking the target as
+// visited. A redirect from http to the https version of the same host means
+// that from now on the two schemes are considered the same visit, avoiding
+// to crawl the site twice.
+func (r *CrawlingRules) Redirected(from, to *url.URL) {
+	if from.Scheme == "http" && to.Scheme == "https" && from.Hostname() == to.Hostname() {
+		r.UnifySchemes()
+	}
+	r.cache.Set(r.baseDomain.String(), r.cacheKey(to))
+}
+
+// UnifySchemes makes the http and https versions of the URLs of the domain
+// the same visit from now on, once the domain is known to serve the same
+// content on both, e.g. from the canonical URLs of its pages
+func (r *CrawlingRules) UnifySchemes() {
+	r.rwMutex.Lock()
+	defer r.rwMutex.Unlock()
+	r.schemeAgnostic = true
+}
+
+// visited tests if an URL was visited given its cache key, the URLs visited
+// with either scheme before the schemes were unified count too
+func (r *CrawlingRules) visited(link *url.URL, key string) bool {
+	link = r.aliases.URL(link)
+	namespace := r.baseDomain.String()
+	if r.cache.Contains(namespace, key) {
+		return true
+	}
+	if key == link.String() {
 		return false
 	}
-	defer r.cache.Set(r.baseDomain.String(), url.String())
-	if r.robotsGroup != nil {
-		return r.robotsGroup.Test(url.RequestURI()) && subdomain(r.baseDomain, url)
+	for _, scheme := range []string{"http", "https"} {
+		variant := *link
+		variant.Scheme = scheme
+		if r.cache.Contains(namespace, variant.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheKey returns the key used to track the visit of an URL, on its
+// canonical host, stripping the scheme if http and https are the same visit
+func (r *CrawlingRules) cacheKey(link *url.URL) string {
+	link = r.aliases.URL(link)
+	r.rwMutex.RLock()
+	defer r.rwMutex.RUnlock()
+	if !r.schemeAgnostic {
+		return link.String()
 	}
-	return subdomain(r.baseDomain, url)
+	key := *link
+	key.Scheme = ""
+	return key.String()
 }
 
 // CrawlDelay return the delay to be respected for the next request on a same
 // domain. It chooses from 3 different possible delays, the most important one
 // is the one defined by the robots.txt of the domain, then it proceeds
-// generating a random delay based on the last request response time and a
-// fixed delay set by configuration of the crawler.
+// generating a random delay based on the response times of the requests and
+// a fixed delay set by configuration of the crawler.
 //
 // It follows these steps:
 //
 // - robots.txt delay
 // - delay = random 0.5*fixedDelay and 1.5*fixedDelay
-// - max(lastResponseTime^2, delay, robots.txt delay)
+// - max(median response time, delay, robots.txt delay)
 func (r *CrawlingRules) CrawlDelay() time.Duration {
 	r.rwMutex.RLock()
 	defer r.rwMutex.RUnlock()
@@ -95,38 +364,72 @@ func (r *CrawlingRules) CrawlDelay() time.Duration {
 		delay = r.robotsGroup.CrawlDelay
 	}
 	// We calculate a random value: 0.5*fixedDelay < value < 1.5*fixedDelay
-	randomDelay := randDelay(int64(r.fixedDelay.Milliseconds())) * time.Millisecond
+	r.rngMutex.Lock()
+	randomDelay := randDelay(r.rng, int64(r.fixedDelay.Milliseconds())) * time.Millisecond
+	r.rngMutex.Unlock()
 	baseDelay := time.Duration(
 		math.Max(float64(randomDelay.Milliseconds()), float64(delay.Milliseconds())),
 	) * time.Millisecond
-	// We return the max between the random value calculated and the lastDelay
+	// We return the max between the random value calculated and the median
+	// response time
+	median := r.latencies.Quantile(0.5)
 	return time.Duration(
-		math.Max(float64(r.lastDelay.Milliseconds()), float64(baseDelay.Milliseconds())),
+		math.Max(float64(median.Milliseconds()), float64(baseDelay.Milliseconds())),
 	) * time.Millisecond
 }
 
-// SetDelay just pow(2) the lastTime response in seconds and set it as the
-// lastDelay value
-func (r *CrawlingRules) UpdateLastDelay(lastResponseTime time.Duration) {
+// Delay returns the delay to be respected for the next request, see
+// CrawlDelay
+func (r *CrawlingRules) Delay() time.Duration {
+	return r.CrawlDelay()
+}
+
+// SetFixedDelay replaces the fixed delay, applied from the next request
+func (r *CrawlingRules) SetFixedDelay(fixedDelay time.Duration) {
 	r.rwMutex.Lock()
-	r.lastDelay = time.Duration(
-		math.Pow(float64(lastResponseTime.Seconds()), 2.0),
-	) * time.Second
-	r.rwMutex.Unlock()
+	defer r.rwMutex.Unlock()
+	r.fixedDelay = fixedDelay
+}
+
+// OnResponse updates the last delay with the total time of the call and
+// records the redirect of the link fetched if any
+func (r *CrawlingRules) OnResponse(link *url.URL, page *Page, timings Timings) {
+	r.UpdateLastDelay(timings.Total)
+	if page != nil && page.URL != nil && page.URL.String() != link.String() {
+		r.Redirected(link, page.URL)
+	}
+}
+
+// UpdateLastDelay records the response time of the last request, the delay
+// of the next requests is at least the median response time of the domain,
+// slowing down as the domain does
+func (r *CrawlingRules) UpdateLastDelay(lastResponseTime time.Duration) {
+	r.latencies.Observe(lastResponseTime)
 }
 
 // GetRobotsTxtGroup tryes to fetch the robots.txt from the domain and parse
 // it. Returns a boolean based on the success of the process.
 func (r *CrawlingRules) GetRobotsTxtGroup(f Fetcher,
+	userAgent string, domain *url.URL) bool {
+	return r.GetRobotsTxtGroupContext(context.Background(), f, userAgent, domain)
+}
+
+// GetRobotsTxtGroupContext is `GetRobotsTxtGroup` bound to a context, the
+// fetch of the robots.txt is aborted once the context is done
+func (r *CrawlingRules) GetRobotsTxtGroupContext(ctx context.Context, f Fetcher,
 	userAgent string, domain *url.URL) bool {
 	u, _ := url.Parse(robotsTxtPath)
 	targetURL := domain.ResolveReference(u)
 	// Try to fetch the robots.txt file
-	_, res, err := f.Fetch(targetURL.String())
+	_, res, err := fetchContext(ctx, f, targetURL.String())
 	if err != nil || res.StatusCode == http.StatusNotFound {
 		return false
 	}
-	body, err := robotstxt.FromResponse(res)
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return false
+	}
+	body, err := robotstxt.FromStatusAndBytes(res.StatusCode, raw)
 
 	// If robots data cannot be parsed, will return nil, which will allow access by default.
 	// Reasonable, since by default no robots.txt means full access, so invalid
@@ -134,17 +437,38 @@ func (r *CrawlingRules) GetRobotsTxtGroup(f Fetcher,
 	if err != nil {
 		return false
 	}
+	r.sitemaps = body.Sitemaps
 	r.robotsGroup = body.FindGroup(userAgent)
+	if r.robotsGroup != nil {
+		r.robotsSummary = summarizeRobotsGroup(raw, userAgent, r.robotsGroup)
+		r.robotsSummary.Sitemaps = len(body.Sitemaps)
+	}
 	return r.robotsGroup != nil
 }
 
-// Return a random value between 1.5*value and 0.5*value
-func randDelay(value int64) time.Duration {
+// RobotsSummary returns the summary of the group of the robots.txt followed,
+// false if no valid robots.txt was found
+func (r *CrawlingRules) RobotsSummary() (RobotsSummary, bool) {
+	return r.robotsSummary, r.robotsGroup != nil
+}
+
+// Sitemaps returns the sitemaps listed in the robots.txt file of the domain
+func (r *CrawlingRules) Sitemaps() []string {
+	return r.sitemaps
+}
+
+// Return a random value between 0.5*value and 1.5*value, drawn from a given
+// source or from the global one if nil
+func randDelay(rng *rand.Rand, value int64) time.Duration {
 	if value == 0 {
 		return 0
 	}
 	max, min := 1.5*float64(value), 0.5*float64(value)
-	return time.Duration(rand.Int63n(int64(max-min)) + int64(max))
+	int63n := rand.Int63n
+	if rng != nil {
+		int63n = rng.Int63n
+	}
+	return time.Duration(int63n(int64(max-min)) + int64(min))
 }
 
 func subdomain(domain *url.URL, link *url.URL) bool {
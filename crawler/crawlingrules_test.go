@@ -3,9 +3,11 @@
 package crawler
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"testing"
 	"time"
 
@@ -14,7 +16,7 @@ import (
 
 const userAgent = "test-agent"
 
-var f = fetcher.New(userAgent, nil, 10*time.Second)
+var f = fetcher.New(fetcher.WithUserAgent(userAgent))
 
 func serverMock() *httptest.Server {
 	handler := http.NewServeMux()
@@ -57,6 +59,36 @@ func TestCrawlingRules(t *testing.T) {
 	}
 }
 
+func TestCrawlingRulesRobotsSummary(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`User-agent: *
+Disallow: /
+
+User-agent: other-agent
+User-agent: test-agent # this crawler
+Allow: /public
+Disallow: /private
+Disallow: /tmp
+Disallow:
+Crawl-delay: 3
+
+Sitemap: /sitemap.xml`))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	r := NewCrawlingRules(serverURL, newMemoryCache(), 0)
+	if _, ok := r.RobotsSummary(); ok {
+		t.Errorf("CrawlingRules#RobotsSummary failed: expected no summary before the robots.txt")
+	}
+	r.GetRobotsTxtGroup(f, userAgent, serverURL)
+	expected := RobotsSummary{Group: "test-agent", CrawlDelay: 3 * time.Second, Allow: 1, Disallow: 2, Sitemaps: 1}
+	if summary, ok := r.RobotsSummary(); !ok || summary != expected {
+		t.Errorf("CrawlingRules#RobotsSummary failed: expected %+v got %+v", expected, summary)
+	}
+}
+
 func TestCrawlingRulesNotFound(t *testing.T) {
 	server := serverWithoutCrawlingRules()
 	defer server.Close()
@@ -66,3 +98,132 @@ func TestCrawlingRulesNotFound(t *testing.T) {
 		t.Errorf("CrawlingRules#GetRobotsTxtGroup failed")
 	}
 }
+
+func TestCrawlingRulesRobotsTxtCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	r := NewCrawlingRules(serverURL, newMemoryCache(), 100*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if r.GetRobotsTxtGroupContext(ctx, f, userAgent, serverURL) {
+		t.Errorf("CrawlingRules#GetRobotsTxtGroupContext failed: expected false got true")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("CrawlingRules#GetRobotsTxtGroupContext failed: expected prompt cancellation, took %v", elapsed)
+	}
+}
+
+func TestCrawlingRulesURLLimits(t *testing.T) {
+	serverURL, _ := url.Parse("http://localhost:8787")
+	r := NewCrawlingRules(serverURL, newMemoryCache(), 100*time.Millisecond,
+		WithURLLimits(URLLimits{MaxLength: 64, MaxQueryParams: 2, MaxPathSegments: 3}))
+	tests := map[string]bool{
+		"http://localhost:8787/a/b/c":                                         true,
+		"http://localhost:8787/a/b/c/d":                                       false,
+		"http://localhost:8787/a?x=1&y=2":                                     true,
+		"http://localhost:8787/a?x=1&y=2&z=3":                                 false,
+		"http://localhost:8787/a-very-long-path-exceeding-the-maximum-length": false,
+	}
+	for href, expected := range tests {
+		link, _ := url.Parse(href)
+		if r.Allowed(link) != expected {
+			t.Errorf("CrawlingRules#Allowed failed: expected %v for %s", expected, href)
+		}
+	}
+}
+
+func TestCrawlingRulesSchemeAgnosticDedup(t *testing.T) {
+	serverURL, _ := url.Parse("https://localhost")
+	r := NewCrawlingRules(serverURL, newMemoryCache(), 100*time.Millisecond,
+		WithSchemeAgnosticDedup())
+	httpsLink, _ := url.Parse("https://localhost/foo")
+	httpLink, _ := url.Parse("http://localhost/foo")
+	if !r.Allowed(httpsLink) {
+		t.Errorf("CrawlingRules#Allowed failed: expected true got false")
+	}
+	if r.Allowed(httpLink) {
+		t.Errorf("CrawlingRules#Allowed failed: expected false got true")
+	}
+}
+
+func TestCrawlingRulesRedirectedToHTTPS(t *testing.T) {
+	serverURL, _ := url.Parse("http://localhost")
+	r := NewCrawlingRules(serverURL, newMemoryCache(), 100*time.Millisecond)
+	from, _ := url.Parse("http://localhost/foo")
+	to, _ := url.Parse("https://localhost/foo")
+	other, _ := url.Parse("http://localhost/bar")
+	otherHTTPS, _ := url.Parse("https://localhost/bar")
+	r.Allowed(from)
+	r.Redirected(from, to)
+	if r.Allowed(to) {
+		t.Errorf("CrawlingRules#Allowed failed: expected redirect target to be visited")
+	}
+	if !r.Allowed(other) {
+		t.Errorf("CrawlingRules#Allowed failed: expected true got false")
+	}
+	if r.Allowed(otherHTTPS) {
+		t.Errorf("CrawlingRules#Allowed failed: expected false got true")
+	}
+}
+
+func TestCrawlingRulesUnifySchemes(t *testing.T) {
+	serverURL, _ := url.Parse("http://localhost")
+	r := NewCrawlingRules(serverURL, newMemoryCache(), 100*time.Millisecond)
+	httpLink, _ := url.Parse("http://localhost/foo")
+	httpsLink, _ := url.Parse("https://localhost/foo")
+	r.Allowed(httpLink)
+	r.UnifySchemes()
+	// Visited before the schemes were unified
+	if r.Allowed(httpsLink) {
+		t.Errorf("CrawlingRules#Allowed failed: expected the http visit to count")
+	}
+}
+
+func TestRandDelay(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		if delay := randDelay(nil, 100); delay < 50 || delay >= 150 {
+			t.Fatalf("randDelay failed: expected a delay in [50, 150) got %d", delay)
+		}
+	}
+}
+
+func TestCrawlingRulesWithRandomSeed(t *testing.T) {
+	serverURL, _ := url.Parse("http://localhost")
+	delays := func() []time.Duration {
+		r := NewCrawlingRules(serverURL, newMemoryCache(), 100*time.Millisecond, WithRandomSeed(42))
+		var delays []time.Duration
+		for i := 0; i < 10; i++ {
+			delays = append(delays, r.CrawlDelay())
+		}
+		return delays
+	}
+	first, second := delays(), delays()
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("CrawlingRules#CrawlDelay failed: expected %v got %v", first, second)
+	}
+}
+
+func TestCrawlingRulesHostAliases(t *testing.T) {
+	serverURL, _ := url.Parse("https://example.com")
+	r := NewCrawlingRules(serverURL, newMemoryCache(), 100*time.Millisecond,
+		WithHostAliases(HostAliases{"cdn.example.com": "example.com"}))
+	link, _ := url.Parse("https://example.com/foo")
+	alias, _ := url.Parse("https://cdn.example.com/foo")
+	other, _ := url.Parse("https://cdn.example.com/bar")
+	if !r.Allowed(link) {
+		t.Errorf("CrawlingRules#Allowed failed: expected true got false")
+	}
+	if r.Allowed(alias) {
+		t.Errorf("CrawlingRules#Allowed failed: expected the alias visited already")
+	}
+	if !r.Allowed(other) {
+		t.Errorf("CrawlingRules#Allowed failed: expected the alias part of the domain")
+	}
+}
@@ -0,0 +1,40 @@
+// Package crawltest containing synthetic sites served over httptest, to
+// validate the correctness and to measure the throughput of a crawl at a
+// realistic scale
+package crawltest
+
+import (
+	"testing"
+	"time"
+)
+
+// Benchmark runs b.N crawls, each one on a new site generated by a config,
+// reporting the throughput in pages fetched per second. The crawl is a
+// function crawling a site from its root URL till exhausted, the creation
+// of the sites is not timed. Each crawl is verified, the benchmark fails
+// if a site is not crawled correctly.
+func Benchmark(b *testing.B, config SiteConfig, crawl func(root string)) {
+	b.Helper()
+	var (
+		fetched int
+		elapsed time.Duration
+	)
+	b.StopTimer()
+	for i := 0; i < b.N; i++ {
+		site := NewSite(config)
+		b.StartTimer()
+		start := time.Now()
+		crawl(site.URL())
+		elapsed += time.Since(start)
+		b.StopTimer()
+		err := site.Verify()
+		fetched += site.Stats().Fetched
+		site.Close()
+		if err != nil {
+			b.Fatalf("crawl of the synthetic site failed: %v", err)
+		}
+	}
+	if elapsed > 0 {
+		b.ReportMetric(float64(fetched)/elapsed.Seconds(), "pages/s")
+	}
+}
@@ -0,0 +1,274 @@
+// Package crawltest containing synthetic sites served over httptest, to
+// validate the correctness and to measure the throughput of a crawl at a
+// realistic scale
+package crawltest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default shape of a site
+const (
+	defaultPages  int = 100
+	defaultFanOut int = 10
+)
+
+// Paths of the pages, of the ones disallowed by the robots.txt and of the
+// calendar trap
+const (
+	pagePrefix    = "/doc/"
+	privatePrefix = "/private/"
+	trapPrefix    = "/calendar/"
+)
+
+// SiteConfig describes the shape of a synthetic site
+type SiteConfig struct {
+	// Pages is the number of pages of the site, all reachable from the root
+	// one, 100 if zero
+	Pages int
+	// FanOut is the number of links to other pages of each page, 10 if
+	// zero
+	FanOut int
+	// PageSize pads the body of each page with text up to a size in bytes,
+	// to account for the cost of downloading and parsing real pages
+	PageSize int
+	// Latency delays every response of the site
+	Latency time.Duration
+	// Private adds to each page a link to a private page, disallowed by the
+	// robots.txt of the site, a crawl must never fetch them
+	Private bool
+	// CrawlDelay is the Crawl-delay directive of the robots.txt, none if
+	// zero
+	CrawlDelay time.Duration
+	// Traps adds to each page a link to an endless calendar, each day
+	// linking to the next one
+	Traps bool
+}
+
+// Stats counts the requests served by a site
+type Stats struct {
+	// Pages is the number of pages of the site
+	Pages int
+	// Fetched is the number of distinct pages fetched
+	Fetched int
+	// Duplicates is the number of pages fetched more than once
+	Duplicates int
+	// Missing is the number of pages never fetched
+	Missing int
+	// Disallowed is the number of requests to private pages
+	Disallowed int
+	// Traps is the number of requests to calendar pages
+	Traps int
+	// Robots is the number of requests to the robots.txt
+	Robots int
+}
+
+// Site is a synthetic site served by an `httptest.Server`, page i links to
+// the pages i*FanOut+1 to i*FanOut+FanOut, wrapping around, so that every
+// page is reachable from the root one. It records the requests served, to
+// be checked once crawled.
+type Site struct {
+	server   *httptest.Server
+	config   SiteConfig
+	mutex    sync.Mutex
+	requests map[string]int
+}
+
+// NewSite starts serving a synthetic site, it must be closed once done
+func NewSite(config SiteConfig) *Site {
+	if config.Pages <= 0 {
+		config.Pages = defaultPages
+	}
+	if config.FanOut <= 0 {
+		config.FanOut = defaultFanOut
+	}
+	s := &Site{config: config, requests: make(map[string]int)}
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", s.serveRobotsTxt)
+	handler.HandleFunc(pagePrefix, s.servePage)
+	handler.HandleFunc(privatePrefix, s.servePrivate)
+	handler.HandleFunc(trapPrefix, s.serveTrap)
+	s.server = httptest.NewServer(handler)
+	return s
+}
+
+// URL returns the URL of the root page of the site
+func (s *Site) URL() string {
+	return s.server.URL + pagePath(0)
+}
+
+// PageURLs returns the URLs of all the pages of the site, the root first
+func (s *Site) PageURLs() []string {
+	urls := make([]string, s.config.Pages)
+	for i := range urls {
+		urls[i] = s.server.URL + pagePath(i)
+	}
+	return urls
+}
+
+// Close shuts the site down
+func (s *Site) Close() {
+	s.server.Close()
+}
+
+// Stats returns the counts of the requests served so far
+func (s *Site) Stats() Stats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := Stats{Pages: s.config.Pages, Robots: s.requests["/robots.txt"]}
+	for i := 0; i < s.config.Pages; i++ {
+		switch n := s.requests[pagePath(i)]; {
+		case n == 0:
+			stats.Missing++
+		case n > 1:
+			stats.Duplicates++
+			stats.Fetched++
+		default:
+			stats.Fetched++
+		}
+	}
+	for path, n := range s.requests {
+		switch {
+		case strings.HasPrefix(path, privatePrefix):
+			stats.Disallowed += n
+		case strings.HasPrefix(path, trapPrefix):
+			stats.Traps += n
+		}
+	}
+	return stats
+}
+
+// Verify checks that a crawl of the site fetched every page once, never
+// fetching a private page, returning an error for each violation found
+func (s *Site) Verify() error {
+	stats := s.Stats()
+	errs := []error{}
+	if stats.Missing > 0 {
+		errs = append(errs, fmt.Errorf("%d pages of %d never fetched", stats.Missing, stats.Pages))
+	}
+	if stats.Duplicates > 0 {
+		errs = append(errs, fmt.Errorf("%d pages fetched more than once", stats.Duplicates))
+	}
+	if stats.Disallowed > 0 {
+		errs = append(errs, fmt.Errorf("%d requests disallowed by the robots.txt", stats.Disallowed))
+	}
+	return errors.Join(errs...)
+}
+
+// serve records a request and waits for the latency of the site, false if
+// the client went away meanwhile
+func (s *Site) serve(r *http.Request) bool {
+	s.mutex.Lock()
+	s.requests[r.URL.Path]++
+	s.mutex.Unlock()
+	if s.config.Latency <= 0 {
+		return true
+	}
+	timer := time.NewTimer(s.config.Latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (s *Site) serveRobotsTxt(w http.ResponseWriter, r *http.Request) {
+	if !s.serve(r) {
+		return
+	}
+	if !s.config.Private && s.config.CrawlDelay == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	robots := "User-agent: *\n"
+	if s.config.Private {
+		robots += "Disallow: " + privatePrefix + "\n"
+	}
+	if s.config.CrawlDelay > 0 {
+		robots += fmt.Sprintf("Crawl-delay: %g\n", s.config.CrawlDelay.Seconds())
+	}
+	_, _ = w.Write([]byte(robots))
+}
+
+func (s *Site) servePage(w http.ResponseWriter, r *http.Request) {
+	i, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, pagePrefix))
+	if err != nil || i < 0 || i >= s.config.Pages {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.serve(r) {
+		return
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "<html><head><title>Page %d</title></head><body><h1>Page %d</h1>", i, i)
+	for k := 1; k <= s.config.FanOut; k++ {
+		link := (i*s.config.FanOut + k) % s.config.Pages
+		fmt.Fprintf(&body, `<a href="%s">Page %d</a>`, pagePath(link), link)
+	}
+	if s.config.Private {
+		fmt.Fprintf(&body, `<a href="%s%d">Private</a>`, privatePrefix, i)
+	}
+	if s.config.Traps {
+		fmt.Fprintf(&body, `<a href="%s">Calendar</a>`, trapPath(0))
+	}
+	pad(&body, s.config.PageSize)
+	body.WriteString("</body></html>")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(body.String()))
+}
+
+func (s *Site) servePrivate(w http.ResponseWriter, r *http.Request) {
+	if !s.serve(r) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte("<html><body><p>Private</p></body></html>"))
+}
+
+// serveTrap serves a day of an endless calendar, linking to the next one
+func (s *Site) serveTrap(w http.ResponseWriter, r *http.Request) {
+	day, err := time.Parse("2006-01-02", strings.TrimPrefix(r.URL.Path, trapPrefix))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.serve(r) {
+		return
+	}
+	next := day.AddDate(0, 0, 1)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<html><body><a href="%s%s">Next day</a></body></html>`,
+		trapPrefix, next.Format("2006-01-02"))
+}
+
+// pagePath returns the path of the i-th page
+func pagePath(i int) string {
+	return pagePrefix + strconv.Itoa(i)
+}
+
+// trapPath returns the path of a day of the calendar, days from 2000-01-01
+func trapPath(day int) string {
+	return trapPrefix + time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, day).Format("2006-01-02")
+}
+
+// pad appends text to a body up to a size in bytes
+func pad(body *strings.Builder, size int) {
+	const text = "Lorem ipsum dolor sit amet, consectetur adipiscing elit. "
+	if body.Len() >= size {
+		return
+	}
+	body.WriteString("<p>")
+	for body.Len() < size {
+		body.WriteString(text)
+	}
+	body.WriteString("</p>")
+}
@@ -0,0 +1,71 @@
+package crawltest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(body)
+}
+
+func TestSite(t *testing.T) {
+	site := NewSite(SiteConfig{Pages: 5, FanOut: 2, PageSize: 512, Private: true, Traps: true})
+	defer site.Close()
+	code, body := get(t, site.URL())
+	if code != http.StatusOK || len(body) < 512 {
+		t.Fatalf("Site failed: unexpected root page %d %q", code, body)
+	}
+	for _, link := range []string{`href="/doc/1"`, `href="/doc/2"`, `href="/private/0"`, `href="/calendar/2000-01-01"`} {
+		if !strings.Contains(body, link) {
+			t.Errorf("Site failed: expected %s in the root page", link)
+		}
+	}
+	// The links of the last pages wrap around
+	if _, body := get(t, site.PageURLs()[4]); !strings.Contains(body, `href="/doc/4"`) || !strings.Contains(body, `href="/doc/0"`) {
+		t.Errorf("Site failed: expected the links wrapped around got %q", body)
+	}
+	if _, body := get(t, site.server.URL+"/calendar/2000-01-31"); !strings.Contains(body, "/calendar/2000-02-01") {
+		t.Errorf("Site failed: expected a link to the next day got %q", body)
+	}
+	if code, body := get(t, site.server.URL+"/robots.txt"); code != http.StatusOK ||
+		!strings.Contains(body, "Disallow: /private/") {
+		t.Errorf("Site failed: unexpected robots.txt %d %q", code, body)
+	}
+	if code, _ := get(t, site.server.URL+"/doc/5"); code != http.StatusNotFound {
+		t.Errorf("Site failed: expected 404 for a missing page got %d", code)
+	}
+}
+
+func TestSiteVerify(t *testing.T) {
+	site := NewSite(SiteConfig{Pages: 3, FanOut: 1, Private: true})
+	defer site.Close()
+	urls := site.PageURLs()
+	for _, url := range append(urls, urls[0]) {
+		get(t, url)
+	}
+	get(t, site.server.URL+"/private/0")
+	expected := Stats{Pages: 3, Fetched: 3, Duplicates: 1, Disallowed: 1}
+	if stats := site.Stats(); stats != expected {
+		t.Errorf("Site#Stats failed: expected %+v got %+v", expected, stats)
+	}
+	err := site.Verify()
+	if err == nil || !strings.Contains(err.Error(), "1 pages fetched more than once") ||
+		!strings.Contains(err.Error(), "1 requests disallowed") {
+		t.Errorf("Site#Verify failed: unexpected error %v", err)
+	}
+	empty := NewSite(SiteConfig{})
+	defer empty.Close()
+	if err := empty.Verify(); err == nil || !strings.Contains(err.Error(), "100 pages of 100") {
+		t.Errorf("Site#Verify failed: expected every page missing got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package crawler
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/codepr/webcrawler/crawler/crawltest"
+)
+
+// crawlSite crawls a synthetic site till exhausted, discarding the results
+func crawlSite(root string, opts ...CrawlerOpt) {
+	testbus := testQueue{make(chan []byte)}
+	go func() {
+		for range testbus.bus {
+		}
+	}()
+	opts = append([]CrawlerOpt{withCrawlTimeout(50 * time.Millisecond), withPolitenessDelay(0),
+		func(s *CrawlerSettings) {
+			s.Concurrency = 16
+		}}, opts...)
+	crawler := New("test-agent", &testbus, opts...)
+	crawler.Crawl(root)
+	testbus.Close()
+}
+
+func TestCrawlSyntheticSite(t *testing.T) {
+	site := crawltest.NewSite(crawltest.SiteConfig{Pages: 300, FanOut: 5, Private: true, Traps: true})
+	defer site.Close()
+	crawlSite(site.URL())
+	if err := site.Verify(); err != nil {
+		t.Errorf("Crawler#Crawl failed: %v", err)
+	}
+	if stats := site.Stats(); stats.Traps > 0 || stats.Robots != 1 {
+		t.Errorf("Crawler#Crawl failed: unexpected requests %+v", stats)
+	}
+}
+
+func TestCrawlSyntheticSiteSpillingLinks(t *testing.T) {
+	site := crawltest.NewSite(crawltest.SiteConfig{Pages: 300, FanOut: 10})
+	defer site.Close()
+	dir := t.TempDir()
+	crawlSite(site.URL(), func(s *CrawlerSettings) {
+		s.FrontierMemoryLimit = 8
+		s.FrontierSpillDir = dir
+	})
+	if err := site.Verify(); err != nil {
+		t.Errorf("Crawler#Crawl failed: %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Crawler#Crawl failed: expected the spill file removed got %d files", len(files))
+	}
+}
+
+func BenchmarkCrawlSyntheticSite(b *testing.B) {
+	crawltest.Benchmark(b, crawltest.SiteConfig{Pages: 1000, FanOut: 10, PageSize: 8 << 10,
+		Latency: 5 * time.Millisecond}, func(root string) { crawlSite(root) })
+}
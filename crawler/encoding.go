@@ -0,0 +1,302 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+)
+
+// ResultEncoding is the serialization format of the results produced
+type ResultEncoding string
+
+const (
+	// JSONEncoding encodes each result as a JSON object and each batch as a
+	// JSON array, the default
+	JSONEncoding ResultEncoding = "json"
+	// BinaryEncoding encodes the results in a compact binary format, much
+	// cheaper to encode and decode than JSON, meant for in-process queues
+	// with Go consumers decoding them with `DecodeResults`
+	BinaryEncoding ResultEncoding = "binary"
+)
+
+// First byte of the binary encoded payloads, telling them from the JSON ones,
+// followed by the version of the binary format
+const (
+	binaryMagic   byte = 0xb1
+	binaryVersion byte = 1
+)
+
+// validResultEncoding tests if an encoding is supported, empty means JSON
+func validResultEncoding(encoding ResultEncoding) bool {
+	switch encoding {
+	case "", JSONEncoding, BinaryEncoding:
+		return true
+	}
+	return false
+}
+
+// resultEncoding returns the encoding of the results of a type, the binary
+// encoding supports the page results only, the other types are JSON encoded
+func (c *WebCrawler) resultEncoding(resultType ResultType) ResultEncoding {
+	if resultType != PageResult {
+		return JSONEncoding
+	}
+	return c.settings.ResultEncoding
+}
+
+// marshalResult encodes a single result
+func marshalResult(encoding ResultEncoding, result any) ([]byte, error) {
+	if encoding != BinaryEncoding {
+		return json.Marshal(result)
+	}
+	return marshalBatch(encoding, []any{result})
+}
+
+// marshalBatch encodes a batch of results, JSON encoded batches are arrays
+// whatever their size
+func marshalBatch(encoding ResultEncoding, results []any) ([]byte, error) {
+	if encoding != BinaryEncoding {
+		return json.Marshal(results)
+	}
+	buf := []byte{binaryMagic, binaryVersion}
+	buf = binary.AppendUvarint(buf, uint64(len(results)))
+	for _, result := range results {
+		r, ok := result.(ParsedResult)
+		if !ok {
+			return nil, fmt.Errorf("binary encoding of %T not supported", result)
+		}
+		var err error
+		if buf, err = appendBinaryResult(buf, r); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendBinaryResult appends a result in binary format to a buffer, strings
+// are prefixed by their length, numbers are varints. Every field of the
+// result is encoded in order of declaration, the extracted fields are
+// arbitrary values and are JSON encoded, a new field requires a new
+// binaryVersion
+func appendBinaryResult(buf []byte, r ParsedResult) ([]byte, error) {
+	appendString := func(buf []byte, s string) []byte {
+		buf = binary.AppendUvarint(buf, uint64(len(s)))
+		return append(buf, s...)
+	}
+	appendStrings := func(buf []byte, strs []string) []byte {
+		buf = binary.AppendUvarint(buf, uint64(len(strs)))
+		for _, s := range strs {
+			buf = appendString(buf, s)
+		}
+		return buf
+	}
+	buf = appendString(buf, r.URL)
+	buf = appendStrings(buf, r.Links)
+	buf = binary.AppendUvarint(buf, uint64(len(r.LinkClasses)))
+	for _, class := range r.LinkClasses {
+		buf = appendString(buf, string(class))
+	}
+	buf = appendStrings(buf, r.InvalidLinks)
+	buf = appendStrings(buf, r.Assets)
+	for _, d := range []time.Duration{r.Timings.DNS, r.Timings.Connect,
+		r.Timings.TLS, r.Timings.TTFB, r.Timings.Total} {
+		buf = binary.AppendVarint(buf, int64(d))
+	}
+	buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(r.Relevance))
+	buf = binary.AppendUvarint(buf, uint64(len(r.Metadata)))
+	for k, v := range r.Metadata {
+		buf = appendString(buf, k)
+		buf = appendString(buf, v)
+	}
+	buf = binary.AppendVarint(buf, int64(r.Status))
+	buf = binary.AppendUvarint(buf, uint64(len(r.Header)))
+	for k, v := range r.Header {
+		buf = appendString(buf, k)
+		buf = appendStrings(buf, v)
+	}
+	buf = appendStrings(buf, r.Redirects)
+	buf = appendString(buf, r.Excerpt)
+	var extracted []byte
+	if len(r.Extracted) > 0 {
+		var err error
+		if extracted, err = json.Marshal(r.Extracted); err != nil {
+			return nil, err
+		}
+	}
+	buf = appendString(buf, string(extracted))
+	return appendString(buf, r.TraceID), nil
+}
+
+// binaryReader decodes the fields of binary encoded results, the first
+// error stops the decoding
+type binaryReader struct {
+	buf []byte
+	err error
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = errors.New("invalid varint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = errors.New("invalid varint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) string() string {
+	size := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if size > uint64(len(r.buf)) {
+		r.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	s := string(r.buf[:size])
+	r.buf = r.buf[size:]
+	return s
+}
+
+func (r *binaryReader) strings() []string {
+	n := r.uvarint()
+	if r.err != nil || n == 0 {
+		return nil
+	}
+	if n > uint64(len(r.buf)) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	strs := make([]string, n)
+	for i := range strs {
+		strs[i] = r.string()
+	}
+	return strs
+}
+
+func (r *binaryReader) float64() float64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.buf) < 8 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := math.Float64frombits(binary.BigEndian.Uint64(r.buf))
+	r.buf = r.buf[8:]
+	return v
+}
+
+// result decodes a result
+func (r *binaryReader) result() ParsedResult {
+	result := ParsedResult{URL: r.string(), Links: r.strings()}
+	if n := r.uvarint(); n > 0 && r.err == nil {
+		if n > uint64(len(r.buf)) {
+			r.err = io.ErrUnexpectedEOF
+			return result
+		}
+		result.LinkClasses = make([]LinkClass, n)
+		for i := range result.LinkClasses {
+			result.LinkClasses[i] = LinkClass(r.string())
+		}
+	}
+	result.InvalidLinks = r.strings()
+	result.Assets = r.strings()
+	for _, d := range []*time.Duration{&result.Timings.DNS, &result.Timings.Connect,
+		&result.Timings.TLS, &result.Timings.TTFB, &result.Timings.Total} {
+		*d = time.Duration(r.varint())
+	}
+	result.Relevance = r.float64()
+	if n := r.uvarint(); n > 0 && r.err == nil {
+		result.Metadata = make(map[string]string, n)
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			k := r.string()
+			result.Metadata[k] = r.string()
+		}
+	}
+	result.Status = int(r.varint())
+	if n := r.uvarint(); n > 0 && r.err == nil {
+		result.Header = make(http.Header, n)
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			k := r.string()
+			result.Header[k] = r.strings()
+		}
+	}
+	result.Redirects = r.strings()
+	result.Excerpt = r.string()
+	if extracted := r.string(); extracted != "" && r.err == nil {
+		if err := json.Unmarshal([]byte(extracted), &result.Extracted); err != nil {
+			r.err = err
+		}
+	}
+	result.TraceID = r.string()
+	return result
+}
+
+// DecodeResults returns the results of a payload produced by the crawler,
+// whatever its encoding, decompressing it first if needed, see
+// `DecodePayload`. A payload holds a single result unless batches are
+// enabled.
+func DecodeResults(payload []byte) ([]ParsedResult, error) {
+	if len(payload) > 0 && (payload[0] == PayloadPlain || payload[0] == PayloadGzip) {
+		var err error
+		if payload, err = DecodePayload(payload); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case bytes.HasPrefix(payload, []byte{binaryMagic}):
+		if len(payload) < 2 || payload[1] != binaryVersion {
+			return nil, errors.New("decoding results failed: unsupported binary version")
+		}
+		r := &binaryReader{buf: payload[2:]}
+		n := r.uvarint()
+		if r.err == nil && n > uint64(len(r.buf)) {
+			r.err = io.ErrUnexpectedEOF
+		}
+		results := make([]ParsedResult, 0, n)
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			results = append(results, r.result())
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("decoding results failed: %w", r.err)
+		}
+		return results, nil
+	case bytes.HasPrefix(payload, []byte{'['}):
+		var results []ParsedResult
+		if err := json.Unmarshal(payload, &results); err != nil {
+			return nil, fmt.Errorf("decoding results failed: %w", err)
+		}
+		return results, nil
+	default:
+		var result ParsedResult
+		if err := json.Unmarshal(payload, &result); err != nil {
+			return nil, fmt.Errorf("decoding results failed: %w", err)
+		}
+		return []ParsedResult{result}, nil
+	}
+}
@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeResults(t *testing.T) {
+	results := []any{
+		ParsedResult{URL: "https://example.com/a", Links: []string{"https://example.com/b"},
+			Timings: Timings{Total: time.Second}},
+		ParsedResult{URL: "https://example.com/b", Metadata: map[string]string{"label": "b"}},
+	}
+	for _, encoding := range []ResultEncoding{JSONEncoding, BinaryEncoding} {
+		for _, batch := range [][]any{results[:1], results} {
+			payload, err := marshalBatch(encoding, batch)
+			if err != nil {
+				t.Fatalf("marshalBatch failed: %v", err)
+			}
+			if encoding == JSONEncoding && payload[0] != '[' {
+				t.Errorf("marshalBatch failed: expected a JSON array got %s", payload)
+			}
+			compressed, _ := encodePayload(payload, 1)
+			for _, p := range [][]byte{payload, compressed} {
+				decoded, err := DecodeResults(p)
+				if err != nil {
+					t.Fatalf("DecodeResults failed: %s %v", encoding, err)
+				}
+				if len(decoded) != len(batch) {
+					t.Fatalf("DecodeResults failed: expected %d results got %d", len(batch), len(decoded))
+				}
+				for i := range decoded {
+					expected := batch[i].(ParsedResult)
+					if !reflect.DeepEqual(decoded[i], expected) {
+						t.Errorf("DecodeResults failed: %s expected %v got %v", encoding, expected, decoded[i])
+					}
+				}
+			}
+		}
+	}
+	if _, err := DecodeResults([]byte("garbage")); err == nil {
+		t.Error("DecodeResults failed: expected error")
+	}
+}
+
+func TestBinaryEncodingRoundTrip(t *testing.T) {
+	result := ParsedResult{
+		URL:          "https://example.com/a",
+		Links:        []string{"https://example.com/b", "https://docs.example.com/", "https://other.com/"},
+		LinkClasses:  []LinkClass{InternalLink, SubdomainLink, ExternalLink},
+		InvalidLinks: []string{"http://[::1"},
+		Assets:       []string{"https://example.com/logo.png"},
+		Timings: Timings{DNS: time.Millisecond, Connect: 2 * time.Millisecond,
+			TLS: 3 * time.Millisecond, TTFB: 4 * time.Millisecond, Total: time.Second},
+		Relevance: 0.5,
+		Metadata:  map[string]string{"label": "a"},
+		Status:    200,
+		Header:    http.Header{"Content-Type": {"text/html"}, "Set-Cookie": {"a=1", "b=2"}},
+		Redirects: []string{"http://example.com/a"},
+		Excerpt:   "Example page",
+		Extracted: map[string]any{"title": "Example", "price": 9.99, "tags": []any{"a", "b"}},
+		TraceID:   "0123456789abcdef",
+	}
+	// Every field must be populated, so that a new one not carried by the
+	// binary encoding fails the round trip
+	v := reflect.ValueOf(result)
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			t.Fatalf("BinaryEncoding failed: field %s not populated", v.Type().Field(i).Name)
+		}
+	}
+	payload, err := marshalResult(BinaryEncoding, result)
+	if err != nil {
+		t.Fatalf("marshalResult failed: %v", err)
+	}
+	decoded, err := DecodeResults(payload)
+	if err != nil {
+		t.Fatalf("DecodeResults failed: %v", err)
+	}
+	if len(decoded) != 1 || !reflect.DeepEqual(decoded[0], result) {
+		t.Errorf("BinaryEncoding failed: expected %v got %v", result, decoded)
+	}
+	payload[1] = binaryVersion + 1
+	if _, err := DecodeResults(payload); err == nil {
+		t.Error("DecodeResults failed: expected error on unknown version")
+	}
+}
+
+func TestCrawlPagesBinaryEncoded(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() {
+		res := []ParsedResult{}
+		for e := range testbus.bus {
+			decoded, err := DecodeResults(e)
+			if err != nil {
+				t.Errorf("DecodeResults failed: %v", err)
+			}
+			res = append(res, decoded...)
+		}
+		results <- res
+	}()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.ResultEncoding = BinaryEncoding })
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	if res := <-results; len(res) != 3 {
+		t.Errorf("Crawler#Crawl failed: expected 3 results got %v", res)
+	}
+}
+
+func TestCrawlHeadersOnlyBinaryEncoded(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/", resourceMock(`<a href="/old">`))
+	handler.HandleFunc("/new", resourceMock(``))
+	handler.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() {
+		res := []ParsedResult{}
+		for e := range testbus.bus {
+			decoded, err := DecodeResults(e)
+			if err != nil {
+				t.Errorf("DecodeResults failed: %v", err)
+			}
+			res = append(res, decoded...)
+		}
+		results <- res
+	}()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.HeadersOnly = true
+			s.ResultEncoding = BinaryEncoding
+		})
+	crawler.Crawl(server.URL + "/")
+	testbus.Close()
+	var old ParsedResult
+	for _, res := range <-results {
+		if res.URL == server.URL+"/old" {
+			old = res
+		}
+	}
+	if old.Status != http.StatusOK || old.Header.Get("Date") == "" ||
+		!reflect.DeepEqual(old.Redirects, []string{server.URL + "/old"}) {
+		t.Errorf("Crawler#Crawl failed: expected status, headers and redirects got %v", old)
+	}
+}
+
+func benchmarkEncoding(b *testing.B, encoding ResultEncoding) {
+	result := ParsedResult{URL: "https://example.com/", Timings: Timings{Total: time.Second}}
+	for i := 0; i < 50; i++ {
+		result.Links = append(result.Links, "https://example.com/item/"+string(rune('a'+i%26)))
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		payload, _ := marshalResult(encoding, result)
+		if _, err := DecodeResults(payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONEncoding(b *testing.B) { benchmarkEncoding(b, JSONEncoding) }
+
+func BenchmarkBinaryEncoding(b *testing.B) { benchmarkEncoding(b, BinaryEncoding) }
@@ -0,0 +1,116 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType defines the kind of lifecycle event of a crawl
+type EventType int
+
+const (
+	// CrawlStarted is published when a crawl starts, before any fetch
+	CrawlStarted EventType = iota
+	// HostDiscovered is published the first time a host is met during a
+	// crawl, as a seed or in the links of a page
+	HostDiscovered
+	// PageFetched is published after every fetch, Err is set if it failed
+	PageFetched
+	// PageSkipped is published for every link refused by the crawl rules,
+	// with the reason
+	PageSkipped
+	// HostExhausted is published when the crawl of a host ends
+	HostExhausted
+	// CrawlFinished is published when every host has been crawled
+	CrawlFinished
+)
+
+func (t EventType) String() string {
+	switch t {
+	case CrawlStarted:
+		return "CrawlStarted"
+	case HostDiscovered:
+		return "HostDiscovered"
+	case PageFetched:
+		return "PageFetched"
+	case PageSkipped:
+		return "PageSkipped"
+	case HostExhausted:
+		return "HostExhausted"
+	case CrawlFinished:
+		return "CrawlFinished"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event is a lifecycle event of a crawl, the fields set depend on its type
+type Event struct {
+	Type EventType
+	// Time is the moment the event occurred
+	Time time.Time
+	// Host is the host the event refers to, empty for CrawlStarted and
+	// CrawlFinished
+	Host string
+	// URL is the page fetched or skipped
+	URL string
+	// Depth is the distance of the page from the root URL
+	Depth int
+	// Timings of the fetch of a PageFetched event
+	Timings Timings
+	// Err is the error of a failed fetch
+	Err error
+	// Reason tells why the page of a PageSkipped event was skipped
+	Reason SkipReason
+	// TraceID identifies the fetch of a PageFetched event, or of the page
+	// redirected of a PageSkipped one, the same of its logs and its result
+	TraceID string
+}
+
+// Subscriber receives the lifecycle events of the crawls, it's called
+// synchronously from the crawling goroutines, so it must be thread-safe
+// and fast, slow work should be moved to another goroutine
+type Subscriber func(Event)
+
+// eventBus dispatches the events published to every subscriber registered
+type eventBus struct {
+	mutex       sync.RWMutex
+	subscribers []Subscriber
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{}
+}
+
+// Subscribe registers a new subscriber
+func (b *eventBus) Subscribe(subscriber Subscriber) {
+	b.mutex.Lock()
+	b.subscribers = append(b.subscribers, subscriber)
+	b.mutex.Unlock()
+}
+
+// Publish delivers an event to every subscriber, setting its time
+func (b *eventBus) Publish(event Event) {
+	event.Time = time.Now()
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for _, subscriber := range b.subscribers {
+		subscriber(event)
+	}
+}
+
+// Subscribe registers a subscriber to the lifecycle events of the crawls,
+// e.g. to collect metrics or to report progress
+func (c *WebCrawler) Subscribe(subscriber Subscriber) {
+	c.events.Subscribe(subscriber)
+}
+
+// discover publishes a HostDiscovered event the first time a host is met
+// during a crawl
+func (c *WebCrawler) discover(run *crawlRun, host string) {
+	if _, seen := run.hosts.LoadOrStore(host, struct{}{}); !seen {
+		c.events.Publish(Event{Type: HostDiscovered, Host: host})
+	}
+}
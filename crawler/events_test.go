@@ -0,0 +1,48 @@
+package crawler
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCrawlEvents(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0))
+	var (
+		mutex  sync.Mutex
+		events []Event
+	)
+	crawler.Subscribe(func(e Event) {
+		mutex.Lock()
+		events = append(events, e)
+		mutex.Unlock()
+	})
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	<-results
+	if len(events) < 2 || events[0].Type != CrawlStarted || events[len(events)-1].Type != CrawlFinished {
+		t.Fatalf("Crawler#Subscribe failed: unexpected events %v", events)
+	}
+	counts := map[EventType]int{}
+	discovered := map[string]bool{}
+	for _, e := range events {
+		counts[e.Type]++
+		if e.Type == HostDiscovered {
+			discovered[e.Host] = true
+		}
+	}
+	host, _ := url.Parse(server.URL)
+	if counts[PageFetched] != 3 || counts[PageSkipped] == 0 || counts[HostExhausted] != 1 {
+		t.Errorf("Crawler#Subscribe failed: unexpected event counts %v", counts)
+	}
+	if !discovered[host.Host] || !discovered["example-page.com"] || counts[HostDiscovered] != len(discovered) {
+		t.Errorf("Crawler#Subscribe failed: unexpected hosts discovered %v", discovered)
+	}
+}
@@ -0,0 +1,82 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/temoto/robotstxt"
+)
+
+// Explanation tells if an URL would be crawled and why
+type Explanation struct {
+	// URL is the URL explained
+	URL string
+	// Allowed is true if the URL would be crawled
+	Allowed bool
+	// Reasons lists every rule refusing the URL, empty if allowed
+	Reasons []string
+}
+
+// ExplainURL evaluates the rules the crawler would apply to an URL, without
+// running a crawl, reporting all the ones refusing it. The URL is treated as
+// the root of its domain, a custom `RulesEngine` is not evaluated as its
+// state could change. Returns an error if the URL is invalid.
+func (c *WebCrawler) ExplainURL(rawURL string) (*Explanation, error) {
+	link, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("explaining %s failed: %w", rawURL, err)
+	}
+	if link.Scheme == "" || link.Host == "" {
+		return nil, fmt.Errorf("explaining %s failed: absolute URL required", rawURL)
+	}
+	reasons := []string{}
+	if !c.hostAllowed(link.Hostname()) {
+		reasons = append(reasons, "host not allowed by AllowedHosts and BlockedHosts")
+	}
+	if scope := c.Reloadable().Scope; scope != nil && !scope.Allowed(link, 0) {
+		reasons = append(reasons, "out of scope")
+	}
+	if c.settings.URLLimits.Exceeded(link) {
+		reasons = append(reasons, "exceeds URLLimits")
+	}
+	traps := newTrapDetector(c.settings.TrapPatterns, c.settings.MaxRepeatedSegments)
+	if traps.IsTrap(link) {
+		for name := range traps.Suppressed() {
+			reasons = append(reasons, "crawler trap: "+name)
+		}
+	}
+	if c.settings.RulesEngine == nil && !c.settings.IgnoreRobotsTxt {
+		allowed, err := c.robotsAllowed(link)
+		if err != nil {
+			c.logger.With("host", link.Host).Warn("Robots.txt check failed", "url", link, "err", err)
+		} else if !allowed {
+			reasons = append(reasons, "disallowed by robots.txt")
+		}
+	}
+	return &Explanation{URL: link.String(), Allowed: len(reasons) == 0, Reasons: reasons}, nil
+}
+
+// robotsAllowed fetches the robots.txt of the domain of a link and checks
+// the link against it the same way the crawler does, a missing or
+// unreachable robots.txt allows anything
+func (c *WebCrawler) robotsAllowed(link *url.URL) (bool, error) {
+	robotsURL := link.ResolveReference(&url.URL{Path: robotsTxtPath})
+	_, res, err := c.linkFetcher.Fetch(robotsURL.String())
+	if err != nil {
+		return true, nil
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return true, fmt.Errorf("reading %s failed: %w", robotsURL, err)
+	}
+	data, err := robotstxt.FromStatusAndBytes(res.StatusCode, body)
+	if err != nil {
+		return true, nil
+	}
+	userAgent := c.settings.UserAgents.For(link.Hostname(), c.settings.UserAgent)
+	return data.FindGroup(userAgent).Test(link.RequestURI()), nil
+}
@@ -0,0 +1,62 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestExplainURL(t *testing.T) {
+	server := serverMockWithRobotsTxt()
+	defer server.Close()
+	crawler := New("test-agent", &testQueue{}, func(s *CrawlerSettings) {
+		s.BlockedHosts = []string{"blocked.localhost"}
+	})
+	testCases := []struct {
+		url     string
+		reasons []string
+	}{
+		{server.URL + "/foo/bar/baz", []string{}},
+		{server.URL + "/foo/bar/test", []string{"disallowed by robots.txt"}},
+		{server.URL + "/a/b/a/b/a/b", []string{"crawler trap: repeating /a/b"}},
+		{"http://blocked.localhost:1/foo", []string{"host not allowed by AllowedHosts and BlockedHosts"}},
+	}
+	for _, tc := range testCases {
+		explanation, err := crawler.ExplainURL(tc.url)
+		if err != nil {
+			t.Fatalf("Crawler#ExplainURL failed: %v", err)
+		}
+		if explanation.Allowed != (len(tc.reasons) == 0) ||
+			!reflect.DeepEqual(explanation.Reasons, tc.reasons) {
+			t.Errorf("Crawler#ExplainURL(%s) failed: expected %v got %v",
+				tc.url, tc.reasons, explanation.Reasons)
+		}
+	}
+	if _, err := crawler.ExplainURL("/relative"); err == nil {
+		t.Errorf("Crawler#ExplainURL failed: expected error on relative URL")
+	}
+}
+
+func TestExplainURLRobotsTxtUnavailable(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	explanation, err := New("test-agent", &testQueue{}).ExplainURL(server.URL + "/foo")
+	if err != nil {
+		t.Fatalf("Crawler#ExplainURL failed: %v", err)
+	}
+	// The verdict is the one of the rules followed while crawling
+	serverURL, _ := url.Parse(server.URL)
+	rules := NewCrawlingRules(serverURL, newMemoryCache(), 0)
+	rules.GetRobotsTxtGroup(f, "test-agent", serverURL)
+	link, _ := url.Parse(server.URL + "/foo")
+	if allowed := rules.Allowed(link); explanation.Allowed != allowed {
+		t.Errorf("Crawler#ExplainURL failed: expected allowed %v got %v",
+			allowed, explanation.Reasons)
+	}
+}
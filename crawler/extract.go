@@ -0,0 +1,93 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import "context"
+
+// Extractor scrapes domain-specific data from the pages crawled, e.g. the
+// prices of a catalog or the schema.org entities of an article. It's called
+// with the URL, the content type and the body of every page downloaded, the
+// fields returned are merged in the `Extracted` map of its result.
+// Extractors are called concurrently and must not retain the body, it's
+// reused once the page is parsed. They need the body apart from the parsed
+// page, a crawl with extractors fails if the fetcher downloads and parses
+// the pages at once.
+type Extractor interface {
+	Extract(url, contentType string, body []byte) (map[string]any, error)
+}
+
+// ExtractorFunc is an adapter to use a function as an `Extractor`
+type ExtractorFunc func(url, contentType string, body []byte) (map[string]any, error)
+
+// Extract calls f(url, contentType, body)
+func (f ExtractorFunc) Extract(url, contentType string, body []byte) (map[string]any, error) {
+	return f(url, contentType, body)
+}
+
+// contextExtractor is implemented by the extractors able to abort an
+// extraction once a context is done, the crawl aborts them on shutdown
+type contextExtractor interface {
+	ExtractContext(ctx context.Context,
+		url, contentType string, body []byte) (map[string]any, error)
+}
+
+// crawlExtractor is implemented by the extractors holding resources while
+// crawls run them, e.g. the runtime of a `WASMExtractor`, acquired at the
+// start of every crawl and released at its end
+type crawlExtractor interface {
+	Acquire()
+	Release(context.Context) error
+}
+
+// acquireExtractors marks the start of a crawl to the extractors holding
+// resources, returning the function releasing them at its end
+func (c *WebCrawler) acquireExtractors() func() {
+	var acquired []crawlExtractor
+	for _, extractor := range c.settings.Extractors {
+		if e, ok := extractor.(crawlExtractor); ok {
+			e.Acquire()
+			acquired = append(acquired, e)
+		}
+	}
+	return func() {
+		for _, e := range acquired {
+			if err := e.Release(context.Background()); err != nil {
+				c.logger.Warn("Extractor release failed", "err", err)
+			}
+		}
+	}
+}
+
+// extract runs the extractors on a page downloaded, merging their fields in
+// order, the latter extractors overwriting the fields of the former ones.
+// The extractors failing are logged and skipped, nil if no field is
+// extracted. The body must not be released yet.
+func (c *WebCrawler) extract(h *hostCrawl, job *fetchedPage) map[string]any {
+	if len(c.settings.Extractors) == 0 || job.raw == nil || !job.raw.HasBody() {
+		return nil
+	}
+	var extracted map[string]any
+	link, contentType, body := job.link.String(), job.raw.ContentType, job.raw.Bytes()
+	for i, extractor := range c.settings.Extractors {
+		var (
+			fields map[string]any
+			err    error
+		)
+		if e, ok := extractor.(contextExtractor); ok {
+			fields, err = e.ExtractContext(h.work, link, contentType, body)
+		} else {
+			fields, err = extractor.Extract(link, contentType, body)
+		}
+		if err != nil {
+			job.logger.Warn("Extraction failed", "url", job.link, "extractor", i, "err", err)
+			continue
+		}
+		for k, v := range fields {
+			if extracted == nil {
+				extracted = make(map[string]any, len(fields))
+			}
+			extracted[k] = v
+		}
+	}
+	return extracted
+}
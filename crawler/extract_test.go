@@ -0,0 +1,62 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrawlPagesWithExtractors(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/foo", resourceMock(`<head><title>Foo</title></head><body><a href="/bar">bar</a></body>`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	title := ExtractorFunc(func(url, contentType string, body []byte) (map[string]any, error) {
+		start, end := strings.Index(string(body), "<title>"), strings.Index(string(body), "</title>")
+		return map[string]any{"title": string(body[start+len("<title>") : end]), "source": "title"}, nil
+	})
+	failing := ExtractorFunc(func(url, contentType string, body []byte) (map[string]any, error) {
+		return nil, errors.New("no price")
+	})
+	size := ExtractorFunc(func(url, contentType string, body []byte) (map[string]any, error) {
+		return map[string]any{"size": len(body), "source": "size"}, nil
+	})
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.Extractors = []Extractor{title, failing, size}
+		})
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	res := <-results
+	// Numbers are decoded as float64 from JSON
+	expected := map[string]any{"title": "Foo", "size": float64(66), "source": "size"}
+	if len(res) != 1 || !reflect.DeepEqual(res[0].Extracted, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, res)
+	}
+}
+
+func TestCrawlWithExtractorsFailsWithoutRawPages(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	title := ExtractorFunc(func(url, contentType string, body []byte) (map[string]any, error) {
+		return map[string]any{"title": "Foo"}, nil
+	})
+	crawler := New("test-agent", &testQueue{make(chan []byte, 16)},
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0),
+		func(s *CrawlerSettings) {
+			s.Extractors = []Extractor{title}
+		})
+	crawler.linkFetcher = linkFetcherOnly{crawler.linkFetcher}
+	if err := crawler.CrawlSeedsContext(context.Background(), Seed{URL: server.URL + "/foo"}); err == nil {
+		t.Errorf("Crawler#CrawlSeedsContext failed: expected error with extractors and no raw pages")
+	}
+}
@@ -0,0 +1,317 @@
+// Package fetcher defines and implement the downloading and parsing utilities
+// for remote resources
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// IPPreference selects the IP versions used to connect to the servers
+type IPPreference int
+
+const (
+	// DualStack connects over IPv4 and IPv6 in the order of the resolver
+	DualStack IPPreference = iota
+	// PreferIPv4 tries the IPv4 addresses of a host first
+	PreferIPv4
+	// PreferIPv6 tries the IPv6 addresses of a host first
+	PreferIPv6
+	// IPv4Only connects over IPv4 only
+	IPv4Only
+	// IPv6Only connects over IPv6 only
+	IPv6Only
+)
+
+var ipPreferenceNames = map[IPPreference]string{
+	DualStack:  "dual",
+	PreferIPv4: "prefer-ipv4",
+	PreferIPv6: "prefer-ipv6",
+	IPv4Only:   "ipv4",
+	IPv6Only:   "ipv6",
+}
+
+func (p IPPreference) String() string {
+	if name, ok := ipPreferenceNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("IPPreference(%d)", int(p))
+}
+
+// ParseIPPreference returns an IP preference by its name, one of "dual",
+// "prefer-ipv4", "prefer-ipv6", "ipv4" and "ipv6", an empty name is "dual"
+func ParseIPPreference(name string) (IPPreference, error) {
+	if name == "" {
+		return DualStack, nil
+	}
+	for p, n := range ipPreferenceNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return DualStack, fmt.Errorf("unknown IP preference %q", name)
+}
+
+// Default time to wait for a connection on the first family of a host
+// before racing the other one
+const defaultFallbackDelay time.Duration = 300 * time.Millisecond
+
+// DialerOptions configures the connections to the servers, for dual-stack
+// environments and multi-IP egress setups
+type DialerOptions struct {
+	// IPPreference selects the IP versions used, DualStack by default
+	IPPreference IPPreference
+	// FallbackDelay is the time to wait for a connection on the preferred
+	// family of a host before racing the other one, as in happy eyeballs
+	// (RFC 6555). 300ms if zero, negative disables the race, the addresses
+	// are tried one at a time
+	FallbackDelay time.Duration
+	// SourceIPs are the local addresses the connections are made from, the
+	// first one of the family of each server is used
+	SourceIPs []net.IP
+	// Interface binds the connections to the addresses of a network
+	// interface, e.g. eth1, instead of SourceIPs
+	Interface string
+}
+
+// IsZero tests if the options are the default ones
+func (o DialerOptions) IsZero() bool {
+	return o.IPPreference == DualStack && o.FallbackDelay == 0 &&
+		len(o.SourceIPs) == 0 && o.Interface == ""
+}
+
+// dialer connects to the addresses of a host in the order and from the
+// source addresses set by its options
+type dialer struct {
+	base    net.Dialer
+	options DialerOptions
+}
+
+func newDialer(options DialerOptions) *dialer {
+	return &dialer{
+		base:    net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		options: options,
+	}
+}
+
+// lookupFunc resolves a host into its addresses
+type lookupFunc func(context.Context, string) ([]string, error)
+
+// DialContext connects to an address, its host is resolved by lookup
+func (d *dialer) DialContext(ctx context.Context, network, address string, lookup lookupFunc) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return d.base.DialContext(ctx, network, address)
+	}
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		if addrs, err = lookup(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+	ips := d.order(addrs)
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address", Name: host, IsNotFound: true}
+	}
+	primaries, fallbacks := splitFamilies(ips)
+	if len(fallbacks) == 0 || d.options.FallbackDelay < 0 {
+		return d.dialSerial(ctx, network, append(primaries, fallbacks...), port)
+	}
+	return d.dialParallel(ctx, network, primaries, fallbacks, port)
+}
+
+// order returns the addresses of the IP versions allowed, the ones of the
+// preferred version first
+func (d *dialer) order(addrs []string) []net.IP {
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		switch d.options.IPPreference {
+		case IPv4Only:
+			if ip.To4() == nil {
+				continue
+			}
+		case IPv6Only:
+			if ip.To4() != nil {
+				continue
+			}
+		}
+		ips = append(ips, ip)
+	}
+	switch d.options.IPPreference {
+	case PreferIPv4:
+		sort.SliceStable(ips, func(i, j int) bool { return ips[i].To4() != nil && ips[j].To4() == nil })
+	case PreferIPv6:
+		sort.SliceStable(ips, func(i, j int) bool { return ips[i].To4() == nil && ips[j].To4() != nil })
+	}
+	return ips
+}
+
+// splitFamilies splits the addresses in the ones of the family of the first
+// one and the others
+func splitFamilies(ips []net.IP) (primaries, fallbacks []net.IP) {
+	ipv4 := ips[0].To4() != nil
+	for _, ip := range ips {
+		if (ip.To4() != nil) == ipv4 {
+			primaries = append(primaries, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+	return primaries, fallbacks
+}
+
+// dialSerial tries the addresses in order, returning the first connection
+// established
+func (d *dialer) dialSerial(ctx context.Context, network string, ips []net.IP, port string) (net.Conn, error) {
+	errs := []error{}
+	for _, ip := range ips {
+		dialer := d.base
+		local, err := d.localAddr(ip)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if local != nil {
+			dialer.LocalAddr = local
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// dialParallel races the addresses of the two families, the fallback ones
+// start after the fallback delay or as soon as the primary ones fail, the
+// first connection established wins and the other is closed
+func (d *dialer) dialParallel(ctx context.Context, network string, primaries, fallbacks []net.IP, port string) (net.Conn, error) {
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	returned := make(chan struct{})
+	defer close(returned)
+	results := make(chan dialResult)
+	race := func(ips []net.IP) {
+		conn, err := d.dialSerial(ctx, network, ips, port)
+		select {
+		case results <- dialResult{conn, err}:
+		case <-returned:
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+	delay := d.options.FallbackDelay
+	if delay == 0 {
+		delay = defaultFallbackDelay
+	}
+	fallback := time.NewTimer(delay)
+	defer fallback.Stop()
+	pending := 1
+	go race(primaries)
+	startFallback := func() {
+		if fallbacks != nil {
+			pending++
+			go race(fallbacks)
+			fallbacks = nil
+		}
+	}
+	errs := []error{}
+	for {
+		select {
+		case <-fallback.C:
+			startFallback()
+		case res := <-results:
+			if res.err == nil {
+				return res.conn, nil
+			}
+			errs = append(errs, res.err)
+			pending--
+			startFallback()
+			if pending == 0 {
+				return nil, errors.Join(errs...)
+			}
+		}
+	}
+}
+
+// localAddr returns the source address of a connection to an IP, the first
+// one of its family among the source IPs or the addresses of the interface,
+// nil if none is set
+func (d *dialer) localAddr(ip net.IP) (net.Addr, error) {
+	sources := d.options.SourceIPs
+	if d.options.Interface != "" {
+		var err error
+		if sources, err = interfaceIPs(d.options.Interface); err != nil {
+			return nil, err
+		}
+	} else if len(sources) == 0 {
+		return nil, nil
+	}
+	for _, source := range sources {
+		if (source.To4() != nil) == (ip.To4() != nil) {
+			return &net.TCPAddr{IP: source}, nil
+		}
+	}
+	return nil, fmt.Errorf("no source address to connect to %s", ip)
+}
+
+// interfaceIPs returns the addresses of a network interface, link-local
+// ones excluded as they can't reach the servers
+func interfaceIPs(name string) ([]net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("binding to interface %s failed: %w", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("binding to interface %s failed: %w", name, err)
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if prefix, ok := addr.(*net.IPNet); ok && !prefix.IP.IsLinkLocalUnicast() {
+			ips = append(ips, prefix.IP)
+		}
+	}
+	return ips, nil
+}
+
+// WithDialer sets how the connections to the servers are established, the
+// IP versions, the happy eyeballs race and the source addresses
+func WithDialer(options DialerOptions) Option {
+	return func(f *stdHttpFetcher) {
+		f.dialer = newDialer(options)
+	}
+}
+
+// dialContext returns the dial function of the transport, resolving the
+// hosts through the DNS cache if enabled
+func (f stdHttpFetcher) dialContext() func(context.Context, string, string) (net.Conn, error) {
+	d := f.dialer
+	if d == nil {
+		d = newDialer(DialerOptions{})
+	}
+	lookup := net.DefaultResolver.LookupHost
+	if f.dns != nil {
+		lookup = f.dns.Lookup
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		return d.DialContext(ctx, network, address, lookup)
+	}
+}
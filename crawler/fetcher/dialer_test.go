@@ -0,0 +1,95 @@
+package fetcher
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIPPreference(t *testing.T) {
+	for name, expected := range map[string]IPPreference{
+		"":            DualStack,
+		"dual":        DualStack,
+		"prefer-ipv4": PreferIPv4,
+		"prefer-ipv6": PreferIPv6,
+		"ipv4":        IPv4Only,
+		"ipv6":        IPv6Only,
+	} {
+		if p, err := ParseIPPreference(name); err != nil || p != expected {
+			t.Errorf("ParseIPPreference failed: expected %s for %q got %s, %v", expected, name, p, err)
+		}
+	}
+	if _, err := ParseIPPreference("ipv5"); err == nil {
+		t.Errorf("ParseIPPreference failed: expected an error got nil")
+	}
+}
+
+func TestDialerOrder(t *testing.T) {
+	addrs := []string{"::1", "10.0.0.1", "2001:db8::1", "127.0.0.1"}
+	for preference, expected := range map[IPPreference][]string{
+		DualStack:  {"::1", "10.0.0.1", "2001:db8::1", "127.0.0.1"},
+		PreferIPv4: {"10.0.0.1", "127.0.0.1", "::1", "2001:db8::1"},
+		PreferIPv6: {"::1", "2001:db8::1", "10.0.0.1", "127.0.0.1"},
+		IPv4Only:   {"10.0.0.1", "127.0.0.1"},
+		IPv6Only:   {"::1", "2001:db8::1"},
+	} {
+		d := newDialer(DialerOptions{IPPreference: preference})
+		got := []string{}
+		for _, ip := range d.order(addrs) {
+			got = append(got, ip.String())
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("dialer#order failed: expected %v for %s got %v", expected, preference, got)
+		}
+	}
+}
+
+func TestDialerFallback(t *testing.T) {
+	server := serverMock()
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	// The server listens on IPv4 only, the IPv6 address is refused and the
+	// IPv4 one is raced right away
+	lookup := func(context.Context, string) ([]string, error) {
+		return []string{"::1", "127.0.0.1"}, nil
+	}
+	address := net.JoinHostPort("localhost", serverURL.Port())
+	for _, options := range []DialerOptions{
+		{IPPreference: PreferIPv6},
+		{IPPreference: PreferIPv6, FallbackDelay: -1},
+		{IPPreference: IPv4Only, SourceIPs: []net.IP{net.ParseIP("127.0.0.1")}},
+	} {
+		conn, err := newDialer(options).DialContext(context.Background(), "tcp", address, lookup)
+		if err != nil {
+			t.Errorf("dialer#DialContext failed: %v with %+v", err, options)
+			continue
+		}
+		if local := conn.LocalAddr().(*net.TCPAddr); !local.IP.Equal(net.ParseIP("127.0.0.1")) {
+			t.Errorf("dialer#DialContext failed: expected a connection from 127.0.0.1 got %s", local)
+		}
+		conn.Close()
+	}
+	d := newDialer(DialerOptions{SourceIPs: []net.IP{net.ParseIP("127.0.0.1")}, IPPreference: IPv6Only})
+	if _, err := d.DialContext(context.Background(), "tcp", address, lookup); err == nil ||
+		!strings.Contains(err.Error(), "no source address") {
+		t.Errorf("dialer#DialContext failed: expected no source address got %v", err)
+	}
+}
+
+func TestFetchWithDialer(t *testing.T) {
+	server := serverMock()
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"), WithDialer(DialerOptions{IPPreference: IPv4Only}))
+	target := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/foo/bar"
+	_, res, err := f.Fetch(target)
+	if err != nil {
+		t.Fatalf("StdHttpFetcher#Fetch failed: %v", err)
+	}
+	res.Body.Close()
+	if _, _, err := New(WithDialer(DialerOptions{Interface: "nonexistent0"})).Fetch(target); err == nil {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected an error binding to a missing interface got nil")
+	}
+}
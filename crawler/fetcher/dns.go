@@ -0,0 +1,113 @@
+// Package fetcher defines and implement the fetching and parsing utilities
+// for remote resources
+package fetcher
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsEntry is the resolution of a host, ready is closed once it's done
+type dnsEntry struct {
+	addrs   []string
+	err     error
+	expires time.Time
+	ready   chan struct{}
+}
+
+// dnsCache resolves hosts ahead of the requests and caches the addresses
+// found for a time, so that the first request to a host doesn't pay the
+// resolution latency. Concurrent resolutions of the same host are merged.
+type dnsCache struct {
+	resolver *net.Resolver
+	ttl      time.Duration
+	mutex    sync.Mutex
+	entries  map[string]*dnsEntry
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		resolver: net.DefaultResolver,
+		ttl:      ttl,
+		entries:  make(map[string]*dnsEntry),
+	}
+}
+
+// Prefetch resolves a host in background, if not already cached
+func (c *dnsCache) Prefetch(host string) {
+	if host == "" || net.ParseIP(host) != nil {
+		return
+	}
+	if entry, resolve := c.entry(host); resolve {
+		go c.resolve(host, entry)
+	}
+}
+
+// Lookup returns the addresses of a host, waiting for a resolution in
+// progress or starting a new one if not cached or expired
+func (c *dnsCache) Lookup(ctx context.Context, host string) ([]string, error) {
+	entry, resolve := c.entry(host)
+	if resolve {
+		c.resolve(host, entry)
+	}
+	select {
+	case <-entry.ready:
+		return entry.addrs, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// entry returns the cache entry of a host, true if it's new and must be
+// resolved by the caller
+func (c *dnsCache) entry(host string) (*dnsEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[host]
+	if ok {
+		select {
+		case <-entry.ready:
+			if time.Now().Before(entry.expires) {
+				return entry, false
+			}
+		default:
+			// Resolution in progress
+			return entry, false
+		}
+	}
+	entry = &dnsEntry{ready: make(chan struct{})}
+	c.entries[host] = entry
+	return entry, true
+}
+
+// resolve looks a host up filling its entry, failed resolutions are not
+// cached
+func (c *dnsCache) resolve(host string, entry *dnsEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	entry.addrs, entry.err = c.resolver.LookupHost(ctx, host)
+	entry.expires = time.Now().Add(c.ttl)
+	if entry.err != nil {
+		entry.expires = time.Now()
+	}
+	close(entry.ready)
+}
+
+// WithDNSCache enables the caching of the resolutions of the hosts for a
+// time, hosts can be resolved ahead of the requests with PrefetchDNS. The DNS
+// timings are not recorded as the resolution is not part of the requests.
+func WithDNSCache(ttl time.Duration) Option {
+	return func(f *stdHttpFetcher) {
+		f.dns = newDNSCache(ttl)
+	}
+}
+
+// PrefetchDNS resolves a host in background, ahead of the first request to
+// it, no-op if the DNS cache is not enabled
+func (f stdHttpFetcher) PrefetchDNS(host string) {
+	if f.dns != nil {
+		f.dns.Prefetch(host)
+	}
+}
@@ -0,0 +1,50 @@
+package fetcher
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDNSCachePrefetch(t *testing.T) {
+	server := serverMock()
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"), WithDNSCache(time.Minute))
+	f.PrefetchDNS("localhost")
+	entry, resolve := f.dns.entry("localhost")
+	if resolve {
+		t.Fatal("DNSCache#Prefetch failed: localhost was not being resolved")
+	}
+	<-entry.ready
+	if entry.err != nil || len(entry.addrs) == 0 {
+		t.Fatalf("DNSCache#Prefetch failed: %v %v", entry.addrs, entry.err)
+	}
+	target := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/foo/bar"
+	_, res, err := f.Fetch(target)
+	if err != nil {
+		t.Fatalf("StdHttpFetcher#Fetch failed: %v", err)
+	}
+	res.Body.Close()
+	if cached, _ := f.dns.entry("localhost"); cached != entry {
+		t.Error("DNSCache#Lookup failed: localhost was resolved again")
+	}
+}
+
+func TestDNSCacheFailuresNotCached(t *testing.T) {
+	cache := newDNSCache(time.Minute)
+	if _, err := cache.Lookup(context.Background(), "nonexistent.invalid"); err == nil {
+		t.Fatal("DNSCache#Lookup failed: expected an error")
+	}
+	if _, resolve := cache.entry("nonexistent.invalid"); !resolve {
+		t.Error("DNSCache#Lookup failed: failed resolution cached")
+	}
+}
+
+func TestPrefetchDNSDisabled(t *testing.T) {
+	f := New(WithUserAgent("test-agent"))
+	f.PrefetchDNS("localhost")
+	if f.dns != nil {
+		t.Error("StdHttpFetcher#PrefetchDNS failed: DNS cache enabled")
+	}
+}
@@ -3,97 +3,516 @@
 package fetcher
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
-
-	"github.com/PuerkitoBio/rehttp"
 )
 
+// Page is the outcome of the parsing of a fetched resource
+type Page struct {
+	// URL is the final URL of the page, after following any redirect
+	URL *url.URL
+	// Links contains all the links found in the page
+	Links []*url.URL
+	// InvalidLinks contains the hrefs of the page failing to parse as URLs,
+	// even once repaired
+	InvalidLinks []string
+	// Assets contains all the embedded resources found in the page, e.g.
+	// images, videos and audio sources
+	Assets []*url.URL
+	// Pagination contains the links to the next and the previous pages of
+	// a paginated listing, declared by rel=next and rel=prev
+	Pagination []*url.URL
+	// Alternates maps the languages, declared by the hreflang of the
+	// rel=alternate links, to the translations of the page
+	Alternates map[string]*url.URL
+	// Canonical is the canonical URL of the page, declared by its
+	// rel=canonical link, if any
+	Canonical *url.URL
+	// AMPHTML is the AMP version of the page, declared by its rel=amphtml
+	// link, if any
+	AMPHTML *url.URL
+	// Icons are the favicons of the page, declared by its rel=icon and
+	// rel=apple-touch-icon links
+	Icons []*url.URL
+	// Manifest is the web app manifest of the page, declared by its
+	// rel=manifest link, if any
+	Manifest *url.URL
+	// AMP tells if the page is an AMP one, its html tag has the amp or the
+	// ⚡ attribute
+	AMP bool
+	// Text is the visible text of the page, with normalized spaces
+	Text string
+	// ContentType is the Content-Type header of the response
+	ContentType string
+	// Header contains the headers of the response
+	Header http.Header
+}
+
 // Parser is an interface exposing a single method `Parse`, to be used on
 // raw results of a fetch call
 type Parser interface {
-	Parse(string, io.Reader) ([]*url.URL, error)
+	Parse(string, io.Reader) (*Page, error)
+}
+
+// Timings collects the duration of each phase of an HTTP request, once
+// serialized every value is expressed in nanoseconds.
+// DNS, Connect and TLS are zero if the request reused a kept-alive
+// connection.
+type Timings struct {
+	DNS     time.Duration `json:"dns"`
+	Connect time.Duration `json:"connect"`
+	TLS     time.Duration `json:"tls"`
+	TTFB    time.Duration `json:"ttfb"`
+	Total   time.Duration `json:"total"`
+}
+
+// tracer is a simple `httptrace.ClientTrace` backend recording the start and
+// the end of each phase of a request. Hooks can be called by different
+// goroutines (e.g. dialing both IPv4 and IPv6), so a mutex is needed.
+type tracer struct {
+	mutex                            sync.Mutex
+	start                            time.Time
+	dnsStart, connectStart, tlsStart time.Time
+	timings                          Timings
+}
+
+// clientTrace returns an `*httptrace.ClientTrace` updating the tracer timings
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.record(t.dnsStart, &t.timings.DNS) },
+		ConnectStart: func(string, string) {
+			t.mark(&t.connectStart)
+		},
+		ConnectDone: func(string, string, error) {
+			t.record(t.connectStart, &t.timings.Connect)
+		},
+		TLSHandshakeStart: func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.record(t.tlsStart, &t.timings.TLS)
+		},
+		GotFirstResponseByte: func() { t.record(t.start, &t.timings.TTFB) },
+	}
+}
+
+func (t *tracer) mark(phase *time.Time) {
+	t.mutex.Lock()
+	*phase = time.Now()
+	t.mutex.Unlock()
+}
+
+func (t *tracer) record(start time.Time, phase *time.Duration) {
+	t.mutex.Lock()
+	*phase = time.Since(start)
+	t.mutex.Unlock()
+}
+
+// done set the total duration of the request returning the collected timings
+func (t *tracer) done() Timings {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.timings.Total = time.Since(t.start)
+	return t.timings
 }
 
 // stdHttpFetcher is a simple Fetcher with std library http.Client as a
 // backend for HTTP requests.
 type stdHttpFetcher struct {
-	userAgent string
-	parser    Parser
-	client    *http.Client
-}
-
-// New create a new Fetcher specifying a timeout and a concurrency level.
-// 0 concurrency means an unbounded Fetcher. By default it retries when
-// a temporary error occurs (most temporary errors are HTTP ones) for a
-// specified number of times by applying an exponential backoff strategy.
-func New(userAgent string, parser Parser, timeout time.Duration) *stdHttpFetcher {
-	transport := rehttp.NewTransport(
-		&http.Transport{
+	userAgent     string
+	userAgents    UserAgents
+	parser        Parser
+	timeout       time.Duration
+	hostTimeouts  HostTimeouts
+	client        *http.Client
+	clients       map[time.Duration]*http.Client
+	transport     *http.Transport
+	requestHook   RequestHook
+	dns           *dnsCache
+	dialer        *dialer
+	maxRetryAfter time.Duration
+}
+
+// Default timeout of a request
+const defaultTimeout time.Duration = 10 * time.Second
+
+// RequestHook is called on every request right before it's sent, allowing
+// to mutate it, e.g. signing it or injecting dynamic headers. An error
+// aborts the request. The trace ID of the fetch, if any, is found in the
+// context of the request, see TraceID.
+type RequestHook func(*http.Request) error
+
+// traceIDKey is the context key of the trace ID of a fetch
+type traceIDKey struct{}
+
+// WithTraceID returns a context carrying the trace ID of a fetch, the
+// `RequestHook` finds it in the context of the request, see TraceID
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// TraceID returns the trace ID of the fetch a context belongs to, empty if
+// it carries none
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
+
+// Option is a type definition for option pattern while creating a new
+// fetcher
+type Option func(*stdHttpFetcher)
+
+// WithUserAgent sets the User-Agent header of every request, by default the
+// one of the go http client
+func WithUserAgent(userAgent string) Option {
+	return func(f *stdHttpFetcher) {
+		f.userAgent = userAgent
+	}
+}
+
+// WithParser sets the `Parser` used to extract links from fetched pages, by
+// default a `GoqueryParser`
+func WithParser(parser Parser) Option {
+	return func(f *stdHttpFetcher) {
+		f.parser = parser
+	}
+}
+
+// WithTimeout sets the time to wait for a request to complete, 10 seconds by
+// default
+func WithTimeout(timeout time.Duration) Option {
+	return func(f *stdHttpFetcher) {
+		f.timeout = timeout
+	}
+}
+
+// WithRequestHook sets a `RequestHook` called on every request
+func WithRequestHook(hook RequestHook) Option {
+	return func(f *stdHttpFetcher) {
+		f.requestHook = hook
+	}
+}
+
+// WithTLSVerification enables the verification of the certificates of the
+// servers, by default any certificate is accepted
+func WithTLSVerification() Option {
+	return func(f *stdHttpFetcher) {
+		f.transport.TLSClientConfig.InsecureSkipVerify = false
+	}
+}
+
+// WithClientCertificates sets the certificates presented to the servers
+// requiring mutual TLS authentication
+func WithClientCertificates(certs ...tls.Certificate) Option {
+	return func(f *stdHttpFetcher) {
+		f.transport.TLSClientConfig.Certificates = append(
+			f.transport.TLSClientConfig.Certificates, certs...)
+	}
+}
+
+// New create a new Fetcher configured by a list of options. By default it
+// retries when a temporary error occurs (most temporary errors are HTTP
+// ones) for a specified number of times by applying an exponential backoff
+// strategy, and when the server answers 429 or 503 with a Retry-After,
+// waiting the time asked.
+// Cookies set by the servers are kept in a jar, enabling sessions.
+func New(opts ...Option) *stdHttpFetcher {
+	f := &stdHttpFetcher{
+		parser:        NewGoqueryParser(),
+		timeout:       defaultTimeout,
+		maxRetryAfter: defaultMaxRetryAfter,
+		transport: &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		},
-		rehttp.RetryAll(rehttp.RetryMaxRetries(3), rehttp.RetryTemporaryErr()),
-		rehttp.ExpJitterDelay(1, 10*time.Second),
-	)
-	client := &http.Client{Timeout: timeout, Transport: transport}
-	return &stdHttpFetcher{userAgent, parser, client}
+	}
+	// Mix in all optionals
+	for _, opt := range opts {
+		opt(f)
+	}
+	if f.dns != nil || f.dialer != nil {
+		f.transport.DialContext = f.dialContext()
+	}
+	// cookiejar.New never returns an error
+	jar, _ := cookiejar.New(nil)
+	f.client = &http.Client{Timeout: f.timeout, Transport: retryTransport(f.transport, f.maxRetryAfter), Jar: jar}
+	if len(f.hostTimeouts) > 0 {
+		f.clients = f.hostClients()
+	}
+	return f
+}
+
+// Client returns the underlying `*http.Client`, sharing its cookie jar and
+// transport, useful to perform requests other than GET, e.g. a login
+func (f stdHttpFetcher) Client() *http.Client {
+	return f.client
 }
 
 // Parse an URL extracting the protion <scheme>://<host>:<port>
 // Returns a string with the base domain of the URL
-func parseStartURL(u string) string {
-	parsed, _ := url.Parse(u)
-	return fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host)
+func parseStartURL(u *url.URL) string {
+	return fmt.Sprintf("%s://%s", u.Scheme, u.Host)
 }
 
 // Fetch is a private function used to make a single HTTP GET request
 // toward an URL.
-// It returns an `*http.Response` or any error occured during the call.
-func (f stdHttpFetcher) Fetch(url string) (time.Duration, *http.Response, error) {
+// It returns the `Timings` of the call, an `*http.Response` or any error
+// occured during the call. The total time accounts only for the headers,
+// the body is left to be read by the caller.
+func (f stdHttpFetcher) Fetch(url string) (Timings, *http.Response, error) {
+	return f.FetchContext(context.Background(), url)
+}
 
-	req, err := http.NewRequest("GET", url, nil)
+// FetchContext is `Fetch` bound to a context, the request is aborted once
+// the context is done
+func (f stdHttpFetcher) FetchContext(ctx context.Context, url string) (Timings, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return time.Duration(0), nil, err
+		return Timings{}, nil, err
 	}
-	req.Header.Set("User-Agent", f.userAgent)
-	// We want to time the request
-	start := time.Now()
-	res, err := f.client.Do(req)
-	elapsed := time.Since(start)
+	f.setUserAgent(req)
+	if f.requestHook != nil {
+		if err := f.requestHook(req); err != nil {
+			return Timings{}, nil, err
+		}
+	}
+	// We want to time the request, tracing each phase of it
+	t := &tracer{start: time.Now()}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.clientTrace()))
+	res, err := f.clientFor(req.URL.Hostname()).Do(req)
+	timings := t.done()
 	if err != nil {
-		return elapsed, nil, err
+		return timings, nil, err
+	}
+
+	return timings, res, nil
+}
+
+// StatusError is returned when the response to a request has an error
+// status code, 4xx or 5xx
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
+// RawPage is a page downloaded and not parsed yet, its body comes from a
+// pool of buffers and must be released once done with it
+type RawPage struct {
+	// URL is the final URL of the page, after following any redirect
+	URL *url.URL
+	// ContentType is the Content-Type header of the response
+	ContentType string
+	// Header contains the headers of the response
+	Header http.Header
+	// StatusCode is the status code of the response
+	StatusCode int
+	// Redirects are the URLs redirected from to reach the page, in order,
+	// starting from the one requested
+	Redirects []*url.URL
+	body      *bytes.Buffer
+}
+
+// Bytes returns the body of the page, valid until the page is released,
+// nil if the body wasn't read
+func (r *RawPage) Bytes() []byte {
+	if r.body == nil {
+		return nil
 	}
+	return r.body.Bytes()
+}
 
-	return elapsed, res, nil
+// HasBody tests if the body of the page was read
+func (r *RawPage) HasBody() bool {
+	return r.body != nil
 }
 
-// Fetch contact and download raw data from a specified URL and parse the
-// content into a `ParserResult` struct.
-// It returns a `*ParserResult` or any error occuring during the call or the
-// parsing of the results.
-func (f stdHttpFetcher) FetchLinks(targetURL string) (time.Duration, []*url.URL, error) {
+// Release puts the body of the page back in the pool, the page must not be
+// used afterwards
+func (r *RawPage) Release() {
+	if r.body != nil {
+		putBuffer(r.body)
+		r.body = nil
+	}
+}
+
+// FetchLinks contact and download raw data from a specified URL and parse the
+// content into a `Page` struct.
+// It returns the `Timings` of the call, including the full transfer of the
+// body, a `*Page` or any error occuring during the call or the parsing of the
+// results.
+func (f stdHttpFetcher) FetchLinks(targetURL string) (Timings, *Page, error) {
 	if f.parser == nil {
-		return time.Duration(0), nil, fmt.Errorf("fetching links from %s failed: no parser set", targetURL)
+		return Timings{}, nil, fmt.Errorf("fetching links from %s failed: no parser set", targetURL)
+	}
+	timings, raw, err := f.Download(targetURL)
+	if err != nil {
+		return timings, nil, fmt.Errorf("fetching links from %s failed: %w", targetURL, err)
 	}
-	// Extract base domain from the url
-	baseDomain := parseStartURL(targetURL)
+	defer raw.Release()
+	page, err := f.ParsePage(raw)
+	if err != nil {
+		return timings, nil, fmt.Errorf("fetching links from %s failed: %w", targetURL, err)
+	}
+	return timings, page, nil
+}
 
-	elapsed, resp, err := f.Fetch(targetURL)
+// Download fetches a page without parsing it, the entire body is read so
+// that the timings account for the whole transfer. Responses with an error
+// status are reported as errors.
+func (f stdHttpFetcher) Download(targetURL string) (Timings, *RawPage, error) {
+	return f.DownloadContext(context.Background(), targetURL)
+}
+
+// DownloadContext is `Download` bound to a context
+func (f stdHttpFetcher) DownloadContext(ctx context.Context, targetURL string) (Timings, *RawPage, error) {
+	timings, resp, err := f.FetchContext(ctx, targetURL)
 	if err != nil {
-		return elapsed, nil, fmt.Errorf("fetching links from %s failed: %w", targetURL, err)
+		return timings, nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= http.StatusBadRequest {
-		return elapsed, nil, fmt.Errorf("fetching links from %s failed: %s", targetURL, resp.Status)
+		return timings, nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	// The buffer is recycled once the page is released
+	body := getBuffer()
+	start := time.Now()
+	_, err = body.ReadFrom(resp.Body)
+	timings.Total += time.Since(start)
+	if err != nil {
+		putBuffer(body)
+		return timings, nil, err
 	}
+	page := newRawPage(resp)
+	page.body = body
+	return timings, page, nil
+}
+
+// Inspect fetches the status and the headers of a page, following its
+// redirects, the body is read only if the response is successful and
+// HTML, e.g. to discover its links, and discarded unread otherwise. Unlike
+// Download, responses with an error status are not errors.
+func (f stdHttpFetcher) Inspect(targetURL string) (Timings, *RawPage, error) {
+	return f.InspectContext(context.Background(), targetURL)
+}
 
-	links, err := f.parser.Parse(baseDomain, resp.Body)
+// InspectContext is `Inspect` bound to a context
+func (f stdHttpFetcher) InspectContext(ctx context.Context, targetURL string) (Timings, *RawPage, error) {
+	// A GET instead of a HEAD, many servers handle the latter poorly and
+	// the body of the HTML pages is needed anyway
+	timings, resp, err := f.FetchContext(ctx, targetURL)
 	if err != nil {
-		return elapsed, nil, fmt.Errorf("fetching links from %s failed: %w", targetURL, err)
+		return timings, nil, err
+	}
+	defer resp.Body.Close()
+	page := newRawPage(resp)
+	if resp.StatusCode >= http.StatusBadRequest || !IsHTML(page.ContentType) {
+		return timings, page, nil
+	}
+	body := getBuffer()
+	start := time.Now()
+	_, err = body.ReadFrom(resp.Body)
+	timings.Total += time.Since(start)
+	if err != nil {
+		putBuffer(body)
+		return timings, nil, err
+	}
+	page.body = body
+	return timings, page, nil
+}
+
+// newRawPage creates a page from the status and the headers of a response,
+// with no body
+func newRawPage(resp *http.Response) *RawPage {
+	return &RawPage{
+		URL:         resp.Request.URL,
+		ContentType: resp.Header.Get("Content-Type"),
+		Header:      resp.Header,
+		StatusCode:  resp.StatusCode,
+		Redirects:   redirectChain(resp),
+	}
+}
+
+// redirectChain returns the URLs redirected from to get a response, in
+// order, empty if the URL requested wasn't redirected
+func redirectChain(resp *http.Response) []*url.URL {
+	var chain []*url.URL
+	for r := resp.Request.Response; r != nil; r = r.Request.Response {
+		chain = append([]*url.URL{r.Request.URL}, chain...)
+	}
+	return chain
+}
+
+// IsHTML tests if a content type is the one of an HTML page, a missing
+// content type is assumed to be
+func IsHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// SniffContentType returns the content type of a body, the declared one
+// unless it's missing, generic or lies about a binary body, e.g. an image
+// served as text/html, in which case the one sniffed from the first 512
+// bytes of the body is returned
+func SniffContentType(declared string, body []byte) string {
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil || mediaType == "application/octet-stream" {
+		return http.DetectContentType(body)
+	}
+	if sniffed := http.DetectContentType(body); isBinary(sniffed) && !isBinary(declared) {
+		return sniffed
+	}
+	return declared
+}
+
+// isBinary tests if a content type is not the one of a textual document,
+// the ones sniffed are either text/* or binary
+func isBinary(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"), strings.HasSuffix(mediaType, "+xml"),
+		mediaType == "application/xml", mediaType == "application/json":
+		return false
+	default:
+		return true
+	}
+}
+
+// ParsePage parses a page downloaded, relative links are resolved against
+// the final URL of the page. The content type of the page is sniffed from
+// its body if missing or lying, only HTML pages are parsed, the others, e.g.
+// JSON documents or images, have no links.
+func (f stdHttpFetcher) ParsePage(raw *RawPage) (*Page, error) {
+	if f.parser == nil {
+		return nil, errors.New("no parser set")
+	}
+	contentType := SniffContentType(raw.ContentType, raw.Bytes())
+	page := &Page{}
+	if IsHTML(contentType) {
+		var err error
+		page, err = f.parser.Parse(parseStartURL(raw.URL), bytes.NewReader(raw.Bytes()))
+		if err != nil {
+			return nil, err
+		}
 	}
-	return elapsed, links, nil
+	page.URL = raw.URL
+	page.ContentType = contentType
+	page.Header = raw.Header
+	return page, nil
 }
@@ -1,6 +1,8 @@
 package fetcher
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -35,7 +37,7 @@ func resourceMock(w http.ResponseWriter, r *http.Request) {
 func TestStdHttpFetcherFetch(t *testing.T) {
 	server := serverMock()
 	defer server.Close()
-	f := New("test-agent", nil, 10*time.Second)
+	f := New(WithUserAgent("test-agent"))
 	target := fmt.Sprintf("%s/foo/bar", server.URL)
 	_, res, err := f.Fetch(target)
 	if err != nil {
@@ -53,7 +55,7 @@ func TestStdHttpFetcherFetch(t *testing.T) {
 func TestStdHttpFetcherFetchLinks(t *testing.T) {
 	server := serverMock()
 	defer server.Close()
-	f := New("test-agent", NewGoqueryParser(), 10*time.Second)
+	f := New(WithUserAgent("test-agent"), WithParser(NewGoqueryParser()))
 	target := fmt.Sprintf("%s/foo/bar", server.URL)
 	firstLink, _ := url.Parse("https://example.com/sample-page/")
 	secondLink, _ := url.Parse(server.URL + "/sample-page/")
@@ -63,7 +65,271 @@ func TestStdHttpFetcherFetchLinks(t *testing.T) {
 	if err != nil {
 		t.Errorf("StdHttpFetcher#FetchLinks failed: expected %v got %v", expected, err)
 	}
-	if !reflect.DeepEqual(res, expected) {
-		t.Errorf("StdHttpFetcher#FetchLinks failed: expected %v got %v", expected, res)
+	if !reflect.DeepEqual(res.Links, expected) {
+		t.Errorf("StdHttpFetcher#FetchLinks failed: expected %v got %v", expected, res.Links)
+	}
+}
+
+func TestStdHttpFetcherTimings(t *testing.T) {
+	server := serverMock()
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"), WithParser(NewGoqueryParser()))
+	timings, _, err := f.FetchLinks(server.URL + "/foo/bar")
+	if err != nil {
+		t.Errorf("StdHttpFetcher#FetchLinks failed: %v", err)
+	}
+	if timings.Connect <= 0 || timings.TTFB <= 0 {
+		t.Errorf("StdHttpFetcher#FetchLinks failed: expected timings got %#v", timings)
+	}
+	if timings.Total < timings.TTFB {
+		t.Errorf("StdHttpFetcher#FetchLinks failed: expected total >= ttfb got %#v", timings)
+	}
+}
+
+func TestStdHttpFetcherFetchLinksRedirect(t *testing.T) {
+	target := serverMock()
+	defer target.Close()
+	handler := http.NewServeMux()
+	handler.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/foo/bar", http.StatusMovedPermanently)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"), WithParser(NewGoqueryParser()))
+	_, res, err := f.FetchLinks(server.URL + "/foo")
+	if err != nil {
+		t.Errorf("StdHttpFetcher#FetchLinks failed: %v", err)
+	}
+	if res.URL.String() != target.URL+"/foo/bar" {
+		t.Errorf("StdHttpFetcher#FetchLinks failed: expected %s got %s", target.URL+"/foo/bar", res.URL)
+	}
+	expected := target.URL + "/sample-page/"
+	if len(res.Links) < 2 || res.Links[1].String() != expected {
+		t.Errorf("StdHttpFetcher#FetchLinks failed: expected %s got %v", expected, res.Links)
+	}
+}
+
+func TestStdHttpFetcherRequestHook(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/signed", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Signature") != "signed" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"), WithRequestHook(func(r *http.Request) error {
+		r.Header.Set("X-Signature", "signed")
+		return nil
+	}))
+	_, res, err := f.Fetch(server.URL + "/signed")
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected 200 got %v %v", res, err)
+	}
+	f = New(WithUserAgent("test-agent"), WithRequestHook(func(r *http.Request) error {
+		return fmt.Errorf("missing credentials")
+	}))
+	if _, _, err = f.Fetch(server.URL + "/signed"); err == nil {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected error got nil")
+	}
+}
+
+func TestStdHttpFetcherTraceID(t *testing.T) {
+	server := serverMock()
+	defer server.Close()
+	var traced string
+	f := New(WithUserAgent("test-agent"), WithRequestHook(func(r *http.Request) error {
+		traced = TraceID(r.Context())
+		return nil
+	}))
+	_, page, err := f.DownloadContext(WithTraceID(context.Background(), "abc123"), server.URL+"/foo/bar")
+	if err != nil {
+		t.Fatalf("StdHttpFetcher#DownloadContext failed: %v", err)
+	}
+	page.Release()
+	if traced != "abc123" {
+		t.Errorf("StdHttpFetcher#DownloadContext failed: expected trace ID abc123 got %q", traced)
+	}
+	if id := TraceID(context.Background()); id != "" {
+		t.Errorf("TraceID failed: expected no trace ID got %q", id)
+	}
+}
+
+func TestStdHttpFetcherClientCertificates(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(resourceMock))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"))
+	if _, _, err := f.Fetch(server.URL); err == nil {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected error without certificates")
+	}
+	f = New(WithUserAgent("test-agent"), WithClientCertificates(server.TLS.Certificates...))
+	_, res, err := f.Fetch(server.URL)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected 200 got %v %v", res, err)
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	f := New()
+	if f.client.Timeout != defaultTimeout {
+		t.Errorf("New default timeout expected %v got %v", defaultTimeout, f.client.Timeout)
+	}
+	if _, ok := f.parser.(GoqueryParser); !ok {
+		t.Errorf("New default parser expected GoqueryParser got %T", f.parser)
+	}
+	f = New(WithUserAgent("test-agent"), WithTimeout(time.Second), WithParser(nil))
+	if f.userAgent != "test-agent" {
+		t.Errorf("WithUserAgent expected test-agent got %s", f.userAgent)
+	}
+	if f.client.Timeout != time.Second {
+		t.Errorf("WithTimeout expected %v got %v", time.Second, f.client.Timeout)
+	}
+	if f.parser != nil {
+		t.Errorf("WithParser expected nil parser got %T", f.parser)
+	}
+}
+
+func TestStdHttpFetcherDownloadAndParse(t *testing.T) {
+	server := serverMock()
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"))
+	_, raw, err := f.Download(server.URL + "/foo/bar")
+	if err != nil {
+		t.Fatalf("StdHttpFetcher#Download failed: %v", err)
+	}
+	if raw.URL.String() != server.URL+"/foo/bar" || len(raw.Bytes()) == 0 {
+		t.Errorf("StdHttpFetcher#Download failed: unexpected page %#v", raw)
+	}
+	page, err := f.ParsePage(raw)
+	raw.Release()
+	if err != nil {
+		t.Fatalf("StdHttpFetcher#ParsePage failed: %v", err)
+	}
+	if len(page.Links) != 3 || page.URL.String() != server.URL+"/foo/bar" {
+		t.Errorf("StdHttpFetcher#ParsePage failed: unexpected page %#v", page)
+	}
+	if _, _, err := f.Download(server.URL + "/missing"); err == nil {
+		t.Errorf("StdHttpFetcher#Download failed: expected error on 404")
+	}
+}
+
+func TestStdHttpFetcherInspect(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/page", resourceMock)
+	handler.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+	})
+	handler.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/image.png", http.StatusFound)
+	})
+	handler.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("not really a png"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"))
+	_, raw, err := f.Inspect(server.URL + "/page")
+	if err != nil {
+		t.Fatalf("StdHttpFetcher#Inspect failed: %v", err)
+	}
+	if !raw.HasBody() || raw.StatusCode != http.StatusOK || len(raw.Redirects) != 0 {
+		t.Errorf("StdHttpFetcher#Inspect failed: expected an HTML page with body got %#v", raw)
+	}
+	raw.Release()
+	_, raw, err = f.Inspect(server.URL + "/old")
+	if err != nil {
+		t.Fatalf("StdHttpFetcher#Inspect failed: %v", err)
+	}
+	if raw.HasBody() || raw.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("StdHttpFetcher#Inspect failed: expected headers only got %#v", raw)
+	}
+	expected := []string{server.URL + "/old", server.URL + "/moved"}
+	if len(raw.Redirects) != 2 || raw.Redirects[0].String() != expected[0] || raw.Redirects[1].String() != expected[1] {
+		t.Errorf("StdHttpFetcher#Inspect failed: expected redirects %v got %v", expected, raw.Redirects)
+	}
+	_, raw, err = f.Inspect(server.URL + "/missing")
+	if err != nil || raw.StatusCode != http.StatusNotFound || raw.HasBody() {
+		t.Errorf("StdHttpFetcher#Inspect failed: expected a 404 with no body got %#v %v", raw, err)
+	}
+}
+
+func TestIsHTML(t *testing.T) {
+	for contentType, expected := range map[string]bool{
+		"text/html; charset=utf-8": true,
+		"application/xhtml+xml":    true,
+		"":                         true,
+		"application/pdf":          false,
+		"image/png":                false,
+	} {
+		if IsHTML(contentType) != expected {
+			t.Errorf("IsHTML failed: expected %v for %q", expected, contentType)
+		}
+	}
+}
+
+func TestSniffContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	html := []byte("<html><body><a href=\"/foo\"></a></body></html>")
+	tests := []struct {
+		declared string
+		body     []byte
+		expected string
+	}{
+		{"text/html; charset=utf-8", html, "text/html; charset=utf-8"},
+		{"text/html", png, "image/png"},
+		{"", html, "text/html; charset=utf-8"},
+		{"application/octet-stream", html, "text/html; charset=utf-8"},
+		{"image/png", png, "image/png"},
+		{"application/xml", []byte("<?xml version=\"1.0\"?><urlset/>"), "application/xml"},
+	}
+	for _, test := range tests {
+		if contentType := SniffContentType(test.declared, test.body); contentType != test.expected {
+			t.Errorf("SniffContentType failed: expected %q for %q got %q", test.expected, test.declared, contentType)
+		}
+	}
+}
+
+func TestStdHttpFetcherParsePageLyingContentType(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR<a href=\"/foo\">"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"))
+	_, page, err := f.FetchLinks(server.URL + "/image")
+	if err != nil {
+		t.Fatalf("StdHttpFetcher#FetchLinks failed: %v", err)
+	}
+	if page.ContentType != "image/png" || len(page.Links) != 0 {
+		t.Errorf("StdHttpFetcher#FetchLinks failed: expected an image with no links got %#v", page)
+	}
+}
+
+func TestStdHttpFetcherParsePageNotHTML(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/data.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"html": "<a href=\"/foo\">foo</a>"}`))
+	})
+	handler.HandleFunc("/notes.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(`<a href="/foo">foo</a>`))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"))
+	for path, contentType := range map[string]string{"/data.json": "application/json", "/notes.txt": "text/plain"} {
+		_, page, err := f.FetchLinks(server.URL + path)
+		if err != nil {
+			t.Fatalf("StdHttpFetcher#FetchLinks failed: %v", err)
+		}
+		if page.ContentType != contentType || len(page.Links) != 0 || page.Text != "" {
+			t.Errorf("StdHttpFetcher#FetchLinks failed: expected %s unparsed got %#v", path, page)
+		}
 	}
 }
@@ -3,10 +3,12 @@
 package fetcher
 
 import (
+	"fmt"
 	"io"
 	"net/url"
-	"path/filepath"
-	"sync"
+	"path"
+	"strings"
+	"unicode"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -15,82 +17,255 @@ import (
 // `github.com/PuerkitoBio/goquery` as a backend library
 type GoqueryParser struct {
 	excludedExts map[string]bool
-	seen         *sync.Map
 }
 
 // NewGoqueryParser create a new parser with goquery as backend
 func NewGoqueryParser() GoqueryParser {
 	return GoqueryParser{
 		excludedExts: make(map[string]bool),
-		seen:         new(sync.Map),
 	}
 }
 
+// Name returns the name of the parser, "goquery"
+func (p GoqueryParser) Name() string {
+	return "goquery"
+}
+
 // ExcludeExtensions add extensions to be excluded to the default exclusion
-// pool
-func (p *GoqueryParser) ExcludeExtensions(exts ...string) {
+// pool, case insensitive, the pool is shared by the copies of the parser
+func (p GoqueryParser) ExcludeExtensions(exts ...string) {
 	for _, ext := range exts {
-		p.excludedExts[ext] = true
+		p.excludedExts[strings.ToLower(ext)] = true
 	}
 }
 
+// excluded tests if the path of a link has one of the extensions excluded,
+// the query string is not part of the path
+func (p *GoqueryParser) excluded(link *url.URL) bool {
+	return len(p.excludedExts) > 0 &&
+		p.excludedExts[strings.ToLower(path.Ext(link.Path))]
+}
+
 // Parse is the implementation of the `Parser` interface for the
 // `GoqueryParser` struct, read the content of an `io.Reader` (e.g.
-// any file-like streamable object) and extracts all anchor links.
-// It returns a `ParserResult` object or any error that arises from the goquery
+// any file-like streamable object) and extracts all anchor links and the
+// visible text.
+// It returns a `*Page` object or any error that arises from the goquery
 // call on the data read.
-func (p GoqueryParser) Parse(baseURL string, reader io.Reader) ([]*url.URL, error) {
+func (p GoqueryParser) Parse(baseURL string, reader io.Reader) (*Page, error) {
 	doc, err := goquery.NewDocumentFromReader(reader)
 	if err != nil {
 		return nil, err
 	}
-	links := p.extractLinks(doc, baseURL)
-	return links, nil
+	// The base URL is parsed once, instead of once per link
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	links, invalid := p.extractLinks(doc, base)
+	return &Page{
+		Links:        links,
+		InvalidLinks: invalid,
+		Assets:       extractAssets(doc, base),
+		Pagination:   extractPagination(doc, base),
+		Alternates:   extractAlternates(doc, base),
+		Canonical:    extractLinkRel(doc, base, "canonical"),
+		AMPHTML:      extractLinkRel(doc, base, "amphtml"),
+		Icons:        extractIcons(doc, base),
+		Manifest:     extractLinkRel(doc, base, "manifest"),
+		AMP:          doc.Find("html[amp],html[\u26a1]").Length() > 0,
+		Text:         extractText(doc),
+	}, nil
+}
+
+// extractIcons retrieves the favicons declared by the links of a
+// `goquery.Document`, including the apple-touch-icon ones
+func extractIcons(doc *goquery.Document, base *url.URL) []*url.URL {
+	var icons []*url.URL
+	doc.Find("link[rel~=icon][href],link[rel~=apple-touch-icon][href]").Each(func(i int, element *goquery.Selection) {
+		href, _ := element.Attr("href")
+		if link, ok := resolveRelativeURL(base, href); ok {
+			icons = append(icons, link)
+		}
+	})
+	return icons
+}
+
+// extractLinkRel retrieves the URL of the first link of a
+// `goquery.Document` with a rel attribute, nil if there is none
+func extractLinkRel(doc *goquery.Document, base *url.URL, rel string) *url.URL {
+	href, ok := doc.Find("link[rel~=" + rel + "][href]").First().Attr("href")
+	if !ok {
+		return nil
+	}
+	link, _ := resolveRelativeURL(base, href)
+	return link
+}
+
+// extractAlternates retrieves the translations of a page declared by the
+// rel=alternate links of a `goquery.Document`, by language, nil if there
+// are none
+func extractAlternates(doc *goquery.Document, base *url.URL) map[string]*url.URL {
+	var alternates map[string]*url.URL
+	doc.Find("link[rel~=alternate][hreflang][href]").Each(func(i int, element *goquery.Selection) {
+		lang, _ := element.Attr("hreflang")
+		href, _ := element.Attr("href")
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		link, ok := resolveRelativeURL(base, href)
+		if !ok || lang == "" {
+			return
+		}
+		if alternates == nil {
+			alternates = make(map[string]*url.URL)
+		}
+		alternates[lang] = link
+	})
+	return alternates
+}
+
+// extractPagination retrieves the links to the next and the previous pages
+// declared by the anchors and the links of a `goquery.Document` with a
+// rel=next or rel=prev attribute
+func extractPagination(doc *goquery.Document, base *url.URL) []*url.URL {
+	var pagination []*url.URL
+	doc.Find("a[rel~=next][href],a[rel~=prev][href],link[rel~=next][href],link[rel~=prev][href]").
+		Each(func(i int, element *goquery.Selection) {
+			href, _ := element.Attr("href")
+			if link, ok := resolveRelativeURL(base, href); ok {
+				pagination = append(pagination, link)
+			}
+		})
+	return pagination
+}
+
+// extractAssets retrieves all the sources of embedded resources inside a
+// `goquery.Document`, like images, videos and audio files.
+func extractAssets(doc *goquery.Document, base *url.URL) []*url.URL {
+	selection := doc.Find("img[src],source[src],video[src],audio[src]")
+	assets := make([]*url.URL, 0, selection.Length())
+	seen := make(map[string]struct{}, selection.Length())
+	selection.Each(func(i int, element *goquery.Selection) {
+		src, _ := element.Attr("src")
+		link, ok := resolveRelativeURL(base, src)
+		if !ok {
+			return
+		}
+		key := link.String()
+		if _, dup := seen[key]; !dup {
+			seen[key] = struct{}{}
+			assets = append(assets, link)
+		}
+	})
+	return assets
+}
+
+// extractText retrieves the visible text inside the body of a
+// `goquery.Document`, scripts and styles are left out and all the sequences
+// of whitespaces are collapsed into a single space.
+func extractText(doc *goquery.Document) string {
+	body := doc.Find("body").Clone()
+	body.Find("script,style,noscript,template").Remove()
+	return normalizeSpaces(body.Text())
+}
+
+// normalizeSpaces trims a text and collapses all its sequences of
+// whitespaces into a single space, writing on a pooled buffer instead of
+// splitting the text in words
+func normalizeSpaces(text string) string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	space := false
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			space = buf.Len() > 0
+			continue
+		}
+		if space {
+			buf.WriteByte(' ')
+			space = false
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
 }
 
 // extractLinks retrieves all anchor links inside a `goquery.Document`
-// representing an HTML content.
+// representing an HTML content, each one once even if linked several times.
 // It returns a slice of string containing all the extracted links or `nil` if\
-// the passed document is a `nil` pointer.
-func (p *GoqueryParser) extractLinks(doc *goquery.Document, baseURL string) []*url.URL {
+// the passed document is a `nil` pointer, together with the hrefs failing to
+// parse even once repaired. The links already found on other pages are
+// returned again, the crawler counts them as in-links.
+func (p *GoqueryParser) extractLinks(doc *goquery.Document, base *url.URL) ([]*url.URL, []string) {
 	if doc == nil {
-		return nil
+		return nil, nil
 	}
-	foundURLs := []*url.URL{}
-	doc.Find("a,link").FilterFunction(func(i int, element *goquery.Selection) bool {
-		hrefLink, hrefExists := element.Attr("href")
+	var invalid []string
+	selection := doc.Find("a,link")
+	foundURLs := make([]*url.URL, 0, selection.Length())
+	seen := make(map[string]struct{}, selection.Length())
+	selection.FilterFunction(func(i int, element *goquery.Selection) bool {
+		_, hrefExists := element.Attr("href")
 		linkType, linkExists := element.Attr("rel")
-		anchorOk := hrefExists && !p.excludedExts[filepath.Ext(hrefLink)]
-		linkOk := linkExists && linkType == "canonical" && !p.excludedExts[filepath.Ext(linkType)]
-		return anchorOk || linkOk
+		return hrefExists || (linkExists && linkType == "canonical")
 	}).Each(func(i int, element *goquery.Selection) {
 		res, _ := element.Attr("href")
-		if link, ok := resolveRelativeURL(baseURL, res); ok {
-			if present, _ := p.seen.LoadOrStore(link.String(), false); !present.(bool) {
-				foundURLs = append(foundURLs, link)
-				p.seen.Store(link.String(), true)
-			}
+		link, ok := resolveRelativeURL(base, res)
+		if !ok {
+			invalid = append(invalid, res)
+			return
+		}
+		if p.excluded(link) {
+			return
+		}
+		if _, dup := seen[link.String()]; !dup {
+			seen[link.String()] = struct{}{}
+			foundURLs = append(foundURLs, link)
 		}
 	})
-	return foundURLs
+	return foundURLs, invalid
 }
 
 // resolveRelativeURL just correctly join a base domain to a relative path
-// to produce an absolute path to fetch on.
+// to produce an absolute path to fetch on, a path failing to parse is
+// repaired first, see `repairHref`.
 // It returns a tuple, a string representing the absolute path with resolved
 // paths and a boolean representing the success or failure of the process.
-func resolveRelativeURL(baseURL string, relative string) (*url.URL, bool) {
+func resolveRelativeURL(base *url.URL, relative string) (*url.URL, bool) {
 	u, err := url.Parse(relative)
 	if err != nil {
-		return nil, false
+		if u, err = url.Parse(repairHref(relative)); err != nil {
+			return nil, false
+		}
 	}
 	if u.Hostname() != "" {
 		return u, true
 	}
-	base, err := url.Parse(baseURL)
-	if err != nil {
-		return nil, false
+	return base.ResolveReference(u), true
+}
+
+// repairHref makes an href failing to parse a valid URL where it's safe, as
+// browsers do: the surrounding whitespaces are trimmed, tabs and newlines
+// removed, and the spaces, the control characters and the % not starting an
+// escape sequence are percent-encoded. Hosts are not repaired, an href with
+// an invalid host still fails to parse.
+func repairHref(href string) string {
+	href = strings.TrimFunc(href, unicode.IsSpace)
+	var b strings.Builder
+	for i := 0; i < len(href); i++ {
+		switch c := href[i]; {
+		case c == '\t' || c == '\n' || c == '\r':
+		case c == '%' && (i+2 >= len(href) || !isHex(href[i+1]) || !isHex(href[i+2])):
+			b.WriteString("%25")
+		case c <= ' ' || c == 0x7f:
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
 	}
+	return b.String()
+}
 
-	return base.ResolveReference(u), true
+// isHex tests if a byte is an hexadecimal digit
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
 }
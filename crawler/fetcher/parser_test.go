@@ -2,8 +2,10 @@ package fetcher
 
 import (
 	"bytes"
+	"fmt"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -28,7 +30,223 @@ func TestGoqueryParsePage(t *testing.T) {
 	if err != nil {
 		t.Errorf("GoqueryParser#ParsePage failed: expected %v got %v", expected, err)
 	}
-	if !reflect.DeepEqual(res, expected) {
-		t.Errorf("GoqueryParser#ParsePage failed: expected %v got %v", expected, res)
+	if !reflect.DeepEqual(res.Links, expected) {
+		t.Errorf("GoqueryParser#ParsePage failed: expected %v got %v", expected, res.Links)
+	}
+}
+
+func TestGoqueryParseText(t *testing.T) {
+	parser := NewGoqueryParser()
+	content := bytes.NewBufferString(
+		`<head><title>Title</title><style>p { color: red; }</style></head>
+		 <body>
+			<h1>Hello</h1>
+			<script>var x = 1;</script>
+			<p>crawling   the
+			web</p>
+		</body>`,
+	)
+	res, err := parser.Parse("http://localhost:8787", content)
+	if err != nil {
+		t.Errorf("GoqueryParser#Parse failed: %v", err)
+	}
+	if res.Text != "Hello crawling the web" {
+		t.Errorf("GoqueryParser#Parse failed: expected %q got %q", "Hello crawling the web", res.Text)
+	}
+}
+
+func TestGoqueryParseAssets(t *testing.T) {
+	parser := NewGoqueryParser()
+	content := bytes.NewBufferString(
+		`<body>
+			<img src="/baz.png">
+			<img src="/baz.png">
+			<video><source src="https://cdn.example.com/movie.mp4"></video>
+		</body>`,
+	)
+	res, err := parser.Parse("http://localhost:8787", content)
+	if err != nil {
+		t.Errorf("GoqueryParser#Parse failed: %v", err)
+	}
+	first, _ := url.Parse("http://localhost:8787/baz.png")
+	second, _ := url.Parse("https://cdn.example.com/movie.mp4")
+	expected := []*url.URL{first, second}
+	if !reflect.DeepEqual(res.Assets, expected) {
+		t.Errorf("GoqueryParser#Parse failed: expected %v got %v", expected, res.Assets)
+	}
+}
+
+func TestNormalizeSpaces(t *testing.T) {
+	testCases := map[string]string{
+		"":                          "",
+		"  \n\t ":                   "",
+		"plain":                     "plain",
+		"  lead and\n\ntrail \t ":   "lead and trail",
+		"multi\u00a0\u00a0byte\tok": "multi byte ok",
+	}
+	for text, expected := range testCases {
+		if got := normalizeSpaces(text); got != expected {
+			t.Errorf("normalizeSpaces(%q) failed: expected %q got %q", text, expected, got)
+		}
+	}
+}
+
+func TestRepairHref(t *testing.T) {
+	testCases := map[string]string{
+		"/plain":         "/plain",
+		"  /trimmed \n":  "/trimmed",
+		"/new\nline":     "/newline",
+		"/percent%zz":    "/percent%25zz",
+		"/escaped%2F%":   "/escaped%2F%25",
+		"/control\x01ch": "/control%01ch",
+		"/with space":    "/with%20space",
+	}
+	for href, expected := range testCases {
+		if got := repairHref(href); got != expected {
+			t.Errorf("repairHref(%q) failed: expected %q got %q", href, expected, got)
+		}
+	}
+}
+
+func TestGoqueryParseInvalidLinks(t *testing.T) {
+	parser := NewGoqueryParser()
+	content := bytes.NewBufferString(
+		`<body>
+			<a href="/valid">valid</a>
+			<a href="/discount%off">repaired</a>
+			<a href="http://exa mple.com/">invalid host</a>
+			<a href="http://[::1/">invalid ip</a>
+		</body>`,
+	)
+	res, err := parser.Parse("http://localhost:8787", content)
+	if err != nil {
+		t.Errorf("GoqueryParser#Parse failed: %v", err)
+	}
+	valid, _ := url.Parse("http://localhost:8787/valid")
+	repaired, _ := url.Parse("http://localhost:8787/discount%25off")
+	expected := []*url.URL{valid, repaired}
+	if !reflect.DeepEqual(res.Links, expected) {
+		t.Errorf("GoqueryParser#Parse failed: expected %v got %v", expected, res.Links)
+	}
+	expectedInvalid := []string{"http://exa mple.com/", "http://[::1/"}
+	if !reflect.DeepEqual(res.InvalidLinks, expectedInvalid) {
+		t.Errorf("GoqueryParser#Parse failed: expected %v got %v", expectedInvalid, res.InvalidLinks)
+	}
+}
+
+func BenchmarkGoqueryParse(b *testing.B) {
+	var page strings.Builder
+	page.WriteString("<html><body>")
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&page, `<p>Paragraph %d</p><a href="/page/%d">link</a><img src="/img/%d.png">`, i, i, i)
+	}
+	page.WriteString("</body></html>")
+	content := page.String()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parser := NewGoqueryParser()
+		if _, err := parser.Parse("http://localhost", strings.NewReader(content)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGoqueryParsePagination(t *testing.T) {
+	parser := NewGoqueryParser()
+	content := bytes.NewBufferString(
+		`<head><link rel="prev" href="/posts?page=1"></head>
+		 <body>
+			<a href="/posts/1">First post</a>
+			<a rel="nofollow next" href="/posts?page=3">Next</a>
+		</body>`,
+	)
+	res, err := parser.Parse("http://localhost:8787", content)
+	if err != nil {
+		t.Errorf("GoqueryParser#Parse failed: %v", err)
+	}
+	prev, _ := url.Parse("http://localhost:8787/posts?page=1")
+	next, _ := url.Parse("http://localhost:8787/posts?page=3")
+	expected := []*url.URL{prev, next}
+	if !reflect.DeepEqual(res.Pagination, expected) {
+		t.Errorf("GoqueryParser#Parse failed: expected %v got %v", expected, res.Pagination)
+	}
+}
+
+func TestGoqueryParseAlternates(t *testing.T) {
+	parser := NewGoqueryParser()
+	content := bytes.NewBufferString(
+		`<head>
+			<link rel="alternate" hreflang="en-GB" href="/en/">
+			<link rel="alternate" hreflang="it" href="https://example.it/">
+			<link rel="alternate" type="application/rss+xml" href="/feed">
+		</head>`,
+	)
+	res, err := parser.Parse("http://localhost:8787", content)
+	if err != nil {
+		t.Errorf("GoqueryParser#Parse failed: %v", err)
+	}
+	en, _ := url.Parse("http://localhost:8787/en/")
+	it, _ := url.Parse("https://example.it/")
+	expected := map[string]*url.URL{"en-gb": en, "it": it}
+	if !reflect.DeepEqual(res.Alternates, expected) {
+		t.Errorf("GoqueryParser#Parse failed: expected %v got %v", expected, res.Alternates)
+	}
+}
+
+func TestGoqueryParseAMP(t *testing.T) {
+	parser := NewGoqueryParser()
+	for content, amp := range map[string]bool{
+		`<html amp><head><link rel="canonical" href="/post"></head></html>`:                                  true,
+		`<html ⚡><head><link rel="canonical" href="/post"></head></html>`:                                    true,
+		`<html><head><link rel="canonical" href="/post"><link rel="amphtml" href="/amp/post"></head></html>`: false,
+	} {
+		res, err := parser.Parse("http://localhost:8787", bytes.NewBufferString(content))
+		if err != nil {
+			t.Fatalf("GoqueryParser#Parse failed: %v", err)
+		}
+		if res.AMP != amp || res.Canonical == nil || res.Canonical.String() != "http://localhost:8787/post" {
+			t.Errorf("GoqueryParser#Parse failed: expected AMP %v and canonical got %v %v", amp, res.AMP, res.Canonical)
+		}
+		if !amp && (res.AMPHTML == nil || res.AMPHTML.String() != "http://localhost:8787/amp/post") {
+			t.Errorf("GoqueryParser#Parse failed: expected the AMP version got %v", res.AMPHTML)
+		}
+	}
+}
+
+func TestGoqueryParseIconsAndManifest(t *testing.T) {
+	parser := NewGoqueryParser()
+	content := bytes.NewBufferString(
+		`<head>
+			<link rel="shortcut icon" href="/favicon.ico">
+			<link rel="apple-touch-icon" sizes="180x180" href="/touch.png">
+			<link rel="manifest" href="/site.webmanifest">
+		</head>`,
+	)
+	res, err := parser.Parse("http://localhost:8787", content)
+	if err != nil {
+		t.Fatalf("GoqueryParser#Parse failed: %v", err)
+	}
+	favicon, _ := url.Parse("http://localhost:8787/favicon.ico")
+	touch, _ := url.Parse("http://localhost:8787/touch.png")
+	if expected := []*url.URL{favicon, touch}; !reflect.DeepEqual(res.Icons, expected) {
+		t.Errorf("GoqueryParser#Parse failed: expected %v got %v", expected, res.Icons)
+	}
+	if res.Manifest == nil || res.Manifest.String() != "http://localhost:8787/site.webmanifest" {
+		t.Errorf("GoqueryParser#Parse failed: expected the manifest got %v", res.Manifest)
+	}
+}
+
+func TestGoqueryParseExcludingExtensions(t *testing.T) {
+	parser := NewGoqueryParser()
+	parser.ExcludeExtensions(".pdf")
+	page, _ := url.Parse("http://localhost:8787/page")
+	expected := []*url.URL{page}
+	content := bytes.NewBufferString(
+		`<a href="/doc.PDF?v=1"><a href="/page"><a href="/other.pdf#top">`,
+	)
+	res, err := parser.Parse("http://localhost:8787", content)
+	if err != nil || !reflect.DeepEqual(res.Links, expected) {
+		t.Errorf("GoqueryParser#Parse failed: expected %v got %v %v", expected, res, err)
 	}
 }
@@ -0,0 +1,36 @@
+// Package fetcher defines and implement the fetching and parsing utilities
+// for remote resources
+package fetcher
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Buffers bigger than this are not put back in the pool, a single huge page
+// would otherwise keep its memory alive for the whole crawl
+const maxPooledBufferSize int = 4 << 20
+
+// bufferPool recycles the buffers used to read response bodies and to
+// normalize the text of the pages, cutting the allocations when crawling
+// many pages
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer puts a buffer back in the pool, it must not be used afterwards
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
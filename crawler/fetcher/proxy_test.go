@@ -0,0 +1,48 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		expected      bool
+	}{
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"EXAMPLE.com", "example.COM", true},
+		{"*", "localhost", true},
+		{"[", "localhost", false},
+	}
+	for _, test := range tests {
+		if MatchHost(test.pattern, test.host) != test.expected {
+			t.Errorf("MatchHost failed: expected %v for %s %s", test.expected, test.pattern, test.host)
+		}
+	}
+}
+
+func TestStdHttpFetcherProxyRules(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proxied-Host", r.URL.Host)
+	}))
+	defer proxy.Close()
+	server := serverMock()
+	defer server.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	f := New(WithUserAgent("test-agent"), WithProxyRules(
+		ProxyRule{Host: "127.0.0.1", Proxy: nil},
+		ProxyRule{Host: "*.test", Proxy: proxyURL},
+	))
+	_, res, err := f.Fetch("http://crawler.test/foo")
+	if err != nil || res.Header.Get("X-Proxied-Host") != "crawler.test" {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected proxied request got %v %v", res, err)
+	}
+	_, res, err = f.Fetch(server.URL + "/foo/bar")
+	if err != nil || res.Header.Get("X-Proxied-Host") != "" {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected direct request got %v %v", res, err)
+	}
+}
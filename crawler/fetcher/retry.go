@@ -0,0 +1,98 @@
+// Package fetcher defines and implement the downloading and parsing utilities
+// for remote resources
+package fetcher
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/rehttp"
+)
+
+// Maximum number of retries of a request
+const maxRetries int = 3
+
+// Default cap of the waits asked by the Retry-After headers
+const defaultMaxRetryAfter time.Duration = 5 * time.Second
+
+// WithMaxRetryAfter caps the wait before retrying a request answered with
+// a 429 or a 503 and a Retry-After header, 5 seconds by default. The waits
+// count in the timeout of the request.
+func WithMaxRetryAfter(max time.Duration) Option {
+	return func(f *stdHttpFetcher) {
+		f.maxRetryAfter = max
+	}
+}
+
+// retryTransport wraps a transport retrying the requests failed with a
+// temporary error, after an exponential backoff, and the ones answered with
+// a 429 or a 503 carrying a Retry-After header, after the wait asked capped
+// at max
+func retryTransport(transport http.RoundTripper, max time.Duration) http.RoundTripper {
+	return rehttp.NewTransport(
+		transport,
+		rehttp.RetryAll(
+			rehttp.RetryMaxRetries(maxRetries),
+			rehttp.RetryAny(rehttp.RetryTemporaryErr(), retryAfterStatus),
+		),
+		retryAfterDelay(max, rehttp.ExpJitterDelay(1, 10*time.Second)),
+	)
+}
+
+// retryAfterStatus tests if an attempt was answered with a 429 or a 503
+// telling when to retry
+func retryAfterStatus(attempt rehttp.Attempt) bool {
+	_, ok := attemptRetryAfter(attempt)
+	return ok
+}
+
+// retryAfterDelay returns a delay function waiting the Retry-After of the
+// attempts, capped at max, the other attempts wait the fallback delay
+func retryAfterDelay(max time.Duration, fallback rehttp.DelayFn) rehttp.DelayFn {
+	return func(attempt rehttp.Attempt) time.Duration {
+		delay, ok := attemptRetryAfter(attempt)
+		if !ok {
+			return fallback(attempt)
+		}
+		if delay > max {
+			return max
+		}
+		return delay
+	}
+}
+
+// attemptRetryAfter returns the wait asked by the Retry-After header of the
+// response of an attempt, only 429 and 503 responses are considered
+func attemptRetryAfter(attempt rehttp.Attempt) (time.Duration, bool) {
+	res := attempt.Response
+	if res == nil || (res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	return parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either a number
+// of seconds or an HTTP date, returning the wait from now. Dates in the past
+// mean no wait.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
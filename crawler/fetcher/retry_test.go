@@ -0,0 +1,85 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		wait  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{" 0 ", 0, true},
+		{"-1", 0, false},
+		{"Mon, 01 Jan 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, test := range tests {
+		if wait, ok := parseRetryAfter(test.value, now); wait != test.wait || ok != test.ok {
+			t.Errorf("parseRetryAfter failed: expected %v %v for %q got %v %v",
+				test.wait, test.ok, test.value, wait, ok)
+		}
+	}
+}
+
+func TestStdHttpFetcherRetryAfter(t *testing.T) {
+	var requests int32
+	var retried time.Time
+	handler := http.NewServeMux()
+	start := time.Now()
+	handler.HandleFunc("/limited", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		retried = time.Now()
+	})
+	handler.HandleFunc("/unavailable", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	handler.HandleFunc("/failing", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"))
+	_, res, err := f.Fetch(server.URL + "/limited")
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("StdHttpFetcher#Fetch failed: expected 200 got %v %v", res, err)
+	}
+	res.Body.Close()
+	if wait := retried.Sub(start); wait < time.Second {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected a retry after 1s got %v", wait)
+	}
+	// Waits longer than the cap are cut to it
+	f = New(WithUserAgent("test-agent"), WithMaxRetryAfter(10*time.Millisecond))
+	start = time.Now()
+	_, res, err = f.Fetch(server.URL + "/unavailable")
+	if err != nil || res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("StdHttpFetcher#Fetch failed: expected 503 got %v %v", res, err)
+	}
+	res.Body.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected the waits capped got %v", elapsed)
+	}
+	// Error statuses without a Retry-After are not retried
+	atomic.StoreInt32(&requests, 0)
+	if _, res, err = f.Fetch(server.URL + "/failing"); err == nil {
+		res.Body.Close()
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected no retries got %d requests", n)
+	}
+}
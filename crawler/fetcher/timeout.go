@@ -0,0 +1,61 @@
+// Package fetcher defines and implement the downloading and parsing utilities
+// for remote resources
+package fetcher
+
+import (
+	"net/http"
+	"time"
+)
+
+// HostTimeouts maps host patterns to the time to wait for their requests to
+// complete, overriding the default one, e.g. longer for slow legacy hosts
+// and shorter for fast APIs
+type HostTimeouts map[string]time.Duration
+
+// For returns the timeout of a host, or the fallback if no pattern matches.
+// An exact match wins, otherwise the longest pattern matching, like
+// `UserAgents`.
+func (t HostTimeouts) For(host string, fallback time.Duration) time.Duration {
+	if timeout, ok := t[host]; ok {
+		return timeout
+	}
+	timeout, longest := fallback, -1
+	for pattern, patternTimeout := range t {
+		if len(pattern) > longest && MatchHost(pattern, host) {
+			timeout, longest = patternTimeout, len(pattern)
+		}
+	}
+	return timeout
+}
+
+// WithHostTimeouts sets the timeouts of the requests to specific hosts, the
+// default timeout is used for all the others. The timeout of a request
+// redirected to another host is the one of the host first requested.
+func WithHostTimeouts(timeouts HostTimeouts) Option {
+	return func(f *stdHttpFetcher) {
+		f.hostTimeouts = timeouts
+	}
+}
+
+// hostClients returns a client for each timeout overriding the default
+// one, sharing the transport and the cookie jar of the default client
+func (f stdHttpFetcher) hostClients() map[time.Duration]*http.Client {
+	clients := make(map[time.Duration]*http.Client)
+	for _, timeout := range f.hostTimeouts {
+		if _, ok := clients[timeout]; !ok && timeout != f.timeout {
+			client := *f.client
+			client.Timeout = timeout
+			clients[timeout] = &client
+		}
+	}
+	return clients
+}
+
+// clientFor returns the client to send the requests to a host with, bound
+// to the timeout of the host
+func (f stdHttpFetcher) clientFor(host string) *http.Client {
+	if client, ok := f.clients[f.hostTimeouts.For(host, f.timeout)]; ok {
+		return client
+	}
+	return f.client
+}
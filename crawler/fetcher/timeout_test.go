@@ -0,0 +1,43 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostTimeoutsFor(t *testing.T) {
+	timeouts := HostTimeouts{
+		"*.example.com":     time.Minute,
+		"api.example.com":   time.Second,
+		"*.api.example.com": 2 * time.Second,
+	}
+	tests := map[string]time.Duration{
+		"www.example.com":    time.Minute,
+		"api.example.com":    time.Second,
+		"v1.api.example.com": 2 * time.Second,
+		"golang.org":         10 * time.Second,
+	}
+	for host, expected := range tests {
+		if timeout := timeouts.For(host, 10*time.Second); timeout != expected {
+			t.Errorf("HostTimeouts#For failed: expected %v for %s got %v", expected, host, timeout)
+		}
+	}
+}
+
+func TestStdHttpFetcherHostTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"), WithTimeout(time.Second),
+		WithHostTimeouts(HostTimeouts{"localhost": 20 * time.Millisecond}))
+	if _, _, err := f.Fetch(server.URL); err != nil {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected the default timeout got %v", err)
+	}
+	if _, _, err := f.Fetch(strings.Replace(server.URL, "127.0.0.1", "localhost", 1)); err == nil {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected the timeout of localhost to expire")
+	}
+}
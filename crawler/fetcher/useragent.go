@@ -0,0 +1,46 @@
+// Package fetcher defines and implement the downloading and parsing utilities
+// for remote resources
+package fetcher
+
+import "net/http"
+
+// UserAgents maps host patterns to the user agent to present to them, e.g.
+// a branded agent for owned properties
+type UserAgents map[string]string
+
+// For returns the user agent of a host, or the fallback if no pattern
+// matches. An exact match wins, otherwise the longest pattern matching, e.g.
+// *.docs.example.com is preferred over *.example.com. Between patterns of
+// the same length the first in lexicographic order wins.
+func (u UserAgents) For(host, fallback string) string {
+	if userAgent, ok := u[host]; ok {
+		return userAgent
+	}
+	userAgent, chosen := fallback, ""
+	for pattern, agent := range u {
+		if !MatchHost(pattern, host) {
+			continue
+		}
+		if chosen == "" || len(pattern) > len(chosen) ||
+			(len(pattern) == len(chosen) && pattern < chosen) {
+			userAgent, chosen = agent, pattern
+		}
+	}
+	return userAgent
+}
+
+// WithUserAgents sets the user agents to present to specific hosts, the
+// default user agent is used for all the others
+func WithUserAgents(userAgents UserAgents) Option {
+	return func(f *stdHttpFetcher) {
+		f.userAgents = userAgents
+	}
+}
+
+// setUserAgent sets the User-Agent header of a request according to its
+// host, if no user agent is set the go http client one is left
+func (f stdHttpFetcher) setUserAgent(req *http.Request) {
+	if userAgent := f.userAgents.For(req.URL.Hostname(), f.userAgent); userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+}
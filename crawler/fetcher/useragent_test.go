@@ -0,0 +1,44 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUserAgentsFor(t *testing.T) {
+	agents := UserAgents{
+		"*.example.com":      "generic-bot",
+		"*.docs.example.com": "docs-bot",
+		"example.com":        "apex-bot",
+		"*.example.org":      "org-bot",
+		"www.example.*":      "www-bot",
+	}
+	tests := map[string]string{
+		"example.com":          "apex-bot",
+		"www.example.com":      "generic-bot",
+		"api.docs.example.com": "docs-bot",
+		"golang.org":           "default-bot",
+		"www.example.org":      "org-bot",
+	}
+	for host, expected := range tests {
+		// Patterns of the same length must not depend on the map order
+		for i := 0; i < 10; i++ {
+			if agent := agents.For(host, "default-bot"); agent != expected {
+				t.Errorf("UserAgents#For failed: expected %s got %s", expected, agent)
+			}
+		}
+	}
+}
+
+func TestStdHttpFetcherUserAgents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-User-Agent", r.UserAgent())
+	}))
+	defer server.Close()
+	f := New(WithUserAgent("test-agent"), WithUserAgents(UserAgents{"127.0.0.1": "owned-agent"}))
+	_, res, err := f.Fetch(server.URL)
+	if err != nil || res.Header.Get("X-User-Agent") != "owned-agent" {
+		t.Errorf("StdHttpFetcher#Fetch failed: expected owned-agent got %v %v", res, err)
+	}
+}
@@ -0,0 +1,124 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// URLFilter is evaluated on every link before it enters the frontier, ahead
+// of its deduplication and of the other admission checks, links for which it
+// returns false are skipped for SkipFilter. Filters are applied in order and
+// may modify the link in place, e.g. to strip some query parameters, the
+// following ones and the deduplication see the link modified. The targets
+// of the redirects are filtered too, on a copy as they're already fetched.
+type URLFilter interface {
+	Accept(*url.URL) bool
+}
+
+// URLFilterFunc is an adapter to use a function as a `URLFilter`
+type URLFilterFunc func(*url.URL) bool
+
+// Accept calls f(link)
+func (f URLFilterFunc) Accept(link *url.URL) bool {
+	return f(link)
+}
+
+// WithURLFilters adds filters to the chain of `URLFilter` applied to the
+// links found
+func WithURLFilters(filters ...URLFilter) CrawlerOpt {
+	return func(s *CrawlerSettings) {
+		s.URLFilters = append(s.URLFilters, filters...)
+	}
+}
+
+// AllowRegexps returns a `URLFilter` accepting only the links matching at
+// least one of the expressions
+func AllowRegexps(exprs ...*regexp.Regexp) URLFilter {
+	return URLFilterFunc(func(link *url.URL) bool {
+		return matchAny(exprs, link.String())
+	})
+}
+
+// DenyRegexps returns a `URLFilter` refusing the links matching any of the
+// expressions
+func DenyRegexps(exprs ...*regexp.Regexp) URLFilter {
+	return URLFilterFunc(func(link *url.URL) bool {
+		return !matchAny(exprs, link.String())
+	})
+}
+
+// PathPrefixes returns a `URLFilter` accepting only the links with a path
+// starting with one of the prefixes, e.g. "/blog/"
+func PathPrefixes(prefixes ...string) URLFilter {
+	return URLFilterFunc(func(link *url.URL) bool {
+		path := link.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// StripQueryParams returns a `URLFilter` removing some query parameters from
+// the links, e.g. tracking ones like utm_source, or the whole query if none
+// is given, accepting every link
+func StripQueryParams(params ...string) URLFilter {
+	return URLFilterFunc(func(link *url.URL) bool {
+		if link.RawQuery == "" {
+			return true
+		}
+		if len(params) == 0 {
+			link.RawQuery = ""
+			return true
+		}
+		query := link.Query()
+		stripped := false
+		for _, param := range params {
+			if query.Has(param) {
+				query.Del(param)
+				stripped = true
+			}
+		}
+		if stripped {
+			link.RawQuery = query.Encode()
+		}
+		return true
+	})
+}
+
+// extensionSet returns a set of extensions lowercased and with the leading
+// dot, e.g. "PDF" and ".pdf" are both ".pdf", nil if empty
+func extensionSet(exts []string) map[string]bool {
+	var set map[string]bool
+	for _, ext := range exts {
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if set == nil {
+			set = make(map[string]bool, len(exts))
+		}
+		set[strings.ToLower(ext)] = true
+	}
+	return set
+}
+
+// excludedExtension tests if the path of a link has one of the
+// ExcludedExtensions, the query string is not part of the path
+func (c *WebCrawler) excludedExtension(link *url.URL) bool {
+	if len(c.excludedExts) == 0 {
+		return false
+	}
+	return c.excludedExts[strings.ToLower(path.Ext(link.Path))]
+}
@@ -0,0 +1,167 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+func TestURLFilters(t *testing.T) {
+	tests := []struct {
+		filter   URLFilter
+		link     string
+		accepted bool
+		expected string
+	}{
+		{AllowRegexps(regexp.MustCompile(`/blog/`)), "https://example.com/blog/post", true, ""},
+		{AllowRegexps(regexp.MustCompile(`/blog/`)), "https://example.com/shop", false, ""},
+		{DenyRegexps(regexp.MustCompile(`\.pdf$`)), "https://example.com/doc.pdf", false, ""},
+		{DenyRegexps(regexp.MustCompile(`\.pdf$`)), "https://example.com/doc", true, ""},
+		{PathPrefixes("/docs/", "/blog/"), "https://example.com/docs/intro", true, ""},
+		{PathPrefixes("/docs/"), "https://example.com", false, ""},
+		{StripQueryParams("utm_source"), "https://example.com/?utm_source=x&page=2", true, "https://example.com/?page=2"},
+		{StripQueryParams(), "https://example.com/?page=2", true, "https://example.com/"},
+	}
+	for _, test := range tests {
+		link, _ := url.Parse(test.link)
+		if accepted := test.filter.Accept(link); accepted != test.accepted {
+			t.Errorf("URLFilter#Accept failed: expected %v for %s got %v", test.accepted, test.link, accepted)
+		}
+		if test.expected != "" && link.String() != test.expected {
+			t.Errorf("URLFilter#Accept failed: expected %s got %s", test.expected, link)
+		}
+	}
+}
+
+func TestCrawlPagesWithURLFilters(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/", resourceMock(
+		`<a href="/docs/a?utm_source=x"><a href="/docs/a"><a href="/docs/b.pdf"><a href="/shop">`))
+	handler.HandleFunc("/docs/a", resourceMock(`<a href="/docs/a?utm_source=y">`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), WithURLFilters(
+			StripQueryParams("utm_source"),
+			PathPrefixes("/docs/"),
+			DenyRegexps(regexp.MustCompile(`\.pdf$`)),
+		))
+	crawler.Crawl(server.URL + "/docs/")
+	testbus.Close()
+	res := <-results
+	crawled := []string{}
+	for _, r := range res {
+		crawled = append(crawled, r.URL)
+	}
+	sort.Strings(crawled)
+	if len(crawled) != 2 || crawled[0] != server.URL+"/docs/" || crawled[1] != server.URL+"/docs/a" {
+		t.Errorf("Crawler#Crawl failed: expected /docs/ and /docs/a got %v", crawled)
+	}
+}
+
+func TestCrawlPagesSkipsFilteredRedirects(t *testing.T) {
+	var leaked int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/docs/", resourceMock(`<a href="/docs/moved">`))
+	handler.HandleFunc("/docs/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/shop", http.StatusMovedPermanently)
+	})
+	handler.HandleFunc("/shop", resourceMock(`<a href="/docs/leak">`))
+	handler.HandleFunc("/docs/leak", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&leaked, 1)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), WithURLFilters(PathPrefixes("/docs/")))
+	crawler.Crawl(server.URL + "/docs/")
+	testbus.Close()
+	res := <-results
+	if len(res) != 1 || res[0].URL != server.URL+"/docs/" {
+		t.Errorf("Crawler#Crawl failed: expected the filtered redirect skipped got %v", res)
+	}
+	if leaked := atomic.LoadInt32(&leaked); leaked != 0 {
+		t.Errorf("Crawler#Crawl failed: expected the links of the filtered redirect skipped got %d fetches", leaked)
+	}
+}
+
+// parserOnly hides the optional interfaces of a parser, e.g. the exclusion
+// of the extensions
+type parserOnly struct {
+	Parser
+}
+
+func TestCrawlPagesExcludingExtensions(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/", resourceMock(`<a href="/doc.pdf?v=1"><a href="/archive.ZIP"><a href="/page">`))
+	handler.HandleFunc("/page", resourceMock(`<a href="/other.zip">`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	tests := []struct {
+		name    string
+		parser  Parser
+		results int
+		links   int
+		skipped map[string]SkipReason
+	}{
+		// The parser leaves out the links excluded, whatever the case and
+		// the query string, /page has no links left and no result
+		{"parser", fetcher.NewGoqueryParser(), 1, 1, map[string]SkipReason{}},
+		// They're refused on admission otherwise
+		{"admission", parserOnly{fetcher.NewGoqueryParser()}, 2, 3, map[string]SkipReason{
+			server.URL + "/doc.pdf?v=1": SkipExtension,
+			server.URL + "/archive.ZIP": SkipExtension,
+			server.URL + "/other.zip":   SkipExtension,
+		}},
+	}
+	for _, test := range tests {
+		testbus := testQueue{make(chan []byte)}
+		results := make(chan []ParsedResult)
+		go func() { results <- consumeEvents(&testbus) }()
+		crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+			withPolitenessDelay(0), func(s *CrawlerSettings) {
+				s.Parser = test.parser
+				s.ExcludedExtensions = []string{"pdf", ".zip"}
+			})
+		var mutex sync.Mutex
+		skipped := map[string]SkipReason{}
+		crawler.Subscribe(func(e Event) {
+			if e.Type == PageSkipped {
+				mutex.Lock()
+				skipped[e.URL] = e.Reason
+				mutex.Unlock()
+			}
+		})
+		crawler.Crawl(server.URL + "/")
+		testbus.Close()
+		res := <-results
+		sort.Slice(res, func(i, j int) bool { return res[i].URL < res[j].URL })
+		if len(res) != test.results || len(res[0].Links) != test.links {
+			t.Errorf("Crawler#Crawl failed: expected %d results, / with %d links, by %s got %v",
+				test.results, test.links, test.name, res)
+		}
+		mutex.Lock()
+		if !reflect.DeepEqual(skipped, test.skipped) {
+			t.Errorf("Crawler#Crawl failed: expected skipped links %v by %s got %v", test.skipped, test.name, skipped)
+		}
+		mutex.Unlock()
+	}
+}
@@ -0,0 +1,257 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+	"github.com/codepr/webcrawler/env"
+	"github.com/codepr/webcrawler/messaging"
+)
+
+// Flags binds the crawler settings to the flags of a `flag.FlagSet`, so that
+// a crawler can be embedded in an existing command line tool:
+//
+//	flags := crawler.BindFlags(flag.CommandLine)
+//	flag.Parse()
+//	c, err := flags.NewCrawler(queue)
+type Flags struct {
+	settings *CrawlerSettings
+	// Flags not mapping directly on a settings field, converted on creation
+	// of the crawler
+	keywords, assetExtensions, userAgents string
+	grepPatterns, hostAliases             string
+	allowedHosts, blockedHosts            string
+	allowedDomains, excludedExtensions    string
+	parser, cache, assetsDir              string
+	proxy, proxyRules                     string
+	ipPreference, sourceIPs               string
+	clientCert, clientKey                 string
+	scopeFile, logLevel                   string
+	wasmExtractors, fetchTimeouts         string
+	notifyWebhook, notifySlack            string
+}
+
+// BindFlags registers a flag for each crawler setting configurable from
+// command line on a `flag.FlagSet`, the default values are the ones of a
+// crawler created by `New`
+func BindFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{settings: defaultSettings(defaultUserAgent)}
+	s := f.settings
+	fs.StringVar(&s.UserAgent, "useragent", s.UserAgent, "User-Agent header to present")
+	fs.StringVar(&f.userAgents, "useragents", "",
+		"semicolon separated list of host-pattern=user-agent pairs")
+	fs.DurationVar(&s.FetchTimeout, "fetch-timeout", s.FetchTimeout, "timeout of a single fetch")
+	fs.StringVar(&f.fetchTimeouts, "fetch-timeouts", "",
+		"semicolon separated list of host-pattern=timeout pairs overriding -fetch-timeout")
+	fs.DurationVar(&s.MaxRetryAfter, "max-retry-after", s.MaxRetryAfter,
+		"maximum wait asked by a Retry-After before retrying a fetch, 0 means 5s")
+	fs.DurationVar(&s.CrawlTimeout, "crawl-timeout", s.CrawlTimeout,
+		"time to wait for new links before ending the crawl")
+	fs.DurationVar(&s.ShutdownTimeout, "shutdown-timeout", s.ShutdownTimeout,
+		"time to wait for the in-flight fetches to end when interrupted")
+	fs.IntVar(&s.Concurrency, "concurrency", s.Concurrency, "number of concurrent fetches per domain")
+	fs.IntVar(&s.MaxConcurrentDomains, "max-concurrent-domains", s.MaxConcurrentDomains,
+		"number of domains crawled at once, the others are queued, 0 means unbounded")
+	fs.BoolVar(&s.AdaptiveConcurrency, "adaptive-concurrency", s.AdaptiveConcurrency,
+		"grow the concurrency of each domain up to -concurrency while healthy, halving it on errors")
+	fs.DurationVar(&s.AdaptiveLatencyTarget, "adaptive-latency-target", s.AdaptiveLatencyTarget,
+		"response time above which the adaptive concurrency is halved, 0 means errors only")
+	fs.IntVar(&s.ParseConcurrency, "parse-concurrency", s.ParseConcurrency,
+		"number of concurrent parsers per domain, 0 means one per CPU")
+	fs.IntVar(&s.MaxDepth, "depth", s.MaxDepth,
+		"maximum distance in links of the pages fetched from the seeds, 0 means unbounded")
+	fs.IntVar(&s.MaxPages, "max-pages", s.MaxPages, "number of pages to fetch per domain, 0 means unbounded")
+	fs.IntVar(&s.FrontierMemoryLimit, "frontier-memory-limit", s.FrontierMemoryLimit,
+		"number of links waiting to be crawled held in memory per domain, the others spill to disk, 0 means unbounded")
+	fs.StringVar(&s.FrontierSpillDir, "frontier-spill-dir", s.FrontierSpillDir,
+		"directory of the links spilled to disk, the temporary directory if empty")
+	fs.DurationVar(&s.PolitenessFixedDelay, "politeness-delay", s.PolitenessFixedDelay,
+		"fixed delay between calls to the same domain")
+	fs.StringVar(&f.keywords, "keywords", "", "comma separated list of keywords of a focused crawl")
+	fs.Float64Var(&s.MinRelevance, "min-relevance", s.MinRelevance,
+		"minimum fraction of keywords of a relevant page")
+	fs.StringVar(&f.grepPatterns, "grep", "",
+		"semicolon separated list of regular expressions to grep the pages for, producing their matches")
+	fs.IntVar(&s.ExcerptLength, "excerpt-length", s.ExcerptLength,
+		"number of characters of the text of each page in its result, 0 means none")
+	fs.IntVar(&s.URLLimits.MaxLength, "max-url-length", s.URLLimits.MaxLength,
+		"maximum length of an URL, 0 means unbounded")
+	fs.IntVar(&s.URLLimits.MaxQueryParams, "max-query-params", s.URLLimits.MaxQueryParams,
+		"maximum number of query parameters of an URL, 0 means unbounded")
+	fs.IntVar(&s.URLLimits.MaxPathSegments, "max-path-segments", s.URLLimits.MaxPathSegments,
+		"maximum number of path segments of an URL, 0 means unbounded")
+	fs.IntVar(&s.MaxRepeatedSegments, "max-repeated-segments", s.MaxRepeatedSegments,
+		"maximum repetitions of the same path segments of an URL, 0 means unbounded")
+	fs.BoolVar(&s.SchemeAgnosticDedup, "scheme-agnostic-dedup", s.SchemeAgnosticDedup,
+		"consider http and https versions of a page the same visit")
+	fs.StringVar(&f.hostAliases, "host-aliases", "",
+		"semicolon separated list of alias=canonical-host pairs crawled as one host")
+	fs.BoolVar(&s.IgnoreRobotsTxt, "ignore-robotstxt", s.IgnoreRobotsTxt,
+		"ignore robots.txt directives, only for owned sites")
+	fs.BoolVar(&s.DownloadAssets, "download-assets", s.DownloadAssets, "download images and documents")
+	fs.StringVar(&f.assetsDir, "assets-dir", "", "directory to store the downloaded assets")
+	fs.StringVar(&f.assetExtensions, "asset-extensions", strings.Join(s.AssetExtensions, ","),
+		"comma separated list of extensions of the links to download as assets")
+	fs.Int64Var(&s.MaxAssetSize, "max-asset-size", s.MaxAssetSize, "maximum size in bytes of an asset")
+	fs.StringVar(&f.parser, "parser", "goquery", "parser to use")
+	fs.StringVar(&f.cache, "cache", "memory", "cache backend to use")
+	fs.StringVar(&f.proxy, "proxy", "", "proxy URL, http, https and socks5 are supported")
+	fs.StringVar(&f.proxyRules, "proxy-rules", "",
+		"semicolon separated list of host-pattern=proxy-url pairs, direct means no proxy")
+	fs.StringVar(&f.ipPreference, "ip-preference", "dual",
+		"IP versions to connect over: dual, prefer-ipv4, prefer-ipv6, ipv4 or ipv6")
+	fs.DurationVar(&s.Dialer.FallbackDelay, "happy-eyeballs-delay", s.Dialer.FallbackDelay,
+		"time to wait for the preferred IP version before racing the other, negative disables it")
+	fs.StringVar(&f.sourceIPs, "source-ips", "", "comma separated list of source addresses to connect from")
+	fs.StringVar(&s.Dialer.Interface, "bind-interface", s.Dialer.Interface,
+		"network interface to connect from")
+	fs.BoolVar(&s.VerifyTLS, "tls-verify", s.VerifyTLS, "verify the certificates of the servers")
+	fs.BoolVar(&s.DNSPrefetch, "dns-prefetch", s.DNSPrefetch,
+		"resolve the hosts ahead of their first fetch, caching their addresses")
+	fs.BoolVar(&s.Recrawl, "recrawl", s.Recrawl,
+		"crawl again the stale pages first by their cache headers, skipping the fresh ones")
+	fs.BoolVar(&s.PrioritizePagination, "prioritize-pagination", s.PrioritizePagination,
+		"crawl the pages of paginated listings first, at the depth of the page linking them")
+	fs.IntVar(&s.MaxListingPages, "max-listing-pages", s.MaxListingPages,
+		"number of pages of a listing crawled at the depth of its first page, 0 means unbounded")
+	fs.BoolVar(&s.FollowHreflang, "follow-hreflang", s.FollowHreflang,
+		"crawl the translations of the pages declared by their hreflang links")
+	fs.BoolVar(&s.FollowAMP, "follow-amp", s.FollowAMP,
+		"crawl the AMP versions of the pages, without producing their results")
+	fs.BoolVar(&s.SiteMetadata, "site-metadata", s.SiteMetadata,
+		"produce the favicons and the web app manifest of each domain as a site result")
+	fs.BoolVar(&s.EmitSkipped, "emit-skipped", s.EmitSkipped,
+		"produce a skipped result for every link skipped, with the reason")
+	fs.BoolVar(&s.FetchManifest, "fetch-manifest", s.FetchManifest,
+		"fetch the web app manifest of each domain for the site result")
+	fs.BoolVar(&s.OrderedResults, "ordered-results", s.OrderedResults,
+		"produce the results of each domain in the order their links are dispatched")
+	fs.Int64Var(&s.RandomSeed, "random-seed", s.RandomSeed,
+		"seed of the random delays, crawling the links of each domain one at a time, 0 means random")
+	fs.BoolVar(&s.SitemapOnly, "sitemap-only", s.SitemapOnly,
+		"enumerate the URLs listed by the sitemaps only, following no link")
+	fs.BoolVar(&s.HeadersOnly, "headers-only", s.HeadersOnly,
+		"record the status, headers and redirects of every page, downloading the HTML pages only")
+	fs.IntVar(&s.CompressThreshold, "compress-threshold", s.CompressThreshold,
+		"size in bytes above which the results are gzipped, 0 means no compression")
+	fs.StringVar(&s.OutboxPath, "outbox", s.OutboxPath,
+		"write-ahead log of the results, to produce again the ones lost on the next crawl")
+	fs.StringVar(&s.ReloadFile, "reload-file", s.ReloadFile,
+		"JSON file of the settings to reload on SIGHUP while crawling")
+	fs.StringVar(&s.DebugAddr, "debug-addr", s.DebugAddr,
+		"address to serve the pprof endpoints on while crawling, e.g. localhost:6060")
+	fs.IntVar(&s.BatchSize, "batch-size", s.BatchSize,
+		"number of results sent in each message, 0 means one per message")
+	fs.StringVar((*string)(&s.ResultEncoding), "result-encoding", string(JSONEncoding),
+		"serialization format of the results, json or binary")
+	fs.StringVar(&f.clientCert, "tls-client-cert", "", "client certificate file for mutual TLS")
+	fs.StringVar(&f.clientKey, "tls-client-key", "", "client key file for mutual TLS")
+	fs.StringVar(&f.allowedHosts, "allowed-hosts", "",
+		"comma separated list of the only host patterns to fetch from")
+	fs.StringVar(&f.excludedExtensions, "excluded-extensions", "",
+		"comma separated list of the extensions of the links never to crawl, e.g. .pdf,.zip")
+	fs.StringVar(&f.allowedDomains, "allowed-domains", "",
+		"comma separated list of the domain patterns a crawl following external links can span")
+	fs.BoolVar(&s.FollowExternalLinks, "follow-external-links", s.FollowExternalLinks,
+		"crawl the links to the other domains matching the allowed domains")
+	fs.BoolVar(&s.IncludeSubdomains, "include-subdomains", s.IncludeSubdomains,
+		"crawl the links to the other hosts of the registered domain of the seeds")
+	fs.StringVar(&f.blockedHosts, "blocked-hosts", "",
+		"comma separated list of host patterns never to fetch from")
+	fs.StringVar(&f.logLevel, "log-level", LogInfo.String(),
+		"verbosity of the logs, debug, info, warn or error")
+	fs.StringVar(&f.scopeFile, "scope", "", "JSON file of the scope rules of the crawl")
+	fs.StringVar(&f.wasmExtractors, "wasm-extractors", "", "directory of the WASM extractors to run on every page")
+	fs.StringVar(&f.notifyWebhook, "notify-webhook", "", "URL to POST the summary of the crawl to")
+	fs.StringVar(&f.notifySlack, "notify-slack", "", "Slack incoming webhook URL to send the summary of the crawl to")
+	return f
+}
+
+// NewCrawler creates a new crawler from the parsed flags, returns an error
+// if any flag is invalid or if the resulting settings are not valid. Options
+// are applied after the flags.
+func (f *Flags) NewCrawler(queue messaging.Producer, opts ...CrawlerOpt) (*WebCrawler, error) {
+	settings, err := f.Settings()
+	if err != nil {
+		return nil, err
+	}
+	flagsOpt := func(s *CrawlerSettings) {
+		*s = *settings
+	}
+	crawler := New(settings.UserAgent, queue, append([]CrawlerOpt{flagsOpt}, opts...)...)
+	if err := crawler.settings.Validate(); err != nil {
+		return nil, fmt.Errorf("reading settings from flags failed: %w", err)
+	}
+	return crawler, nil
+}
+
+// Settings returns a copy of the crawler settings set by the parsed flags
+func (f *Flags) Settings() (*CrawlerSettings, error) {
+	settings := *f.settings
+	errs := []error{}
+	settings.Keywords = env.ParseSlice(f.keywords, ",")
+	settings.GrepPatterns = env.ParseSlice(f.grepPatterns, ";")
+	settings.AssetExtensions = env.ParseSlice(f.assetExtensions, ",")
+	settings.UserAgents = env.ParseMap(f.userAgents, ";")
+	settings.HostAliases = env.ParseMap(f.hostAliases, ";")
+	settings.AllowedHosts = env.ParseSlice(f.allowedHosts, ",")
+	settings.BlockedHosts = env.ParseSlice(f.blockedHosts, ",")
+	settings.AllowedDomains = env.ParseSlice(f.allowedDomains, ",")
+	settings.ExcludedExtensions = env.ParseSlice(f.excludedExtensions, ",")
+	if f.assetsDir != "" {
+		settings.BodyStore = NewFileStore(f.assetsDir)
+	}
+	if f.notifyWebhook != "" {
+		settings.Notifiers = append(settings.Notifiers, NewWebhookNotifier(f.notifyWebhook))
+	}
+	if f.notifySlack != "" {
+		settings.Notifiers = append(settings.Notifiers, NewSlackNotifier(f.notifySlack))
+	}
+	var err error
+	if settings.Parser, err = parserByName(f.parser); err != nil {
+		errs = append(errs, err)
+	}
+	if settings.Cache, err = cacheByName(f.cache); err != nil {
+		errs = append(errs, err)
+	}
+	if settings.FetchTimeouts, err = parseHostTimeouts(env.ParseMap(f.fetchTimeouts, ";")); err != nil {
+		errs = append(errs, err)
+	}
+	if settings.ProxyRules, err = parseProxyRules(env.ParseMap(f.proxyRules, ";"), f.proxy); err != nil {
+		errs = append(errs, err)
+	}
+	if settings.Dialer.IPPreference, err = fetcher.ParseIPPreference(f.ipPreference); err != nil {
+		errs = append(errs, err)
+	}
+	if settings.Dialer.SourceIPs, err = parseSourceIPs(env.ParseSlice(f.sourceIPs, ",")); err != nil {
+		errs = append(errs, err)
+	}
+	if settings.ClientCertificates, err = loadClientCertificates(f.clientCert, f.clientKey); err != nil {
+		errs = append(errs, err)
+	}
+	if settings.LogLevel, err = ParseLogLevel(f.logLevel); err != nil {
+		errs = append(errs, err)
+	}
+	if f.scopeFile != "" {
+		if settings.Scope, err = LoadScope(f.scopeFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if f.wasmExtractors != "" {
+		extractors, err := LoadWASMExtractors(context.Background(), f.wasmExtractors)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		settings.Extractors = append(settings.Extractors, extractors...)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("reading settings from flags failed: %w", err)
+	}
+	return &settings, nil
+}
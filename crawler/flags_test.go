@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBindFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := BindFlags(fs)
+	err := fs.Parse([]string{
+		"-useragent", "flag-agent",
+		"-concurrency", "2",
+		"-parse-concurrency", "6",
+		"-depth", "8",
+		"-politeness-delay", "250ms",
+		"-keywords", "go, crawler",
+		"-proxy-rules", "*.internal=socks5://localhost:1080",
+		"-dns-prefetch",
+	})
+	if err != nil {
+		t.Fatalf("BindFlags failed: %v", err)
+	}
+	crawler, err := flags.NewCrawler(testQueue{})
+	if err != nil {
+		t.Fatalf("Flags#NewCrawler failed: %v", err)
+	}
+	s := crawler.settings
+	if s.UserAgent != "flag-agent" || s.Concurrency != 2 || s.ParseConcurrency != 6 || s.MaxDepth != 8 ||
+		s.PolitenessFixedDelay != 250*time.Millisecond || !s.DNSPrefetch {
+		t.Errorf("Flags#NewCrawler failed: unexpected settings %#v", s)
+	}
+	if !reflect.DeepEqual(s.Keywords, []string{"go", "crawler"}) {
+		t.Errorf("Flags#NewCrawler failed: expected [go crawler] got %v", s.Keywords)
+	}
+	if len(s.ProxyRules) != 1 || s.ProxyRules[0].Proxy.Scheme != "socks5" {
+		t.Errorf("Flags#NewCrawler failed: unexpected proxy rules %v", s.ProxyRules)
+	}
+}
+
+func TestBindFlagsErrors(t *testing.T) {
+	tests := [][]string{
+		{"-parser", "regex"},
+		{"-concurrency", "-1"},
+		{"-proxy", "ftp://localhost"},
+		{"-tls-client-key", "key.pem"},
+		{"-allowed-hosts", "example.com,[cdn"},
+		{"-log-level", "verbose"},
+	}
+	for _, args := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		flags := BindFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatalf("BindFlags failed: %v", err)
+		}
+		if _, err := flags.NewCrawler(testQueue{}); err == nil {
+			t.Errorf("Flags#NewCrawler failed: expected error for %v", args)
+		}
+	}
+}
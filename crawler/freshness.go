@@ -0,0 +1,240 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"container/list"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fraction of the time since the last modification a page without explicit
+// freshness is considered fresh for, as suggested by RFC 9111
+const heuristicFreshness float64 = 0.1
+
+// Number of pages whose freshness is tracked at most, the ones recorded
+// least recently are forgotten beyond it, crawled again as new pages
+const freshnessLimit int = 1 << 17
+
+// Score added to the stale pages in the frontier of a recrawl, so that they
+// are fetched before the pages never crawled
+const stalePriority float64 = 1 << 40
+
+// freshUntil returns the time a response stays fresh until, based on its
+// Cache-Control max-age, Expires or Last-Modified headers, in this order of
+// precedence. Responses with none of them, or with no-cache or no-store,
+// are stale immediately.
+func freshUntil(header http.Header, now time.Time) time.Time {
+	date := now
+	if d, err := http.ParseTime(header.Get("Date")); err == nil {
+		date = d
+	}
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache" || directive == "no-store":
+			return now
+		case strings.HasPrefix(directive, "max-age="):
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil {
+				return date.Add(time.Duration(seconds) * time.Second)
+			}
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		// Invalid dates, e.g. 0, mean already expired
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return now
+		}
+		return t
+	}
+	if lastModified, err := http.ParseTime(header.Get("Last-Modified")); err == nil && lastModified.Before(date) {
+		return date.Add(time.Duration(heuristicFreshness * float64(date.Sub(lastModified))))
+	}
+	return now
+}
+
+// freshnessKey returns the key tracking the freshness of an URL, or of a
+// visit cache key, with no scheme, so that http and https are the same page
+func freshnessKey(link string) string {
+	if i := strings.Index(link, "//"); i >= 0 {
+		return link[i:]
+	}
+	return link
+}
+
+// freshness is the freshness of a page fetched, with the depth it was
+// found at to crawl it again at the same depth
+type freshness struct {
+	key   string
+	link  *url.URL
+	depth int
+	until time.Time
+}
+
+// freshnessTracker records until when each page fetched stays fresh, up
+// to a limit of pages, forgetting the ones recorded least recently
+type freshnessTracker struct {
+	mutex sync.RWMutex
+	limit int
+	pages map[string]*list.Element
+	// order holds the pages from the one recorded least recently
+	order *list.List
+}
+
+func newFreshnessTracker(limit int) *freshnessTracker {
+	return &freshnessTracker{limit: limit, pages: make(map[string]*list.Element), order: list.New()}
+}
+
+// Record records the freshness of a page found at a depth from the headers
+// of its response
+func (f *freshnessTracker) Record(link *url.URL, depth int, header http.Header) {
+	key := freshnessKey(link.String())
+	page := freshness{key: key, link: link, depth: depth, until: freshUntil(header, time.Now())}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if e, ok := f.pages[key]; ok {
+		e.Value = page
+		f.order.MoveToBack(e)
+		return
+	}
+	f.pages[key] = f.order.PushBack(page)
+	if f.order.Len() > f.limit {
+		oldest := f.order.Remove(f.order.Front()).(freshness)
+		delete(f.pages, oldest.key)
+	}
+}
+
+// Staleness returns for how long a page has been stale, negative if it's
+// still fresh, false if it was never fetched
+func (f *freshnessTracker) Staleness(key string) (time.Duration, bool) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	e, ok := f.pages[freshnessKey(key)]
+	if !ok {
+		return 0, false
+	}
+	return time.Since(e.Value.(freshness).until), true
+}
+
+// Stale returns the pages of a host stale by now, with their depth
+func (f *freshnessTracker) Stale(host string) []freshness {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	now := time.Now()
+	var stale []freshness
+	for e := f.order.Front(); e != nil; e = e.Next() {
+		page := e.Value.(freshness)
+		if page.link.Host == host && !now.Before(page.until) {
+			stale = append(stale, page)
+		}
+	}
+	return stale
+}
+
+// freshnessCache is a `Cachable` treating the pages visited by the previous
+// crawls as not visited once they're stale, so that they're crawled again,
+// while the fresh ones are skipped. The pages visited during the running
+// crawl are visited whatever their freshness.
+type freshnessCache struct {
+	Cachable
+	tracker *freshnessTracker
+	mutex   sync.Mutex
+	// seen are the keys visited during the running crawl, by namespace
+	seen map[string]map[string]bool
+}
+
+func newFreshnessCache(cache Cachable, tracker *freshnessTracker) *freshnessCache {
+	return &freshnessCache{Cachable: cache, tracker: tracker, seen: make(map[string]map[string]bool)}
+}
+
+// Set marks a key as visited
+func (c *freshnessCache) Set(namespace, key string) {
+	c.mutex.Lock()
+	if c.seen[namespace] == nil {
+		c.seen[namespace] = make(map[string]bool)
+	}
+	c.seen[namespace][key] = true
+	c.mutex.Unlock()
+	c.Cachable.Set(namespace, key)
+}
+
+// Contains tests if a key was visited during the running crawl, or during
+// the previous ones and it's still fresh
+func (c *freshnessCache) Contains(namespace, key string) bool {
+	c.mutex.Lock()
+	seen := c.seen[namespace][key]
+	c.mutex.Unlock()
+	if seen {
+		return true
+	}
+	if !c.Cachable.Contains(namespace, key) {
+		return false
+	}
+	staleness, ok := c.tracker.Staleness(key)
+	return ok && staleness < 0
+}
+
+// reset forgets the keys visited during the last crawl, at the start of a
+// new one
+func (c *freshnessCache) reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.seen = make(map[string]map[string]bool)
+}
+
+// freshnessScorer is a `Scorer` putting the stale pages before the ones
+// never crawled, the most stale first
+type freshnessScorer struct {
+	Scorer
+	tracker *freshnessTracker
+}
+
+// Score returns the score of the wrapped scorer, raised for stale pages
+func (s freshnessScorer) Score(link *url.URL, depth, inLinks int) float64 {
+	score := s.Scorer.Score(link, depth, inLinks)
+	if staleness, ok := s.tracker.Staleness(link.String()); ok && staleness >= 0 {
+		score += stalePriority + staleness.Seconds()
+	}
+	return score
+}
+
+// prepareRecrawl starts tracking the freshness of the pages on the first
+// crawl, wrapping the cache of the settings so that the pages are crawled
+// again once stale, and forgets the pages visited by the last crawl on the
+// following ones
+func (c *WebCrawler) prepareRecrawl() {
+	if !c.settings.Recrawl {
+		return
+	}
+	if c.freshness == nil {
+		c.freshness = newFreshnessTracker(freshnessLimit)
+		c.freshCache = newFreshnessCache(c.settings.Cache, c.freshness)
+		return
+	}
+	c.freshCache.reset()
+}
+
+// cache returns the cache of the visited links, the one of the settings
+// wrapped by the freshness on a recrawl
+func (c *WebCrawler) cache() Cachable {
+	if c.freshCache != nil {
+		return c.freshCache
+	}
+	return c.settings.Cache
+}
+
+// pushStale pushes the stale pages of a host crawled before to its
+// frontier, they're fetched first even if no fresh page links them anymore
+func (c *WebCrawler) pushStale(h *hostCrawl) {
+	if c.freshness == nil {
+		return
+	}
+	for _, page := range c.freshness.Stale(h.rootURL.Host) {
+		h.frontier.Push(page.link, page.depth)
+	}
+}
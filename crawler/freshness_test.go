@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFreshUntil(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	date := now.Add(-time.Minute).Format(http.TimeFormat)
+	for name, tc := range map[string]struct {
+		header   http.Header
+		expected time.Time
+	}{
+		"max-age":        {http.Header{"Cache-Control": {"public, max-age=60"}}, now.Add(time.Minute)},
+		"max-age date":   {http.Header{"Cache-Control": {"max-age=120"}, "Date": {date}}, now.Add(time.Minute)},
+		"no-cache":       {http.Header{"Cache-Control": {"no-cache"}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, now},
+		"expires":        {http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, now.Add(time.Hour)},
+		"invalid expire": {http.Header{"Expires": {"0"}}, now},
+		"last-modified":  {http.Header{"Last-Modified": {now.Add(-10 * time.Hour).Format(http.TimeFormat)}}, now.Add(time.Hour)},
+		"none":           {http.Header{}, now},
+	} {
+		if until := freshUntil(tc.header, now); !until.Equal(tc.expected) {
+			t.Errorf("freshUntil failed: %s expected %v got %v", name, tc.expected, until)
+		}
+	}
+}
+
+func TestFreshnessTracker(t *testing.T) {
+	tracker := newFreshnessTracker(3)
+	fresh, _ := url.Parse("https://example.com/fresh")
+	stale, _ := url.Parse("https://example.com/stale")
+	tracker.Record(fresh, 1, http.Header{"Cache-Control": {"max-age=3600"}})
+	tracker.Record(stale, 2, http.Header{"Cache-Control": {"no-store"}})
+	if staleness, ok := tracker.Staleness("http://example.com/fresh"); !ok || staleness >= 0 {
+		t.Errorf("freshnessTracker#Staleness failed: expected fresh got %v %v", staleness, ok)
+	}
+	if _, ok := tracker.Staleness("https://example.com/unknown"); ok {
+		t.Errorf("freshnessTracker#Staleness failed: expected unknown page")
+	}
+	pages := tracker.Stale("example.com")
+	if len(pages) != 1 || pages[0].link != stale || pages[0].depth != 2 {
+		t.Errorf("freshnessTracker#Stale failed: expected %s got %v", stale, pages)
+	}
+	scorer := freshnessScorer{inLinksScorer{}, tracker}
+	if scorer.Score(stale, 2, 1) <= scorer.Score(fresh, 0, 10) {
+		t.Errorf("freshnessScorer#Score failed: expected stale pages first")
+	}
+	// Beyond the limit the page recorded least recently is forgotten
+	tracker.Record(fresh, 1, http.Header{"Cache-Control": {"max-age=3600"}})
+	for _, path := range []string{"/a", "/b"} {
+		link, _ := url.Parse("https://example.com" + path)
+		tracker.Record(link, 1, http.Header{})
+	}
+	if _, ok := tracker.Staleness(stale.String()); ok {
+		t.Errorf("freshnessTracker#Record failed: expected %s forgotten", stale)
+	}
+	if _, ok := tracker.Staleness(fresh.String()); !ok {
+		t.Errorf("freshnessTracker#Record failed: expected %s tracked", fresh)
+	}
+}
+
+func TestCrawlRecrawlsStalePages(t *testing.T) {
+	var mutex sync.Mutex
+	hits := make(map[string]int)
+	page := func(cacheControl, content string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			hits[r.URL.Path]++
+			mutex.Unlock()
+			w.Header().Set("Cache-Control", cacheControl)
+			_, _ = w.Write([]byte(content))
+		}
+	}
+	handler := http.NewServeMux()
+	handler.HandleFunc("/", page("max-age=3600", `<a href="/fresh"><a href="/stale">`))
+	handler.HandleFunc("/fresh", page("max-age=3600", ""))
+	handler.HandleFunc("/stale", page("no-cache", ""))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	crawler := New("test-agent", &testQueue{make(chan []byte, 16)},
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0),
+		func(s *CrawlerSettings) { s.Recrawl = true })
+	crawler.Crawl(server.URL)
+	crawler.Crawl(server.URL)
+	mutex.Lock()
+	defer mutex.Unlock()
+	for path, expected := range map[string]int{"/": 1, "/fresh": 1, "/stale": 2} {
+		if hits[path] != expected {
+			t.Errorf("Crawler#Crawl failed: expected %s fetched %d times got %d", path, expected, hits[path])
+		}
+	}
+	// The settings are left as set
+	_, cache := crawler.settings.Cache.(*freshnessCache)
+	if _, scorer := crawler.settings.Scorer.(freshnessScorer); cache || scorer {
+		t.Errorf("Crawler#Crawl failed: expected the cache and the scorer not wrapped in the settings")
+	}
+}
@@ -0,0 +1,401 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"container/heap"
+	"errors"
+	"hash/fnv"
+	"math"
+	"net/url"
+	"sync"
+)
+
+// Scorer defines the priority of each link waiting to be crawled, the higher
+// the score, the sooner the link will be fetched. Useful to crawl the most
+// important pages first when limits cut the crawl short.
+type Scorer interface {
+	// Score returns the priority of a link, given its depth, e.g. the
+	// distance from the root URL, and the number of pages found so far
+	// linking to it
+	Score(link *url.URL, depth, inLinks int) float64
+}
+
+// Prioritizer defines the priority class of each link waiting to be
+// crawled, given its depth, links of a higher priority are fetched before
+// the others whatever their score, e.g. product pages before the archives.
+// The `Scorer` orders the links of the same priority.
+type Prioritizer func(link *url.URL, depth int) int
+
+// WithPrioritizer sets the `Prioritizer` of the links waiting to be crawled
+func WithPrioritizer(prioritizer Prioritizer) CrawlerOpt {
+	return func(s *CrawlerSettings) {
+		s.Prioritizer = prioritizer
+	}
+}
+
+// inLinksScorer is the default `Scorer`, it favours links referenced by many
+// pages and close to the root URL
+type inLinksScorer struct{}
+
+// Score returns the number of in-links of a link weighted by its depth
+func (inLinksScorer) Score(_ *url.URL, depth, inLinks int) float64 {
+	return float64(inLinks) / float64(depth+1)
+}
+
+// frontierEntry is a single link waiting to be crawled
+type frontierEntry struct {
+	link    *url.URL
+	depth   int
+	inLinks int
+	// priority is the class of the link given by the `Prioritizer`, it
+	// takes precedence over the score
+	priority int
+	score    float64
+	// metadata of the seed the link was found from, nil means the one of
+	// the crawl
+	metadata map[string]string
+	// seq is the insertion order, links with the same score are popped in
+	// FIFO order
+	seq uint64
+	// index is the position of the entry in the heap, needed to fix its
+	// position when the score changes
+	index int
+}
+
+// frontierQueue is a max-heap of `*frontierEntry` ordered by score,
+// implementing `heap.Interface`
+type frontierQueue []*frontierEntry
+
+func (q frontierQueue) Len() int { return len(q) }
+
+func (q frontierQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	if q[i].score == q[j].score {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].score > q[j].score
+}
+
+func (q frontierQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *frontierQueue) Push(x interface{}) {
+	entry := x.(*frontierEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *frontierQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return entry
+}
+
+// frontier is a thread-safe, unbounded priority queue of links to crawl.
+// Every link pushed is first checked against an admission function, e.g. the
+// crawling rules of the domain, given the link and its depth and returning
+// why it's refused, links pushed again while still waiting to be crawled
+// only increase their in-links count, updating their priority. The links
+// refused are reported once the lock is released, so that reporting them
+// can block without stalling the frontier.
+// Optionally the links beyond a number held in memory are spilled to disk,
+// in FIFO order by priority and band of score, see `spillClass`, and read
+// back as soon as the best one in memory is of a lower priority or score
+// than the best ones spilled.
+type frontier struct {
+	mutex   sync.Mutex
+	scorer  Scorer
+	admit   func(*url.URL, int) SkipReason
+	refused func(*url.URL, int, SkipReason)
+	queue   frontierQueue
+	pending map[string]*frontierEntry
+	seq     uint64
+	// prioritizer gives the priority of the links, nil means the same for
+	// all of them
+	prioritizer Prioritizer
+	// filter refuses the links or rewrites them in place ahead of their
+	// deduplication, nil means none
+	filter func(*url.URL) SkipReason
+	// spills hold the links beyond limit by class, nil means all the links
+	// are held in memory
+	spills   map[spillClass]*linkSpill
+	spillDir string
+	limit    int
+	// spilledDepths are the depths of the links spilled by the hash of
+	// their URL, so that a link found again by a shorter path while on disk
+	// is read back at the shorter depth
+	spilledDepths map[uint64]int
+}
+
+// newFrontier creates a new frontier with a `Scorer` to prioritize links and
+// an admission function, a nil scorer means the default in-links one
+func newFrontier(scorer Scorer, admit func(*url.URL, int) SkipReason) *frontier {
+	if scorer == nil {
+		scorer = inLinksScorer{}
+	}
+	return &frontier{
+		scorer:  scorer,
+		admit:   admit,
+		pending: make(map[string]*frontierEntry),
+	}
+}
+
+// Push adds a link found at a given depth to the frontier, returns true if
+// the link is new and has been admitted
+func (f *frontier) Push(link *url.URL, depth int) bool {
+	return f.PushFrom(link, depth, nil)
+}
+
+// PushFrom adds a link found at a given depth from a seed to the frontier,
+// the metadata of the seed is returned along the link once popped. Links
+// found from several seeds keep the metadata of the first one.
+func (f *frontier) PushFrom(link *url.URL, depth int, metadata map[string]string) bool {
+	admitted, reason, refused := f.push(link, depth, metadata)
+	if reason != "" && refused != nil {
+		refused(link, depth, reason)
+	}
+	return admitted
+}
+
+// push adds a link to the frontier under the lock, returns true if the link
+// is new and has been admitted, otherwise why it's refused, if it is, and
+// the callback to report it
+func (f *frontier) push(link *url.URL, depth int,
+	metadata map[string]string) (bool, SkipReason, func(*url.URL, int, SkipReason)) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.filter != nil {
+		if reason := f.filter(link); reason != "" {
+			return false, reason, f.refused
+		}
+	}
+	if entry, ok := f.pending[link.String()]; ok {
+		entry.inLinks++
+		if depth < entry.depth {
+			entry.depth = depth
+		}
+		entry.priority = f.priority(entry.link, entry.depth)
+		entry.score = f.scorer.Score(entry.link, entry.depth, entry.inLinks)
+		heap.Fix(&f.queue, entry.index)
+		return false, "", nil
+	}
+	if spilledDepth, ok := f.spilledDepths[linkHash(link.String())]; ok {
+		f.spilledDepths[linkHash(link.String())] = min(spilledDepth, depth)
+		return false, "", nil
+	}
+	if reason := f.admit(link, depth); reason != "" {
+		return false, reason, f.refused
+	}
+	// Links failing to spill are kept in memory
+	if f.spills != nil && f.queue.Len() >= f.limit {
+		priority, score := f.priority(link, depth), f.scorer.Score(link, depth, 1)
+		spill := f.spillOf(newSpillClass(priority, score))
+		spilled := spilledLink{URL: link.String(), Depth: depth, Metadata: metadata}
+		if err := spill.Push(spilled, score); err == nil {
+			f.spilledDepths[linkHash(spilled.URL)] = depth
+			return true, "", nil
+		}
+	}
+	f.enqueue(link, depth, metadata)
+	return true, "", nil
+}
+
+// enqueue adds a link to the heap, the lock must be held
+func (f *frontier) enqueue(link *url.URL, depth int, metadata map[string]string) {
+	entry := &frontierEntry{link: link, depth: depth, inLinks: 1, seq: f.seq, metadata: metadata}
+	entry.priority = f.priority(link, depth)
+	entry.score = f.scorer.Score(link, depth, entry.inLinks)
+	f.seq++
+	f.pending[link.String()] = entry
+	heap.Push(&f.queue, entry)
+}
+
+// spillClass is the class of the spilled links read back together, the
+// links of a priority whose scores are within the same power of two, so
+// that the spills are read back roughly in order of score
+type spillClass struct {
+	priority int
+	band     int
+}
+
+func newSpillClass(priority int, score float64) spillClass {
+	band := math.MinInt
+	if score > 0 {
+		band = math.Ilogb(score)
+	}
+	return spillClass{priority: priority, band: band}
+}
+
+// before tests if a class is read back before another one
+func (c spillClass) before(other spillClass) bool {
+	if c.priority != other.priority {
+		return c.priority > other.priority
+	}
+	return c.band > other.band
+}
+
+// spillOf returns the spill of the links of a class, the lock must be held
+func (f *frontier) spillOf(class spillClass) *linkSpill {
+	spill, ok := f.spills[class]
+	if !ok {
+		spill = &linkSpill{dir: f.spillDir}
+		f.spills[class] = spill
+	}
+	return spill
+}
+
+// spilled returns the class of the best links spilled, false if there are
+// none, the lock must be held
+func (f *frontier) spilled() (spillClass, bool) {
+	var top spillClass
+	ok := false
+	for class, spill := range f.spills {
+		if spill.Len() > 0 && (!ok || class.before(top)) {
+			top, ok = class, true
+		}
+	}
+	return top, ok
+}
+
+// outranks tests if the best links spilled of a class go before the best
+// one in memory, the lock must be held
+func (f *frontier) outranks(class spillClass) bool {
+	if f.queue.Len() == 0 {
+		return true
+	}
+	top := f.queue[0]
+	if top.priority != class.priority {
+		return top.priority < class.priority
+	}
+	return top.score < f.spills[class].best
+}
+
+// refill reads back the spilled links of a class into the heap, up to limit
+// or at least one, the lock must be held. Spilled links already passed the
+// admission, they're not checked again. On a read failure the links left on
+// disk are dropped, as there's no telling where the next one starts.
+func (f *frontier) refill(class spillClass) {
+	spill := f.spills[class]
+	links, err := spill.Pop(max(f.limit-f.queue.Len(), 1))
+	for _, spilled := range links {
+		hash := linkHash(spilled.URL)
+		depth, ok := f.spilledDepths[hash]
+		delete(f.spilledDepths, hash)
+		link, err := url.Parse(spilled.URL)
+		if err != nil {
+			continue
+		}
+		if !ok {
+			depth = spilled.Depth
+		}
+		f.enqueue(link, depth, spilled.Metadata)
+	}
+	if err != nil {
+		spill.Close()
+	}
+}
+
+// Pop removes and returns the link with the highest priority, its depth and
+// the metadata of the seed it was found from, false if the frontier is empty
+func (f *frontier) Pop() (*url.URL, int, map[string]string, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	// Spilled links of a higher priority or score than the ones in memory
+	// are read back first
+	if class, ok := f.spilled(); ok && f.outranks(class) {
+		f.refill(class)
+	}
+	if f.queue.Len() == 0 {
+		return nil, 0, nil, false
+	}
+	entry := heap.Pop(&f.queue).(*frontierEntry)
+	delete(f.pending, entry.link.String())
+	return entry.link, entry.depth, entry.metadata, true
+}
+
+// Len returns the number of links waiting to be crawled, spilled ones
+// included
+func (f *frontier) Len() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	n := f.queue.Len()
+	for _, spill := range f.spills {
+		n += spill.Len()
+	}
+	return n
+}
+
+// PrioritizeBy sets the `Prioritizer` giving the priority of the links
+// pushed from now on
+func (f *frontier) PrioritizeBy(prioritizer Prioritizer) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.prioritizer = prioritizer
+}
+
+// FilterBy sets the filter applied to the links pushed from now on before
+// anything else, refusing them or rewriting them in place
+func (f *frontier) FilterBy(filter func(*url.URL) SkipReason) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.filter = filter
+}
+
+// OnRefused sets the callback reporting the links refused by the admission
+// function, called without holding the lock
+func (f *frontier) OnRefused(refused func(*url.URL, int, SkipReason)) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.refused = refused
+}
+
+// priority returns the priority of a link found at a given depth, the lock
+// must be held
+func (f *frontier) priority(link *url.URL, depth int) int {
+	if f.prioritizer == nil {
+		return 0
+	}
+	return f.prioritizer(link, depth)
+}
+
+// SpillBeyond bounds the links held in memory to limit, the ones pushed
+// beyond are written to a temporary file per priority in dir, the default
+// temporary directory if empty. The frontier must be closed once done to
+// remove them.
+func (f *frontier) SpillBeyond(limit int, dir string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.spills = make(map[spillClass]*linkSpill)
+	f.spilledDepths = make(map[uint64]int)
+	f.spillDir = dir
+	f.limit = limit
+}
+
+// linkHash returns the hash of an URL identifying a spilled link in memory
+func linkHash(link string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(link))
+	return h.Sum64()
+}
+
+// Close removes the spilled links from disk, if any
+func (f *frontier) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var errs []error
+	for _, spill := range f.spills {
+		if err := spill.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
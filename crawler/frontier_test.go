@@ -0,0 +1,355 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type pathLengthScorer struct{}
+
+func (pathLengthScorer) Score(link *url.URL, _, _ int) float64 {
+	return -float64(len(link.Path))
+}
+
+func allowAll(*url.URL, int) SkipReason { return "" }
+
+func TestFrontierPopByInLinks(t *testing.T) {
+	f := newFrontier(nil, allowAll)
+	first, _ := url.Parse("http://localhost/first")
+	second, _ := url.Parse("http://localhost/second")
+	f.Push(first, 1)
+	f.Push(second, 1)
+	f.Push(second, 2)
+	if f.Len() != 2 {
+		t.Errorf("frontier#Push failed: expected 2 got %d", f.Len())
+	}
+	link, depth, _, ok := f.Pop()
+	if !ok || link != second || depth != 1 {
+		t.Errorf("frontier#Pop failed: expected %v got %v", second, link)
+	}
+	link, _, _, ok = f.Pop()
+	if !ok || link != first {
+		t.Errorf("frontier#Pop failed: expected %v got %v", first, link)
+	}
+	if _, _, _, ok = f.Pop(); ok {
+		t.Errorf("frontier#Pop failed: expected empty frontier")
+	}
+}
+
+func TestFrontierPopByDepth(t *testing.T) {
+	f := newFrontier(nil, allowAll)
+	deep, _ := url.Parse("http://localhost/a/b/c")
+	shallow, _ := url.Parse("http://localhost/a")
+	f.Push(deep, 3)
+	f.Push(shallow, 1)
+	if link, _, _, _ := f.Pop(); link != shallow {
+		t.Errorf("frontier#Pop failed: expected %v got %v", shallow, link)
+	}
+}
+
+func TestFrontierCustomScorer(t *testing.T) {
+	f := newFrontier(pathLengthScorer{}, allowAll)
+	long, _ := url.Parse("http://localhost/a/long/path")
+	short, _ := url.Parse("http://localhost/a")
+	f.Push(long, 1)
+	f.Push(long, 1)
+	f.Push(short, 1)
+	if link, _, _, _ := f.Pop(); link != short {
+		t.Errorf("frontier#Pop failed: expected %v got %v", short, link)
+	}
+}
+
+func TestFrontierPrioritizer(t *testing.T) {
+	f := newFrontier(nil, allowAll)
+	f.PrioritizeBy(func(link *url.URL, _ int) int {
+		if strings.HasPrefix(link.Path, "/products/") {
+			return 1
+		}
+		return 0
+	})
+	archive, _ := url.Parse("http://localhost/archive?page=2")
+	product, _ := url.Parse("http://localhost/products/a/b")
+	other, _ := url.Parse("http://localhost/products/c")
+	f.Push(archive, 1)
+	f.Push(archive, 1)
+	f.Push(product, 3)
+	f.Push(other, 2)
+	expected := []*url.URL{other, product, archive}
+	for _, e := range expected {
+		if link, _, _, _ := f.Pop(); link != e {
+			t.Errorf("frontier#Pop failed: expected %v got %v", e, link)
+		}
+	}
+}
+
+func TestFrontierAdmission(t *testing.T) {
+	f := newFrontier(nil, func(link *url.URL, _ int) SkipReason {
+		if link.Path == "/denied" {
+			return SkipRules
+		}
+		return ""
+	})
+	// The refused links are reported without holding the lock, the
+	// frontier can be used meanwhile
+	var refused SkipReason
+	f.OnRefused(func(_ *url.URL, _ int, reason SkipReason) {
+		refused = reason
+		_ = f.Len()
+	})
+	denied, _ := url.Parse("http://localhost/denied")
+	if f.Push(denied, 1) || f.Len() != 0 {
+		t.Errorf("frontier#Push failed: expected link to be rejected")
+	}
+	if refused != SkipRules {
+		t.Errorf("frontier#Push failed: expected link reported refused got %q", refused)
+	}
+}
+
+func TestFrontierFilterBeforeDedup(t *testing.T) {
+	f := newFrontier(nil, allowAll)
+	f.FilterBy(func(link *url.URL) SkipReason {
+		if !StripQueryParams("utm_source").Accept(link) {
+			return SkipFilter
+		}
+		return ""
+	})
+	var refused []SkipReason
+	f.OnRefused(func(_ *url.URL, _ int, reason SkipReason) {
+		refused = append(refused, reason)
+	})
+	tracked, _ := url.Parse("http://localhost/a?utm_source=x")
+	plain, _ := url.Parse("http://localhost/a")
+	other, _ := url.Parse("http://localhost/b")
+	f.Push(other, 1)
+	f.Push(tracked, 1)
+	f.Push(plain, 1)
+	if f.Len() != 2 || len(refused) != 0 {
+		t.Errorf("frontier#Push failed: expected 2 links and none refused got %d %v", f.Len(), refused)
+	}
+	// The filtered duplicate bumped the in-links of the pending one
+	if link, _, _, _ := f.Pop(); link.String() != plain.String() {
+		t.Errorf("frontier#Pop failed: expected %s got %s", plain, link)
+	}
+}
+
+func TestFrontierConcurrentPushPop(t *testing.T) {
+	const producers, links = 8, 1000
+	f := newFrontier(nil, allowAll)
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < links; i++ {
+				link, _ := url.Parse(fmt.Sprintf("http://localhost/%d/%d", p, i))
+				f.Push(link, 1)
+			}
+		}(p)
+	}
+	popped := 0
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		if _, _, _, ok := f.Pop(); ok {
+			popped++
+			continue
+		}
+		select {
+		case <-done:
+			for _, _, _, ok := f.Pop(); ok; _, _, _, ok = f.Pop() {
+				popped++
+			}
+			if popped != producers*links {
+				t.Errorf("frontier#Pop failed: expected %d links got %d", producers*links, popped)
+			}
+			return
+		default:
+		}
+	}
+}
+
+func TestFrontierSpillBeyond(t *testing.T) {
+	dir := t.TempDir()
+	f := newFrontier(nil, allowAll)
+	f.SpillBeyond(2, dir)
+	metadata := map[string]string{"seed": "a"}
+	for i := 0; i < 5; i++ {
+		link, _ := url.Parse(fmt.Sprintf("http://localhost/%d", i))
+		if !f.PushFrom(link, i, metadata) {
+			t.Errorf("frontier#PushFrom failed: expected %v admitted", link)
+		}
+	}
+	if f.Len() != 5 {
+		t.Errorf("frontier#Len failed: expected 5 got %d", f.Len())
+	}
+	// The links at depth 2 and 3 score within the same power of two, the
+	// one at depth 4 below
+	if files, _ := os.ReadDir(dir); len(files) != 2 {
+		t.Errorf("frontier#SpillBeyond failed: expected 2 spill files got %d", len(files))
+	}
+	popped := []string{}
+	for {
+		link, depth, linkMetadata, ok := f.Pop()
+		if !ok {
+			break
+		}
+		if link.Path != fmt.Sprintf("/%d", depth) || linkMetadata["seed"] != "a" {
+			t.Errorf("frontier#Pop failed: unexpected %v at depth %d with %v", link, depth, linkMetadata)
+		}
+		popped = append(popped, link.Path)
+	}
+	expected := []string{"/0", "/1", "/2", "/3", "/4"}
+	if !reflect.DeepEqual(popped, expected) {
+		t.Errorf("frontier#Pop failed: expected %v got %v", expected, popped)
+	}
+	if f.Len() != 0 {
+		t.Errorf("frontier#Len failed: expected 0 got %d", f.Len())
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("frontier#Close failed: %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("frontier#Close failed: expected no spill file got %d", len(files))
+	}
+}
+
+func TestFrontierSpillBeyondByPriority(t *testing.T) {
+	f := newFrontier(nil, allowAll)
+	f.SpillBeyond(2, t.TempDir())
+	defer f.Close()
+	f.PrioritizeBy(func(link *url.URL, _ int) int {
+		if strings.HasPrefix(link.Path, "/product") {
+			return 1
+		}
+		return 0
+	})
+	// The archives fill the memory, the products pushed after them are
+	// spilled and still popped first
+	for _, path := range []string{"/archive/1", "/archive/2", "/archive/3", "/product/1", "/product/2"} {
+		link, _ := url.Parse("http://localhost" + path)
+		f.Push(link, 1)
+	}
+	popped := []string{}
+	for {
+		link, _, _, ok := f.Pop()
+		if !ok {
+			break
+		}
+		popped = append(popped, link.Path)
+		// Room is made in memory, the archives pushed now are still popped
+		// after the products spilled
+		if len(popped) == 1 {
+			next, _ := url.Parse("http://localhost/archive/4")
+			f.Push(next, 1)
+		}
+	}
+	expected := []string{"/product/1", "/product/2", "/archive/1", "/archive/2", "/archive/3", "/archive/4"}
+	if !reflect.DeepEqual(popped, expected) {
+		t.Errorf("frontier#Pop failed: expected %v got %v", expected, popped)
+	}
+}
+
+func TestFrontierSpillBeyondByScore(t *testing.T) {
+	f := newFrontier(nil, allowAll)
+	f.SpillBeyond(2, t.TempDir())
+	defer f.Close()
+	// The deep links fill the memory, the shallow one pushed after them is
+	// spilled and still popped first, as the ones of a higher score in
+	// memory only
+	for _, path := range []string{"/deep/1", "/deep/2", "/top", "/deep/3"} {
+		link, _ := url.Parse("http://localhost" + path)
+		depth := 5
+		if path == "/top" {
+			depth = 0
+		}
+		f.Push(link, depth)
+	}
+	boost, _ := url.Parse("http://localhost/deep/1")
+	for i := 0; i < 12; i++ {
+		f.Push(boost, 5)
+	}
+	popped := []string{}
+	for {
+		link, _, _, ok := f.Pop()
+		if !ok {
+			break
+		}
+		popped = append(popped, link.Path)
+	}
+	expected := []string{"/deep/1", "/top", "/deep/2", "/deep/3"}
+	if !reflect.DeepEqual(popped, expected) {
+		t.Errorf("frontier#Pop failed: expected %v got %v", expected, popped)
+	}
+}
+
+func TestFrontierShorterPath(t *testing.T) {
+	admissions := 0
+	f := newFrontier(nil, func(*url.URL, int) SkipReason {
+		admissions++
+		return ""
+	})
+	f.SpillBeyond(1, t.TempDir())
+	defer f.Close()
+	first, _ := url.Parse("http://localhost/first")
+	deep, _ := url.Parse("http://localhost/deep")
+	f.Push(first, 3)
+	f.Push(deep, 4)
+	// Found again by a shorter path, in memory or on disk, the links are
+	// not admitted twice
+	if f.Push(first, 1) || f.Push(deep, 2) || admissions != 2 {
+		t.Errorf("frontier#Push failed: expected the links not admitted again")
+	}
+	for _, expected := range []struct {
+		path  string
+		depth int
+	}{{"/first", 1}, {"/deep", 2}} {
+		link, depth, _, _ := f.Pop()
+		if link.Path != expected.path || depth != expected.depth {
+			t.Errorf("frontier#Pop failed: expected %s at depth %d got %v at %d",
+				expected.path, expected.depth, link, depth)
+		}
+	}
+}
+
+func TestCrawlPagesByInLinks(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/foo", resourceMock(`<body><a href="/a">a</a><a href="/b">b</a><a href="/c">c</a></body>`))
+	handler.HandleFunc("/a", resourceMock(`<body><a href="/c">c</a><a href="/a/child">child</a></body>`))
+	handler.HandleFunc("/b", resourceMock(`<body><a href="/b/child">child</a></body>`))
+	handler.HandleFunc("/c", resourceMock(`<body><a href="/c/child">child</a></body>`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		func(s *CrawlerSettings) {
+			// The politeness delay holds the fetch slot till the page
+			// fetched is parsed, its links pushed
+			s.PolitenessFixedDelay = 50 * time.Millisecond
+			s.Concurrency = 1
+		})
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	var crawled []string
+	for _, r := range <-results {
+		crawled = append(crawled, strings.TrimPrefix(r.URL, server.URL))
+	}
+	// /c is linked by /foo and /a, it's crawled before /b
+	expected := []string{"/foo", "/a", "/c", "/b"}
+	if !reflect.DeepEqual(crawled, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, crawled)
+	}
+}
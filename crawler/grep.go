@@ -0,0 +1,122 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// GrepResult is the type of the `PageMatches` of each page matching the
+// grep patterns
+const GrepResult ResultType = "grep"
+
+// Bytes of content kept on each side of a match in its snippet
+const grepContext int = 40
+
+// Maximum number of matches of a pattern reported per page
+const maxGrepMatches int = 100
+
+// Match is an occurrence of a grep pattern in a page, the offset is the one
+// in bytes from the start of the body, or of the text of the page if the
+// fetcher doesn't expose the body
+type Match struct {
+	Pattern string `json:"pattern"`
+	Snippet string `json:"snippet"`
+	Offset  int    `json:"offset"`
+}
+
+// PageMatches contains the matches of the grep patterns in a page, with the
+// metadata of the seed the page was reached from and the trace ID of its
+// fetch, json serializable to be sent on message queues
+type PageMatches struct {
+	URL      string            `json:"url"`
+	Matches  []Match           `json:"matches"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	TraceID  string            `json:"trace_id,omitempty"`
+}
+
+// grepper scans the pages against a list of regular expressions
+type grepper struct {
+	patterns []*regexp.Regexp
+}
+
+// newGrepper compiles the grep patterns, nil if there are none
+func newGrepper(patterns []string) (*grepper, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	g := &grepper{patterns: make([]*regexp.Regexp, 0, len(patterns))}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling grep pattern %q failed: %w", pattern, err)
+		}
+		g.patterns = append(g.patterns, re)
+	}
+	return g, nil
+}
+
+// Grep returns the matches of every pattern in a content, at most
+// maxGrepMatches per pattern, in the order of the patterns
+func (g *grepper) Grep(content []byte) []Match {
+	var matches []Match
+	for _, re := range g.patterns {
+		for _, loc := range re.FindAllIndex(content, maxGrepMatches) {
+			matches = append(matches, Match{
+				Pattern: re.String(),
+				Snippet: snippet(content, loc[0], loc[1]),
+				Offset:  loc[0],
+			})
+		}
+	}
+	return matches
+}
+
+// snippet returns the text around a match of a content, grepContext bytes on
+// each side cut on a character boundary, with normalized spaces
+func snippet(content []byte, start, end int) string {
+	from, to := start-grepContext, end+grepContext
+	if from < 0 {
+		from = 0
+	}
+	if to > len(content) {
+		to = len(content)
+	}
+	for from > 0 && !utf8.RuneStart(content[from]) {
+		from--
+	}
+	for to < len(content) && !utf8.RuneStart(content[to]) {
+		to++
+	}
+	return strings.Join(strings.Fields(string(content[from:to])), " ")
+}
+
+// emitMatches produces the matches of the grep patterns in a page, if any
+func (c *WebCrawler) emitMatches(h *hostCrawl, job *fetchedPage, matches []Match) {
+	if len(matches) == 0 {
+		return
+	}
+	result := PageMatches{URL: job.link.String(), Matches: matches, Metadata: job.metadata, TraceID: job.trace}
+	job.logger.Debug("Grep matches found", "url", result.URL, "matches", len(matches))
+	c.emitResult(h.run, GrepResult, result,
+		c.logger.With("job", h.run.job, "url", result.URL, "trace", job.trace))
+}
+
+// grepPage returns the matches of the grep patterns in a page fetched,
+// found in its body if downloaded, in its text if the fetcher parsed it
+// already, the body must not be released yet
+func (c *WebCrawler) grepPage(h *hostCrawl, job *fetchedPage) []Match {
+	grep := h.run.grep
+	switch {
+	case grep == nil:
+		return nil
+	case job.raw != nil && job.raw.HasBody():
+		return grep.Grep(job.raw.Bytes())
+	case job.page != nil:
+		return grep.Grep([]byte(job.page.Text))
+	}
+	return nil
+}
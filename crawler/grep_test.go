@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGrepper(t *testing.T) {
+	g, err := newGrepper([]string{`old\.example\.com`, `(?i)lorem`})
+	if err != nil {
+		t.Fatalf("newGrepper failed: %v", err)
+	}
+	content := []byte("<a href=\"https://old.example.com/a\">Lorem</a>\n<p>lorem ipsum</p>")
+	expected := []Match{
+		{Pattern: `old\.example\.com`, Snippet: `<a href="https://old.example.com/a">Lorem</a> <p>lorem ipsum</p>`, Offset: 17},
+		{Pattern: `(?i)lorem`, Snippet: `<a href="https://old.example.com/a">Lorem</a> <p>lorem ipsum</p>`, Offset: 36},
+		{Pattern: `(?i)lorem`, Snippet: `https://old.example.com/a">Lorem</a> <p>lorem ipsum</p>`, Offset: 49},
+	}
+	if matches := g.Grep(content); !reflect.DeepEqual(matches, expected) {
+		t.Errorf("grepper#Grep failed: expected %v got %v", expected, matches)
+	}
+}
+
+func TestNewGrepperInvalidPattern(t *testing.T) {
+	if g, err := newGrepper(nil); g != nil || err != nil {
+		t.Errorf("newGrepper failed: expected no grepper got %v, %v", g, err)
+	}
+	if _, err := newGrepper([]string{"(unclosed"}); err == nil {
+		t.Errorf("newGrepper failed: expected an error got nil")
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	content := []byte(strings.Repeat("à", 30) + " needle\n\tin the   haystack " + strings.Repeat("è", 30))
+	start := strings.Index(string(content), "needle")
+	got := snippet(content, start, start+len("needle"))
+	expected := strings.Repeat("à", 20) + " needle in the haystack " + strings.Repeat("è", 10)
+	if got != expected {
+		t.Errorf("snippet failed: expected %q got %q", expected, got)
+	}
+}
+
+func TestCrawlPagesGrep(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/foo", resourceMock(`<body><a href="/bar">bar</a></body>`))
+	handler.HandleFunc("/bar", resourceMock(`<body><p>Copyright 2019</p><a href="/foo">foo</a></body>`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []PageMatches)
+	go func() {
+		var matches []PageMatches
+		for payload := range testbus.bus {
+			var m PageMatches
+			if err := json.Unmarshal(payload, &m); err == nil {
+				m.TraceID = ""
+				matches = append(matches, m)
+			}
+		}
+		results <- matches
+	}()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.GrepPatterns = []string{`Copyright \d{4}`}
+		})
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	res := <-results
+	expected := []PageMatches{{
+		URL:     server.URL + "/bar",
+		Matches: []Match{{Pattern: `Copyright \d{4}`, Snippet: `<body><p>Copyright 2019</p><a href="/foo">foo</a></body>`, Offset: 9}},
+	}}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, res)
+	}
+}
@@ -0,0 +1,150 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+const (
+	// Weight of the last response in the moving averages of latency and
+	// error rate
+	healthAlpha float64 = 0.2
+	// Responses slower than this factor times the average latency are a
+	// sign of degradation
+	healthSlowFactor float64 = 3
+	// Number of responses needed before judging the latency
+	healthMinSamples int = 5
+	// Maximum factor the delay is multiplied and the concurrency divided by
+	maxHostBackoff float64 = 32
+	// Factor the backoff is divided by on every healthy response
+	healthRecovery float64 = 1.25
+)
+
+// hostHealth tracks the error rate and the response times of a host,
+// backing off progressively when it degrades, by doubling the delay between
+// the requests and halving the concurrency, and recovering gradually as
+// healthy responses arrive. It also counts the fetches in flight, to be
+// compared with the concurrency allowed.
+type hostHealth struct {
+	mutex sync.Mutex
+	// latency is the moving average of the response times
+	latency time.Duration
+	// errorRate is the moving average of the degraded responses
+	errorRate float64
+	backoff   float64
+	samples   int
+	fetching  int
+	// released is closed once a fetch ends, and replaced
+	released chan struct{}
+}
+
+func newHostHealth() *hostHealth {
+	return &hostHealth{backoff: 1, released: make(chan struct{})}
+}
+
+// Started records the start of a fetch
+func (h *hostHealth) Started() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.fetching++
+}
+
+// Ended records the end of a fetch, waking up the ones waiting on Released
+func (h *hostHealth) Ended() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.fetching--
+	close(h.released)
+	h.released = make(chan struct{})
+}
+
+// Fetching returns the number of fetches in flight
+func (h *hostHealth) Fetching() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.fetching
+}
+
+// Released returns a channel closed once the next fetch ends, to be taken
+// before testing the fetches in flight so that no end is missed
+func (h *hostHealth) Released() <-chan struct{} {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.released
+}
+
+// Observe records a response, err is the error of the fetch if it failed
+func (h *hostHealth) Observe(latency time.Duration, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	degraded := degrading(err)
+	if err == nil && h.samples >= healthMinSamples &&
+		float64(latency) > healthSlowFactor*float64(h.latency) {
+		degraded = true
+	}
+	if h.samples == 0 {
+		h.latency = latency
+	} else {
+		h.latency = time.Duration((1-healthAlpha)*float64(h.latency) + healthAlpha*float64(latency))
+	}
+	h.samples++
+	sample := 0.0
+	if degraded {
+		sample = 1
+		h.backoff *= 2
+		if h.backoff > maxHostBackoff {
+			h.backoff = maxHostBackoff
+		}
+	} else {
+		h.backoff /= healthRecovery
+		if h.backoff < 1 {
+			h.backoff = 1
+		}
+	}
+	h.errorRate = (1-healthAlpha)*h.errorRate + healthAlpha*sample
+}
+
+// Delay returns a politeness delay scaled by the current backoff
+func (h *hostHealth) Delay(delay time.Duration) time.Duration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return time.Duration(float64(delay) * h.backoff)
+}
+
+// Concurrency returns the number of concurrent fetches allowed out of a
+// maximum, at least one
+func (h *hostHealth) Concurrency(max int) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if n := int(float64(max) / h.backoff); n > 1 {
+		return n
+	}
+	return 1
+}
+
+// snapshot returns the moving averages and the current backoff
+func (h *hostHealth) snapshot() (time.Duration, float64, float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.latency, h.errorRate, h.backoff
+}
+
+// degrading tests if the error of a fetch is a sign of a host in trouble,
+// e.g. network errors, 5xx and 429 responses, while other 4xx responses are
+// not
+func degrading(err error) bool {
+	if err == nil {
+		return false
+	}
+	var statusErr *fetcher.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == http.StatusTooManyRequests || statusErr.Code >= http.StatusInternalServerError
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+func TestHostHealthBackoff(t *testing.T) {
+	h := newHostHealth()
+	h.Observe(10*time.Millisecond, &fetcher.StatusError{Code: 404, Status: "404 Not Found"})
+	if h.Delay(time.Second) != time.Second || h.Concurrency(8) != 8 {
+		t.Errorf("hostHealth#Observe failed: 404 should not degrade the host")
+	}
+	h.Observe(10*time.Millisecond, fmt.Errorf("fetching failed: %w",
+		&fetcher.StatusError{Code: 503, Status: "503 Service Unavailable"}))
+	h.Observe(10*time.Millisecond, errors.New("connection refused"))
+	if h.Delay(time.Second) != 4*time.Second || h.Concurrency(8) != 2 {
+		t.Errorf("hostHealth#Observe failed: expected 4x backoff got delay %v concurrency %d",
+			h.Delay(time.Second), h.Concurrency(8))
+	}
+	for i := 0; i < 10; i++ {
+		h.Observe(10*time.Millisecond, errors.New("connection refused"))
+	}
+	if h.Delay(time.Second) != time.Duration(maxHostBackoff)*time.Second || h.Concurrency(8) != 1 {
+		t.Errorf("hostHealth#Observe failed: expected backoff capped at %v", maxHostBackoff)
+	}
+	h.Observe(10*time.Millisecond, nil)
+	if delay := h.Delay(time.Second); delay >= time.Duration(maxHostBackoff)*time.Second ||
+		delay < time.Duration(maxHostBackoff/2)*time.Second {
+		t.Errorf("hostHealth#Observe failed: expected gradual recovery got %v", delay)
+	}
+	for i := 0; i < 50; i++ {
+		h.Observe(10*time.Millisecond, nil)
+	}
+	if _, errorRate, backoff := h.snapshot(); backoff != 1 || errorRate > 0.01 {
+		t.Errorf("hostHealth#Observe failed: expected full recovery got backoff %v error rate %v",
+			backoff, errorRate)
+	}
+}
+
+func TestHostHealthSlowResponses(t *testing.T) {
+	h := newHostHealth()
+	for i := 0; i < healthMinSamples; i++ {
+		h.Observe(10*time.Millisecond, nil)
+	}
+	h.Observe(time.Second, nil)
+	if _, _, backoff := h.snapshot(); backoff != 2 {
+		t.Errorf("hostHealth#Observe failed: expected slow response to degrade the host got %v", backoff)
+	}
+}
+
+func TestHostHealthFetchesInFlight(t *testing.T) {
+	politeness := newPolitenessRegistry().Domain("example.com", 2)
+	www := &hostCrawl{health: politeness.health, semaphore: politeness.semaphore}
+	docs := &hostCrawl{health: politeness.health, semaphore: politeness.semaphore}
+	released := politeness.health.Released()
+	www.health.Started()
+	www.health.Started()
+	// The fetches of a host count for all the hosts of the domain
+	if !docs.overloaded() {
+		t.Errorf("hostCrawl#overloaded failed: expected the domain overloaded with 2 fetches")
+	}
+	www.health.Ended()
+	select {
+	case <-released:
+	default:
+		t.Errorf("hostHealth#Ended failed: expected the end of a fetch released")
+	}
+	if docs.overloaded() || politeness.health.Fetching() != 1 {
+		t.Errorf("hostCrawl#overloaded failed: expected the domain not overloaded with 1 fetch")
+	}
+}
@@ -0,0 +1,101 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// Upper bound of the first bucket of the latency histograms
+	histogramMin time.Duration = 100 * time.Microsecond
+	// Growth factor of the bounds of the buckets, the relative error of the
+	// quantiles
+	histogramGrowth float64 = 1.1
+	// Number of buckets, the last one holds anything above 100µs*1.1^180,
+	// about 45 minutes
+	histogramBuckets int = 181
+)
+
+// LatencyPercentiles are the percentiles of the response times of a host
+type LatencyPercentiles struct {
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+}
+
+// latencyHistogram is a streaming histogram of response times with
+// buckets growing geometrically, so that quantiles are estimated within a
+// 10% error in constant memory, whatever the number of responses
+type latencyHistogram struct {
+	mutex    sync.Mutex
+	counts   [histogramBuckets]uint64
+	total    uint64
+	min, max time.Duration
+}
+
+// Observe records a response time
+func (h *latencyHistogram) Observe(latency time.Duration) {
+	bucket := 0
+	if latency > histogramMin {
+		bucket = int(math.Ceil(math.Log(float64(latency)/float64(histogramMin)) / math.Log(histogramGrowth)))
+		if bucket >= histogramBuckets {
+			bucket = histogramBuckets - 1
+		}
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.total == 0 || latency < h.min {
+		h.min = latency
+	}
+	if latency > h.max {
+		h.max = latency
+	}
+	h.counts[bucket]++
+	h.total++
+}
+
+// Quantile returns an estimate of the q-quantile of the response times,
+// 0 <= q <= 1, the upper bound of the bucket holding it clamped to the
+// extremes observed, 0 if none was observed
+func (h *latencyHistogram) Quantile(q float64) time.Duration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.quantile(q)
+}
+
+// quantile is Quantile, the mutex must be held
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for bucket, count := range h.counts {
+		seen += count
+		if seen < rank {
+			continue
+		}
+		bound := time.Duration(float64(histogramMin) * math.Pow(histogramGrowth, float64(bucket)))
+		if bound > h.max {
+			bound = h.max
+		}
+		if bound < h.min {
+			bound = h.min
+		}
+		return bound
+	}
+	return h.max
+}
+
+// Percentiles returns the p50, p95 and p99 of the response times
+func (h *latencyHistogram) Percentiles() LatencyPercentiles {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return LatencyPercentiles{P50: h.quantile(0.5), P95: h.quantile(0.95), P99: h.quantile(0.99)}
+}
@@ -0,0 +1,33 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := latencyHistogram{}
+	if p := h.Percentiles(); p != (LatencyPercentiles{}) {
+		t.Errorf("latencyHistogram#Percentiles failed: expected zeros got %v", p)
+	}
+	// 1ms to 1000ms, the p-th percentile is p*10ms
+	for i := 1; i <= 1000; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+	p := h.Percentiles()
+	for name, c := range map[string]struct{ got, expected time.Duration }{
+		"p50": {p.P50, 500 * time.Millisecond},
+		"p95": {p.P95, 950 * time.Millisecond},
+		"p99": {p.P99, 990 * time.Millisecond},
+	} {
+		if c.got < c.expected || float64(c.got) > 1.1*float64(c.expected) {
+			t.Errorf("latencyHistogram#Quantile failed: %s expected ~%v got %v", name, c.expected, c.got)
+		}
+	}
+	if q := h.Quantile(1); q != time.Second {
+		t.Errorf("latencyHistogram#Quantile failed: expected the maximum got %v", q)
+	}
+	if q := h.Quantile(0); q < time.Millisecond || q > 1100*time.Microsecond {
+		t.Errorf("latencyHistogram#Quantile failed: expected ~1ms got %v", q)
+	}
+}
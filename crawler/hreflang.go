@@ -0,0 +1,30 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"net/url"
+)
+
+// Prefix of the metadata keys of the translations of a page, followed by
+// the language, e.g. hreflang:en-gb
+const hreflangMetadataPrefix string = "hreflang:"
+
+// withoutAlternates returns the links of a page but its translations,
+// they're crawled only if FollowHreflang is set
+func (c *WebCrawler) withoutAlternates(page *Page, links []*url.URL) []*url.URL {
+	if c.settings.FollowHreflang || len(page.Alternates) == 0 {
+		return links
+	}
+	alternates := make(map[string]bool, len(page.Alternates))
+	for _, link := range page.Alternates {
+		alternates[link.String()] = true
+	}
+	filtered := make([]*url.URL, 0, len(links))
+	for _, link := range links {
+		if !alternates[link.String()] {
+			filtered = append(filtered, link)
+		}
+	}
+	return filtered
+}
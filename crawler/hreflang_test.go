@@ -0,0 +1,40 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCrawlHreflang(t *testing.T) {
+	for _, follow := range []bool{false, true} {
+		var translations int32
+		handler := http.NewServeMux()
+		handler.HandleFunc("/", resourceMock(`<head><link rel="alternate" hreflang="it" href="/it/"></head>`))
+		handler.HandleFunc("/it/", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&translations, 1)
+		})
+		server := httptest.NewServer(handler)
+		testbus := testQueue{make(chan []byte)}
+		results := make(chan []ParsedResult)
+		go func() { results <- consumeEvents(&testbus) }()
+		crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+			withPolitenessDelay(0), func(s *CrawlerSettings) { s.FollowHreflang = follow })
+		crawler.CrawlSeeds(Seed{URL: server.URL + "/", Metadata: map[string]string{"customer": "acme"}})
+		testbus.Close()
+		res := <-results
+		server.Close()
+		if len(res) != 1 || res[0].Metadata["hreflang:it"] != server.URL+"/it/" || res[0].Metadata["customer"] != "acme" {
+			t.Errorf("Crawler#Crawl failed: expected the translation in the metadata got %v", res)
+		}
+		expected := int32(0)
+		if follow {
+			expected = 1
+		}
+		if fetched := atomic.LoadInt32(&translations); fetched != expected {
+			t.Errorf("Crawler#Crawl failed: follow %v expected translation fetched %d times got %d", follow, expected, fetched)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"net/url"
+	"sync"
+)
+
+// Maximum number of pages listed as sources of the links to an external
+// host
+const maxExternalSources = 3
+
+// ExternalHost contains the links found to a host of another registered
+// domain, followed or not, json serializable
+type ExternalHost struct {
+	// Links is the number of links to the host found on every page, a link
+	// repeated on the same page counts once
+	Links int64 `json:"links"`
+	// Sources are some of the pages linking the host, the first ones found
+	Sources []string `json:"sources"`
+}
+
+// externalInventory aggregates the links to the external hosts found during
+// a crawl, by host
+type externalInventory struct {
+	mutex sync.Mutex
+	hosts map[string]*ExternalHost
+}
+
+func newExternalInventory() *externalInventory {
+	return &externalInventory{hosts: make(map[string]*ExternalHost)}
+}
+
+// Add records an external link found on a page
+func (i *externalInventory) Add(source string, link *url.URL) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	host, ok := i.hosts[link.Host]
+	if !ok {
+		host = &ExternalHost{}
+		i.hosts[link.Host] = host
+	}
+	host.Links++
+	if len(host.Sources) == maxExternalSources {
+		return
+	}
+	for _, s := range host.Sources {
+		if s == source {
+			return
+		}
+	}
+	host.Sources = append(host.Sources, source)
+}
+
+// Snapshot returns a copy of the external hosts found so far, nil if none
+func (i *externalInventory) Snapshot() map[string]ExternalHost {
+	if i == nil {
+		return nil
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if len(i.hosts) == 0 {
+		return nil
+	}
+	hosts := make(map[string]ExternalHost, len(i.hosts))
+	for name, host := range i.hosts {
+		hosts[name] = ExternalHost{Links: host.Links, Sources: append([]string(nil), host.Sources...)}
+	}
+	return hosts
+}
+
+// inventoryExternalLinks records the external links of a page, given their
+// classes
+func (c *WebCrawler) inventoryExternalLinks(h *hostCrawl, source string,
+	links []*url.URL, classes []LinkClass) {
+	for i, link := range links {
+		if classes[i] == ExternalLink {
+			h.run.external.Add(source, link)
+		}
+	}
+}
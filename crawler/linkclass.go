@@ -0,0 +1,45 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import "net/url"
+
+// LinkClass tells how a link relates to the page linking it
+type LinkClass string
+
+const (
+	// InternalLink is a link to the same host of the page, or to one of its
+	// aliases
+	InternalLink LinkClass = "internal"
+	// SubdomainLink is a link to another host of the same registered domain
+	// of the page, e.g. from www.example.com to docs.example.com
+	SubdomainLink LinkClass = "subdomain"
+	// ExternalLink is a link to another registered domain, a third-party
+	ExternalLink LinkClass = "external"
+)
+
+// classifyLink tells how a link relates to the page linking it, the
+// registered domains are the eTLD+1 of the public suffix list
+func classifyLink(aliases HostAliases, page, link *url.URL) LinkClass {
+	from, to := aliases.Canonical(page.Hostname()), aliases.Canonical(link.Hostname())
+	switch {
+	case to == "" || to == from:
+		return InternalLink
+	case registeredDomain(to) == registeredDomain(from):
+		return SubdomainLink
+	default:
+		return ExternalLink
+	}
+}
+
+// classifyLinks returns the classes of the links of a page, in order
+func (c *WebCrawler) classifyLinks(page *url.URL, links []*url.URL) []LinkClass {
+	if len(links) == 0 {
+		return nil
+	}
+	classes := make([]LinkClass, len(links))
+	for i, link := range links {
+		classes[i] = classifyLink(c.settings.HostAliases, page, link)
+	}
+	return classes
+}
@@ -0,0 +1,55 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyLink(t *testing.T) {
+	page, _ := url.Parse("https://www.example.co.uk/foo")
+	aliases := HostAliases{"cdn.example.net": "www.example.co.uk"}
+	tests := map[string]LinkClass{
+		"https://www.example.co.uk/bar":  InternalLink,
+		"http://www.example.co.uk:8080/": InternalLink,
+		"/relative":                      InternalLink,
+		"https://cdn.example.net/bar":    InternalLink,
+		"https://docs.example.co.uk/":    SubdomainLink,
+		"https://example.co.uk/":         SubdomainLink,
+		"https://other.co.uk/":           ExternalLink,
+		"https://example.com/":           ExternalLink,
+	}
+	for link, expected := range tests {
+		u, _ := url.Parse(link)
+		if class := classifyLink(aliases, page, u); class != expected {
+			t.Errorf("classifyLink failed: expected %s for %s got %s", expected, link, class)
+		}
+	}
+}
+
+func TestCrawlPagesClassifyingLinks(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0))
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	for _, r := range <-results {
+		if len(r.LinkClasses) != len(r.Links) {
+			t.Fatalf("Crawler#Crawl failed: expected a class for each link got %v for %v", r.LinkClasses, r.Links)
+		}
+		for i, class := range r.LinkClasses {
+			expected := InternalLink
+			if strings.HasPrefix(r.Links[i], "https://example-page.com/") {
+				expected = ExternalLink
+			}
+			if class != expected {
+				t.Errorf("Crawler#Crawl failed: expected %s for %s got %s", expected, r.Links[i], class)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LogLevel defines the verbosity of the crawler logs, only the records with
+// a level greater or equal to the one set are written
+type LogLevel int
+
+const (
+	// LogDebug logs every link fetched and skipped
+	LogDebug LogLevel = iota - 1
+	// LogInfo logs the progress of the crawl of each domain, the default
+	LogInfo
+	// LogWarn logs only unexpected conditions and errors
+	LogWarn
+	// LogError logs only errors
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	default:
+		return "LogLevel(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// ParseLogLevel returns the `LogLevel` with the given name, one of debug,
+// info, warn or error
+func ParseLogLevel(name string) (LogLevel, error) {
+	for _, level := range []LogLevel{LogDebug, LogInfo, LogWarn, LogError} {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+	return LogInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// slogLevel returns the `slog.Level` matching a `LogLevel`
+func (l LogLevel) slogLevel() slog.Level {
+	switch l {
+	case LogDebug:
+		return slog.LevelDebug
+	case LogWarn:
+		return slog.LevelWarn
+	case LogError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// newLogger creates the logger of the crawler, writing on the LogHandler
+// set or in text form on stderr, filtering by LogLevel
+func newLogger(settings *CrawlerSettings) *slog.Logger {
+	if settings.LogHandler != nil {
+		return slog.New(settings.LogHandler)
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr,
+		&slog.HandlerOptions{Level: settings.LogLevel.slogLevel()}))
+}
+
+// WithLogHandler sets the `slog.Handler` the crawler logs to, e.g. a JSON
+// one for machine-parsable logs, LogLevel is not applied as the handler
+// decides the records to write
+func WithLogHandler(handler slog.Handler) CrawlerOpt {
+	return func(s *CrawlerSettings) {
+		s.LogHandler = handler
+	}
+}
+
+// newJobID generates a random identifier of a crawl, attached to every log
+// record
+func newJobID() string {
+	return randomID()
+}
+
+// newTraceID generates a random identifier of a fetch, attached to its log
+// records, its events and its result
+func newTraceID() string {
+	return randomID()
+}
+
+// randomID generates a random hex identifier of 16 characters
+func randomID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// hostLogger returns a logger attaching the job ID of the running crawl and
+// a host to every record
+func (c *WebCrawler) hostLogger(run *crawlRun, host string) *slog.Logger {
+	return c.logger.With("job", run.job, "host", host)
+}
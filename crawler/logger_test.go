@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrawlLogs(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), WithLogHandler(handler))
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	<-results
+	host, _ := url.Parse(server.URL)
+	fetched := 0
+	job := crawler.lastRun.Load().job
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Crawler logs failed: invalid record %s: %v", line, err)
+		}
+		if record["job"] != job {
+			t.Errorf("Crawler logs failed: expected job %s got %v", job, record["job"])
+		}
+		// A crawl done is not an interrupted one
+		if record["msg"] == "Interrupted, shutting down" {
+			t.Errorf("Crawler logs failed: unexpected interruption %v", record)
+		}
+		if record["msg"] != "Fetched" {
+			continue
+		}
+		fetched++
+		if record["host"] != host.Host || record["url"] == nil || record["depth"] == nil {
+			t.Errorf("Crawler logs failed: missing attributes in %v", record)
+		}
+	}
+	if fetched != 3 {
+		t.Errorf("Crawler logs failed: expected 3 fetched records got %d", fetched)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for name, expected := range map[string]LogLevel{
+		"debug": LogDebug, "INFO": LogInfo, "Warn": LogWarn, "error": LogError,
+	} {
+		level, err := ParseLogLevel(name)
+		if err != nil || level != expected {
+			t.Errorf("ParseLogLevel(%s) failed: expected %s got %s, %v", name, expected, level, err)
+		}
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Errorf("ParseLogLevel failed: expected error on unknown level")
+	}
+}
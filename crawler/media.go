@@ -0,0 +1,135 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MediaResult is the type of the `SitemapMedia` results, produced for every
+// image and video listed by the sitemaps along the pages embedding them
+const MediaResult ResultType = "media"
+
+// MediaKind is the kind of a media listed by a sitemap
+type MediaKind string
+
+const (
+	// ImageMedia is an image listed by the image sitemap extension
+	ImageMedia MediaKind = "image"
+	// VideoMedia is a video listed by the video sitemap extension
+	VideoMedia MediaKind = "video"
+)
+
+// sitemapImage is an image of a page listed by a sitemap, see
+// https://www.google.com/schemas/sitemap-image/1.1
+type sitemapImage struct {
+	Loc         string `xml:"loc"`
+	Caption     string `xml:"caption"`
+	Title       string `xml:"title"`
+	GeoLocation string `xml:"geo_location"`
+	License     string `xml:"license"`
+}
+
+// sitemapVideo is a video of a page listed by a sitemap, see
+// https://www.google.com/schemas/sitemap-video/1.1
+type sitemapVideo struct {
+	ThumbnailLoc    string `xml:"thumbnail_loc"`
+	Title           string `xml:"title"`
+	Description     string `xml:"description"`
+	ContentLoc      string `xml:"content_loc"`
+	PlayerLoc       string `xml:"player_loc"`
+	Duration        string `xml:"duration"`
+	PublicationDate string `xml:"publication_date"`
+}
+
+// SitemapMedia is an image or a video listed by a sitemap for one of its
+// pages, to index the media of a site without fetching its pages, json
+// serializable to be sent on message queues
+type SitemapMedia struct {
+	Kind MediaKind `json:"kind"`
+	// URL is the location of the image or of the video content, the player
+	// one if the video doesn't list its content
+	URL string `json:"url"`
+	// Page is the URL of the page embedding the media
+	Page        string `json:"page"`
+	Title       string `json:"title,omitempty"`
+	Caption     string `json:"caption,omitempty"`
+	Description string `json:"description,omitempty"`
+	// ThumbnailURL and PlayerURL are set for the videos only
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	PlayerURL    string `json:"player_url,omitempty"`
+	// Duration is the duration of a video in seconds, 0 if unknown
+	Duration        int               `json:"duration,omitempty"`
+	PublicationDate string            `json:"publication_date,omitempty"`
+	GeoLocation     string            `json:"geo_location,omitempty"`
+	License         string            `json:"license,omitempty"`
+	Sitemap         string            `json:"sitemap"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+// sitemapMedia returns the images and the videos of an URL listed by a
+// sitemap, their locations resolved against the page, the ones with no
+// location are left out
+func sitemapMedia(sitemapLink string, page *url.URL, u sitemapURL) []SitemapMedia {
+	resolve := func(ref string) string {
+		ref = strings.TrimSpace(ref)
+		link, err := url.Parse(ref)
+		if ref == "" || err != nil {
+			return ""
+		}
+		return page.ResolveReference(link).String()
+	}
+	media := []SitemapMedia{}
+	for _, image := range u.Images {
+		loc := resolve(image.Loc)
+		if loc == "" {
+			continue
+		}
+		media = append(media, SitemapMedia{
+			Kind:        ImageMedia,
+			URL:         loc,
+			Page:        page.String(),
+			Title:       strings.TrimSpace(image.Title),
+			Caption:     strings.TrimSpace(image.Caption),
+			GeoLocation: strings.TrimSpace(image.GeoLocation),
+			License:     resolve(image.License),
+			Sitemap:     sitemapLink,
+		})
+	}
+	for _, video := range u.Videos {
+		content, player := resolve(video.ContentLoc), resolve(video.PlayerLoc)
+		loc := content
+		if loc == "" {
+			loc = player
+		}
+		if loc == "" {
+			continue
+		}
+		duration, _ := strconv.Atoi(strings.TrimSpace(video.Duration))
+		media = append(media, SitemapMedia{
+			Kind:            VideoMedia,
+			URL:             loc,
+			Page:            page.String(),
+			Title:           strings.TrimSpace(video.Title),
+			Description:     strings.TrimSpace(video.Description),
+			ThumbnailURL:    resolve(video.ThumbnailLoc),
+			PlayerURL:       player,
+			Duration:        max(duration, 0),
+			PublicationDate: strings.TrimSpace(video.PublicationDate),
+			Sitemap:         sitemapLink,
+		})
+	}
+	return media
+}
+
+// emitSitemapMedia produces the `SitemapMedia` of an URL listed by a
+// sitemap, the media aren't checked against the rules of the domain, they're
+// often served by CDNs
+func (c *WebCrawler) emitSitemapMedia(h *hostCrawl, sitemapLink string, page *url.URL, u sitemapURL) {
+	for _, media := range sitemapMedia(sitemapLink, page, u) {
+		media.Metadata = h.metadata
+		c.emitResult(h.run, MediaResult, media, c.logger.With("job", h.run.job, "url", media.URL))
+	}
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitemapMedia(t *testing.T) {
+	s, err := parseSitemap(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"
+	xmlns:image="http://www.google.com/schemas/sitemap-image/1.1"
+	xmlns:video="http://www.google.com/schemas/sitemap-video/1.1">
+	<url>
+		<loc>https://example.com/gallery</loc>
+		<image:image>
+			<image:loc>https://cdn.example.com/cat.jpg</image:loc>
+			<image:caption> A cat </image:caption>
+		</image:image>
+		<image:image><image:loc>/dog.png</image:loc><image:title>Dog</image:title></image:image>
+		<image:image><image:caption>No location</image:caption></image:image>
+		<video:video>
+			<video:thumbnail_loc>https://cdn.example.com/thumb.jpg</video:thumbnail_loc>
+			<video:title>Grilling steaks</video:title>
+			<video:description>How to grill steaks</video:description>
+			<video:player_loc>https://example.com/player?video=123</video:player_loc>
+			<video:duration>600</video:duration>
+		</video:video>
+	</url>
+</urlset>`))
+	if err != nil {
+		t.Fatalf("parseSitemap failed: %v", err)
+	}
+	page, _ := url.Parse(s.URLs[0].Loc)
+	media := sitemapMedia("https://example.com/sitemap.xml", page, s.URLs[0])
+	expected := []SitemapMedia{
+		{Kind: ImageMedia, URL: "https://cdn.example.com/cat.jpg", Page: "https://example.com/gallery",
+			Caption: "A cat", Sitemap: "https://example.com/sitemap.xml"},
+		{Kind: ImageMedia, URL: "https://example.com/dog.png", Page: "https://example.com/gallery",
+			Title: "Dog", Sitemap: "https://example.com/sitemap.xml"},
+		{Kind: VideoMedia, URL: "https://example.com/player?video=123", Page: "https://example.com/gallery",
+			Title: "Grilling steaks", Description: "How to grill steaks",
+			ThumbnailURL: "https://cdn.example.com/thumb.jpg", PlayerURL: "https://example.com/player?video=123",
+			Duration: 600, Sitemap: "https://example.com/sitemap.xml"},
+	}
+	if !reflect.DeepEqual(media, expected) {
+		t.Errorf("sitemapMedia failed: expected %+v got %+v", expected, media)
+	}
+}
+
+func TestCrawlSitemapOnlyEmitMedia(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<urlset xmlns:video="http://www.google.com/schemas/sitemap-video/1.1">
+			<url><loc>http://%[1]s/watch</loc><video:video>
+				<video:content_loc>http://%[1]s/steaks.mp4</video:content_loc>
+				<video:title>Grilling steaks</video:title>
+			</video:video></url>
+		</urlset>`, r.Host)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []SitemapMedia)
+	go func() {
+		var media []SitemapMedia
+		events := make(chan []byte)
+		go func() {
+			_ = testbus.Consume(events)
+			close(events)
+		}()
+		for e := range events {
+			var m SitemapMedia
+			if err := json.Unmarshal(e, &m); err == nil && m.Kind != "" {
+				media = append(media, m)
+			}
+		}
+		results <- media
+	}()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.SitemapOnly = true })
+	crawler.CrawlSeeds(Seed{URL: server.URL + "/", Metadata: map[string]string{"customer": "acme"}})
+	testbus.Close()
+	expected := []SitemapMedia{{
+		Kind:     VideoMedia,
+		URL:      server.URL + "/steaks.mp4",
+		Page:     server.URL + "/watch",
+		Title:    "Grilling steaks",
+		Sitemap:  server.URL + "/sitemap.xml",
+		Metadata: map[string]string{"customer": "acme"},
+	}}
+	if media := <-results; !reflect.DeepEqual(media, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %+v got %+v", expected, media)
+	}
+}
@@ -0,0 +1,178 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// CrawlSummary is the outcome of a crawl job, sent to the notifiers once it
+// finishes or fails
+type CrawlSummary struct {
+	Job      string    `json:"job"`
+	Seeds    []string  `json:"seeds"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Hosts is the number of hosts crawled
+	Hosts   int   `json:"hosts"`
+	Fetched int64 `json:"fetched"`
+	Skipped int64 `json:"skipped"`
+	Errors  int64 `json:"errors"`
+	// Latency are the percentiles of the response times of each host
+	// crawled, since the creation of the crawler
+	Latency map[string]LatencyPercentiles `json:"latency,omitempty"`
+	// Robots are the robots.txt directives honored on each host crawled
+	// having a valid one
+	Robots map[string]RobotsSummary `json:"robots,omitempty"`
+	// Err is the reason of the failure of the job, empty if it finished
+	Err string `json:"error,omitempty"`
+}
+
+// Failed tests if the job failed
+func (s CrawlSummary) Failed() bool {
+	return s.Err != ""
+}
+
+// String returns a human readable report of the job
+func (s CrawlSummary) String() string {
+	if s.Failed() {
+		return fmt.Sprintf("Crawl %s failed after %s: %s", s.Job,
+			s.Finished.Sub(s.Started).Round(time.Second), s.Err)
+	}
+	return fmt.Sprintf("Crawl %s of %s finished in %s: %d hosts, %d pages fetched, %d links skipped, %d errors",
+		s.Job, strings.Join(s.Seeds, ", "), s.Finished.Sub(s.Started).Round(time.Second),
+		s.Hosts, s.Fetched, s.Skipped, s.Errors)
+}
+
+// Notifier is notified with the summary of every crawl job once it
+// finishes or fails, e.g. to alert the operators of scheduled crawls
+type Notifier interface {
+	Notify(CrawlSummary) error
+}
+
+// webhookNotifier POSTs the summaries as JSON to an URL
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a `Notifier` POSTing the summaries of the jobs
+// as JSON to an URL
+func NewWebhookNotifier(url string) Notifier {
+	return webhookNotifier{url, &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Notify POSTs a summary
+func (n webhookNotifier) Notify(summary CrawlSummary) error {
+	body, _ := json.Marshal(summary)
+	return postJSON(n.client, n.url, body)
+}
+
+// slackNotifier posts the summaries to a Slack incoming webhook
+type slackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlackNotifier creates a `Notifier` posting the summaries of the jobs
+// as messages to a Slack incoming webhook URL
+func NewSlackNotifier(url string) Notifier {
+	return slackNotifier{url, &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Notify posts a summary as a Slack message
+func (n slackNotifier) Notify(summary CrawlSummary) error {
+	body, _ := json.Marshal(map[string]string{"text": summary.String()})
+	return postJSON(n.client, n.url, body)
+}
+
+// postJSON POSTs a JSON body to an URL, failing on responses not in the
+// 2xx range
+func postJSON(client *http.Client, url string, body []byte) error {
+	res, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("notifying %s failed: %w", url, err)
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("notifying %s failed: unexpected status %s", url, res.Status)
+	}
+	return nil
+}
+
+// emailNotifier sends the summaries by email through an SMTP server
+type emailNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+// NewEmailNotifier creates a `Notifier` sending the summaries of the jobs
+// by email through an SMTP server at addr, host:port, auth may be nil
+func NewEmailNotifier(addr string, auth smtp.Auth, from string, to ...string) Notifier {
+	return emailNotifier{addr, auth, from, to}
+}
+
+// Notify sends a summary by email
+func (n emailNotifier) Notify(summary CrawlSummary) error {
+	subject := fmt.Sprintf("Crawl %s finished", summary.Job)
+	if summary.Failed() {
+		subject = fmt.Sprintf("Crawl %s failed", summary.Job)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n",
+		n.from, strings.Join(n.to, ", "), subject, summary)
+	if err := smtp.SendMail(n.addr, n.auth, n.from, n.to, []byte(msg)); err != nil {
+		return fmt.Errorf("notifying %s failed: %w", strings.Join(n.to, ", "), err)
+	}
+	return nil
+}
+
+// summarize returns the summary of the running job, the counters are the
+// difference between the current ones and the ones at the start of the job
+func (c *WebCrawler) summarize(run *crawlRun, seeds []Seed, started time.Time,
+	before map[string]HostStats, err error) CrawlSummary {
+	summary := CrawlSummary{Job: run.job, Started: started, Finished: time.Now()}
+	for _, seed := range seeds {
+		summary.Seeds = append(summary.Seeds, seed.URL)
+	}
+	for host, stats := range c.stats.Snapshot() {
+		prev := before[host]
+		if stats.Fetched+stats.Skipped+stats.Errors == prev.Fetched+prev.Skipped+prev.Errors {
+			continue
+		}
+		summary.Hosts++
+		if summary.Latency == nil {
+			summary.Latency = make(map[string]LatencyPercentiles)
+		}
+		summary.Latency[host] = stats.Latency
+		if stats.Robots != nil {
+			if summary.Robots == nil {
+				summary.Robots = make(map[string]RobotsSummary)
+			}
+			summary.Robots[host] = *stats.Robots
+		}
+		summary.Fetched += stats.Fetched - prev.Fetched
+		summary.Skipped += stats.Skipped - prev.Skipped
+		summary.Errors += stats.Errors - prev.Errors
+	}
+	if err != nil {
+		summary.Err = err.Error()
+	}
+	return summary
+}
+
+// notify sends the summary of a job to every notifier, failures are logged
+func (c *WebCrawler) notify(run *crawlRun, summary CrawlSummary) {
+	for _, notifier := range c.settings.Notifiers {
+		if err := notifier.Notify(summary); err != nil {
+			c.logger.Error("Unable to send notification", "job", run.job, "err", err)
+		}
+	}
+}
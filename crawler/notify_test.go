@@ -0,0 +1,90 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingNotifier records the summaries notified
+type recordingNotifier struct {
+	summaries []CrawlSummary
+}
+
+func (n *recordingNotifier) Notify(summary CrawlSummary) error {
+	n.summaries = append(n.summaries, summary)
+	return nil
+}
+
+func TestCrawlNotifiesSummary(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	notifier := &recordingNotifier{}
+	crawler := New("test-agent", &testQueue{make(chan []byte, 10)}, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.Notifiers = []Notifier{notifier} })
+	for i := 0; i < 2; i++ {
+		crawler.Crawl(server.URL + "/foo")
+	}
+	if len(notifier.summaries) != 2 {
+		t.Fatalf("Crawler#Crawl failed: expected 2 summaries got %v", notifier.summaries)
+	}
+	// The counters of each summary are the ones of its job only, the pages
+	// visited by the first job are skipped by the second
+	first, second := notifier.summaries[0], notifier.summaries[1]
+	if first.Failed() || first.Hosts != 1 || first.Fetched != 3 || len(first.Seeds) != 1 {
+		t.Errorf("Crawler#Crawl failed: unexpected summary %#v", first)
+	}
+	if second.Failed() || second.Fetched != 0 || second.Skipped != 1 || second.Job == first.Job {
+		t.Errorf("Crawler#Crawl failed: unexpected summary %#v", second)
+	}
+}
+
+func TestCrawlNotifiesFailure(t *testing.T) {
+	notifier := &recordingNotifier{}
+	crawler := New("test-agent", &testQueue{make(chan []byte, 10)}, func(s *CrawlerSettings) {
+		s.Notifiers = []Notifier{notifier}
+		s.OutboxPath = t.TempDir() + "/missing/outbox.log"
+	})
+	crawler.Crawl("http://localhost")
+	if len(notifier.summaries) != 1 || !notifier.summaries[0].Failed() ||
+		!strings.Contains(notifier.summaries[0].String(), "outbox unavailable") {
+		t.Errorf("Crawler#Crawl failed: unexpected summaries %v", notifier.summaries)
+	}
+}
+
+func TestWebhookAndSlackNotifiers(t *testing.T) {
+	bodies := make(chan []byte, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	summary := CrawlSummary{Job: "job", Seeds: []string{"https://example.com"}, Fetched: 3}
+	if err := NewWebhookNotifier(server.URL).Notify(summary); err != nil {
+		t.Fatalf("webhookNotifier#Notify failed: %v", err)
+	}
+	var decoded CrawlSummary
+	if err := json.Unmarshal(<-bodies, &decoded); err != nil || decoded.Fetched != 3 {
+		t.Errorf("webhookNotifier#Notify failed: unexpected summary %v %v", decoded, err)
+	}
+	if err := NewSlackNotifier(server.URL + "/fail").Notify(summary); err == nil {
+		t.Error("slackNotifier#Notify failed: expected error")
+	}
+	var message map[string]string
+	if err := json.Unmarshal(<-bodies, &message); err != nil ||
+		!strings.Contains(message["text"], "3 pages fetched") {
+		t.Errorf("slackNotifier#Notify failed: unexpected message %v %v", message, err)
+	}
+	failed := CrawlSummary{Job: "job", Err: errors.New("boom").Error()}
+	if !strings.Contains(failed.String(), "failed") {
+		t.Errorf("CrawlSummary#String failed: unexpected report %s", failed)
+	}
+}
@@ -0,0 +1,120 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import "sync"
+
+// Number of links dispatched ahead of the oldest one whose result is not
+// produced yet, bounding the results buffered out of order
+const orderedResultsWindow uint64 = 1 << 10
+
+// resultSequencer produces the results of a domain in the order their links
+// were dispatched, so that a page is always produced before the pages it
+// links to. The results completed out of order are buffered till the ones of
+// all the links dispatched before them are produced, up to a window of
+// links, see Full. Results are emitted without holding the lock, by one
+// goroutine at a time to keep their order.
+type resultSequencer struct {
+	mutex sync.Mutex
+	// seq is the sequence number of the next link dispatched
+	seq uint64
+	// next is the sequence number of the next link to produce the result of
+	next    uint64
+	pending map[uint64]*ParsedResult
+	emit    func(ParsedResult)
+	window  uint64
+	// emitting is set while a goroutine emits the results ready, the others
+	// leave theirs to it
+	emitting bool
+	// flushed skips the links never completed from now on
+	flushed bool
+}
+
+func newResultSequencer(emit func(ParsedResult)) *resultSequencer {
+	return &resultSequencer{
+		pending: make(map[uint64]*ParsedResult),
+		emit:    emit,
+		window:  orderedResultsWindow,
+	}
+}
+
+// Next returns the sequence number of a link being dispatched
+func (s *resultSequencer) Next() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	seq := s.seq
+	s.seq++
+	return seq
+}
+
+// Full tests if the window of links dispatched ahead of the oldest one not
+// produced yet is full, no more links should be dispatched till it's
+// completed
+func (s *resultSequencer) Full() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.seq-s.next >= s.window
+}
+
+// Complete marks the end of the processing of a link with its result, nil
+// if it produced none, emitting the results now in order. Every link
+// dispatched must be completed, or the results following it are held.
+func (s *resultSequencer) Complete(seq uint64, result *ParsedResult) {
+	s.mutex.Lock()
+	// Links completed after a flush were skipped already
+	if seq >= s.next {
+		s.pending[seq] = result
+	}
+	s.mutex.Unlock()
+	s.produce()
+}
+
+// Flush emits the results buffered in order, skipping the links never
+// completed, e.g. aborted on shutdown
+func (s *resultSequencer) Flush() {
+	s.mutex.Lock()
+	s.flushed = true
+	s.mutex.Unlock()
+	s.produce()
+}
+
+// produce emits the results ready in order, unless another goroutine is
+// already emitting them
+func (s *resultSequencer) produce() {
+	s.mutex.Lock()
+	if s.emitting {
+		s.mutex.Unlock()
+		return
+	}
+	s.emitting = true
+	for {
+		ready := s.ready()
+		if len(ready) == 0 {
+			s.emitting = false
+			s.mutex.Unlock()
+			return
+		}
+		s.mutex.Unlock()
+		for _, result := range ready {
+			s.emit(*result)
+		}
+		s.mutex.Lock()
+	}
+}
+
+// ready removes the results ready to be produced from the buffer, returning
+// them in order, the lock must be held
+func (s *resultSequencer) ready() []*ParsedResult {
+	var ready []*ParsedResult
+	for ; s.next < s.seq; s.next++ {
+		result, ok := s.pending[s.next]
+		if !ok && !s.flushed {
+			break
+		}
+		delete(s.pending, s.next)
+		if result != nil {
+			ready = append(ready, result)
+		}
+	}
+	return ready
+}
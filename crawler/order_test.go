@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResultSequencer(t *testing.T) {
+	var emitted []string
+	s := newResultSequencer(func(r ParsedResult) { emitted = append(emitted, r.URL) })
+	first, second, third := s.Next(), s.Next(), s.Next()
+	s.Complete(third, &ParsedResult{URL: "third"})
+	s.Complete(second, nil)
+	if len(emitted) != 0 {
+		t.Errorf("resultSequencer#Complete failed: expected no results got %v", emitted)
+	}
+	s.Complete(first, &ParsedResult{URL: "first"})
+	expected := []string{"first", "third"}
+	if !reflect.DeepEqual(emitted, expected) {
+		t.Errorf("resultSequencer#Complete failed: expected %v got %v", expected, emitted)
+	}
+}
+
+func TestResultSequencerFlush(t *testing.T) {
+	var emitted []string
+	s := newResultSequencer(func(r ParsedResult) { emitted = append(emitted, r.URL) })
+	_, second := s.Next(), s.Next()
+	s.Complete(second, &ParsedResult{URL: "second"})
+	s.Flush()
+	expected := []string{"second"}
+	if !reflect.DeepEqual(emitted, expected) {
+		t.Errorf("resultSequencer#Flush failed: expected %v got %v", expected, emitted)
+	}
+}
+
+func TestResultSequencerWindow(t *testing.T) {
+	s := newResultSequencer(func(ParsedResult) {})
+	s.window = 2
+	first, _ := s.Next(), s.Next()
+	if !s.Full() {
+		t.Errorf("resultSequencer#Full failed: expected the window full")
+	}
+	s.Complete(first, nil)
+	if s.Full() {
+		t.Errorf("resultSequencer#Full failed: expected the window not full")
+	}
+}
+
+func TestResultSequencerEmitsWithoutLock(t *testing.T) {
+	var s *resultSequencer
+	var emitted []string
+	s = newResultSequencer(func(r ParsedResult) {
+		emitted = append(emitted, r.URL)
+		// Completing another link while emitting must not deadlock, its
+		// result is emitted by the goroutine already emitting
+		if r.URL == "first" {
+			s.Complete(1, &ParsedResult{URL: "second"})
+		}
+	})
+	first, _ := s.Next(), s.Next()
+	s.Complete(first, &ParsedResult{URL: "first"})
+	expected := []string{"first", "second"}
+	if !reflect.DeepEqual(emitted, expected) {
+		t.Errorf("resultSequencer#Complete failed: expected %v got %v", expected, emitted)
+	}
+}
+
+func TestCrawlPagesWithOrderedResults(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/foo", resourceMock(`<body><a href="/slow">slow</a><a href="/fast">fast</a></body>`))
+	handler.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte(`<body><a href="/slow/child">child</a></body>`))
+	})
+	handler.HandleFunc("/fast", resourceMock(`<body><a href="/fast/child">child</a></body>`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), withMaxDepth(1), func(s *CrawlerSettings) {
+			s.OrderedResults = true
+		})
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	res := <-results
+	var crawled []string
+	for _, r := range res {
+		crawled = append(crawled, r.URL)
+	}
+	expected := []string{server.URL + "/foo", server.URL + "/slow", server.URL + "/fast"}
+	if !reflect.DeepEqual(crawled, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, crawled)
+	}
+}
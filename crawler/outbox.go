@@ -0,0 +1,206 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// outboxRecord is a line of the outbox log, a payload to produce with its
+// result type or the commit of a payload produced
+type outboxRecord struct {
+	ID        uint64     `json:"id"`
+	Type      ResultType `json:"type,omitempty"`
+	Payload   []byte     `json:"payload,omitempty"`
+	Committed bool       `json:"committed,omitempty"`
+}
+
+// outbox is a write-ahead log of the results, each payload is written on
+// disk before being produced and marked as committed once produced, so that
+// the payloads not produced because of a crash or of a failure of the queue
+// are produced again on the next crawl. Payloads are produced at least once.
+type outbox struct {
+	mutex   sync.Mutex
+	file    *os.File
+	nextID  uint64
+	pending map[uint64]outboxRecord
+}
+
+// openOutbox opens the outbox log at a path, creating it if missing, and
+// compacts it leaving the payloads not committed only
+func openOutbox(path string) (*outbox, error) {
+	o := &outbox{pending: make(map[uint64]outboxRecord)}
+	if file, err := os.Open(path); err == nil {
+		err = o.load(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("opening outbox %s failed: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("opening outbox %s failed: %w", path, err)
+	}
+	if err := o.compact(path); err != nil {
+		return nil, fmt.Errorf("opening outbox %s failed: %w", path, err)
+	}
+	return o, nil
+}
+
+// load reads the records of the log, a truncated last line, left by a
+// crash while writing it, is ignored
+func (o *outbox) load(file *os.File) error {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var record outboxRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if record.Committed {
+			delete(o.pending, record.ID)
+		} else {
+			o.pending[record.ID] = record
+		}
+		if record.ID >= o.nextID {
+			o.nextID = record.ID + 1
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the log with the pending payloads only, replacing the
+// old one atomically
+func (o *outbox) compact(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, id := range o.pendingIDs() {
+		if err := enc.Encode(o.pending[id]); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	o.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	return err
+}
+
+// pendingIDs returns the IDs of the payloads not committed, in order of
+// writing
+func (o *outbox) pendingIDs() []uint64 {
+	ids := make([]uint64, 0, len(o.pending))
+	for id := range o.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// write appends a record to the log, synced to disk
+func (o *outbox) write(record outboxRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := o.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return o.file.Sync()
+}
+
+// Append writes a payload to the log before producing it, returns its ID
+func (o *outbox) Append(resultType ResultType, payload []byte) (uint64, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	record := outboxRecord{ID: o.nextID, Type: resultType, Payload: payload}
+	if err := o.write(record); err != nil {
+		return 0, fmt.Errorf("writing to outbox failed: %w", err)
+	}
+	o.nextID++
+	o.pending[record.ID] = record
+	return record.ID, nil
+}
+
+// Commit marks a payload as produced
+func (o *outbox) Commit(id uint64) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if err := o.write(outboxRecord{ID: id, Committed: true}); err != nil {
+		return fmt.Errorf("committing to outbox failed: %w", err)
+	}
+	delete(o.pending, id)
+	return nil
+}
+
+// Replay produces again the payloads not committed, in order of writing,
+// committing the ones produced successfully
+func (o *outbox) Replay(produce func(ResultType, []byte) error) (int, error) {
+	o.mutex.Lock()
+	ids := o.pendingIDs()
+	records := make([]outboxRecord, len(ids))
+	for i, id := range ids {
+		records[i] = o.pending[id]
+	}
+	o.mutex.Unlock()
+	for i, record := range records {
+		if err := produce(record.Type, record.Payload); err != nil {
+			return i, err
+		}
+		if err := o.Commit(record.ID); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// Close closes the log
+func (o *outbox) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.file.Close()
+}
+
+// openOutbox opens the outbox of the crawl, producing again the results
+// left in it by the previous crawls
+func (c *WebCrawler) openOutbox(run *crawlRun) error {
+	o, err := openOutbox(c.settings.OutboxPath)
+	if err != nil {
+		return err
+	}
+	replayed, err := o.Replay(c.produce)
+	if replayed > 0 {
+		c.logger.Info("Replayed results from outbox", "job", run.job, "count", replayed)
+	}
+	if err != nil {
+		// The results not replayed are left for the next crawl
+		c.logger.Error("Unable to replay results from outbox", "job", run.job, "err", err)
+	}
+	run.outbox = o
+	return nil
+}
+
+// closeOutbox closes the outbox of the crawl
+func (c *WebCrawler) closeOutbox(run *crawlRun) {
+	if err := run.outbox.Close(); err != nil {
+		c.logger.Error("Unable to close outbox", "job", run.job, "err", err)
+	}
+}
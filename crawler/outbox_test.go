@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutboxReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	o, err := openOutbox(path)
+	if err != nil {
+		t.Fatalf("openOutbox failed: %v", err)
+	}
+	ids := []uint64{}
+	for _, payload := range []string{"first", "second", "third"} {
+		id, err := o.Append(PageResult, []byte(payload))
+		if err != nil {
+			t.Fatalf("outbox#Append failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := o.Commit(ids[1]); err != nil {
+		t.Fatalf("outbox#Commit failed: %v", err)
+	}
+	o.Close()
+	// A line torn by a crash while writing it
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	file.WriteString(`{"id":3,"payl`)
+	file.Close()
+
+	o, err = openOutbox(path)
+	if err != nil {
+		t.Fatalf("openOutbox failed: %v", err)
+	}
+	defer o.Close()
+	replayed := []string{}
+	n, err := o.Replay(func(resultType ResultType, payload []byte) error {
+		if resultType != PageResult {
+			t.Errorf("outbox#Replay failed: expected %s got %s",
+				PageResult, resultType)
+		}
+		replayed = append(replayed, string(payload))
+		return nil
+	})
+	if err != nil || n != 2 || fmt.Sprint(replayed) != "[first third]" {
+		t.Errorf("outbox#Replay failed: expected [first third] got %v %v", replayed, err)
+	}
+	if n, _ := o.Replay(func(ResultType, []byte) error { return nil }); n != 0 {
+		t.Errorf("outbox#Replay failed: expected nothing left got %d", n)
+	}
+	if id, _ := o.Append(PageResult, []byte("fourth")); id <= ids[2] {
+		t.Errorf("outbox#Append failed: ID %d reused", id)
+	}
+}
+
+// failingQueue is a producer always failing
+type failingQueue struct{}
+
+func (failingQueue) Produce([]byte) error { return errors.New("queue unavailable") }
+
+func TestCrawlPagesWithOutbox(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	withOutbox := func(s *CrawlerSettings) { s.OutboxPath = path }
+	// The results are lost by the queue, they're left in the outbox
+	crawler := New("test-agent", failingQueue{}, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), withOutbox)
+	crawler.Crawl(server.URL + "/foo")
+
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler = New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), withOutbox)
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	// The results of the first crawl are replayed, the ones of the second
+	// are produced as usual
+	if res := <-results; len(res) != 6 {
+		t.Errorf("Crawler#Crawl failed: expected 6 results got %v", res)
+	}
+}
@@ -0,0 +1,175 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Score added to the pagination links in the frontier, so that paginated
+// listings are traversed before the other links
+const paginationPriority float64 = 1 << 20
+
+// paginationParams are the query parameters carrying the number of the page
+// of a listing, e.g. ?page=2. Ambiguous ones are left out, e.g. WordPress
+// posts are ?p=<id>, the pagination links are crawled at the same depth and
+// would escape the depth limits.
+var paginationParams = []string{"page", "paged"}
+
+// isPagination tests if an URL looks like a page of a paginated listing,
+// e.g. /posts?page=2 or /posts/page/2
+func isPagination(link *url.URL) bool {
+	query := link.Query()
+	for _, param := range paginationParams {
+		if _, err := strconv.Atoi(query.Get(param)); err == nil {
+			return true
+		}
+	}
+	segments := strings.Split(strings.Trim(link.Path, "/"), "/")
+	for i := 0; i < len(segments)-1; i++ {
+		if strings.EqualFold(segments[i], "page") {
+			if _, err := strconv.Atoi(segments[i+1]); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// paginationScorer is a `Scorer` putting the pagination links first, the
+// ones declared by rel=next and rel=prev and the ones looking like pages of
+// a listing
+type paginationScorer struct {
+	Scorer
+	// declared are the links declared as pagination by the pages of the
+	// domain crawled so far
+	declared sync.Map
+	// listed are the positions in their listing of the pagination links
+	// waiting to be crawled at the depth of the first page, forgotten once
+	// crawled
+	mutex  sync.Mutex
+	listed map[string]int
+}
+
+// Declare marks a link as pagination, before pushing it to the frontier
+func (s *paginationScorer) Declare(link *url.URL) {
+	s.declared.Store(link.String(), struct{}{})
+}
+
+// Paginated tests if a link is a pagination one
+func (s *paginationScorer) Paginated(link *url.URL) bool {
+	_, declared := s.declared.Load(link.String())
+	return declared || isPagination(link)
+}
+
+// List records the position in its listing of a pagination link about to be
+// pushed, returns false if it's already recorded
+func (s *paginationScorer) List(link *url.URL, position int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.listed[link.String()]; ok {
+		return false
+	}
+	if s.listed == nil {
+		s.listed = make(map[string]int)
+	}
+	s.listed[link.String()] = position
+	return true
+}
+
+// Unlist forgets the position of a pagination link, e.g. once crawled,
+// returning it, 0 for the first page of a listing or a link not recorded
+func (s *paginationScorer) Unlist(link *url.URL) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	position := s.listed[link.String()]
+	delete(s.listed, link.String())
+	return position
+}
+
+// Score returns the score of the wrapped scorer, raised for pagination links
+func (s *paginationScorer) Score(link *url.URL, depth, inLinks int) float64 {
+	score := s.Scorer.Score(link, depth, inLinks)
+	if s.Paginated(link) {
+		score += paginationPriority
+	}
+	return score
+}
+
+// pushLinks pushes the links found on a page to the frontier of its domain,
+// or hands them to the crawls of the other domains spanned, one level
+// deeper, carrying the metadata of the seed of the page. If
+// pagination is prioritized the pages of a listing are pushed first, at the
+// same depth of the page linking them, being the same level of the site, up
+// to MaxListingPages.
+func (c *WebCrawler) pushLinks(h *hostCrawl, job *fetchedPage, page *Page, links []*url.URL) {
+	depth, metadata := job.depth, job.metadata
+	if h.pagination == nil {
+		for _, link := range links {
+			c.discover(h.run, link.Host)
+			c.push(h, link, depth+1, metadata)
+		}
+		return
+	}
+	for _, link := range page.Pagination {
+		h.pagination.Declare(link)
+	}
+	// Pagination links already found on other pages are left out of the
+	// links, pushing them again raises their priority if still waiting
+	paginated, others := page.Pagination, make([]*url.URL, 0, len(links))
+	declared := make(map[string]bool, len(paginated))
+	for _, link := range paginated {
+		declared[link.String()] = true
+	}
+	for _, link := range links {
+		if declared[link.String()] {
+			continue
+		}
+		if h.pagination.Paginated(link) {
+			paginated = append(paginated, link)
+		} else {
+			others = append(others, link)
+		}
+	}
+	position := h.pagination.Unlist(job.link) + 1
+	limit := c.settings.MaxListingPages
+	for _, link := range paginated {
+		c.discover(h.run, link.Host)
+		if (limit > 0 && position >= limit) || c.spans(h, link) {
+			c.push(h, link, depth+1, metadata)
+			continue
+		}
+		listed := h.pagination.List(link, position)
+		if !h.frontier.PushFrom(link, depth, metadata) && listed {
+			h.pagination.Unlist(link)
+		}
+	}
+	for _, link := range others {
+		c.discover(h.run, link.Host)
+		c.push(h, link, depth+1, metadata)
+	}
+}
+
+// scorer returns the `Scorer` of the frontier of a domain, the one set
+// wrapped to put the pagination links first if enabled
+func (c *WebCrawler) scorer(h *hostCrawl) Scorer {
+	scorer := c.settings.Scorer
+	// On a recrawl the stale pages go first
+	if c.freshness != nil {
+		if scorer == nil {
+			scorer = inLinksScorer{}
+		}
+		scorer = freshnessScorer{scorer, c.freshness}
+	}
+	if !c.settings.PrioritizePagination {
+		return scorer
+	}
+	if scorer == nil {
+		scorer = inLinksScorer{}
+	}
+	h.pagination = &paginationScorer{Scorer: scorer}
+	return h.pagination
+}
@@ -0,0 +1,109 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIsPagination(t *testing.T) {
+	for link, expected := range map[string]bool{
+		"https://example.com/posts?page=2":         true,
+		"https://example.com/blog/?paged=2":        true,
+		"https://example.com/search?q=go&start=20": false,
+		"https://example.com/?p=123":               false,
+		"https://example.com/blog/page/3/":         true,
+		"https://example.com/posts?page=last":      false,
+		"https://example.com/page/about":           false,
+		"https://example.com/posts/2":              false,
+	} {
+		u, _ := url.Parse(link)
+		if isPagination(u) != expected {
+			t.Errorf("isPagination failed: expected %v for %s", expected, link)
+		}
+	}
+}
+
+func TestCrawlPrioritizesPagination(t *testing.T) {
+	var mutex sync.Mutex
+	var fetched []string
+	page := func(content string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			fetched = append(fetched, r.URL.Path)
+			mutex.Unlock()
+			_, _ = w.Write([]byte(content))
+		}
+	}
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/", page(`<a href="/about"><a href="/contact"><a rel="next" href="/list/2">`))
+	handler.HandleFunc("/list/2", page(`<a href="/deep"><link rel="next" href="/list/3">`))
+	handler.HandleFunc("/list/3", page(`<a rel="prev" href="/list/2">`))
+	for _, path := range []string{"/about", "/contact", "/deep"} {
+		handler.HandleFunc(path, page(""))
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	crawler := New("test-agent", &testQueue{make(chan []byte, 16)},
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0),
+		func(s *CrawlerSettings) {
+			s.Concurrency = 1
+			s.ParseConcurrency = 1
+			s.PrioritizePagination = true
+		})
+	crawler.Crawl(server.URL + "/")
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(fetched) != 6 {
+		t.Fatalf("Crawler#Crawl failed: expected 6 pages fetched got %v", fetched)
+	}
+	// The pages are parsed while the next ones are fetched, the links
+	// found by different pages may be fetched in any order
+	order := make(map[string]int)
+	for i, path := range fetched {
+		order[path] = i
+	}
+	for _, before := range [][2]string{{"/list/2", "/about"}, {"/list/2", "/contact"}, {"/list/3", "/deep"}} {
+		if order[before[0]] > order[before[1]] {
+			t.Errorf("Crawler#Crawl failed: expected %s before %s got %v", before[0], before[1], fetched)
+		}
+	}
+}
+
+func TestCrawlPaginationBeyondMaxListingPages(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	// An endless listing, each page links the next one
+	handler.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		_, _ = fmt.Fprintf(w, `<a rel="next" href="/list?page=%d">`, page+1)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	scope, err := NewScope(ScopeConfig{Depths: []DepthRule{{Pattern: "/list", MaxDepth: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.Scope = scope
+			s.PrioritizePagination = true
+			s.MaxListingPages = 3
+		})
+	crawler.Crawl(server.URL + "/list")
+	testbus.Close()
+	// The seed and the pages 1 and 2 of the listing at its depth, the pages
+	// 3 to 5 one level deeper
+	if res := <-results; len(res) != 6 {
+		t.Errorf("Crawler#Crawl failed: expected 6 pages of the listing got %v", res)
+	}
+}
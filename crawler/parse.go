@@ -0,0 +1,47 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import "fmt"
+
+// ParseErrorResult is the type of the `ParseError` results, produced for
+// every page downloaded and failing to parse
+const ParseErrorResult ResultType = "parse_error"
+
+// ParseError is a page downloaded successfully that the parser failed to
+// parse, e.g. malformed HTML, telling it apart from the network failures,
+// json serializable to be sent on message queues
+type ParseError struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+	// Parser is the name of the parser failing, see `parserName`
+	Parser string `json:"parser"`
+	// Err is the error returned by the parser
+	Err     string `json:"error"`
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// namedParser is implemented by the parsers telling their name, the others
+// are named after their type
+type namedParser interface {
+	Name() string
+}
+
+// parserName returns the name of a parser
+func parserName(parser Parser) string {
+	if named, ok := parser.(namedParser); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", parser)
+}
+
+// emitParseError produces the `ParseError` of a page failing to parse
+func (c *WebCrawler) emitParseError(h *hostCrawl, job *fetchedPage, err error) {
+	c.emitResult(h.run, ParseErrorResult, ParseError{
+		URL:     job.link.String(),
+		Depth:   job.depth,
+		Parser:  parserName(c.settings.Parser),
+		Err:     err.Error(),
+		TraceID: job.trace,
+	}, job.logger)
+}
@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+type failingParser struct{}
+
+func (failingParser) Parse(string, io.Reader) (*Page, error) {
+	return nil, errors.New("malformed page")
+}
+
+func TestParserName(t *testing.T) {
+	if name := parserName(fetcher.NewGoqueryParser()); name != "goquery" {
+		t.Errorf("parserName failed: expected goquery got %s", name)
+	}
+	if name := parserName(failingParser{}); name != "crawler.failingParser" {
+		t.Errorf("parserName failed: expected crawler.failingParser got %s", name)
+	}
+}
+
+func TestCrawlEmitParseErrors(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParseError)
+	go func() {
+		var parseErrors []ParseError
+		events := make(chan []byte)
+		go func() {
+			_ = testbus.Consume(events)
+			close(events)
+		}()
+		for e := range events {
+			var p ParseError
+			if err := json.Unmarshal(e, &p); err == nil && p.Parser != "" {
+				parseErrors = append(parseErrors, p)
+			}
+		}
+		results <- parseErrors
+	}()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.Parser = failingParser{} })
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	parseErrors := <-results
+	if len(parseErrors) != 1 {
+		t.Fatalf("Crawler#Crawl failed: expected 1 parse error got %v", parseErrors)
+	}
+	p := parseErrors[0]
+	if p.URL != server.URL+"/foo" || p.Parser != "crawler.failingParser" ||
+		p.Err != "malformed page" || p.TraceID == "" {
+		t.Errorf("Crawler#Crawl failed: unexpected parse error %+v", p)
+	}
+}
@@ -0,0 +1,65 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Flag bytes prepended to the result payloads when compression is enabled,
+// telling the consumers if the rest of the payload is gzipped
+const (
+	PayloadPlain byte = 0
+	PayloadGzip  byte = 1
+)
+
+// encodePayload prepends the flag byte to a payload, gzipping it if larger
+// than the threshold. Payloads are left untouched if the threshold is 0.
+func encodePayload(payload []byte, threshold int) ([]byte, error) {
+	if threshold <= 0 {
+		return payload, nil
+	}
+	if len(payload) <= threshold {
+		return append([]byte{PayloadPlain}, payload...), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(PayloadGzip)
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(payload); err != nil {
+		return nil, fmt.Errorf("compressing payload failed: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("compressing payload failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodePayload returns the result payload produced by a crawler with
+// compression enabled, see `CrawlerSettings.CompressThreshold`, stripping
+// the flag byte and decompressing it if gzipped
+func DecodePayload(payload []byte) ([]byte, error) {
+	if len(payload) == 0 {
+		return nil, errors.New("decoding payload failed: empty payload")
+	}
+	switch payload[0] {
+	case PayloadPlain:
+		return payload[1:], nil
+	case PayloadGzip:
+		r, err := gzip.NewReader(bytes.NewReader(payload[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("decoding payload failed: %w", err)
+		}
+		defer r.Close()
+		decoded, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("decoding payload failed: %w", err)
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("decoding payload failed: unknown flag %d", payload[0])
+	}
+}
@@ -0,0 +1,46 @@
+package crawler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodePayload(t *testing.T) {
+	small := []byte(`{"url":"https://example.com"}`)
+	large := bytes.Repeat([]byte("https://example.com/"), 100)
+	tests := []struct {
+		payload   []byte
+		threshold int
+		flag      byte
+	}{
+		{small, 64, PayloadPlain},
+		{large, 64, PayloadGzip},
+	}
+	for _, tt := range tests {
+		encoded, err := encodePayload(tt.payload, tt.threshold)
+		if err != nil {
+			t.Fatalf("encodePayload failed: %v", err)
+		}
+		if encoded[0] != tt.flag {
+			t.Errorf("encodePayload failed: expected flag %d got %d", tt.flag, encoded[0])
+		}
+		decoded, err := DecodePayload(encoded)
+		if err != nil {
+			t.Fatalf("DecodePayload failed: %v", err)
+		}
+		if !bytes.Equal(decoded, tt.payload) {
+			t.Errorf("DecodePayload failed: expected %s got %s", tt.payload, decoded)
+		}
+	}
+	if encoded, _ := encodePayload(large, 0); !bytes.Equal(encoded, large) {
+		t.Error("encodePayload failed: payload changed with compression disabled")
+	}
+}
+
+func TestDecodePayloadErrors(t *testing.T) {
+	for _, payload := range [][]byte{nil, {7, 'a'}, {PayloadGzip, 'a'}} {
+		if _, err := DecodePayload(payload); err == nil {
+			t.Errorf("DecodePayload failed: expected error for %v", payload)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+// pageDownloader is implemented by the fetchers able to download a page and
+// to parse it in two separate steps, enabling the fetch and the parse
+// stages to run on separate pools of workers. Fetchers not implementing it
+// fetch and parse in the fetch stage.
+type pageDownloader interface {
+	Download(string) (fetcher.Timings, *fetcher.RawPage, error)
+	ParsePage(*fetcher.RawPage) (*fetcher.Page, error)
+}
+
+// pageInspector is implemented by the fetchers able to download the body
+// of the HTML pages only, required by the headers-only crawls. Fetchers not
+// implementing it download every page.
+type pageInspector interface {
+	Inspect(string) (fetcher.Timings, *fetcher.RawPage, error)
+}
+
+// contextDownloader is implemented by the fetchers able to download a page
+// bound to a context, the trace ID of the fetch travels in it to the
+// `RequestHook`
+type contextDownloader interface {
+	DownloadContext(context.Context, string) (fetcher.Timings, *fetcher.RawPage, error)
+	InspectContext(context.Context, string) (fetcher.Timings, *fetcher.RawPage, error)
+}
+
+// schemeUnifier is implemented by the rules engines able to make the http
+// and https versions of the URLs of a domain the same visit
+type schemeUnifier interface {
+	UnifySchemes()
+}
+
+// permissionChecker is implemented by the rules engines able to test if an
+// URL is allowed without visiting it, required to check the targets of the
+// redirects. The redirects are followed anywhere by the other engines.
+type permissionChecker interface {
+	Permitted(*url.URL) bool
+}
+
+// hostCrawl is the state of the crawl of a single domain, shared by the
+// workers of the fetch and the parse stages
+type hostCrawl struct {
+	// run is the state of the crawl the domain is crawled by
+	run      *crawlRun
+	rootURL  *url.URL
+	metadata map[string]string
+	// cancel aborts the crawl of the domain alone
+	cancel context.CancelFunc
+	// work bounds the downloads in flight, they go on after a cancellation
+	// till abort is called once the ShutdownTimeout expires
+	work     context.Context
+	abort    context.CancelFunc
+	rules    RulesEngine
+	frontier *frontier
+	stats    *hostStats
+	health   *hostHealth
+	// aimd adapts the concurrency of the domain to the responses, if
+	// enabled
+	aimd *aimdController
+	// order produces the results in the order the links are dispatched, if
+	// enabled
+	order *resultSequencer
+	// pagination is the scorer putting the pagination links first, if
+	// enabled
+	pagination *paginationScorer
+	// assets are the assets of the pages parsed waiting to be downloaded
+	assets assetQueue
+	// site produces the metadata of the domain once
+	site sync.Once
+	// aliases are the links never to crawl, being aliases of other pages,
+	// e.g. their AMP versions
+	aliases sync.Map
+	logger  *slog.Logger
+	// semaphore limits the number of concurrent goroutine workers fetching
+	// links
+	semaphore *semaphore
+	// wakeup is used by workers to notify the end of the processing of a
+	// link, waking up the main loop waiting for new links
+	wakeup chan struct{}
+	// An atomic counter of the links popped and not processed yet, together
+	// with the frontier length it tells if there are still links to crawl
+	inflight int32
+}
+
+// overloaded tests if the domain of the host can't take another concurrent
+// fetch, the concurrency is reduced when its health degrades. The fetches
+// in flight are the ones of all the hosts of the domain.
+func (h *hostCrawl) overloaded() bool {
+	limit := h.health.Concurrency(h.semaphore.Size())
+	if h.aimd != nil {
+		limit = h.aimd.Limit(limit)
+	}
+	return h.health.Fetching() >= limit
+}
+
+// done marks the end of the processing of a link, waking up the main loop
+func (h *hostCrawl) done() {
+	atomic.AddInt32(&h.inflight, -1)
+	h.wake()
+}
+
+// wake wakes up the main loop waiting for links to crawl
+func (h *hostCrawl) wake() {
+	select {
+	case h.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// fetchedPage is a page downloaded by the fetch stage, waiting to be parsed
+// by the parse stage
+type fetchedPage struct {
+	link  *url.URL
+	depth int
+	// metadata of the seed the link was found from
+	metadata map[string]string
+	// trace identifies the fetch in the logs, the events and the result,
+	// logger attaches it to every record
+	trace  string
+	logger *slog.Logger
+	// seq is the dispatch order of the link, see `resultSequencer`
+	seq uint64
+	// completed is set once the result of the link is produced
+	completed bool
+	timings   Timings
+	// raw is the page to parse, page is set instead if the fetcher
+	// already parsed it
+	raw  *fetcher.RawPage
+	page *fetcher.Page
+}
+
+// parseConcurrency returns the number of workers of the parse stage of each
+// domain, parsing is CPU-bound so by default one per CPU
+func (c *WebCrawler) parseConcurrency() int {
+	if c.settings.ParseConcurrency > 0 {
+		return c.settings.ParseConcurrency
+	}
+	return runtime.NumCPU()
+}
+
+// fetchStage downloads a link and forwards it to the parse stage, the fetch
+// slot is held for the politeness delay only, not while parsing. The delay
+// grows as the health of the host degrades.
+func (c *WebCrawler) fetchStage(ctx context.Context, h *hostCrawl,
+	job *fetchedPage, parsed chan<- *fetchedPage) {
+	link, depth := job.link, job.depth
+	defer func() {
+		delay := h.health.Delay(h.rules.Delay())
+		h.stats.Delayed(delay)
+		// No need to be polite on shutdown, no more fetches follow
+		sleep(ctx, delay)
+		h.health.Ended()
+		h.semaphore.Release()
+	}()
+	var err error
+	if downloader, ok := c.linkFetcher.(pageDownloader); ok {
+		job.timings, job.raw, err = c.download(h.work, downloader, job)
+		if err != nil {
+			err = fmt.Errorf("fetching links from %s failed: %w", link, err)
+		}
+	} else {
+		job.timings, job.page, err = c.linkFetcher.FetchLinks(link.String())
+	}
+	// The body of a page not handed to the parse stage goes back to the
+	// pool here
+	handed := false
+	defer func() {
+		if !handed && job.raw != nil {
+			job.raw.Release()
+		}
+	}()
+	// The rules are updated before the politeness delay, the page may not
+	// be parsed yet
+	response := job.page
+	if job.raw != nil {
+		response = &fetcher.Page{URL: job.raw.URL, ContentType: job.raw.ContentType, Header: job.raw.Header}
+	}
+	h.rules.OnResponse(link, response, job.timings)
+	// Pages inspected with an error status are produced, they still count
+	// as failed fetches
+	observed := err
+	if err == nil && job.raw != nil && job.raw.StatusCode >= http.StatusBadRequest {
+		code := job.raw.StatusCode
+		observed = &fetcher.StatusError{Code: code, Status: fmt.Sprintf("%d %s", code, http.StatusText(code))}
+	}
+	h.health.Observe(job.timings.Total, observed)
+	if h.aimd != nil {
+		h.aimd.Observe(job.timings.Total, observed)
+	}
+	h.stats.Fetched(job.timings.Total, observed)
+	c.events.Publish(Event{Type: PageFetched, Host: h.rootURL.Host,
+		URL: link.String(), Depth: depth, Timings: job.timings, Err: observed, TraceID: job.trace})
+	if err != nil {
+		job.logger.Error("Fetch failed", "url", link, "depth", depth, "err", err)
+		c.complete(h, job, nil)
+		h.done()
+		return
+	}
+	job.logger.Debug("Fetched", "url", link, "depth", depth, "total", job.timings.Total)
+	if job.raw != nil {
+		h.stats.Downloaded(len(job.raw.Bytes()))
+	}
+	// A page redirected out of the scope of the crawl is neither parsed
+	// nor explored
+	target := response.URL
+	if target != nil && target.String() != link.String() {
+		if reason := c.redirectRefusal(h, target, depth); reason != "" {
+			c.skip(h, target, depth, reason, job.trace)
+			job.logger.Debug("Redirect target skipped", "url", link, "target", target,
+				"depth", depth, "reason", reason)
+			c.complete(h, job, nil)
+			h.done()
+			return
+		}
+	}
+	if c.freshness != nil {
+		c.freshness.Record(link, depth, response.Header)
+	}
+	// The parse workers run till the fetch workers are done, even on
+	// shutdown
+	handed = true
+	parsed <- job
+}
+
+// download fetches a page without parsing it, inspecting it on a
+// headers-only crawl, the trace ID of the job is passed in the context of
+// the request if the fetcher supports it, aborting it once the context is
+// done
+func (c *WebCrawler) download(ctx context.Context, downloader pageDownloader,
+	job *fetchedPage) (fetcher.Timings, *fetcher.RawPage, error) {
+	link := job.link.String()
+	if traced, ok := c.linkFetcher.(contextDownloader); ok {
+		ctx := fetcher.WithTraceID(ctx, job.trace)
+		if c.settings.HeadersOnly {
+			return traced.InspectContext(ctx, link)
+		}
+		return traced.DownloadContext(ctx, link)
+	}
+	if inspector, ok := c.linkFetcher.(pageInspector); ok && c.settings.HeadersOnly {
+		return inspector.Inspect(link)
+	}
+	return downloader.Download(link)
+}
+
+// parseStage parses the pages downloaded by the fetch stage till the
+// channel is closed
+func (c *WebCrawler) parseStage(ctx context.Context, h *hostCrawl, parsed <-chan *fetchedPage) {
+	for job := range parsed {
+		c.processPage(ctx, h, job)
+	}
+}
+
+// sleep waits for a delay, returns false if the context is done first
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// drain waits for the fetch workers and then for the parse workers to end,
+// so that every page fetched is parsed and its results produced. On
+// shutdown the downloads still in flight after the ShutdownTimeout are
+// aborted, the workers are waited for anyway, no result can be produced
+// once the crawl returns.
+func (c *WebCrawler) drain(ctx context.Context, h *hostCrawl,
+	fetchWg, parseWg *sync.WaitGroup, parsed chan *fetchedPage) {
+	done := make(chan struct{})
+	go func() {
+		fetchWg.Wait()
+		close(parsed)
+		parseWg.Wait()
+		// The assets queued by the last pages parsed are not downloaded
+		h.assets.Abandon()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+	h.logger.Info("Crawl cancelled, draining in-flight work",
+		"inflight", atomic.LoadInt32(&h.inflight), "dropped", h.frontier.Len())
+	select {
+	case <-done:
+	case <-time.After(c.settings.ShutdownTimeout):
+		h.logger.Warn("Shutdown timeout expired, in-flight work aborted",
+			"inflight", atomic.LoadInt32(&h.inflight))
+		h.abort()
+		<-done
+	}
+}
+
+// schemeVariant tests if two URLs are the http and the https versions of
+// the same URL
+func schemeVariant(a, b *url.URL) bool {
+	if a == nil || b == nil || a.Scheme == b.Scheme {
+		return false
+	}
+	if (a.Scheme != "http" && a.Scheme != "https") || (b.Scheme != "http" && b.Scheme != "https") {
+		return false
+	}
+	return hostKey(a) == hostKey(b) && a.Path == b.Path && a.RawQuery == b.RawQuery
+}
+
+// pageMetadata returns the metadata of the result of a page, the metadata
+// of the seed with the translations and the AMP version of the page added,
+// the seed metadata is returned as is if the page has none
+func pageMetadata(metadata map[string]string, page *Page) map[string]string {
+	if len(page.Alternates) == 0 && page.AMPHTML == nil {
+		return metadata
+	}
+	merged := make(map[string]string, len(metadata)+len(page.Alternates)+1)
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	for lang, link := range page.Alternates {
+		merged[hreflangMetadataPrefix+lang] = link.String()
+	}
+	if page.AMPHTML != nil {
+		merged[ampMetadataKey] = page.AMPHTML.String()
+	}
+	return merged
+}
+
+// processPage parses a page downloaded, forwards the results to the queue
+// and pushes the links found to the frontier
+func (c *WebCrawler) processPage(ctx context.Context, h *hostCrawl, job *fetchedPage) {
+	defer h.done()
+	// Pages producing no result still take their turn, the ones waiting
+	// for their assets take it once downloaded
+	awaiting := false
+	defer func() {
+		if !awaiting {
+			c.complete(h, job, nil)
+		}
+	}()
+	// The body is scanned before being released
+	matches, extracted := c.grepPage(h, job), c.extract(h, job)
+	page := job.page
+	if job.raw != nil {
+		var err error
+		if job.raw.HasBody() {
+			page, err = c.linkFetcher.(pageDownloader).ParsePage(job.raw)
+		} else {
+			// Headers-only crawl of a page not needed to discover links
+			page = &fetcher.Page{URL: job.raw.URL, ContentType: job.raw.ContentType, Header: job.raw.Header}
+		}
+		job.raw.Release()
+		if err != nil {
+			job.logger.Error("Parse failed", "url", job.link, "depth", job.depth, "err", err)
+			c.emitParseError(h, job, err)
+			return
+		}
+	}
+	// Pages with a content type out of scope are neither forwarded nor
+	// explored
+	if scope := c.Reloadable().Scope; scope != nil && !scope.AllowedContentType(page.ContentType) {
+		return
+	}
+	// A page declaring as canonical its version with the other scheme tells
+	// that the domain serves the same content on both
+	if unifier, ok := h.rules.(schemeUnifier); ok && schemeVariant(job.link, page.Canonical) {
+		unifier.UnifySchemes()
+	}
+	// The branding of the domain is found on its root page
+	if job.depth == 0 {
+		c.emitSite(ctx, h, page)
+	}
+	// Assets are downloaded by the fetch stage, links pointing to them are
+	// not crawled
+	links, assets := page.Links, []*url.URL(nil)
+	if c.settings.DownloadAssets {
+		assets, links = c.splitAssets(page)
+		assets = c.allowedAssets(h, assets)
+	}
+	// No errors occured, we want to enqueue all scraped links to the
+	// frontier, a headers-only crawl records every page
+	if len(page.Links) == 0 && len(page.InvalidLinks) == 0 && len(assets) == 0 &&
+		len(matches) == 0 && len(extracted) == 0 && !c.settings.HeadersOnly {
+		return
+	}
+	if len(page.InvalidLinks) > 0 {
+		job.logger.Debug("Invalid links found", "url", job.link, "links", page.InvalidLinks)
+	}
+	// AMP mirrors of pages are explored but not forwarded, their results
+	// would double the ones of the canonical pages
+	mirror := ampMirror(job.link, page)
+	if mirror {
+		job.logger.Debug("AMP mirror not forwarded", "url", job.link, "canonical", page.Canonical)
+	}
+	// The external links are listed in the report, followed or not
+	classes := c.classifyLinks(job.link, page.Links)
+	c.inventoryExternalLinks(h, job.link.String(), page.Links, classes)
+	// Send results from fetch process to the processing queue
+	score := c.relevance(page)
+	result := ParsedResult{
+		URL:          job.link.String(),
+		Links:        stringifyLinks(page.Links),
+		LinkClasses:  classes,
+		InvalidLinks: page.InvalidLinks,
+		Timings:      job.timings,
+		Relevance:    score,
+		Metadata:     pageMetadata(job.metadata, page),
+		Excerpt:      excerpt(page.Text, c.settings.ExcerptLength),
+		Extracted:    extracted,
+		TraceID:      job.trace,
+	}
+	if c.settings.HeadersOnly && job.raw != nil {
+		result.Status, result.Header = job.raw.StatusCode, job.raw.Header
+		if len(job.raw.Redirects) > 0 {
+			result.Redirects = stringifyLinks(job.raw.Redirects)
+		}
+	}
+	// A grep of the sites produces the matches instead of the pages
+	switch {
+	case mirror:
+	case h.run.grep != nil:
+		c.emitMatches(h, job, matches)
+	case len(assets) > 0:
+		awaiting = true
+	default:
+		c.complete(h, job, &result)
+	}
+	// The result of a page with assets is produced once they're downloaded
+	if len(assets) > 0 {
+		produce := awaiting
+		c.queueAssets(h, assets, func(downloaded []string) {
+			if produce {
+				result.Assets = downloaded
+				c.complete(h, job, &result)
+			}
+		})
+	}
+	// On a focused crawl, links from not relevant pages are not explored
+	if job.depth > 0 && !c.relevant(score) {
+		return
+	}
+	// Enqueue found links for the next cycles
+	c.pushLinks(h, job, page, c.ampLinks(h, page, c.withoutAlternates(page, links)))
+}
+
+// complete produces the result of a link processed, nil if it has none,
+// once. With ordered results it's buffered till the results of the links
+// dispatched before it are produced.
+func (c *WebCrawler) complete(h *hostCrawl, job *fetchedPage, result *ParsedResult) {
+	if job.completed {
+		return
+	}
+	job.completed = true
+	if h.order == nil {
+		if result != nil {
+			c.enqueueResults(h.run, *result)
+		}
+		return
+	}
+	h.order.Complete(job.seq, result)
+}
+
+// redirectRefusal tests if the target of a redirect of a link found at a
+// given depth is in the scope of the crawl and allowed by the rules of the
+// domain, it may have been visited already. Returns why it's refused, empty
+// if admitted.
+func (c *WebCrawler) redirectRefusal(h *hostCrawl, target *url.URL, depth int) SkipReason {
+	if !c.hostAllowed(target.Hostname()) {
+		return SkipFilter
+	}
+	// The target is fetched already, the filters see a copy
+	filtered := *target
+	if reason := c.filterRefusal(&filtered); reason != "" {
+		return reason
+	}
+	if reason := c.scopeRefusal(target, depth); reason != "" {
+		return reason
+	}
+	if reasoner, ok := h.rules.(refusalReasoner); ok {
+		return reasoner.Forbidden(target)
+	}
+	if checker, ok := h.rules.(permissionChecker); ok && !checker.Permitted(target) {
+		return SkipRules
+	}
+	return ""
+}
@@ -0,0 +1,328 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+func TestParseConcurrency(t *testing.T) {
+	for setting, expected := range map[int]int{0: runtime.NumCPU(), 3: 3} {
+		crawler := New("test-agent", &testQueue{}, func(s *CrawlerSettings) {
+			s.ParseConcurrency = setting
+		})
+		if got := crawler.parseConcurrency(); got != expected {
+			t.Errorf("Crawler#parseConcurrency failed: setting %d expected %d got %d",
+				setting, expected, got)
+		}
+	}
+}
+
+// flushingQueue counts the flushes of a testQueue
+type flushingQueue struct {
+	testQueue
+	flushes int
+}
+
+func (q *flushingQueue) Flush() error {
+	q.flushes++
+	return nil
+}
+
+func TestCrawlDrainsInFlightFetchesOnInterrupt(t *testing.T) {
+	// Keep the interrupt from killing the test process
+	signal.Notify(make(chan os.Signal, 1), os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+	fetching, release := make(chan struct{}), make(chan struct{})
+	handler := http.NewServeMux()
+	handler.HandleFunc("/foo", resourceMock(`<a href="/foo/slow">`))
+	handler.HandleFunc("/foo/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(fetching)
+		<-release
+		_, _ = w.Write([]byte(`<a href="/foo/never">`))
+	})
+	handler.HandleFunc("/foo/never", resourceMock(`<a href="/foo">`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	go func() {
+		<-fetching
+		_ = syscall.Kill(os.Getpid(), syscall.SIGINT)
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+	queue := &flushingQueue{testQueue: testQueue{make(chan []byte)}}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&queue.testQueue) }()
+	notifier := &recordingNotifier{}
+	crawler := New("test-agent", queue, withCrawlTimeout(10*time.Second),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.Notifiers = []Notifier{notifier} })
+	start := time.Now()
+	crawler.Crawl(server.URL + "/foo")
+	elapsed := time.Since(start)
+	queue.Close()
+	res := <-results
+	if elapsed >= 10*time.Second {
+		t.Errorf("Crawler#Crawl failed: expected to return on interrupt, took %v", elapsed)
+	}
+	// The fetch in flight when interrupted is parsed and produced, the links
+	// it found are not fetched
+	if len(res) != 2 || !strings.HasSuffix(res[1].URL, "/foo/slow") {
+		t.Errorf("Crawler#Crawl failed: expected the in-flight result got %v", res)
+	}
+	if queue.flushes != 1 {
+		t.Errorf("Crawler#Crawl failed: expected the queue flushed once got %d", queue.flushes)
+	}
+	if len(notifier.summaries) != 1 || notifier.summaries[0].Err != "crawl interrupted: interrupt signal received" {
+		t.Errorf("Crawler#Crawl failed: expected an interrupted summary got %v", notifier.summaries)
+	}
+}
+
+func TestCrawlContextCancelled(t *testing.T) {
+	fetching := make(chan struct{})
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/foo", resourceMock(`<a href="/foo/slow">`))
+	handler.HandleFunc("/foo/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(fetching)
+		_, _ = w.Write([]byte(`<a href="/foo/never">`))
+	})
+	handler.HandleFunc("/foo/never", resourceMock(`<a href="/foo">`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-fetching
+		cancel()
+	}()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(10*time.Second), withPolitenessDelay(0))
+	start := time.Now()
+	err := crawler.CrawlContext(ctx, server.URL+"/foo")
+	elapsed := time.Since(start)
+	testbus.Close()
+	<-results
+	if elapsed >= 10*time.Second {
+		t.Errorf("Crawler#CrawlContext failed: expected to return on cancel, took %v", elapsed)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Crawler#CrawlContext failed: expected context.Canceled got %v", err)
+	}
+}
+
+func TestCrawlAbortsInFlightFetchesAfterShutdownTimeout(t *testing.T) {
+	fetching := make(chan struct{})
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/foo", resourceMock(`<a href="/foo/slow">`))
+	handler.HandleFunc("/foo/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(fetching)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-fetching
+		cancel()
+	}()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(10*time.Second),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.ShutdownTimeout = 50 * time.Millisecond
+		})
+	start := time.Now()
+	_ = crawler.CrawlContext(ctx, server.URL+"/foo")
+	elapsed := time.Since(start)
+	testbus.Close()
+	res := <-results
+	if elapsed >= 5*time.Second {
+		t.Errorf("Crawler#CrawlContext failed: expected the fetch aborted, took %v", elapsed)
+	}
+	// The aborted fetch produces no result, neither before nor after the
+	// crawl returns
+	if len(res) != 1 {
+		t.Errorf("Crawler#CrawlContext failed: expected 1 result got %v", res)
+	}
+}
+
+func TestCrawlContextInvalidSeeds(t *testing.T) {
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond))
+	err := crawler.CrawlContext(context.Background(), "http://[::1", "http://%zz", "http://localhost")
+	testbus.Close()
+	if res := <-results; len(res) != 0 {
+		t.Errorf("Crawler#CrawlContext failed: expected no results got %v", res)
+	}
+	if err == nil || !strings.Contains(err.Error(), "http://[::1") || !strings.Contains(err.Error(), "http://%zz") {
+		t.Errorf("Crawler#CrawlContext failed: expected both invalid seeds got %v", err)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	if !sleep(context.Background(), time.Millisecond) {
+		t.Errorf("sleep failed: expected true got false")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if sleep(ctx, time.Hour) || time.Since(start) > time.Second {
+		t.Errorf("sleep failed: expected prompt cancellation")
+	}
+}
+
+func TestCrawlUnifiesSchemesOnCanonical(t *testing.T) {
+	var fetched int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		// The https version is canonical, linked with the other scheme too
+		fmt.Fprintf(w, `<head><link rel="canonical" href="https://%[1]s/"></head><a href="https://%[1]s/">`, r.Host)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	crawler := New("test-agent", &testQueue{make(chan []byte, 16)},
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0))
+	crawler.Crawl(server.URL + "/")
+	// The https version would fail against the test server
+	stats := crawler.Stats()[strings.TrimPrefix(server.URL, "http://")]
+	if fetched := atomic.LoadInt32(&fetched); fetched != 1 || stats.Errors != 0 {
+		t.Errorf("Crawler#Crawl failed: expected the page fetched once got %d, %d errors", fetched, stats.Errors)
+	}
+}
+
+func TestCrawlPagesWithInvalidLinks(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/foo", resourceMock(`<body><a href="http://exa mple.com/">invalid</a></body>`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0))
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	res := <-results
+	if len(res) != 1 || len(res[0].InvalidLinks) != 1 || res[0].InvalidLinks[0] != "http://exa mple.com/" {
+		t.Errorf("Crawler#Crawl failed: expected the invalid link in the result got %v", res)
+	}
+}
+
+func TestCrawlSkipsRedirectsOutOfScope(t *testing.T) {
+	var leaked int32
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<body><a href="/external/child">child</a></body>`))
+	}))
+	defer external.Close()
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", resourceMock("User-agent: *\nDisallow: /private"))
+	handler.HandleFunc("/foo", resourceMock(`<body><a href="/disallowed">a</a><a href="/external">b</a></body>`))
+	handler.HandleFunc("/disallowed", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/private", http.StatusFound)
+	})
+	handler.HandleFunc("/external", func(w http.ResponseWriter, r *http.Request) {
+		// Another host, the port alone doesn't tell the domains apart
+		http.Redirect(w, r, strings.Replace(external.URL, "127.0.0.1", "localhost", 1)+"/external", http.StatusFound)
+	})
+	handler.HandleFunc("/private", resourceMock(`<body><a href="/leak">leak</a></body>`))
+	handler.HandleFunc("/leak", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&leaked, 1)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0))
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	res := <-results
+	if len(res) != 1 || res[0].URL != server.URL+"/foo" {
+		t.Errorf("Crawler#Crawl failed: expected the redirected pages skipped got %v", res)
+	}
+	if leaked := atomic.LoadInt32(&leaked); leaked != 0 {
+		t.Errorf("Crawler#Crawl failed: expected the links of the redirected pages skipped got %d fetches", leaked)
+	}
+}
+
+func TestCrawlPagesTraceIDs(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/foo", resourceMock(`<body><a href="/bar">bar</a></body>`))
+	handler.HandleFunc("/bar", resourceMock(`<body><a href="/foo">foo</a></body>`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan map[string]string)
+	go func() {
+		traces := make(map[string]string)
+		for payload := range testbus.bus {
+			var res ParsedResult
+			if err := json.Unmarshal(payload, &res); err == nil {
+				traces[res.URL] = res.TraceID
+			}
+		}
+		results <- traces
+	}()
+	var (
+		mutex          sync.Mutex
+		hooked, events = make(map[string]string), make(map[string]string)
+	)
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.RequestHook = func(r *http.Request) error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				if r.URL.Path != "/robots.txt" {
+					hooked[r.URL.String()] = fetcher.TraceID(r.Context())
+				}
+				return nil
+			}
+		})
+	crawler.Subscribe(func(e Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if e.Type == PageFetched {
+			events[e.URL] = e.TraceID
+		}
+	})
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	traces := <-results
+	if len(traces) != 2 {
+		t.Fatalf("Crawler#Crawl failed: expected 2 results got %v", traces)
+	}
+	for link, trace := range traces {
+		if trace == "" || hooked[link] != trace || events[link] != trace {
+			t.Errorf("Crawler#Crawl failed: expected the same trace ID for %s got result %q hook %q event %q",
+				link, trace, hooked[link], events[link])
+		}
+	}
+	if traces[server.URL+"/foo"] == traces[server.URL+"/bar"] {
+		t.Errorf("Crawler#Crawl failed: expected a trace ID per fetch got %v", traces)
+	}
+}
@@ -0,0 +1,186 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// domainPoliteness is the politeness state shared by all the crawls of the
+// hosts of a registered domain, e.g. example.com and www.example.com, or
+// several seeds on the same host: the concurrency, the health and the
+// adaptive concurrency of the domain, so that the delays, the backoff and
+// the limits apply to the domain as a whole, and the rules of each host, so
+// that its robots.txt is fetched once
+type domainPoliteness struct {
+	semaphore *semaphore
+	health    *hostHealth
+	mutex     sync.Mutex
+	rules     map[string]*hostRules
+	aimdOnce  sync.Once
+	aimd      *aimdController
+}
+
+// AIMD returns the adaptive concurrency controller of the domain, creating
+// it with a latency target on first use
+func (d *domainPoliteness) AIMD(latencyTarget time.Duration) *aimdController {
+	d.aimdOnce.Do(func() {
+		d.aimd = newAIMDController(latencyTarget)
+	})
+	return d.aimd
+}
+
+// hostRules is the rules engine of a host, ready is closed once it's
+// created, rules is nil if the crawl creating it was cancelled meanwhile
+type hostRules struct {
+	ready chan struct{}
+	rules RulesEngine
+}
+
+// Rules returns the rules engine of a host of the domain, creating it on
+// first use, concurrent crawls of the host wait for its creation while the
+// ones of the other hosts go on. Rules created by a crawl cancelled
+// meanwhile are not shared, they're created again by the next crawl.
+func (d *domainPoliteness) Rules(ctx context.Context, host string, create func() RulesEngine) RulesEngine {
+	for {
+		d.mutex.Lock()
+		pending, ok := d.rules[host]
+		if !ok {
+			pending = &hostRules{ready: make(chan struct{})}
+			d.rules[host] = pending
+		}
+		d.mutex.Unlock()
+		if !ok {
+			rules := create()
+			d.mutex.Lock()
+			if ctx.Err() == nil {
+				pending.rules = rules
+			} else {
+				delete(d.rules, host)
+			}
+			d.mutex.Unlock()
+			close(pending.ready)
+			return rules
+		}
+		select {
+		case <-pending.ready:
+			if pending.rules != nil {
+				return pending.rules
+			}
+		case <-ctx.Done():
+			return create()
+		}
+	}
+}
+
+// hostKey returns the host of an URL, the same for its http and https
+// versions, the default ports being implied
+func hostKey(u *url.URL) string {
+	port := u.Port()
+	if port == "" || (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		return u.Hostname()
+	}
+	return u.Host
+}
+
+// rulesKey returns the key of the rules of the host of an URL. A robots.txt
+// applies to a single scheme, the http and https versions of a host share
+// their rules only if they're the same visit anyway, see SchemeAgnosticDedup
+func rulesKey(u *url.URL, schemeAgnostic bool) string {
+	if schemeAgnostic {
+		return hostKey(u)
+	}
+	return u.Scheme + "://" + hostKey(u)
+}
+
+// HostAliases maps the hostnames of the aliases or mirrors of a host to its
+// canonical hostname, e.g. cdn.example.com to example.com, the aliases are
+// crawled as the same logical host, sharing its politeness and its visited
+// links
+type HostAliases map[string]string
+
+// Canonical returns the canonical hostname of a host, the host itself if
+// it's not an alias
+func (a HostAliases) Canonical(hostname string) string {
+	if canonical, ok := a[hostname]; ok {
+		return canonical
+	}
+	return hostname
+}
+
+// URL returns a copy of an URL on the canonical host, the port is kept, the
+// URL itself if its host is not an alias
+func (a HostAliases) URL(u *url.URL) *url.URL {
+	canonical, ok := a[u.Hostname()]
+	if !ok {
+		return u
+	}
+	c := *u
+	if port := u.Port(); port != "" {
+		c.Host = net.JoinHostPort(canonical, port)
+	} else {
+		c.Host = canonical
+	}
+	return &c
+}
+
+// rulesKey returns the key of the rules of the canonical host of an URL,
+// see rulesKey
+func (a HostAliases) rulesKey(u *url.URL, schemeAgnostic bool) string {
+	return rulesKey(a.URL(u), schemeAgnostic)
+}
+
+// rulesKey returns the key of the rules of the host of an URL in the crawl,
+// shared by its aliases and, with SchemeAgnosticDedup, by its other scheme
+func (c *WebCrawler) rulesKey(u *url.URL) string {
+	return c.settings.HostAliases.rulesKey(u, c.settings.SchemeAgnosticDedup)
+}
+
+// politenessRegistry tracks the politeness state of the registered domains
+// met during a crawl
+type politenessRegistry struct {
+	mutex   sync.Mutex
+	domains map[string]*domainPoliteness
+}
+
+func newPolitenessRegistry() *politenessRegistry {
+	return &politenessRegistry{domains: make(map[string]*domainPoliteness)}
+}
+
+// Domain returns the politeness state of the registered domain of a host,
+// creating it with a concurrency on first use
+func (r *politenessRegistry) Domain(hostname string, concurrency int) *domainPoliteness {
+	domain := registeredDomain(hostname)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	d, ok := r.domains[domain]
+	if !ok {
+		d = &domainPoliteness{
+			semaphore: newSemaphore(concurrency),
+			health:    newHostHealth(),
+			rules:     make(map[string]*hostRules),
+		}
+		r.domains[domain] = d
+	}
+	return d
+}
+
+// registeredDomain returns the eTLD+1 of a hostname, e.g. example.co.uk for
+// www.example.co.uk, or the hostname itself if it has none, e.g. an IP
+// address or localhost
+func registeredDomain(hostname string) string {
+	if net.ParseIP(hostname) != nil {
+		return hostname
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+	if err != nil {
+		return hostname
+	}
+	return domain
+}
@@ -0,0 +1,191 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegisteredDomain(t *testing.T) {
+	for hostname, expected := range map[string]string{
+		"www.example.com":    "example.com",
+		"example.com":        "example.com",
+		"blog.example.co.uk": "example.co.uk",
+		"127.0.0.1":          "127.0.0.1",
+		"localhost":          "localhost",
+	} {
+		if got := registeredDomain(hostname); got != expected {
+			t.Errorf("registeredDomain failed: %s expected %s got %s", hostname, expected, got)
+		}
+	}
+}
+
+func TestPolitenessRegistry(t *testing.T) {
+	r := newPolitenessRegistry()
+	www, bare := r.Domain("www.example.com", 2), r.Domain("example.com", 8)
+	if www != bare || www.semaphore.Size() != 2 {
+		t.Errorf("politenessRegistry#Domain failed: expected the domain shared")
+	}
+	if r.Domain("example.org", 2) == www {
+		t.Errorf("politenessRegistry#Domain failed: expected a different domain")
+	}
+	created := 0
+	create := func() RulesEngine {
+		created++
+		rootURL, _ := url.Parse("http://www.example.com")
+		return NewCrawlingRules(rootURL, newMemoryCache(), 0)
+	}
+	first := www.Rules(context.Background(), "www.example.com", create)
+	if second := www.Rules(context.Background(), "www.example.com", create); second != first {
+		t.Errorf("domainPoliteness#Rules failed: expected the rules of the host shared")
+	}
+	www.Rules(context.Background(), "example.com", create)
+	if created != 2 {
+		t.Errorf("domainPoliteness#Rules failed: expected rules per host, created %d", created)
+	}
+}
+
+func TestDomainPolitenessRulesConcurrentHosts(t *testing.T) {
+	d := newPolitenessRegistry().Domain("example.com", 2)
+	rootURL, _ := url.Parse("http://www.example.com")
+	creating, release := make(chan struct{}), make(chan struct{})
+	slow := make(chan RulesEngine)
+	go func() {
+		slow <- d.Rules(context.Background(), "www.example.com", func() RulesEngine {
+			close(creating)
+			<-release
+			return NewCrawlingRules(rootURL, newMemoryCache(), 0)
+		})
+	}()
+	<-creating
+	// The rules of another host are not held by the ones being created
+	done := make(chan struct{})
+	go func() {
+		d.Rules(context.Background(), "example.com", func() RulesEngine {
+			return NewCrawlingRules(rootURL, newMemoryCache(), 0)
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("domainPoliteness#Rules failed: expected the other host not to wait")
+	}
+	// The crawls of the same host wait for the rules being created
+	waiting := make(chan RulesEngine)
+	go func() {
+		waiting <- d.Rules(context.Background(), "www.example.com", func() RulesEngine {
+			t.Errorf("domainPoliteness#Rules failed: expected the rules created once")
+			return nil
+		})
+	}()
+	close(release)
+	if first, second := <-slow, <-waiting; first != second {
+		t.Errorf("domainPoliteness#Rules failed: expected the rules of the host shared")
+	}
+}
+
+func TestCrawlSharesRobotsTxtBetweenSeeds(t *testing.T) {
+	var robots int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&robots, 1)
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /private"))
+	})
+	handler.HandleFunc("/", resourceMock(`<a href="/private">`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	crawler := New("test-agent", &testQueue{make(chan []byte, 16)},
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0))
+	crawler.Crawl(server.URL+"/foo", server.URL+"/bar")
+	if robots := atomic.LoadInt32(&robots); robots != 1 {
+		t.Errorf("Crawler#Crawl failed: expected robots.txt fetched once got %d", robots)
+	}
+}
+
+func TestRulesKey(t *testing.T) {
+	for link, expected := range map[string]string{
+		"http://example.com/foo":       "http://example.com",
+		"https://example.com:443/foo":  "https://example.com",
+		"http://example.com:80":        "http://example.com",
+		"https://example.com:8443/foo": "https://example.com:8443",
+		"http://example.com:443":       "http://example.com:443",
+	} {
+		u, _ := url.Parse(link)
+		if key := rulesKey(u, false); key != expected {
+			t.Errorf("rulesKey failed: expected %s for %s got %s", expected, link, key)
+		}
+	}
+	// The http and https versions share the rules if they're the same visit
+	for link, expected := range map[string]string{
+		"http://example.com/foo":       "example.com",
+		"https://example.com:443/foo":  "example.com",
+		"https://example.com:8443/foo": "example.com:8443",
+	} {
+		u, _ := url.Parse(link)
+		if key := rulesKey(u, true); key != expected {
+			t.Errorf("rulesKey failed: expected %s for %s got %s", expected, link, key)
+		}
+	}
+}
+
+func TestHostAliases(t *testing.T) {
+	aliases := HostAliases{"cdn.example.com": "example.com"}
+	for link, expected := range map[string]string{
+		"https://cdn.example.com/foo":      "https://example.com/foo",
+		"https://cdn.example.com:8443/foo": "https://example.com:8443/foo",
+		"https://www.example.com/foo":      "https://www.example.com/foo",
+	} {
+		u, _ := url.Parse(link)
+		if got := aliases.URL(u).String(); got != expected {
+			t.Errorf("HostAliases#URL failed: expected %s for %s got %s", expected, link, got)
+		}
+	}
+	if got := aliases.Canonical("cdn.example.com"); got != "example.com" {
+		t.Errorf("HostAliases#Canonical failed: expected example.com got %s", got)
+	}
+}
+
+func TestCrawlSeedsOnHostAliases(t *testing.T) {
+	var robots int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&robots, 1)
+		http.NotFound(w, r)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	alias := "http://localhost:" + serverURL.Port()
+	handler.HandleFunc("/foo", resourceMock(`<body><a href="`+alias+`/bar">bar</a></body>`))
+	handler.HandleFunc("/bar", resourceMock(`<body><a href="`+server.URL+`/foo">foo</a></body>`))
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.HostAliases = HostAliases{"localhost": serverURL.Hostname()}
+		})
+	crawler.Crawl(server.URL+"/foo", alias+"/foo")
+	testbus.Close()
+	res := <-results
+	if n := atomic.LoadInt32(&robots); n != 1 {
+		t.Errorf("Crawler#Crawl failed: expected robots.txt fetched once got %d", n)
+	}
+	crawled := make([]string, 0, len(res))
+	for _, r := range res {
+		crawled = append(crawled, r.URL)
+	}
+	sort.Strings(crawled)
+	expected := []string{server.URL + "/foo", alias + "/bar"}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(crawled, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, crawled)
+	}
+}
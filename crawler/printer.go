@@ -0,0 +1,110 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+
+	"github.com/codepr/webcrawler/messaging"
+)
+
+// DefaultResultTemplate renders the URL of a result with its total fetch
+// time, followed by the links and the assets found, one per line
+const DefaultResultTemplate = `{{bold .URL}} {{faint .Timings.Total}}{{if .Relevance}} {{yellow (printf "%.2f" .Relevance)}}{{end}}
+{{range .Links}}  {{green "->"}} {{.}}
+{{end}}{{range .Assets}}  {{cyan "asset"}} {{.}}
+{{end}}`
+
+// ANSI escape codes of the styles available to the templates
+var ansiStyles = map[string]string{
+	"bold":   "\033[1m",
+	"faint":  "\033[2m",
+	"red":    "\033[31m",
+	"green":  "\033[32m",
+	"yellow": "\033[33m",
+	"cyan":   "\033[36m",
+}
+
+// ResultPrinter renders the results of a crawl with a Go template, making
+// quick interactive crawls readable instead of raw JSON. Templates are
+// executed on a `ParsedResult` and can style text with the functions bold,
+// faint, red, green, yellow and cyan, applied only if writing on a
+// terminal.
+type ResultPrinter struct {
+	w    io.Writer
+	tmpl *template.Template
+}
+
+// NewResultPrinter creates a new `ResultPrinter` writing on w the results
+// rendered with a template, by default `DefaultResultTemplate`. Colors are
+// enabled if w is a terminal and NO_COLOR is not set.
+func NewResultPrinter(w io.Writer, text string) (*ResultPrinter, error) {
+	if text == "" {
+		text = DefaultResultTemplate
+	}
+	color := isTerminal(w) && os.Getenv("NO_COLOR") == ""
+	funcs := template.FuncMap{}
+	for name, code := range ansiStyles {
+		code := code
+		funcs[name] = func(v any) string {
+			if !color {
+				return fmt.Sprint(v)
+			}
+			return code + fmt.Sprint(v) + "\033[0m"
+		}
+	}
+	tmpl, err := template.New("result").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing result template failed: %w", err)
+	}
+	return &ResultPrinter{w: w, tmpl: tmpl}, nil
+}
+
+// isTerminal tests if a writer is a character device, e.g. a TTY
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Print renders a result payload as produced by the crawler, whatever its
+// encoding, batches are rendered one result at a time
+func (p *ResultPrinter) Print(payload []byte) error {
+	results, err := DecodeResults(payload)
+	if err != nil {
+		return fmt.Errorf("printing result failed: %w", err)
+	}
+	for _, result := range results {
+		if err := p.tmpl.Execute(p.w, result); err != nil {
+			return fmt.Errorf("printing result failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Consume renders all the results consumed from a queue till it's closed,
+// payloads failing to render are skipped, the first error is returned
+func (p *ResultPrinter) Consume(queue messaging.Consumer) error {
+	events := make(chan []byte)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- queue.Consume(events)
+		close(events)
+	}()
+	var firstErr error
+	for event := range events {
+		if err := p.Print(event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := <-errCh; err != nil {
+		return err
+	}
+	return firstErr
+}
@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultPrinter(t *testing.T) {
+	var out bytes.Buffer
+	printer, err := NewResultPrinter(&out, "")
+	if err != nil {
+		t.Fatalf("NewResultPrinter failed: %v", err)
+	}
+	result := ParsedResult{
+		URL:     "https://example.com/foo",
+		Links:   []string{"https://example.com/bar"},
+		Assets:  []string{"https://example.com/baz.png"},
+		Timings: Timings{Total: 120 * time.Millisecond},
+	}
+	payload, _ := json.Marshal(result)
+	compressed, _ := encodePayload(payload, 1)
+	for _, p := range [][]byte{payload, compressed} {
+		out.Reset()
+		if err := printer.Print(p); err != nil {
+			t.Fatalf("ResultPrinter#Print failed: %v", err)
+		}
+		expected := "https://example.com/foo 120ms\n" +
+			"  -> https://example.com/bar\n" +
+			"  asset https://example.com/baz.png\n"
+		if out.String() != expected {
+			t.Errorf("ResultPrinter#Print failed: expected %q got %q", expected, out.String())
+		}
+	}
+	if err := printer.Print([]byte("not json")); err == nil {
+		t.Error("ResultPrinter#Print failed: expected error")
+	}
+}
+
+func TestResultPrinterConsume(t *testing.T) {
+	var out bytes.Buffer
+	printer, err := NewResultPrinter(&out, "{{.URL}} {{len .Links}}\n")
+	if err != nil {
+		t.Fatalf("NewResultPrinter failed: %v", err)
+	}
+	queue := testQueue{make(chan []byte)}
+	go func() {
+		for _, url := range []string{"https://example.com/a", "https://example.com/b"} {
+			payload, _ := json.Marshal(ParsedResult{URL: url, Links: []string{url}})
+			queue.Produce(payload)
+		}
+		queue.Close()
+	}()
+	if err := printer.Consume(queue); err != nil {
+		t.Fatalf("ResultPrinter#Consume failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 ||
+		lines[1] != "https://example.com/b 1" {
+		t.Errorf("ResultPrinter#Consume failed: unexpected output %q", out.String())
+	}
+}
+
+func TestNewResultPrinterInvalidTemplate(t *testing.T) {
+	if _, err := NewResultPrinter(&bytes.Buffer{}, "{{.URL"); err == nil {
+		t.Error("NewResultPrinter failed: expected error")
+	}
+}
+
+func TestResultPrinterBatch(t *testing.T) {
+	var out bytes.Buffer
+	printer, _ := NewResultPrinter(&out, "{{.URL}}\n")
+	if err := printer.Print([]byte(`[{"url":"a"},{"url":"b"}]`)); err != nil {
+		t.Fatalf("ResultPrinter#Print failed: %v", err)
+	}
+	if out.String() != "a\nb\n" {
+		t.Errorf("ResultPrinter#Print failed: expected a b got %q", out.String())
+	}
+}
@@ -0,0 +1,83 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	rpprof "runtime/pprof"
+	"time"
+)
+
+// NewDebugHandler returns a handler serving the pprof endpoints under
+// /debug/pprof/, e.g. /debug/pprof/goroutine?debug=2 to find the goroutines
+// blocked in a stuck crawl
+func NewDebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// DumpProfiles writes a heap profile, heap.pprof, and the stack traces of
+// all the goroutines, goroutines.txt, to a directory, creating it if
+// missing
+func DumpProfiles(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("dumping profiles failed: %w", err)
+	}
+	// Up to date statistics of the allocations
+	runtime.GC()
+	if err := writeProfile(filepath.Join(dir, "heap.pprof"), "heap", 0); err != nil {
+		return fmt.Errorf("dumping profiles failed: %w", err)
+	}
+	if err := writeProfile(filepath.Join(dir, "goroutines.txt"), "goroutine", 2); err != nil {
+		return fmt.Errorf("dumping profiles failed: %w", err)
+	}
+	return nil
+}
+
+// writeProfile writes a runtime profile to a file
+func writeProfile(path, name string, debug int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := rpprof.Lookup(name).WriteTo(file, debug); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// serveDebug starts the server of the pprof endpoints on the DebugAddr,
+// returns the function stopping it
+func (c *WebCrawler) serveDebug() func() {
+	listener, err := net.Listen("tcp", c.settings.DebugAddr)
+	if err != nil {
+		c.logger.Error("Unable to serve pprof endpoints", "addr", c.settings.DebugAddr, "err", err)
+		return func() {}
+	}
+	server := &http.Server{Handler: NewDebugHandler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.Error("Serving pprof endpoints failed", "err", err)
+		}
+	}()
+	c.logger.Info("Serving pprof endpoints", "addr", listener.Addr().String())
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}
+}
@@ -0,0 +1,37 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	server := httptest.NewServer(NewDebugHandler())
+	defer server.Close()
+	res, err := http.Get(server.URL + "/debug/pprof/goroutine?debug=1")
+	if err != nil {
+		t.Fatalf("NewDebugHandler failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("NewDebugHandler failed: expected 200 got %d", res.StatusCode)
+	}
+}
+
+func TestDumpProfiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "profiles")
+	if err := DumpProfiles(dir); err != nil {
+		t.Fatalf("DumpProfiles failed: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "heap.pprof")); err != nil || info.Size() == 0 {
+		t.Errorf("DumpProfiles failed: expected a heap profile, %v", err)
+	}
+	goroutines, err := os.ReadFile(filepath.Join(dir, "goroutines.txt"))
+	if err != nil || !strings.Contains(string(goroutines), "TestDumpProfiles") {
+		t.Errorf("DumpProfiles failed: expected the goroutines stacks, %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"strings"
+	"unicode"
+)
+
+// relevance scores a text against a list of keywords, returning the fraction
+// of keywords found at least once in the text, the match is case
+// insensitive. No keywords means that every text is fully relevant.
+func relevance(text string, keywords []string) float64 {
+	if len(keywords) == 0 {
+		return 1
+	}
+	text = strings.ToLower(text)
+	matches := 0
+	for _, keyword := range keywords {
+		if strings.Contains(text, strings.ToLower(keyword)) {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(keywords))
+}
+
+// excerpt returns the first length characters of a text, cut at the last
+// word boundary if any, an empty string if length is 0
+func excerpt(text string, length int) string {
+	if length <= 0 {
+		return ""
+	}
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	cut := string(runes[:length])
+	// A word cut in half is dropped, unless it's the only one
+	if !unicode.IsSpace(runes[length]) {
+		if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > 0 {
+			cut = cut[:i]
+		}
+	}
+	return strings.TrimRightFunc(cut, unicode.IsSpace)
+}
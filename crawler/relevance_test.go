@@ -0,0 +1,36 @@
+package crawler
+
+import "testing"
+
+func TestRelevance(t *testing.T) {
+	text := "Golang is a programming language, Go has goroutines"
+	if score := relevance(text, nil); score != 1 {
+		t.Errorf("relevance failed: expected 1 got %f", score)
+	}
+	if score := relevance(text, []string{"GOROUTINES", "channels"}); score != 0.5 {
+		t.Errorf("relevance failed: expected 0.5 got %f", score)
+	}
+	if score := relevance(text, []string{"rust"}); score != 0 {
+		t.Errorf("relevance failed: expected 0 got %f", score)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	testCases := []struct {
+		text     string
+		length   int
+		expected string
+	}{
+		{"crawling the web", 0, ""},
+		{"crawling the web", 100, "crawling the web"},
+		{"crawling the web", 12, "crawling the"},
+		{"crawling the web", 10, "crawling"},
+		{"crawling the web", 5, "crawl"},
+		{"città di là", 5, "città"},
+	}
+	for _, tc := range testCases {
+		if got := excerpt(tc.text, tc.length); got != tc.expected {
+			t.Errorf("excerpt(%q, %d) failed: expected %q got %q", tc.text, tc.length, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Reloadable is the subset of the settings that can be changed while a
+// crawl runs, without restarting it, see `WebCrawler.Reload`
+type Reloadable struct {
+	// PolitenessFixedDelay is applied to the next fetch of every domain, the
+	// ones being crawled included, if they follow a `CrawlingRules`
+	PolitenessFixedDelay time.Duration
+	// Concurrency is applied to every domain, the ones being crawled
+	// included, see `WebCrawler.SetConcurrency`
+	Concurrency int
+	// AllowedHosts, BlockedHosts and Scope are applied to the links found
+	// after the reload, the ones already in the frontiers are still crawled
+	AllowedHosts []string
+	BlockedHosts []string
+	Scope        *Scope
+}
+
+// reloadConfig is the JSON form of a `Reloadable`, settings missing from it
+// are left unchanged, e.g.
+//
+//	{
+//	    "politeness_delay": "2s",
+//	    "concurrency": 4,
+//	    "allowed_hosts": ["*.example.com"],
+//	    "blocked_hosts": ["cdn.example.com"],
+//	    "scope": {"deny": ["/blog/tags/**"]}
+//	}
+type reloadConfig struct {
+	PolitenessDelay *string      `json:"politeness_delay"`
+	Concurrency     *int         `json:"concurrency"`
+	AllowedHosts    *[]string    `json:"allowed_hosts"`
+	BlockedHosts    *[]string    `json:"blocked_hosts"`
+	Scope           *ScopeConfig `json:"scope"`
+}
+
+// fixedDelaySetter is implemented by the rules engines whose politeness
+// delay can change while they're in use
+type fixedDelaySetter interface {
+	SetFixedDelay(time.Duration)
+}
+
+// Reloadable returns the current values of the settings that can be
+// reloaded
+func (c *WebCrawler) Reloadable() Reloadable {
+	c.reloadMutex.RLock()
+	defer c.reloadMutex.RUnlock()
+	return c.reloadable()
+}
+
+// reloadable returns the current values of the settings that can be
+// reloaded, the reloadMutex must be held
+func (c *WebCrawler) reloadable() Reloadable {
+	return Reloadable{
+		PolitenessFixedDelay: c.settings.PolitenessFixedDelay,
+		Concurrency:          c.settings.Concurrency,
+		AllowedHosts:         c.settings.AllowedHosts,
+		BlockedHosts:         c.settings.BlockedHosts,
+		Scope:                c.settings.Scope,
+	}
+}
+
+// Reload replaces the settings that can be changed while a crawl runs,
+// returns an error, leaving the settings unchanged, if the new ones are not
+// valid. It's safe to call while crawling, e.g. from an admin endpoint.
+func (c *WebCrawler) Reload(r Reloadable) error {
+	return c.reload(func(current *Reloadable) { *current = r })
+}
+
+// SetConcurrency changes the number of concurrent fetches per domain while
+// a crawl runs, the domains being crawled included: on growth new fetches
+// start immediately, on shrink the fetches in excess are left to finish.
+// Returns an error if the concurrency is negative.
+func (c *WebCrawler) SetConcurrency(concurrency int) error {
+	return c.reload(func(r *Reloadable) { r.Concurrency = concurrency })
+}
+
+// reload applies an update to the settings that can be reloaded, if the
+// settings resulting are valid
+func (c *WebCrawler) reload(update func(*Reloadable)) error {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+	r := c.reloadable()
+	update(&r)
+	settings := *c.settings
+	settings.PolitenessFixedDelay = r.PolitenessFixedDelay
+	settings.Concurrency = r.Concurrency
+	settings.AllowedHosts = r.AllowedHosts
+	settings.BlockedHosts = r.BlockedHosts
+	settings.Scope = r.Scope
+	if err := settings.Validate(); err != nil {
+		return fmt.Errorf("reloading settings failed: %w", err)
+	}
+	c.settings.PolitenessFixedDelay = r.PolitenessFixedDelay
+	c.settings.Concurrency = r.Concurrency
+	c.settings.AllowedHosts = r.AllowedHosts
+	c.settings.BlockedHosts = r.BlockedHosts
+	c.settings.Scope = r.Scope
+	c.crawls.Range(func(key, _ any) bool {
+		h := key.(*hostCrawl)
+		h.semaphore.Resize(r.Concurrency)
+		// Domains with no rules yet get the delay once they're set
+		if rules, ok := h.rules.(fixedDelaySetter); ok {
+			rules.SetFixedDelay(r.PolitenessFixedDelay)
+		}
+		return true
+	})
+	c.logger.Info("Settings reloaded",
+		"politeness_delay", r.PolitenessFixedDelay, "concurrency", r.Concurrency)
+	return nil
+}
+
+// setRules sets the rules engine of a domain being crawled, applying the
+// politeness delay reloaded while it was being created
+func (c *WebCrawler) setRules(h *hostCrawl, rules RulesEngine) {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+	if setter, ok := rules.(fixedDelaySetter); ok {
+		setter.SetFixedDelay(c.settings.PolitenessFixedDelay)
+	}
+	h.rules = rules
+}
+
+// LoadReloadable reads the settings to reload from a JSON file on top of
+// the current ones, the settings missing from the file are left unchanged
+func (c *WebCrawler) LoadReloadable(file string) (Reloadable, error) {
+	r := c.Reloadable()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return r, fmt.Errorf("reading %s failed: %w", file, err)
+	}
+	var config reloadConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return r, fmt.Errorf("parsing %s failed: %w", file, err)
+	}
+	if config.PolitenessDelay != nil {
+		if r.PolitenessFixedDelay, err = time.ParseDuration(*config.PolitenessDelay); err != nil {
+			return r, fmt.Errorf("parsing %s failed: %w", file, err)
+		}
+	}
+	if config.Concurrency != nil {
+		r.Concurrency = *config.Concurrency
+	}
+	if config.AllowedHosts != nil {
+		r.AllowedHosts = *config.AllowedHosts
+	}
+	if config.BlockedHosts != nil {
+		r.BlockedHosts = *config.BlockedHosts
+	}
+	if config.Scope != nil {
+		if r.Scope, err = NewScope(*config.Scope); err != nil {
+			return r, fmt.Errorf("parsing %s failed: %w", file, err)
+		}
+	}
+	return r, nil
+}
+
+// reloadFile reloads the settings from the ReloadFile, on SIGHUP, keeping
+// the current ones if it's not valid
+func (c *WebCrawler) reloadFile(run *crawlRun) {
+	r, err := c.LoadReloadable(c.settings.ReloadFile)
+	if err == nil {
+		err = c.Reload(r)
+	}
+	if err != nil {
+		c.logger.Error("Unable to reload settings", "job", run.job,
+			"file", c.settings.ReloadFile, "err", err)
+	}
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	crawler := New("test-agent", &testQueue{}, withPolitenessDelay(time.Second))
+	rootURL, _ := url.Parse("http://example.com")
+	rules := NewCrawlingRules(rootURL, newMemoryCache(), time.Second)
+	crawler.crawls.Store(&hostCrawl{rootURL: rootURL, rules: rules, semaphore: newSemaphore(1)}, struct{}{})
+	r := crawler.Reloadable()
+	r.PolitenessFixedDelay = 0
+	r.BlockedHosts = []string{"*.example.com"}
+	if err := crawler.Reload(r); err != nil {
+		t.Fatalf("Crawler#Reload failed: %v", err)
+	}
+	if crawler.hostAllowed("www.example.com") {
+		t.Errorf("Crawler#Reload failed: expected www.example.com blocked")
+	}
+	// The domains being crawled follow the new politeness delay
+	if delay := rules.Delay(); delay != 0 {
+		t.Errorf("Crawler#Reload failed: expected no delay got %v", delay)
+	}
+	r.Concurrency = -1
+	if err := crawler.Reload(r); err == nil {
+		t.Errorf("Crawler#Reload failed: expected error on negative concurrency")
+	}
+	if got := crawler.Reloadable(); got.Concurrency != defaultConcurrency {
+		t.Errorf("Crawler#Reload failed: expected settings unchanged got %v", got)
+	}
+}
+
+func TestLoadReloadable(t *testing.T) {
+	crawler := New("test-agent", &testQueue{}, func(s *CrawlerSettings) {
+		s.AllowedHosts = []string{"example.com"}
+	})
+	file := filepath.Join(t.TempDir(), "reload.json")
+	data := `{"politeness_delay": "2s", "blocked_hosts": ["cdn.example.com"],
+		"scope": {"deny": ["/tags/**"]}}`
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := crawler.LoadReloadable(file)
+	if err != nil {
+		t.Fatalf("Crawler#LoadReloadable failed: %v", err)
+	}
+	if r.PolitenessFixedDelay != 2*time.Second || r.Concurrency != defaultConcurrency ||
+		!reflect.DeepEqual(r.AllowedHosts, []string{"example.com"}) ||
+		!reflect.DeepEqual(r.BlockedHosts, []string{"cdn.example.com"}) || r.Scope == nil {
+		t.Errorf("Crawler#LoadReloadable failed: unexpected settings %v", r)
+	}
+	if err := os.WriteFile(file, []byte(`{"politeness_delay": "soon"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crawler.LoadReloadable(file); err == nil {
+		t.Errorf("Crawler#LoadReloadable failed: expected error on invalid delay")
+	}
+}
@@ -0,0 +1,109 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"time"
+)
+
+// CrawlReport contains the statistics of a crawl, overall and for each
+// domain crawled, to log and compare crawl runs, json serializable
+type CrawlReport struct {
+	Job      string        `json:"job"`
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	Duration time.Duration `json:"duration"`
+	// Fetched, Discovered, Errors and Bytes are the totals of the hosts
+	Fetched    int64 `json:"fetched"`
+	Discovered int64 `json:"discovered"`
+	Errors     int64 `json:"errors"`
+	Bytes      int64 `json:"bytes"`
+	// Hosts are the statistics of each host crawled
+	Hosts map[string]HostReport `json:"hosts,omitempty"`
+	// External are the links found to the hosts of other registered
+	// domains, followed or not, by host
+	External map[string]ExternalHost `json:"external,omitempty"`
+	// Err is the reason of the failure of the crawl, empty if it finished
+	Err string `json:"error,omitempty"`
+}
+
+// HostReport contains the statistics of the crawl of a single host
+type HostReport struct {
+	// Fetched is the number of pages fetched successfully
+	Fetched int64 `json:"fetched"`
+	// Discovered is the number of distinct links admitted to be crawled,
+	// the seeds included
+	Discovered int64 `json:"discovered"`
+	// Skipped is the number of links refused
+	Skipped int64 `json:"skipped"`
+	// Errors is the number of failed fetches
+	Errors int64 `json:"errors"`
+	// Bytes is the size of the bodies downloaded
+	Bytes int64 `json:"bytes"`
+	// Duration is the time spent crawling the host
+	Duration time.Duration `json:"duration"`
+	// PagesPerSecond is the rate of the fetches, failed ones included
+	PagesPerSecond float64 `json:"pages_per_second"`
+	// Latency are the percentiles of the response times of the host, since
+	// the creation of the crawler
+	Latency LatencyPercentiles `json:"latency"`
+}
+
+// report returns the report of the running crawl, the counters are the
+// difference between the current ones and the ones at the start of the
+// crawl
+func (c *WebCrawler) report(run *crawlRun, started time.Time,
+	before map[string]HostStats, err error) CrawlReport {
+	finished := time.Now()
+	report := CrawlReport{Job: run.job, Started: started, Finished: finished, Duration: finished.Sub(started),
+		External: run.external.Snapshot()}
+	for host, stats := range c.stats.Snapshot() {
+		prev := before[host]
+		r := HostReport{
+			Fetched:    stats.Fetched - prev.Fetched,
+			Discovered: stats.Discovered - prev.Discovered,
+			Skipped:    stats.Skipped - prev.Skipped,
+			Errors:     stats.Errors - prev.Errors,
+			Bytes:      stats.Bytes - prev.Bytes,
+			Duration:   stats.Elapsed - prev.Elapsed,
+			Latency:    stats.Latency,
+		}
+		if r.Fetched+r.Discovered+r.Skipped+r.Errors == 0 {
+			continue
+		}
+		if r.Duration > 0 {
+			r.PagesPerSecond = float64(r.Fetched+r.Errors) / r.Duration.Seconds()
+		}
+		if report.Hosts == nil {
+			report.Hosts = make(map[string]HostReport)
+		}
+		report.Hosts[host] = r
+		report.Fetched += r.Fetched
+		report.Discovered += r.Discovered
+		report.Errors += r.Errors
+		report.Bytes += r.Bytes
+	}
+	if err != nil {
+		report.Err = err.Error()
+	}
+	return report
+}
+
+// finish ends a crawl, keeping its report and notifying its summary, err is
+// the reason of its failure, if any, returned as is along the report
+func (c *WebCrawler) finish(run *crawlRun, seeds []Seed, started time.Time,
+	before map[string]HostStats, err error) (CrawlReport, error) {
+	report := c.report(run, started, before, err)
+	c.lastReport.Store(&report)
+	c.notify(run, c.summarize(run, seeds, started, before, err))
+	return report, err
+}
+
+// Report returns the report of the last crawl to finish, of any of the
+// crawls running at once
+func (c *WebCrawler) Report() CrawlReport {
+	if report := c.lastReport.Load(); report != nil {
+		return *report
+	}
+	return CrawlReport{}
+}
@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCrawlReport(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0))
+	first := crawler.Crawl(server.URL+"/foo", server.URL+"/missing")
+	second := crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	<-results
+	host, _ := url.Parse(server.URL)
+	stats, ok := first.Hosts[host.Host]
+	if !ok {
+		t.Fatalf("Crawler#Crawl failed: no report for %s in %+v", host.Host, first)
+	}
+	if stats.Fetched != 3 || stats.Errors != 1 || stats.Discovered != 4 || stats.Bytes <= 0 ||
+		stats.Duration <= 0 || stats.PagesPerSecond <= 0 {
+		t.Errorf("Crawler#Crawl failed: unexpected host report %+v", stats)
+	}
+	if first.Fetched != 3 || first.Errors != 1 || first.Bytes != stats.Bytes ||
+		first.Duration <= 0 || first.Job == "" || first.Err != "" {
+		t.Errorf("Crawler#Crawl failed: unexpected report %+v", first)
+	}
+	// Every page links the same external page
+	expected := ExternalHost{Links: 3, Sources: []string{server.URL + "/foo",
+		server.URL + "/foo/bar/baz", server.URL + "/foo/bar/test"}}
+	external := first.External["example-page.com"]
+	sort.Strings(external.Sources)
+	if len(first.External) != 1 || !reflect.DeepEqual(external, expected) {
+		t.Errorf("Crawler#Crawl failed: expected external hosts %+v got %+v", expected, first.External)
+	}
+	// The counters of a crawl don't include the ones of the previous crawls,
+	// the seed was visited already
+	if second.Fetched != 0 || second.Errors != 0 || second.Hosts[host.Host].Skipped != 1 ||
+		second.Job == first.Job {
+		t.Errorf("Crawler#Crawl failed: unexpected second report %+v", second)
+	}
+	if report := crawler.Report(); report.Job != second.Job {
+		t.Errorf("Crawler#Report failed: expected the last report got %+v", report)
+	}
+}
+
+func TestConcurrentCrawlReports(t *testing.T) {
+	fast, slow := serverMockWithoutRobotsTxt(), serverMockWithoutRobotsTxt()
+	defer fast.Close()
+	defer slow.Close()
+	crawler := New("test-agent", &testQueue{make(chan []byte, 16)},
+		withCrawlTimeout(100*time.Millisecond), withPolitenessDelay(0))
+	reports := make(chan CrawlReport)
+	go func() { reports <- crawler.Crawl(slow.URL+"/foo", slow.URL+"/missing") }()
+	fastReport := crawler.Crawl(fast.URL + "/foo")
+	slowReport := <-reports
+	// Each crawl returns its own report, whatever the one finished last
+	if fastReport.Job == slowReport.Job || slowReport.Errors != 1 {
+		t.Errorf("Crawler#Crawl failed: expected a report per crawl got %+v and %+v",
+			fastReport, slowReport)
+	}
+	if job := crawler.Report().Job; job != fastReport.Job && job != slowReport.Job {
+		t.Errorf("Crawler#Report failed: expected the last report got %s", job)
+	}
+}
+
+func TestExternalInventory(t *testing.T) {
+	inventory := newExternalInventory()
+	link, _ := url.Parse("https://cdn.example.com/lib.js")
+	for _, source := range []string{"/a", "/b", "/a", "/c", "/d"} {
+		inventory.Add(source, link)
+	}
+	hosts := inventory.Snapshot()
+	if host := hosts["cdn.example.com"]; host.Links != 5 || len(host.Sources) != maxExternalSources ||
+		host.Sources[0] != "/a" || host.Sources[2] != "/c" {
+		t.Errorf("externalInventory#Snapshot failed: unexpected hosts %+v", hosts)
+	}
+}
+
+func TestCrawlReportExternalLinks(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/", resourceMock(`<a href="https://cdn.other.org/x"><a href="/a"><a href="/b">`))
+	handler.HandleFunc("/a", resourceMock(`<a href="https://cdn.other.org/x"><a href="https://cdn.other.org/x">`))
+	handler.HandleFunc("/b", resourceMock(`<a href="https://cdn.other.org/x">`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.RandomSeed = 42 })
+	report := crawler.Crawl(server.URL + "/")
+	testbus.Close()
+	<-results
+	// The links repeated on the same page count once
+	expected := map[string]ExternalHost{"cdn.other.org": {
+		Links:   3,
+		Sources: []string{server.URL + "/", server.URL + "/a", server.URL + "/b"},
+	}}
+	if !reflect.DeepEqual(report.External, expected) {
+		t.Errorf("Crawler#Crawl failed: expected external hosts %+v got %+v", expected, report.External)
+	}
+}
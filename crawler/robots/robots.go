@@ -0,0 +1,25 @@
+// Package robots containing utilities to evaluate robots.txt directives
+// without running a crawl
+package robots
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/temoto/robotstxt"
+)
+
+// Check tests if an URL can be crawled by a user agent according to the
+// content of a robots.txt file, the same way the crawler does. Returns an
+// error if the robots.txt or the URL can't be parsed.
+func Check(userAgent, robotsBody, rawURL string) (bool, error) {
+	data, err := robotstxt.FromString(robotsBody)
+	if err != nil {
+		return false, fmt.Errorf("checking robots.txt failed: %w", err)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, fmt.Errorf("checking robots.txt failed: %w", err)
+	}
+	return data.FindGroup(userAgent).Test(u.RequestURI()), nil
+}
@@ -0,0 +1,37 @@
+package robots
+
+import "testing"
+
+const robotsBody = `User-agent: *
+Disallow: /private
+
+User-agent: test-agent
+Disallow: /foo`
+
+func TestCheck(t *testing.T) {
+	testCases := []struct {
+		userAgent, url string
+		allowed        bool
+	}{
+		{"other-agent", "http://localhost/foo", true},
+		{"other-agent", "http://localhost/private/a", false},
+		{"test-agent", "http://localhost/foo/bar", false},
+		{"test-agent", "http://localhost/private", true},
+	}
+	for _, tc := range testCases {
+		allowed, err := Check(tc.userAgent, robotsBody, tc.url)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if allowed != tc.allowed {
+			t.Errorf("Check(%s, %s) failed: expected %v got %v",
+				tc.userAgent, tc.url, tc.allowed, allowed)
+		}
+	}
+}
+
+func TestCheckInvalidURL(t *testing.T) {
+	if _, err := Check("test-agent", robotsBody, "http://local host/%zz"); err == nil {
+		t.Errorf("Check failed: expected error on invalid URL")
+	}
+}
@@ -0,0 +1,224 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+// ScopeConfig is the declarative form of a `Scope`, meant to be written by
+// hand in a JSON file, e.g.
+//
+//	{
+//	    "domains": ["*.example.com"],
+//	    "allow": ["/blog/**"],
+//	    "deny": ["/blog/tags/**"],
+//	    "content_types": ["text/html"],
+//	    "depths": [{"pattern": "/blog/archive/**", "max_depth": 2}]
+//	}
+//
+// Path globs support `*` matching any character but `/`, `**` matching any
+// character and `?` matching a single character.
+type ScopeConfig struct {
+	// Domains are the host patterns of the domains that can be crawled, no
+	// patterns means any domain
+	Domains []string `json:"domains"`
+	// Allow are the path globs of the links to crawl, no globs means any
+	// path
+	Allow []string `json:"allow"`
+	// Deny are the path globs of the links never to crawl, they take
+	// precedence over Allow
+	Deny []string `json:"deny"`
+	// ContentTypes are the media type patterns, e.g. text/*, of the pages
+	// to process, no patterns means any content type
+	ContentTypes []string `json:"content_types"`
+	// Depths sets the maximum depth of the links matching a path glob, the
+	// first matching rule applies
+	Depths []DepthRule `json:"depths"`
+}
+
+// DepthRule caps the depth of the links whose path matches a glob
+type DepthRule struct {
+	Pattern  string `json:"pattern"`
+	MaxDepth int    `json:"max_depth"`
+}
+
+// depthRule is the compiled form of a `DepthRule`
+type depthRule struct {
+	pattern  *regexp.Regexp
+	maxDepth int
+}
+
+// Scope is a compiled `ScopeConfig`, it decides which links and pages are in
+// the scope of a crawl
+type Scope struct {
+	domains      []string
+	allow, deny  []*regexp.Regexp
+	contentTypes []string
+	depths       []depthRule
+}
+
+// NewScope compiles a `ScopeConfig` into a `Scope`, returns an error if any
+// pattern is invalid
+func NewScope(config ScopeConfig) (*Scope, error) {
+	scope := &Scope{domains: config.Domains}
+	for _, patterns := range [][]string{config.Domains, config.ContentTypes} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil,
+					fmt.Errorf("compiling scope failed: %q: %w", pattern, err)
+			}
+		}
+	}
+	var err error
+	if scope.allow, err = compileGlobs(config.Allow); err != nil {
+		return nil, fmt.Errorf("compiling scope failed: %w", err)
+	}
+	if scope.deny, err = compileGlobs(config.Deny); err != nil {
+		return nil, fmt.Errorf("compiling scope failed: %w", err)
+	}
+	for _, ct := range config.ContentTypes {
+		scope.contentTypes = append(scope.contentTypes, strings.ToLower(ct))
+	}
+	for _, rule := range config.Depths {
+		pattern, err := compileGlob(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling scope failed: %w", err)
+		}
+		if rule.MaxDepth < 0 {
+			return nil, fmt.Errorf("compiling scope failed: %q: negative max depth", rule.Pattern)
+		}
+		scope.depths = append(scope.depths, depthRule{pattern, rule.MaxDepth})
+	}
+	return scope, nil
+}
+
+// ParseScope compiles a `Scope` from its JSON form, unknown fields are
+// reported as errors to catch typos
+func ParseScope(data []byte) (*Scope, error) {
+	var config ScopeConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("parsing scope failed: %w", err)
+	}
+	return NewScope(config)
+}
+
+// LoadScope compiles a `Scope` from a JSON file
+func LoadScope(file string) (*Scope, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("loading scope failed: %w", err)
+	}
+	return ParseScope(data)
+}
+
+// Allowed tests if a link found at a given depth is in scope
+func (s *Scope) Allowed(link *url.URL, depth int) bool {
+	if len(s.domains) > 0 && !matchAnyHost(s.domains, link.Hostname()) {
+		return false
+	}
+	linkPath := link.EscapedPath()
+	if linkPath == "" {
+		linkPath = "/"
+	}
+	if matchAny(s.deny, linkPath) {
+		return false
+	}
+	if len(s.allow) > 0 && !matchAny(s.allow, linkPath) {
+		return false
+	}
+	for _, rule := range s.depths {
+		if rule.pattern.MatchString(linkPath) {
+			return depth <= rule.maxDepth
+		}
+	}
+	return true
+}
+
+// AllowedContentType tests if a page with the given Content-Type header is in
+// scope, a missing header is always in scope
+func (s *Scope) AllowedContentType(contentType string) bool {
+	if len(s.contentTypes) == 0 || contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range s.contentTypes {
+		if ok, _ := path.Match(pattern, mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAnyHost tests if a host matches any of the patterns
+func matchAnyHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if fetcher.MatchHost(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny tests if a string matches any of the regexps
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileGlobs compiles a list of path globs
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		pattern, err := compileGlob(glob)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// compileGlob translates a path glob into an anchored regexp, `**` matches
+// any character, `*` any character but `/` and `?` a single character
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	if glob == "" {
+		return nil, fmt.Errorf("empty path glob")
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScopeAllowed(t *testing.T) {
+	scope, err := ParseScope([]byte(`{
+		"domains": ["*.example.com"],
+		"allow": ["/blog/**", "/about"],
+		"deny": ["/blog/tags/*"],
+		"depths": [{"pattern": "/blog/archive/**", "max_depth": 2}]
+	}`))
+	if err != nil {
+		t.Fatalf("ParseScope failed: %v", err)
+	}
+	testCases := []struct {
+		link    string
+		depth   int
+		allowed bool
+	}{
+		{"http://www.example.com/blog/post", 5, true},
+		{"http://www.example.com/blog/2020/post", 5, true},
+		{"http://www.example.com/about", 1, true},
+		{"http://www.example.com/about/team", 1, false},
+		{"http://www.example.com/contacts", 1, false},
+		{"http://www.example.org/blog/post", 1, false},
+		{"http://www.example.com/blog/tags/go", 1, false},
+		{"http://www.example.com/blog/tags/go/page", 1, true},
+		{"http://www.example.com/blog/archive/2020", 2, true},
+		{"http://www.example.com/blog/archive/2020", 3, false},
+	}
+	for _, tc := range testCases {
+		link, _ := url.Parse(tc.link)
+		if got := scope.Allowed(link, tc.depth); got != tc.allowed {
+			t.Errorf("Scope#Allowed(%s, %d) failed: expected %v got %v",
+				tc.link, tc.depth, tc.allowed, got)
+		}
+	}
+}
+
+func TestScopeAllowedContentType(t *testing.T) {
+	scope, err := NewScope(ScopeConfig{ContentTypes: []string{"text/html", "application/*"}})
+	if err != nil {
+		t.Fatalf("NewScope failed: %v", err)
+	}
+	testCases := map[string]bool{
+		"text/html; charset=utf-8": true,
+		"TEXT/HTML":                true,
+		"application/xhtml+xml":    true,
+		"image/png":                false,
+		"":                         true,
+		"not a media type;;":       false,
+	}
+	for contentType, allowed := range testCases {
+		if got := scope.AllowedContentType(contentType); got != allowed {
+			t.Errorf("Scope#AllowedContentType(%q) failed: expected %v got %v",
+				contentType, allowed, got)
+		}
+	}
+}
+
+func TestParseScopeInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"domains": ["[a"]}`,
+		`{"allow": [""]}`,
+		`{"depths": [{"pattern": "/a", "max_depth": -1}]}`,
+		`{"alow": ["/a"]}`,
+		`not json`,
+	} {
+		if _, err := ParseScope([]byte(data)); err == nil {
+			t.Errorf("ParseScope(%s) failed: expected error", data)
+		}
+	}
+}
+
+func TestLoadScope(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "scope.json")
+	if err := os.WriteFile(file, []byte(`{"deny": ["/private/**"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scope, err := LoadScope(file)
+	if err != nil {
+		t.Fatalf("LoadScope failed: %v", err)
+	}
+	link, _ := url.Parse("http://localhost/private/a")
+	if scope.Allowed(link, 0) {
+		t.Errorf("LoadScope failed: expected %s to be denied", link)
+	}
+	if _, err := LoadScope(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("LoadScope failed: expected error on missing file")
+	}
+}
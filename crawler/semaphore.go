@@ -0,0 +1,87 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"context"
+	"sync"
+)
+
+// semaphore limits the number of concurrent holders, like a buffered
+// channel, but its size can change while in use: growing it admits new
+// holders immediately, shrinking it lets the holders in excess finish and
+// admits new ones once they're back under the size
+type semaphore struct {
+	mutex      sync.Mutex
+	size, held int
+	// changed is closed and replaced on every release and resize, waking up
+	// the goroutines waiting to acquire
+	changed chan struct{}
+}
+
+// newSemaphore creates a new semaphore of a size, at least one
+func newSemaphore(size int) *semaphore {
+	return &semaphore{size: semaphoreSize(size), changed: make(chan struct{})}
+}
+
+// semaphoreSize returns the size of a semaphore for a concurrency setting,
+// 0 means one as we want to disallow the unlimited concurrency, to avoid
+// being banned from the ccurrent crawled domain and also to avoid running
+// OOM or running out of unix file descriptors, as each HTTP call is built
+// upon a socket connection, which is in-fact an opened descriptor.
+func semaphoreSize(concurrency int) int {
+	if concurrency < 1 {
+		return 1
+	}
+	return concurrency
+}
+
+// Acquire blocks till a slot is free, returns false if the context is done
+// first
+func (s *semaphore) Acquire(ctx context.Context) bool {
+	for {
+		s.mutex.Lock()
+		if s.held < s.size {
+			s.held++
+			s.mutex.Unlock()
+			return true
+		}
+		changed := s.changed
+		s.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Release frees a slot
+func (s *semaphore) Release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.held--
+	s.broadcast()
+}
+
+// Resize changes the size of the semaphore, at least one
+func (s *semaphore) Resize(size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.size = semaphoreSize(size)
+	s.broadcast()
+}
+
+// Size returns the current size of the semaphore
+func (s *semaphore) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.size
+}
+
+// broadcast wakes up the goroutines waiting to acquire, the mutex must be
+// held
+func (s *semaphore) broadcast() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
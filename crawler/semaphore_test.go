@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreResize(t *testing.T) {
+	s := newSemaphore(0)
+	if s.Size() != 1 {
+		t.Errorf("semaphore failed: expected size 1 got %d", s.Size())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if !s.Acquire(context.Background()) || s.Acquire(ctx) {
+		t.Fatalf("semaphore#Acquire failed: expected a single slot")
+	}
+	// Growing admits a waiting holder
+	acquired := make(chan bool)
+	go func() { acquired <- s.Acquire(context.Background()) }()
+	s.Resize(2)
+	if !<-acquired {
+		t.Errorf("semaphore#Resize failed: expected a new slot")
+	}
+	// Shrinking lets the holders in excess finish
+	s.Resize(1)
+	go func() { acquired <- s.Acquire(context.Background()) }()
+	s.Release()
+	select {
+	case <-acquired:
+		t.Errorf("semaphore#Resize failed: expected no slot with 1 holder left")
+	case <-time.After(20 * time.Millisecond):
+	}
+	s.Release()
+	if !<-acquired {
+		t.Errorf("semaphore#Release failed: expected a slot")
+	}
+}
+
+func TestSetConcurrency(t *testing.T) {
+	crawler := New("test-agent", &testQueue{})
+	h := &hostCrawl{semaphore: newSemaphore(1)}
+	crawler.crawls.Store(h, struct{}{})
+	if err := crawler.SetConcurrency(4); err != nil {
+		t.Fatalf("Crawler#SetConcurrency failed: %v", err)
+	}
+	if h.semaphore.Size() != 4 || crawler.Reloadable().Concurrency != 4 {
+		t.Errorf("Crawler#SetConcurrency failed: expected 4 got %d", h.semaphore.Size())
+	}
+	if err := crawler.SetConcurrency(-1); err == nil {
+		t.Errorf("Crawler#SetConcurrency failed: expected error on negative concurrency")
+	}
+}
@@ -0,0 +1,66 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SessionInitializer establishes a session on a domain before crawling it,
+// e.g. performing a login flow. Cookies set during the process are kept by
+// the client and sent on every following request.
+type SessionInitializer interface {
+	// InitSession is called with the client used by the crawler and the
+	// root URL of the domain about to be crawled
+	InitSession(ctx context.Context, client *http.Client, rootURL *url.URL) error
+}
+
+// SessionInitializerFunc is an adapter to use ordinary functions as
+// `SessionInitializer`
+type SessionInitializerFunc func(context.Context, *http.Client, *url.URL) error
+
+// InitSession calls f(ctx, client, rootURL)
+func (f SessionInitializerFunc) InitSession(ctx context.Context,
+	client *http.Client, rootURL *url.URL) error {
+	return f(ctx, client, rootURL)
+}
+
+// FormLogin is a `SessionInitializer` posting a form of credentials to a
+// login path of the domain
+type FormLogin struct {
+	// Path is the path of the login form action, resolved against the root
+	// URL of the domain
+	Path string
+	// Values are the form fields to submit, e.g. username and password
+	Values url.Values
+}
+
+// InitSession posts the login form, any response with a status code of 400
+// or greater is considered a failure
+func (l FormLogin) InitSession(ctx context.Context,
+	client *http.Client, rootURL *url.URL) error {
+	path, err := url.Parse(l.Path)
+	if err != nil {
+		return fmt.Errorf("login on %s failed: %w", rootURL.Host, err)
+	}
+	loginURL := rootURL.ResolveReference(path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		loginURL.String(), strings.NewReader(l.Values.Encode()))
+	if err != nil {
+		return fmt.Errorf("login on %s failed: %w", rootURL.Host, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("login on %s failed: %w", rootURL.Host, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("login on %s failed: %s", rootURL.Host, res.Status)
+	}
+	return nil
+}
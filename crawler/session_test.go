@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func serverMockWithLogin() *httptest.Server {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.FormValue("password") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "ok", Path: "/"})
+	})
+	handler.HandleFunc("/private", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "ok" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`<body><a href="/private/page">page</a></body>`))
+	})
+	return httptest.NewServer(handler)
+}
+
+func withSession(s SessionInitializer) CrawlerOpt {
+	return func(settings *CrawlerSettings) {
+		settings.SessionInitializer = s
+	}
+}
+
+func TestCrawlPagesWithFormLogin(t *testing.T) {
+	server := serverMockWithLogin()
+	defer server.Close()
+	tests := map[string]int{"secret": 1, "wrong": 0}
+	for password, expected := range tests {
+		testbus := testQueue{make(chan []byte)}
+		results := make(chan []ParsedResult)
+		go func() { results <- consumeEvents(&testbus) }()
+		login := FormLogin{Path: "/login", Values: url.Values{"password": {password}}}
+		crawler := New("test-agent", &testbus,
+			withCrawlTimeout(100*time.Millisecond), withSession(login))
+		crawler.Crawl(server.URL + "/private")
+		testbus.Close()
+		if res := <-results; len(res) != expected {
+			t.Errorf("Crawler#Crawl failed: expected %d results got %v", expected, res)
+		}
+	}
+}
+
+func TestCrawlContextWithFailedLogin(t *testing.T) {
+	server := serverMockWithLogin()
+	defer server.Close()
+	for password, failed := range map[string]bool{"secret": false, "wrong": true} {
+		testbus := testQueue{make(chan []byte)}
+		results := make(chan []ParsedResult)
+		go func() { results <- consumeEvents(&testbus) }()
+		login := FormLogin{Path: "/login", Values: url.Values{"password": {password}}}
+		crawler := New("test-agent", &testbus,
+			withCrawlTimeout(100*time.Millisecond), withSession(login))
+		err := crawler.CrawlContext(context.Background(), server.URL+"/private")
+		testbus.Close()
+		<-results
+		if (err != nil) != failed {
+			t.Errorf("Crawler#CrawlContext failed: unexpected error %v", err)
+		}
+	}
+}
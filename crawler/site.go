@@ -0,0 +1,113 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+// SiteResult is the type of the `SiteMetadata` of each domain crawled
+const SiteResult ResultType = "site"
+
+// Maximum size of a web app manifest
+const maxManifestSize int64 = 1 << 20
+
+// SiteMetadata contains the branding of a domain crawled, found on its root
+// page: the favicons, the web app manifest and, if fetched, the content of
+// the manifest, json serializable to be sent on message queues
+type SiteMetadata struct {
+	URL         string            `json:"url"`
+	Favicons    []string          `json:"favicons,omitempty"`
+	Manifest    string            `json:"manifest,omitempty"`
+	WebManifest *WebManifest      `json:"web_manifest,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// WebManifest contains the fields of a web app manifest describing the
+// branding of a site, the URLs are resolved against the manifest one
+type WebManifest struct {
+	Name            string         `json:"name,omitempty"`
+	ShortName       string         `json:"short_name,omitempty"`
+	StartURL        string         `json:"start_url,omitempty"`
+	ThemeColor      string         `json:"theme_color,omitempty"`
+	BackgroundColor string         `json:"background_color,omitempty"`
+	Icons           []ManifestIcon `json:"icons,omitempty"`
+}
+
+// ManifestIcon is an icon listed by a web app manifest
+type ManifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// parseWebManifest parses a web app manifest fetched from an URL
+func parseWebManifest(manifestURL *url.URL, r io.Reader) (*WebManifest, error) {
+	var manifest WebManifest
+	if err := json.NewDecoder(io.LimitReader(r, maxManifestSize)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest failed: %w", err)
+	}
+	resolve := func(ref string) string {
+		u, err := url.Parse(ref)
+		if ref == "" || err != nil {
+			return ref
+		}
+		return manifestURL.ResolveReference(u).String()
+	}
+	manifest.StartURL = resolve(manifest.StartURL)
+	for i := range manifest.Icons {
+		manifest.Icons[i].Src = resolve(manifest.Icons[i].Src)
+	}
+	return &manifest, nil
+}
+
+// emitSite produces the `SiteMetadata` of a domain from its root page, if
+// enabled, once per crawl of the domain
+func (c *WebCrawler) emitSite(ctx context.Context, h *hostCrawl, page *Page) {
+	if !c.settings.SiteMetadata {
+		return
+	}
+	h.site.Do(func() {
+		site := SiteMetadata{
+			URL:      h.rootURL.String(),
+			Favicons: stringifyLinks(page.Icons),
+			Metadata: h.metadata,
+		}
+		if page.Manifest != nil {
+			site.Manifest = page.Manifest.String()
+			if c.settings.FetchManifest {
+				manifest, err := c.fetchManifest(ctx, h, page.Manifest)
+				if err != nil {
+					h.logger.Error("Manifest fetch failed", "url", page.Manifest, "err", err)
+				}
+				site.WebManifest = manifest
+			}
+		}
+		c.emitResult(h.run, SiteResult, site, c.logger.With("job", h.run.job, "url", site.URL))
+	})
+}
+
+// fetchManifest fetches and parses the web app manifest of a domain, if
+// allowed by its rules
+func (c *WebCrawler) fetchManifest(ctx context.Context, h *hostCrawl, link *url.URL) (*WebManifest, error) {
+	if !h.rules.Allowed(link) {
+		return nil, fmt.Errorf("fetching manifest %s failed: not allowed", link)
+	}
+	_, res, err := fetchContext(ctx, c.linkFetcher, link.String())
+	if err != nil {
+		return nil, fmt.Errorf("fetching manifest %s failed: %w", link, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching manifest %s failed: %w", link,
+			&fetcher.StatusError{Code: res.StatusCode, Status: res.Status})
+	}
+	return parseWebManifest(link, res.Body)
+}
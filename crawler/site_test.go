@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWebManifest(t *testing.T) {
+	manifestURL, _ := url.Parse("https://example.com/static/site.webmanifest")
+	manifest, err := parseWebManifest(manifestURL, strings.NewReader(`{
+		"name": "Example", "start_url": "/", "theme_color": "#fff",
+		"icons": [{"src": "icon-192.png", "sizes": "192x192", "type": "image/png"}]
+	}`))
+	if err != nil {
+		t.Fatalf("parseWebManifest failed: %v", err)
+	}
+	expected := &WebManifest{
+		Name:       "Example",
+		StartURL:   "https://example.com/",
+		ThemeColor: "#fff",
+		Icons:      []ManifestIcon{{Src: "https://example.com/static/icon-192.png", Sizes: "192x192", Type: "image/png"}},
+	}
+	if !reflect.DeepEqual(manifest, expected) {
+		t.Errorf("parseWebManifest failed: expected %v got %v", expected, manifest)
+	}
+	if _, err := parseWebManifest(manifestURL, strings.NewReader("<html>")); err == nil {
+		t.Errorf("parseWebManifest failed: expected error on invalid JSON")
+	}
+}
+
+func TestCrawlSiteMetadata(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/", resourceMock(
+		`<head><link rel="icon" href="/favicon.png"><link rel="manifest" href="/manifest.json"></head>
+		 <a href="/about">`))
+	handler.HandleFunc("/about", resourceMock(`<head><link rel="icon" href="/other.png"></head><a href="/">`))
+	handler.HandleFunc("/manifest.json", resourceMock(`{"name": "Test site", "short_name": "Test"}`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	queue := &testQueue{make(chan []byte, 16)}
+	crawler := New("test-agent", queue, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.SiteMetadata = true
+			s.FetchManifest = true
+		})
+	crawler.Crawl(server.URL + "/")
+	queue.Close()
+	var sites []SiteMetadata
+	for payload := range queue.bus {
+		if strings.Contains(string(payload), `"favicons"`) {
+			var site SiteMetadata
+			if err := json.Unmarshal(payload, &site); err != nil {
+				t.Fatalf("Crawler#Crawl failed: invalid site result %v", err)
+			}
+			sites = append(sites, site)
+		}
+	}
+	expected := []SiteMetadata{{
+		URL:         server.URL + "/",
+		Favicons:    []string{server.URL + "/favicon.png"},
+		Manifest:    server.URL + "/manifest.json",
+		WebManifest: &WebManifest{Name: "Test site", ShortName: "Test"},
+	}}
+	if !reflect.DeepEqual(sites, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, sites)
+	}
+}
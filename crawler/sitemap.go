@@ -0,0 +1,218 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+// Default path of the sitemap of a domain not listing any in its robots.txt
+const sitemapPath string = "/sitemap.xml"
+
+// Maximum size of an uncompressed sitemap, as set by the sitemaps protocol
+const maxSitemapSize int64 = 50 << 20
+
+// sitemapLister is implemented by the rules engines knowing the sitemaps of
+// their domain, e.g. from the robots.txt
+type sitemapLister interface {
+	Sitemaps() []string
+}
+
+// sitemapURL is an URL listed by a sitemap
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+	// Images and Videos are listed by the image and video sitemap
+	// extensions, e.g. <image:image>, matched by their local name
+	Images []sitemapImage `xml:"image"`
+	Videos []sitemapVideo `xml:"video"`
+}
+
+// sitemap is a sitemap document, either an urlset listing the URLs of a
+// site or a sitemapindex listing other sitemaps
+type sitemap struct {
+	XMLName  xml.Name
+	URLs     []sitemapURL `xml:"url"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// parseSitemap parses a sitemap document, gzipped or not
+func parseSitemap(r io.Reader) (*sitemap, error) {
+	buffered := bufio.NewReader(r)
+	// Gzipped sitemaps are common, e.g. sitemap.xml.gz, their magic number
+	// tells them apart whatever the content type
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("parsing sitemap failed: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = buffered
+	}
+	var s sitemap
+	if err := xml.NewDecoder(io.LimitReader(r, maxSitemapSize)).Decode(&s); err != nil {
+		return nil, fmt.Errorf("parsing sitemap failed: %w", err)
+	}
+	if s.XMLName.Local != "urlset" && s.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("parsing sitemap failed: unexpected root element %q", s.XMLName.Local)
+	}
+	return &s, nil
+}
+
+// sitemapMetadata returns the metadata of a result of an URL listed by a
+// sitemap, the metadata of the seed with the sitemap attributes set
+func sitemapMetadata(seed map[string]string, sitemapLink string, u sitemapURL) map[string]string {
+	metadata := make(map[string]string, len(seed)+4)
+	for k, v := range seed {
+		metadata[k] = v
+	}
+	metadata["sitemap"] = sitemapLink
+	for k, v := range map[string]string{"lastmod": u.LastMod, "changefreq": u.ChangeFreq, "priority": u.Priority} {
+		if v = strings.TrimSpace(v); v != "" {
+			metadata[k] = v
+		}
+	}
+	return metadata
+}
+
+// sitemaps returns the sitemaps of a domain, the ones listed in its
+// robots.txt or the default /sitemap.xml
+func (c *WebCrawler) sitemaps(h *hostCrawl) []string {
+	if lister, ok := h.rules.(sitemapLister); ok {
+		if sitemaps := lister.Sitemaps(); len(sitemaps) > 0 {
+			return sitemaps
+		}
+	}
+	u, _ := url.Parse(sitemapPath)
+	return []string{h.rootURL.ResolveReference(u).String()}
+}
+
+// crawlSitemaps enumerates the URLs of a domain from its sitemaps alone,
+// following the sitemap indexes, with no page fetched. Every URL listed and
+// admitted is produced as a result with no links, its lastmod, changefreq
+// and priority in the metadata.
+func (c *WebCrawler) crawlSitemaps(ctx context.Context, h *hostCrawl) {
+	pending := c.sitemaps(h)
+	seen := make(map[string]bool)
+	for len(pending) > 0 && ctx.Err() == nil {
+		link := pending[0]
+		pending = pending[1:]
+		if seen[link] {
+			continue
+		}
+		seen[link] = true
+		s, timings, err := c.fetchSitemap(ctx, link)
+		h.health.Observe(timings.Total, err)
+		h.stats.Fetched(timings.Total, err)
+		c.events.Publish(Event{Type: PageFetched, Host: h.rootURL.Host,
+			URL: link, Timings: timings, Err: err})
+		if err != nil {
+			h.logger.Error("Sitemap fetch failed", "url", link, "err", err)
+		} else {
+			h.logger.Debug("Fetched sitemap", "url", link, "urls", len(s.URLs), "sitemaps", len(s.Sitemaps))
+			for _, index := range s.Sitemaps {
+				if loc := c.sitemapChild(h, index.Loc); loc != "" {
+					pending = append(pending, loc)
+				}
+			}
+			c.emitSitemapURLs(h, link, s.URLs)
+		}
+		if len(pending) > 0 {
+			delay := h.health.Delay(h.rules.Delay())
+			h.stats.Delayed(delay)
+			sleep(ctx, delay)
+		}
+	}
+}
+
+// sitemapChild admits a sitemap listed by a sitemap index, returning its
+// URL, empty if refused. The sitemaps of a domain are fetched like its pages,
+// so those on another domain, on a host refused or disallowed by the robots.txt
+// are skipped.
+func (c *WebCrawler) sitemapChild(h *hostCrawl, loc string) string {
+	link, err := url.Parse(strings.TrimSpace(loc))
+	if err != nil || link.Host == "" {
+		return ""
+	}
+	if reason := c.sitemapRefusal(h, link); reason != "" {
+		c.skip(h, link, 0, reason, "")
+		return ""
+	}
+	return link.String()
+}
+
+// sitemapRefusal tests a sitemap listed by a sitemap index against the rules
+// of the crawl of a domain, returning why it's refused, empty if admitted.
+// Unlike `refusal` it neither marks the sitemap as visited nor applies the
+// depth, scope and extension rules, meant for pages.
+func (c *WebCrawler) sitemapRefusal(h *hostCrawl, link *url.URL) SkipReason {
+	if !c.hostAllowed(link.Hostname()) {
+		return SkipFilter
+	}
+	if reason := c.filterRefusal(link); reason != "" {
+		return reason
+	}
+	if reasoner, ok := h.rules.(refusalReasoner); ok {
+		return reasoner.Forbidden(link)
+	}
+	if checker, ok := h.rules.(permissionChecker); ok && !checker.Permitted(link) {
+		return SkipRules
+	}
+	return ""
+}
+
+// fetchSitemap fetches and parses a sitemap
+func (c *WebCrawler) fetchSitemap(ctx context.Context, link string) (*sitemap, fetcher.Timings, error) {
+	timings, res, err := fetchContext(ctx, c.linkFetcher, link)
+	if err != nil {
+		return nil, timings, fmt.Errorf("fetching sitemap %s failed: %w", link, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, timings, fmt.Errorf("fetching sitemap %s failed: %w", link,
+			&fetcher.StatusError{Code: res.StatusCode, Status: res.Status})
+	}
+	s, err := parseSitemap(res.Body)
+	return s, timings, err
+}
+
+// emitSitemapURLs produces the URLs listed by a sitemap along with their
+// images and videos, the ones refused, e.g. out of scope or disallowed by the
+// robots.txt, are skipped
+func (c *WebCrawler) emitSitemapURLs(h *hostCrawl, sitemapLink string, urls []sitemapURL) {
+	for _, u := range urls {
+		link, err := url.Parse(strings.TrimSpace(u.Loc))
+		if err != nil || link.Host == "" {
+			continue
+		}
+		reason := c.filterRefusal(link)
+		if reason == "" {
+			reason = c.refusal(h, link, 1)
+		}
+		if reason != "" {
+			c.skip(h, link, 1, reason, "")
+			continue
+		}
+		c.discover(h.run, link.Host)
+		c.enqueueResults(h.run, ParsedResult{
+			URL:      link.String(),
+			Links:    []string{},
+			Metadata: sitemapMetadata(h.metadata, sitemapLink, u),
+		})
+		c.emitSitemapMedia(h, sitemapLink, link, u)
+	}
+}
@@ -0,0 +1,137 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseSitemap(t *testing.T) {
+	s, err := parseSitemap(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>https://example.com/</loc><lastmod>2024-01-01</lastmod><priority>1.0</priority></url>
+	<url><loc>https://example.com/about</loc></url>
+</urlset>`))
+	if err != nil {
+		t.Fatalf("parseSitemap failed: %v", err)
+	}
+	expected := []sitemapURL{
+		{Loc: "https://example.com/", LastMod: "2024-01-01", Priority: "1.0"},
+		{Loc: "https://example.com/about"},
+	}
+	if !reflect.DeepEqual(s.URLs, expected) {
+		t.Errorf("parseSitemap failed: expected %v got %v", expected, s.URLs)
+	}
+	if _, err := parseSitemap(strings.NewReader("<html><body></body></html>")); err == nil {
+		t.Errorf("parseSitemap failed: expected error on a HTML page")
+	}
+}
+
+func TestParseSitemapGzipped(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte(`<sitemapindex><sitemap><loc>https://example.com/a.xml</loc></sitemap></sitemapindex>`))
+	_ = gz.Close()
+	s, err := parseSitemap(&buf)
+	if err != nil {
+		t.Fatalf("parseSitemap failed: %v", err)
+	}
+	if len(s.Sitemaps) != 1 || s.Sitemaps[0].Loc != "https://example.com/a.xml" {
+		t.Errorf("parseSitemap failed: expected the sitemap listed got %v", s.Sitemaps)
+	}
+}
+
+func TestCrawlSitemapOnly(t *testing.T) {
+	var pages int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "User-agent: *\nDisallow: /private\nSitemap: http://%s/index.xml", r.Host)
+	})
+	handler.HandleFunc("/index.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<sitemapindex><sitemap><loc>http://%s/pages.xml.gz</loc></sitemap></sitemapindex>", r.Host)
+	})
+	handler.HandleFunc("/pages.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		gz := gzip.NewWriter(w)
+		fmt.Fprintf(gz, `<urlset>
+			<url><loc>http://%[1]s/foo</loc><lastmod>2024-01-01</lastmod><changefreq>daily</changefreq><priority>0.8</priority></url>
+			<url><loc>http://%[1]s/private</loc></url>
+		</urlset>`, r.Host)
+		_ = gz.Close()
+	})
+	handler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pages, 1)
+		_, _ = w.Write([]byte(`<a href="/bar">`))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.SitemapOnly = true })
+	crawler.CrawlSeeds(Seed{URL: server.URL + "/", Metadata: map[string]string{"customer": "acme"}})
+	testbus.Close()
+	res := <-results
+	expected := []ParsedResult{{
+		URL:   server.URL + "/foo",
+		Links: []string{},
+		Metadata: map[string]string{
+			"customer":   "acme",
+			"sitemap":    server.URL + "/pages.xml.gz",
+			"lastmod":    "2024-01-01",
+			"changefreq": "daily",
+			"priority":   "0.8",
+		},
+	}}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, res)
+	}
+	if pages := atomic.LoadInt32(&pages); pages != 0 {
+		t.Errorf("Crawler#Crawl failed: expected no page fetched got %d", pages)
+	}
+}
+
+func TestCrawlSitemapOnlySkipsRefusedSitemaps(t *testing.T) {
+	var fetched int32
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		_, _ = w.Write([]byte(`<urlset><url><loc>http://example.com/</loc></url></urlset>`))
+	}))
+	defer external.Close()
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "User-agent: *\nDisallow: /private\nSitemap: http://%s/index.xml", r.Host)
+	})
+	handler.HandleFunc("/index.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<sitemapindex>
+			<sitemap><loc>http://localhost:%d/other.xml</loc></sitemap>
+			<sitemap><loc>http://%s/private/pages.xml</loc></sitemap>
+		</sitemapindex>`, external.Listener.Addr().(*net.TCPAddr).Port, r.Host)
+	})
+	handler.HandleFunc("/private/pages.xml", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.SitemapOnly = true })
+	crawler.CrawlSeeds(Seed{URL: server.URL + "/"})
+	testbus.Close()
+	if res := <-results; len(res) != 0 {
+		t.Errorf("Crawler#Crawl failed: expected no results got %v", res)
+	}
+	if fetched := atomic.LoadInt32(&fetched); fetched != 0 {
+		t.Errorf("Crawler#Crawl failed: expected no refused sitemap fetched got %d", fetched)
+	}
+}
@@ -0,0 +1,134 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"net/url"
+)
+
+// SkipReason tells why a link was not crawled
+type SkipReason string
+
+const (
+	// SkipVisited is a link already crawled or waiting to be, or an alias
+	// of a page already crawled
+	SkipVisited SkipReason = "visited"
+	// SkipRobots is a link disallowed by the robots.txt of the domain
+	SkipRobots SkipReason = "robots"
+	// SkipDomain is a link outside the domain crawled
+	SkipDomain SkipReason = "domain"
+	// SkipScope is a link out of the `Scope` of the crawl
+	SkipScope SkipReason = "scope"
+	// SkipDepth is a link deeper than MaxDepth, or in scope but deeper than
+	// the depth rule of the `Scope` matching it allows
+	SkipDepth SkipReason = "depth"
+	// SkipFilter is a link on a host refused by AllowedHosts or BlockedHosts,
+	// or a link refused by one of the URLFilters
+	SkipFilter SkipReason = "filter"
+	// SkipExtension is a link with one of the ExcludedExtensions
+	SkipExtension SkipReason = "extension"
+	// SkipLimits is a link exceeding the URLLimits
+	SkipLimits SkipReason = "limits"
+	// SkipTrap is a link looking like a crawler trap
+	SkipTrap SkipReason = "trap"
+	// SkipRules is a link refused by a custom `RulesEngine`
+	SkipRules SkipReason = "rules"
+)
+
+// SkippedResult is the type of the `SkippedURL` results, produced for every
+// link skipped if EmitSkipped is set
+const SkippedResult ResultType = "skipped"
+
+// SkippedURL is a link skipped during the crawl of a domain and the reason,
+// json serializable to be sent on message queues
+type SkippedURL struct {
+	URL string `json:"url"`
+	// Host is the host of the crawl the link was skipped by
+	Host   string     `json:"host"`
+	Depth  int        `json:"depth"`
+	Reason SkipReason `json:"reason"`
+	// TraceID identifies the fetch redirected to the link, if any
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// refusalReasoner is implemented by the rules engines telling why a link is
+// refused, the others refuse links for SkipRules. Refusal is `Allowed` and
+// Forbidden is `Permitted` returning the reason, empty if allowed.
+type refusalReasoner interface {
+	Refusal(*url.URL) SkipReason
+	Forbidden(*url.URL) SkipReason
+}
+
+// refusal tests a link found at a given depth against the rules of the
+// crawl of a domain, returning why it's refused, empty if admitted.
+// Admitting a link marks it as visited.
+func (c *WebCrawler) refusal(h *hostCrawl, link *url.URL, depth int) SkipReason {
+	rules := h.rules
+	if !c.hostAllowed(link.Hostname()) {
+		return SkipFilter
+	}
+	if c.excludedExtension(link) {
+		return SkipExtension
+	}
+	if c.settings.MaxDepth > 0 && depth > c.settings.MaxDepth {
+		return SkipDepth
+	}
+	if reason := c.scopeRefusal(link, depth); reason != "" {
+		return reason
+	}
+	if reasoner, ok := rules.(refusalReasoner); ok {
+		if reason := reasoner.Refusal(link); reason != "" {
+			return reason
+		}
+	} else if !rules.Allowed(link) {
+		return SkipRules
+	}
+	if h.run.traps.IsTrap(link) {
+		return SkipTrap
+	}
+	return ""
+}
+
+// filterRefusal applies the URLFilters in order to a link, rewriting it in
+// place, returns SkipFilter if one of them refuses it, empty otherwise
+func (c *WebCrawler) filterRefusal(link *url.URL) SkipReason {
+	for _, filter := range c.settings.URLFilters {
+		if !filter.Accept(link) {
+			return SkipFilter
+		}
+	}
+	return ""
+}
+
+// scopeRefusal tests a link found at a given depth against the `Scope` of
+// the crawl, a link refused only for its depth is refused for SkipDepth
+func (c *WebCrawler) scopeRefusal(link *url.URL, depth int) SkipReason {
+	scope := c.Reloadable().Scope
+	switch {
+	case scope == nil || scope.Allowed(link, depth):
+		return ""
+	case scope.Allowed(link, 0):
+		return SkipDepth
+	default:
+		return SkipScope
+	}
+}
+
+// skip records a link skipped by the crawl of a domain, publishing a
+// PageSkipped event and producing a `SkippedURL` result if EmitSkipped is
+// set. The trace is the one of the fetch redirected to the link, if any.
+func (c *WebCrawler) skip(h *hostCrawl, link *url.URL, depth int, reason SkipReason, trace string) {
+	h.stats.Skipped()
+	c.events.Publish(Event{Type: PageSkipped, Host: h.rootURL.Host, URL: link.String(),
+		Depth: depth, Reason: reason, TraceID: trace})
+	if !c.settings.EmitSkipped {
+		return
+	}
+	c.emitResult(h.run, SkippedResult, SkippedURL{
+		URL:     link.String(),
+		Host:    h.rootURL.Host,
+		Depth:   depth,
+		Reason:  reason,
+		TraceID: trace,
+	}, h.logger)
+}
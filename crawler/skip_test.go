@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCrawlEmitSkipped(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	})
+	handler.HandleFunc("/foo", resourceMock(
+		`<a href="/foo"><a href="/private/page"><a href="https://example-page.com/">`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan map[string]SkipReason)
+	go func() {
+		skipped := map[string]SkipReason{}
+		events := make(chan []byte)
+		go func() {
+			_ = testbus.Consume(events)
+			close(events)
+		}()
+		for e := range events {
+			var s SkippedURL
+			if err := json.Unmarshal(e, &s); err == nil && s.Reason != "" {
+				skipped[s.URL] = s.Reason
+			}
+		}
+		results <- skipped
+	}()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) { s.EmitSkipped = true })
+	var mutex sync.Mutex
+	reasons := map[string]SkipReason{}
+	crawler.Subscribe(func(e Event) {
+		if e.Type == PageSkipped {
+			mutex.Lock()
+			reasons[e.URL] = e.Reason
+			mutex.Unlock()
+		}
+	})
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	skipped := <-results
+	expected := map[string]SkipReason{
+		server.URL + "/foo":          SkipVisited,
+		server.URL + "/private/page": SkipRobots,
+		"https://example-page.com/":  SkipDomain,
+	}
+	for link, reason := range expected {
+		if skipped[link] != reason || reasons[link] != reason {
+			t.Errorf("Crawler#Crawl failed: expected %s skipped for %s got %q and %q",
+				link, reason, skipped[link], reasons[link])
+		}
+	}
+}
+
+func TestCrawlerRefusal(t *testing.T) {
+	scope, _ := NewScope(ScopeConfig{
+		Deny:   []string{"/admin/**"},
+		Depths: []DepthRule{{Pattern: "/archive/**", MaxDepth: 1}},
+	})
+	crawler := New("test-agent", &testQueue{}, func(s *CrawlerSettings) {
+		s.Scope = scope
+		s.BlockedHosts = []string{"blocked.com"}
+	})
+	base, _ := url.Parse("http://localhost")
+	h := &hostCrawl{
+		run:   &crawlRun{traps: newTrapDetector(nil, 0)},
+		rules: NewCrawlingRules(base, newMemoryCache(), 0),
+	}
+	for link, expected := range map[string]SkipReason{
+		"http://localhost/page":         "",
+		"http://blocked.com/page":       SkipFilter,
+		"http://localhost/admin/users":  SkipScope,
+		"http://localhost/archive/2001": SkipDepth,
+	} {
+		u, _ := url.Parse(link)
+		if reason := crawler.refusal(h, u, 2); reason != expected {
+			t.Errorf("WebCrawler#refusal failed: expected %q for %s got %q", expected, link, reason)
+		}
+	}
+}
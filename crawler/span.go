@@ -0,0 +1,144 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"net/url"
+	"sync"
+)
+
+// WithAllowedDomains sets the host patterns, e.g. *.example.com, of the
+// domains a crawl can span following their links, see FollowExternalLinks
+func WithAllowedDomains(domains []string) CrawlerOpt {
+	return func(s *CrawlerSettings) {
+		s.AllowedDomains = domains
+	}
+}
+
+// domainSpan tracks the crawls of the domains spanned by a crawl following
+// external links or including the subdomains, by key of their rules,
+// handing them the links to their domain found by the others. A crawl is
+// spawned for a domain not being crawled.
+type domainSpan struct {
+	mutex  sync.Mutex
+	crawls map[string]*spannedCrawl
+	spawn  func([]hostSeed)
+}
+
+// spannedCrawl is the crawl of a domain spanned, the links handed before
+// its frontier is ready are kept pending
+type spannedCrawl struct {
+	h       *hostCrawl
+	pending []hostSeed
+}
+
+func newDomainSpan(spawn func([]hostSeed)) *domainSpan {
+	return &domainSpan{crawls: make(map[string]*spannedCrawl), spawn: spawn}
+}
+
+// Starting records the crawl of a domain about to start
+func (s *domainSpan) Starting(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.crawls[key] = &spannedCrawl{}
+}
+
+// Join records the crawl of a domain ready to receive links, returning the
+// links handed to it so far
+func (s *domainSpan) Join(key string, h *hostCrawl) []hostSeed {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	crawl, ok := s.crawls[key]
+	if !ok {
+		crawl = &spannedCrawl{}
+		s.crawls[key] = crawl
+	}
+	pending := crawl.pending
+	crawl.h, crawl.pending = h, nil
+	return pending
+}
+
+// Hand hands a link to the crawl of its domain, spawning it if the domain
+// is not being crawled. The link is pushed under the lock, not to race with
+// the end of the crawl, but its refusal is reported after releasing it as
+// that may block producing the skip.
+func (s *domainSpan) Hand(key string, seed hostSeed) {
+	var (
+		admitted bool
+		reason   SkipReason
+		refused  func(*url.URL, int, SkipReason)
+	)
+	s.mutex.Lock()
+	crawl, ok := s.crawls[key]
+	switch {
+	case !ok:
+		s.crawls[key] = &spannedCrawl{}
+		s.spawn([]hostSeed{seed})
+	case crawl.h == nil:
+		crawl.pending = append(crawl.pending, seed)
+	default:
+		admitted, reason, refused = crawl.h.frontier.push(seed.url,
+			seed.depth, seed.metadata)
+	}
+	s.mutex.Unlock()
+	if admitted {
+		crawl.h.wake()
+	}
+	if reason != "" && refused != nil {
+		refused(seed.url, seed.depth, reason)
+	}
+}
+
+// Exhausted tests if the crawl of a domain has no more links to crawl,
+// forgetting it if so, the links handed afterwards spawn a new one
+func (s *domainSpan) Exhausted(key string, h *hostCrawl) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if h.frontier.Len() > 0 {
+		return false
+	}
+	if crawl, ok := s.crawls[key]; ok && crawl.h == h {
+		delete(s.crawls, key)
+	}
+	return true
+}
+
+// Forget forgets the crawl of a domain ended, the links still pending are
+// dropped
+func (s *domainSpan) Forget(key string, h *hostCrawl) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if crawl, ok := s.crawls[key]; ok && (crawl.h == h || crawl.h == nil) {
+		delete(s.crawls, key)
+	}
+}
+
+// spans tests if a link found by the crawl of a domain points to another
+// domain the crawl can span, a subdomain of the same registered domain or
+// an external one allowed
+func (c *WebCrawler) spans(h *hostCrawl, link *url.URL) bool {
+	host := link.Hostname()
+	if h.run.span == nil || host == "" || !c.hostAllowed(host) {
+		return false
+	}
+	following := c.settings.FollowExternalLinks && matchAnyHost(c.settings.AllowedDomains, host)
+	switch classifyLink(c.settings.HostAliases, h.rootURL, link) {
+	case SubdomainLink:
+		return c.settings.IncludeSubdomains || following
+	case ExternalLink:
+		return following
+	default:
+		return false
+	}
+}
+
+// push pushes a link found by the crawl of a domain to its frontier, the
+// links to the other domains spanned are handed to their crawls
+func (c *WebCrawler) push(h *hostCrawl, link *url.URL, depth int, metadata map[string]string) {
+	if c.spans(h, link) {
+		h.run.span.Hand(c.rulesKey(link),
+			hostSeed{url: link, depth: depth, metadata: metadata})
+		return
+	}
+	h.frontier.PushFrom(link, depth, metadata)
+}
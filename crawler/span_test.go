@@ -0,0 +1,150 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codepr/webcrawler/crawler/fetcher"
+)
+
+func TestCrawlFollowingExternalLinks(t *testing.T) {
+	var blog, docs string
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `<a href="%s/bar"><a href="https://example-page.com/">`, docs)
+	})
+	handler.HandleFunc("/bar", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `<a href="%s/baz">`, blog)
+	})
+	handler.HandleFunc("/baz", resourceMock(`<a href="/foo">`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	blog, docs = server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), WithAllowedDomains([]string{"127.0.0.1", "localhost"}),
+		func(s *CrawlerSettings) { s.FollowExternalLinks = true })
+	if err := crawler.CrawlContext(context.Background(), blog+"/foo"); err != nil {
+		t.Fatalf("Crawler#CrawlContext failed: %v", err)
+	}
+	testbus.Close()
+	res := <-results
+	crawled := []string{}
+	for _, r := range res {
+		crawled = append(crawled, r.URL)
+	}
+	sort.Strings(crawled)
+	expected := []string{blog + "/baz", blog + "/foo", docs + "/bar"}
+	if strings.Join(crawled, " ") != strings.Join(expected, " ") {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, crawled)
+	}
+}
+
+func TestCrawlFollowingExternalLinksRespectingMaxDepth(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	docs := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	handler.HandleFunc("/foo", resourceMock(fmt.Sprintf(`<a href="%s/bar">`, docs)))
+	handler.HandleFunc("/bar", resourceMock(`<a href="/baz">`))
+	handler.HandleFunc("/baz", resourceMock(``))
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), withMaxDepth(1), WithAllowedDomains([]string{"localhost"}),
+		func(s *CrawlerSettings) { s.FollowExternalLinks = true })
+	if err := crawler.CrawlContext(context.Background(), server.URL+"/foo"); err != nil {
+		t.Fatalf("Crawler#CrawlContext failed: %v", err)
+	}
+	testbus.Close()
+	res := <-results
+	if len(res) != 2 {
+		t.Errorf("Crawler#Crawl failed: expected 2 results got %v", res)
+	}
+}
+
+func TestCrawlIncludingSubdomains(t *testing.T) {
+	// The server proxies every host, so that the hosts of the registered
+	// domain are served by it
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", http.NotFound)
+	handler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "www.example.test":
+			_, _ = w.Write([]byte(`<a href="http://docs.example.test/bar">` +
+				`<a href="http://example.test/"><a href="http://other.test/">`))
+		case "docs.example.test":
+			_, _ = w.Write([]byte(`<a href="http://www.example.test/">`))
+		case "example.test":
+			_, _ = w.Write([]byte(`<a href="http://other.test/apex">`))
+		default:
+			t.Errorf("Crawler#Crawl failed: unexpected fetch of %s", r.URL)
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	proxy, _ := url.Parse(server.URL)
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.IncludeSubdomains = true
+			s.ProxyRules = []fetcher.ProxyRule{{Host: "*", Proxy: proxy}}
+		})
+	if err := crawler.CrawlContext(context.Background(), "http://www.example.test/"); err != nil {
+		t.Fatalf("Crawler#CrawlContext failed: %v", err)
+	}
+	testbus.Close()
+	crawled := []string{}
+	for _, r := range <-results {
+		crawled = append(crawled, r.URL)
+	}
+	sort.Strings(crawled)
+	expected := []string{"http://docs.example.test/bar", "http://example.test/", "http://www.example.test/"}
+	if strings.Join(crawled, " ") != strings.Join(expected, " ") {
+		t.Errorf("Crawler#Crawl failed: expected %v got %v", expected, crawled)
+	}
+}
+
+func TestDomainSpanHandReportsRefusalsUnlocked(t *testing.T) {
+	span := newDomainSpan(func([]hostSeed) {})
+	h := &hostCrawl{
+		frontier: newFrontier(nil, func(*url.URL, int) SkipReason { return SkipRules }),
+		wakeup:   make(chan struct{}, 1),
+	}
+	var refused SkipReason
+	// Reporting the refusal hands another link, the span must be unlocked
+	h.frontier.OnRefused(func(_ *url.URL, _ int, reason SkipReason) {
+		refused = reason
+		span.Hand("other", hostSeed{})
+	})
+	span.Starting("example.test")
+	span.Join("example.test", h)
+	link, _ := url.Parse("http://example.test/private")
+	done := make(chan struct{})
+	go func() {
+		span.Hand("example.test", hostSeed{url: link, depth: 1})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("domainSpan#Hand failed: expected the refusal reported without the lock")
+	}
+	if refused != SkipRules {
+		t.Errorf("domainSpan#Hand failed: expected link refused for %q got %q", SkipRules, refused)
+	}
+}
@@ -0,0 +1,107 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spilledLink is a link of a frontier written to disk, one JSON object per
+// line
+type spilledLink struct {
+	URL      string            `json:"u"`
+	Depth    int               `json:"d"`
+	Metadata map[string]string `json:"m,omitempty"`
+}
+
+// linkSpill is an on-disk FIFO queue of the links of a frontier beyond its
+// memory limit, backed by a temporary file created on the first link
+// spilled and removed on close. The file is truncated every time it's
+// drained. It's not thread-safe, the frontier guards it.
+type linkSpill struct {
+	dir  string
+	file *os.File
+	// readOffset and writeOffset delimit the links spilled not read back
+	// yet, count counts them
+	readOffset, writeOffset int64
+	count                   int
+	// best is the highest score of the links spilled since the queue was
+	// last drained, an upper bound of the ones not read back yet
+	best float64
+}
+
+// Push writes a link with its score at the end of the queue
+func (s *linkSpill) Push(link spilledLink, score float64) error {
+	if s.file == nil {
+		file, err := os.CreateTemp(s.dir, "frontier-*.spill")
+		if err != nil {
+			return fmt.Errorf("spilling links failed: %w", err)
+		}
+		s.file = file
+	}
+	line, err := json.Marshal(link)
+	if err != nil {
+		return fmt.Errorf("spilling links failed: %w", err)
+	}
+	line = append(line, '\n')
+	n, err := s.file.WriteAt(line, s.writeOffset)
+	if err != nil {
+		return fmt.Errorf("spilling links failed: %w", err)
+	}
+	s.writeOffset += int64(n)
+	if s.count == 0 || score > s.best {
+		s.best = score
+	}
+	s.count++
+	return nil
+}
+
+// Pop reads up to n links from the start of the queue
+func (s *linkSpill) Pop(n int) ([]spilledLink, error) {
+	if s.count == 0 {
+		return nil, nil
+	}
+	reader := bufio.NewReader(io.NewSectionReader(s.file, s.readOffset, s.writeOffset-s.readOffset))
+	links := make([]spilledLink, 0, min(n, s.count))
+	for len(links) < n && s.count > 0 {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return links, fmt.Errorf("reading spilled links failed: %w", err)
+		}
+		s.readOffset += int64(len(line))
+		s.count--
+		var link spilledLink
+		if err := json.Unmarshal(line, &link); err != nil {
+			return links, fmt.Errorf("reading spilled links failed: %w", err)
+		}
+		links = append(links, link)
+	}
+	// Drained, the space on disk is reclaimed
+	if s.count == 0 {
+		s.readOffset, s.writeOffset = 0, 0
+		if err := s.file.Truncate(0); err != nil {
+			return links, fmt.Errorf("reading spilled links failed: %w", err)
+		}
+	}
+	return links, nil
+}
+
+// Len returns the number of links spilled not read back yet
+func (s *linkSpill) Len() int {
+	return s.count
+}
+
+// Close removes the file of the queue, the links not read back are lost
+func (s *linkSpill) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	err := os.Remove(s.file.Name())
+	s.file, s.count, s.readOffset, s.writeOffset, s.best = nil, 0, 0, 0, 0
+	return err
+}
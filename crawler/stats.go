@@ -0,0 +1,178 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HostStats contains the counters of the crawl of a single host
+type HostStats struct {
+	// Fetched is the number of pages fetched successfully
+	Fetched int64
+	// Discovered is the number of distinct links admitted to be crawled,
+	// the seeds included
+	Discovered int64
+	// Skipped is the number of links refused, e.g. already visited,
+	// disallowed by the robots.txt, out of scope or crawler traps
+	Skipped int64
+	// Errors is the number of failed fetches
+	Errors int64
+	// Bytes is the size of the bodies downloaded
+	Bytes int64
+	// Elapsed is the time spent crawling the host
+	Elapsed time.Duration
+	// AvgLatency is the average total time of the fetches
+	AvgLatency time.Duration
+	// Latency are the percentiles of the total time of the fetches
+	Latency LatencyPercentiles
+	// RecentLatency is the moving average of the total time of the
+	// fetches, weighting the recent ones more
+	RecentLatency time.Duration
+	// ErrorRate is the moving average of the fetches failing with signs of
+	// a host in trouble, e.g. network errors, 5xx or 429 responses
+	ErrorRate float64
+	// Backoff is the factor the delay is multiplied and the concurrency
+	// divided by as the host degrades, 1 if healthy
+	Backoff float64
+	// Delay is the last politeness delay respected between two requests
+	Delay time.Duration
+	// Backlog is the number of links waiting to be crawled
+	Backlog int
+	// Robots is the summary of the robots.txt directives honored, nil if
+	// the host has no valid robots.txt or the rules don't follow one
+	Robots *RobotsSummary
+}
+
+// hostStats tracks the counters of a host, updated concurrently by the
+// workers
+type hostStats struct {
+	fetched, skipped, errors   int64
+	discovered, bytes, elapsed int64
+	// latency is the sum of the total time of all the fetches
+	latency int64
+	delay   int64
+	// latencies is the distribution of the total time of the fetches
+	latencies latencyHistogram
+	// frontier and health of the running crawl of the host, if any
+	frontier *frontier
+	health   *hostHealth
+	// robots is the summary of the robots.txt honored, nil if none
+	robots atomic.Pointer[RobotsSummary]
+}
+
+// Fetched records a fetch, successful if err is nil
+func (h *hostStats) Fetched(latency time.Duration, err error) {
+	if err != nil {
+		atomic.AddInt64(&h.errors, 1)
+	} else {
+		atomic.AddInt64(&h.fetched, 1)
+	}
+	atomic.AddInt64(&h.latency, int64(latency))
+	h.latencies.Observe(latency)
+}
+
+// Skipped records a link refused
+func (h *hostStats) Skipped() {
+	atomic.AddInt64(&h.skipped, 1)
+}
+
+// Discovered records a link admitted to be crawled
+func (h *hostStats) Discovered() {
+	atomic.AddInt64(&h.discovered, 1)
+}
+
+// Downloaded records the size of a body downloaded
+func (h *hostStats) Downloaded(size int) {
+	atomic.AddInt64(&h.bytes, int64(size))
+}
+
+// Crawled records the time spent by a crawl of the host
+func (h *hostStats) Crawled(elapsed time.Duration) {
+	atomic.AddInt64(&h.elapsed, int64(elapsed))
+}
+
+// Delayed records the politeness delay respected
+func (h *hostStats) Delayed(delay time.Duration) {
+	atomic.StoreInt64(&h.delay, int64(delay))
+}
+
+// Honoring records the robots.txt directives honored by the rules of the
+// host, if they follow one
+func (h *hostStats) Honoring(rules RulesEngine) {
+	summarizer, ok := rules.(robotsSummarizer)
+	if !ok {
+		return
+	}
+	if summary, ok := summarizer.RobotsSummary(); ok {
+		h.robots.Store(&summary)
+	}
+}
+
+// crawlStats tracks the counters of every host crawled
+type crawlStats struct {
+	mutex sync.RWMutex
+	hosts map[string]*hostStats
+}
+
+func newCrawlStats() *crawlStats {
+	return &crawlStats{hosts: make(map[string]*hostStats)}
+}
+
+// Track returns the counters of a host, creating them if it's the first
+// crawl of the host, and binds them to the frontier and the health of the
+// crawl
+func (s *crawlStats) Track(host string, f *frontier, health *hostHealth) *hostStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats, ok := s.hosts[host]
+	if !ok {
+		stats = &hostStats{}
+		s.hosts[host] = stats
+	}
+	stats.frontier = f
+	stats.health = health
+	return stats
+}
+
+// Snapshot returns a copy of the counters of every host
+func (s *crawlStats) Snapshot() map[string]HostStats {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	snapshot := make(map[string]HostStats, len(s.hosts))
+	for host, h := range s.hosts {
+		stats := HostStats{
+			Fetched:    atomic.LoadInt64(&h.fetched),
+			Discovered: atomic.LoadInt64(&h.discovered),
+			Skipped:    atomic.LoadInt64(&h.skipped),
+			Errors:     atomic.LoadInt64(&h.errors),
+			Bytes:      atomic.LoadInt64(&h.bytes),
+			Elapsed:    time.Duration(atomic.LoadInt64(&h.elapsed)),
+			Delay:      time.Duration(atomic.LoadInt64(&h.delay)),
+			Latency:    h.latencies.Percentiles(),
+		}
+		if fetches := stats.Fetched + stats.Errors; fetches > 0 {
+			stats.AvgLatency = time.Duration(atomic.LoadInt64(&h.latency) / fetches)
+		}
+		if h.frontier != nil {
+			stats.Backlog = h.frontier.Len()
+		}
+		if h.health != nil {
+			stats.RecentLatency, stats.ErrorRate, stats.Backoff = h.health.snapshot()
+		}
+		if robots := h.robots.Load(); robots != nil {
+			summary := *robots
+			stats.Robots = &summary
+		}
+		snapshot[host] = stats
+	}
+	return snapshot
+}
+
+// Stats returns the counters of every host crawled since the creation of
+// the crawler, safe to call while crawling
+func (c *WebCrawler) Stats() map[string]HostStats {
+	return c.stats.Snapshot()
+}
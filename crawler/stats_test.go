@@ -0,0 +1,58 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCrawlStats(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0))
+	crawler.Crawl(server.URL+"/foo", server.URL+"/missing")
+	testbus.Close()
+	<-results
+	host, _ := url.Parse(server.URL)
+	stats, ok := crawler.Stats()[host.Host]
+	if !ok {
+		t.Fatalf("Crawler#Stats failed: no stats for %s", host.Host)
+	}
+	if stats.Fetched != 3 || stats.Errors != 1 || stats.Skipped == 0 ||
+		stats.Backlog != 0 || stats.AvgLatency <= 0 ||
+		stats.Latency.P50 <= 0 || stats.Latency.P99 < stats.Latency.P50 {
+		t.Errorf("Crawler#Stats failed: unexpected stats %+v", stats)
+	}
+	if stats.Robots != nil {
+		t.Errorf("Crawler#Stats failed: expected no robots.txt got %+v", stats.Robots)
+	}
+}
+
+func TestCrawlStatsRobotsSummary(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /private\nAllow: /private/public\n"))
+	})
+	handler.HandleFunc("/foo", resourceMock(`<a href="/private/page">`))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0))
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	<-results
+	host, _ := url.Parse(server.URL)
+	expected := RobotsSummary{Group: "*", Allow: 1, Disallow: 1}
+	if robots := crawler.Stats()[host.Host].Robots; robots == nil || *robots != expected {
+		t.Errorf("Crawler#Stats failed: expected robots %+v got %+v", expected, robots)
+	}
+}
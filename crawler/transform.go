@@ -0,0 +1,81 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import "net/url"
+
+// ResultTransformer is invoked on every result right before encoding it,
+// after the `ResultFilter`, e.g. to redact query parameters, truncate the
+// lists of links or add computed fields to the metadata. Transformers must
+// not modify the slices and the maps of the result in place, they may be
+// shared with other results.
+type ResultTransformer interface {
+	Transform(ParsedResult) ParsedResult
+}
+
+// ResultTransformerFunc is an adapter to use a function as a
+// `ResultTransformer`
+type ResultTransformerFunc func(ParsedResult) ParsedResult
+
+// Transform calls f(result)
+func (f ResultTransformerFunc) Transform(result ParsedResult) ParsedResult {
+	return f(result)
+}
+
+// RedactQueryParams returns a `ResultTransformer` replacing the values of
+// some query parameters, e.g. tokens or session IDs, in the URL, the links
+// and the assets of a result
+func RedactQueryParams(params ...string) ResultTransformer {
+	redact := func(rawURL string) string {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.RawQuery == "" {
+			return rawURL
+		}
+		query := u.Query()
+		redacted := false
+		for _, param := range params {
+			if query.Has(param) {
+				query.Set(param, "REDACTED")
+				redacted = true
+			}
+		}
+		if !redacted {
+			return rawURL
+		}
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	redactAll := func(urls []string) []string {
+		if urls == nil {
+			return nil
+		}
+		redacted := make([]string, len(urls))
+		for i, u := range urls {
+			redacted[i] = redact(u)
+		}
+		return redacted
+	}
+	return ResultTransformerFunc(func(result ParsedResult) ParsedResult {
+		result.URL = redact(result.URL)
+		result.Links = redactAll(result.Links)
+		result.Assets = redactAll(result.Assets)
+		return result
+	})
+}
+
+// TruncateLinks returns a `ResultTransformer` keeping at most max links in a
+// result, 0 or less drops them all
+func TruncateLinks(max int) ResultTransformer {
+	if max < 0 {
+		max = 0
+	}
+	return ResultTransformerFunc(func(result ParsedResult) ParsedResult {
+		if len(result.Links) > max {
+			result.Links = result.Links[:max:max]
+		}
+		if len(result.LinkClasses) > max {
+			result.LinkClasses = result.LinkClasses[:max:max]
+		}
+		return result
+	})
+}
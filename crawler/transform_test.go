@@ -0,0 +1,68 @@
+package crawler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRedactQueryParams(t *testing.T) {
+	result := ParsedResult{
+		URL:    "https://example.com/foo?token=secret&page=2",
+		Links:  []string{"https://example.com/bar?sid=abc", "https://example.com/baz"},
+		Assets: []string{"https://example.com/a.png?token=secret"},
+	}
+	links := result.Links
+	redacted := RedactQueryParams("token", "sid").Transform(result)
+	expected := ParsedResult{
+		URL:    "https://example.com/foo?page=2&token=REDACTED",
+		Links:  []string{"https://example.com/bar?sid=REDACTED", "https://example.com/baz"},
+		Assets: []string{"https://example.com/a.png?token=REDACTED"},
+	}
+	if !reflect.DeepEqual(redacted, expected) {
+		t.Errorf("RedactQueryParams failed: expected %v got %v", expected, redacted)
+	}
+	if links[0] != "https://example.com/bar?sid=abc" {
+		t.Errorf("RedactQueryParams failed: original links modified %v", links)
+	}
+}
+
+func TestTruncateLinks(t *testing.T) {
+	result := ParsedResult{Links: []string{"a", "b", "c"}}
+	if truncated := TruncateLinks(2).Transform(result); !reflect.DeepEqual(truncated.Links, []string{"a", "b"}) {
+		t.Errorf("TruncateLinks failed: expected [a b] got %v", truncated.Links)
+	}
+	if truncated := TruncateLinks(5).Transform(result); len(truncated.Links) != 3 {
+		t.Errorf("TruncateLinks failed: expected 3 links got %v", truncated.Links)
+	}
+	if truncated := TruncateLinks(-1).Transform(result); len(truncated.Links) != 0 {
+		t.Errorf("TruncateLinks failed: expected no links got %v", truncated.Links)
+	}
+}
+
+func TestCrawlPagesTransformingResults(t *testing.T) {
+	server := serverMockWithoutRobotsTxt()
+	defer server.Close()
+	testbus := testQueue{make(chan []byte)}
+	results := make(chan []ParsedResult)
+	go func() { results <- consumeEvents(&testbus) }()
+	annotate := ResultTransformerFunc(func(r ParsedResult) ParsedResult {
+		r.Metadata = map[string]string{"links": "counted"}
+		return r
+	})
+	crawler := New("test-agent", &testbus, withCrawlTimeout(100*time.Millisecond),
+		withPolitenessDelay(0), func(s *CrawlerSettings) {
+			s.ResultTransformers = []ResultTransformer{TruncateLinks(0), annotate}
+		})
+	crawler.Crawl(server.URL + "/foo")
+	testbus.Close()
+	res := <-results
+	if len(res) != 3 {
+		t.Fatalf("Crawler#Crawl failed: expected 3 results got %v", res)
+	}
+	for _, r := range res {
+		if len(r.Links) != 0 || r.Metadata["links"] != "counted" {
+			t.Errorf("Crawler#Crawl failed: result not transformed %v", r)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// TrapPattern is a named regular expression matching the shape of URLs
+// generated by crawler traps, e.g. pages linking to an endless number of
+// other generated pages
+type TrapPattern struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultTrapPatterns contains the most common crawler traps:
+//
+// - calendar pages, with dates in the path or in the query string
+// - infinite pagination, page numbers from 1000 on
+// - session IDs in the path or in the query string
+var DefaultTrapPatterns = []TrapPattern{
+	{
+		Name:    "calendar",
+		Pattern: regexp.MustCompile(`(?i)/(calendar|events?)/\d{4}([/-]\d{1,2}){1,2}|[?&](date|day|month|year)=\d`),
+	},
+	{
+		Name:    "pagination",
+		Pattern: regexp.MustCompile(`(?i)[?&](page|p|pg|offset|start)=\d{4,}|/page/\d{4,}`),
+	},
+	{
+		Name:    "session",
+		Pattern: regexp.MustCompile(`(?i);jsessionid=|[?&](phpsessid|sid|sessionid|session_id)=|/\(s\([a-z0-9]+\)\)/`),
+	},
+}
+
+// trapDetector rejects URLs matching any of a set of trap patterns or with
+// a path repeating the same segments too many times (e.g. /a/b/a/b/a/b),
+// keeping count of the URLs suppressed by each one of them
+type trapDetector struct {
+	mutex    sync.Mutex
+	patterns []TrapPattern
+	// maxRepetitions is the number of consecutive repetitions of a sequence
+	// of path segments allowed, 0 means no limit
+	maxRepetitions int
+	suppressed     map[string]int
+}
+
+// newTrapDetector creates a new trapDetector with a set of patterns and a
+// maximum number of repetitions of path segments
+func newTrapDetector(patterns []TrapPattern, maxRepetitions int) *trapDetector {
+	return &trapDetector{
+		patterns:       patterns,
+		maxRepetitions: maxRepetitions,
+		suppressed:     make(map[string]int),
+	}
+}
+
+// IsTrap tests an URL against the trap patterns, returns true and increase
+// the counter of the matching pattern if the URL looks like a trap. URLs
+// with repeating path segments are counted by the repeating sequence
+// found, e.g. "repeating /a/b".
+func (t *trapDetector) IsTrap(link *url.URL) bool {
+	href := link.String()
+	for _, trap := range t.patterns {
+		if trap.Pattern.MatchString(href) {
+			t.suppress(trap.Name)
+			return true
+		}
+	}
+	if sequence, ok := repeatingSegments(link.Path, t.maxRepetitions); ok {
+		t.suppress("repeating " + sequence)
+		return true
+	}
+	return false
+}
+
+// repeatingSegments looks for a sequence of path segments consecutively
+// repeated more than maxRepetitions times, returning it and true if found
+func repeatingSegments(path string, maxRepetitions int) (string, bool) {
+	if maxRepetitions <= 0 {
+		return "", false
+	}
+	segments := strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+	n := len(segments)
+	for start := 0; start < n; start++ {
+		for period := 1; start+period*(maxRepetitions+1) <= n; period++ {
+			repetitions := 1
+			for next := start + period; next+period <= n; next += period {
+				if !equalSegments(segments[start:start+period], segments[next:next+period]) {
+					break
+				}
+				repetitions++
+			}
+			if repetitions > maxRepetitions {
+				return "/" + strings.Join(segments[start:start+period], "/"), true
+			}
+		}
+	}
+	return "", false
+}
+
+func equalSegments(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// suppress increases the counter of URLs suppressed by a trap pattern
+func (t *trapDetector) suppress(name string) {
+	t.mutex.Lock()
+	t.suppressed[name]++
+	t.mutex.Unlock()
+}
+
+// Suppressed returns a copy of the counters of URLs suppressed by each trap
+// pattern
+func (t *trapDetector) Suppressed() map[string]int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	suppressed := make(map[string]int, len(t.suppressed))
+	for name, count := range t.suppressed {
+		suppressed[name] = count
+	}
+	return suppressed
+}
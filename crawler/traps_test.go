@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestTrapDetector(t *testing.T) {
+	d := newTrapDetector(DefaultTrapPatterns, 0)
+	traps := []string{
+		"http://localhost/calendar/2020/10/12",
+		"http://localhost/events?month=10&year=2020",
+		"http://localhost/blog?page=12000",
+		"http://localhost/shop;jsessionid=1234ABCD",
+		"http://localhost/shop?PHPSESSID=abcd",
+	}
+	for _, href := range traps {
+		link, _ := url.Parse(href)
+		if !d.IsTrap(link) {
+			t.Errorf("trapDetector#IsTrap failed: expected %s to be a trap", href)
+		}
+	}
+	regular := []string{
+		"http://localhost/blog?page=2",
+		"http://localhost/events",
+		"http://localhost/about/2020-plans",
+	}
+	for _, href := range regular {
+		link, _ := url.Parse(href)
+		if d.IsTrap(link) {
+			t.Errorf("trapDetector#IsTrap failed: expected %s not to be a trap", href)
+		}
+	}
+	expected := map[string]int{"calendar": 2, "pagination": 1, "session": 2}
+	if !reflect.DeepEqual(d.Suppressed(), expected) {
+		t.Errorf("trapDetector#Suppressed failed: expected %v got %v", expected, d.Suppressed())
+	}
+}
+
+func TestTrapDetectorRepeatingSegments(t *testing.T) {
+	d := newTrapDetector(nil, 2)
+	traps := []string{
+		"http://localhost/a/b/a/b/a/b",
+		"http://localhost/docs/x/x/x",
+		"http://localhost/c/a/b/a/b/a/b/d",
+	}
+	for _, href := range traps {
+		link, _ := url.Parse(href)
+		if !d.IsTrap(link) {
+			t.Errorf("trapDetector#IsTrap failed: expected %s to be a trap", href)
+		}
+	}
+	regular := []string{
+		"http://localhost/a/b/a/b",
+		"http://localhost/docs/docs/index",
+		"http://localhost/a/b/c/a/b/c",
+	}
+	for _, href := range regular {
+		link, _ := url.Parse(href)
+		if d.IsTrap(link) {
+			t.Errorf("trapDetector#IsTrap failed: expected %s not to be a trap", href)
+		}
+	}
+	expected := map[string]int{"repeating /a/b": 2, "repeating /x": 1}
+	if !reflect.DeepEqual(d.Suppressed(), expected) {
+		t.Errorf("trapDetector#Suppressed failed: expected %v got %v", expected, d.Suppressed())
+	}
+}
@@ -0,0 +1,191 @@
+// Package crawler containing the crawling logics and utilities to scrape
+// remote resources on the web
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Maximum time a WASM extractor can run on a single page
+const wasmExtractTimeout = 5 * time.Second
+
+// Maximum memory of a WASM extractor, in pages of 64 KiB, 64 MiB
+const wasmMemoryLimitPages uint32 = 1024
+
+// WASMExtractor is an `Extractor` compiled to WebAssembly, run sandboxed by
+// wazero. It's a WASI command, run once per page with the URL and the
+// content type of the page as arguments and its body on the standard input,
+// it must write a JSON object of the fields extracted on the standard output
+// and exit with 0. A command exiting with any other code fails, with the
+// standard error as the reason.
+//
+// No file system, network or environment is exposed to the extractors, they
+// can be updated without recompiling the crawler. The runtime compiling the
+// command is held while crawls run it, it's closed once the last one ends
+// and compiled again on the next use.
+type WASMExtractor struct {
+	name    string
+	wasm    []byte
+	mutex   sync.Mutex
+	runtime wazero.Runtime
+	module  wazero.CompiledModule
+	// crawls is the number of crawls running the extractor
+	crawls int
+}
+
+// NewWASMExtractor compiles a WASI command into a `WASMExtractor`, the name
+// is its first argument, e.g. the name of its file
+func NewWASMExtractor(ctx context.Context, name string, wasm []byte) (*WASMExtractor, error) {
+	e := &WASMExtractor{name: name, wasm: wasm}
+	if _, _, err := e.compiled(ctx); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// compiled returns the runtime and the compiled command, compiling it if
+// the runtime was closed
+func (e *WASMExtractor) compiled(ctx context.Context) (wazero.Runtime,
+	wazero.CompiledModule, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.runtime != nil {
+		return e.runtime, e.module, nil
+	}
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(wasmMemoryLimitPages))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, nil, fmt.Errorf("loading WASM extractor %s failed: %w", e.name, err)
+	}
+	module, err := runtime.CompileModule(ctx, e.wasm)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, nil, fmt.Errorf("loading WASM extractor %s failed: %w", e.name, err)
+	}
+	e.runtime, e.module = runtime, module
+	return runtime, module, nil
+}
+
+// Extract runs the command on a page, see ExtractContext
+func (e *WASMExtractor) Extract(url, contentType string, body []byte) (map[string]any, error) {
+	return e.ExtractContext(context.Background(), url, contentType, body)
+}
+
+// ExtractContext runs the command on a page, a new instance for each call,
+// so that pages can be extracted concurrently. The command is killed once
+// the context is done or after wasmExtractTimeout.
+func (e *WASMExtractor) ExtractContext(ctx context.Context,
+	url, contentType string, body []byte) (map[string]any, error) {
+	ctx, cancel := context.WithTimeout(ctx, wasmExtractTimeout)
+	defer cancel()
+	runtime, compiled, err := e.compiled(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(e.name, url, contentType).
+		WithStdin(bytes.NewReader(body)).
+		WithStdout(&stdout).
+		WithStderr(&stderr)
+	module, err := runtime.InstantiateModule(ctx, compiled, config)
+	if module != nil {
+		defer module.Close(ctx)
+	}
+	if err != nil {
+		if reason := strings.TrimSpace(stderr.String()); reason != "" {
+			return nil, fmt.Errorf("running WASM extractor %s failed: %w: %s", e.name, err, reason)
+		}
+		return nil, fmt.Errorf("running WASM extractor %s failed: %w", e.name, err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &fields); err != nil {
+		return nil, fmt.Errorf("decoding WASM extractor %s output failed: %w", e.name, err)
+	}
+	return fields, nil
+}
+
+// Acquire marks the start of a crawl running the command
+func (e *WASMExtractor) Acquire() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.crawls++
+}
+
+// Release marks the end of a crawl running the command, closing the
+// runtime once no crawl runs it anymore
+func (e *WASMExtractor) Release(ctx context.Context) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.crawls > 0 {
+		e.crawls--
+	}
+	if e.crawls > 0 {
+		return nil
+	}
+	return e.close(ctx)
+}
+
+// Close releases the compiled command, compiled again on the next use
+func (e *WASMExtractor) Close(ctx context.Context) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.close(ctx)
+}
+
+// close closes the runtime, if open, the lock must be held
+func (e *WASMExtractor) close(ctx context.Context) error {
+	if e.runtime == nil {
+		return nil
+	}
+	runtime := e.runtime
+	e.runtime, e.module = nil, nil
+	return runtime.Close(ctx)
+}
+
+// LoadWASMExtractors compiles every .wasm file of a directory into a
+// `WASMExtractor`, in the order of their names
+func LoadWASMExtractors(ctx context.Context, dir string) ([]Extractor, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, fmt.Errorf("loading WASM extractors failed: %w", err)
+	}
+	sort.Strings(paths)
+	extractors := make([]Extractor, 0, len(paths))
+	for _, path := range paths {
+		extractor, err := loadWASMExtractor(ctx, path)
+		if err != nil {
+			// The ones loaded already are released
+			for _, loaded := range extractors {
+				loaded.(*WASMExtractor).Close(ctx)
+			}
+			return nil, err
+		}
+		extractors = append(extractors, extractor)
+	}
+	return extractors, nil
+}
+
+// loadWASMExtractor compiles a .wasm file into a `WASMExtractor`
+func loadWASMExtractor(ctx context.Context, path string) (*WASMExtractor, error) {
+	wasm, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading WASM extractor %s failed: %w", path, err)
+	}
+	return NewWASMExtractor(ctx, filepath.Base(path), wasm)
+}
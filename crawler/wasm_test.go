@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// echoWASM is a WASI command writing its standard input on the standard
+// output, compiled from:
+//
+//	(module
+//	  (import "wasi_snapshot_preview1" "fd_read" (func (param i32 i32 i32 i32) (result i32)))
+//	  (import "wasi_snapshot_preview1" "fd_write" (func (param i32 i32 i32 i32) (result i32)))
+//	  (memory (export "memory") 1)
+//	  (func (export "_start")
+//	    (i32.store (i32.const 0) (i32.const 64))
+//	    (i32.store (i32.const 4) (i32.const 1024))
+//	    (drop (call 0 (i32.const 0) (i32.const 0) (i32.const 1) (i32.const 8)))
+//	    (i32.store (i32.const 4) (i32.load (i32.const 8)))
+//	    (drop (call 1 (i32.const 1) (i32.const 0) (i32.const 1) (i32.const 8)))))
+const echoWASM = "0061736d01000000010c0260047f7f7f7f017f60000002440216776173695f73" +
+	"6e617073686f745f70726576696577310766645f72656164000016776173695f" +
+	"736e617073686f745f70726576696577310866645f7772697465000003020101" +
+	"0503010001071302066d656d6f72790200065f737461727400020a3401320041" +
+	"0041c0003602004104418008360200410041004101410810001a410441082802" +
+	"00360200410141004101410810011a0b"
+
+// trapWASM is the same WASI command of echoWASM with an unreachable _start
+const trapWASM = "0061736d01000000010c0260047f7f7f7f017f60000002440216776173695f73" +
+	"6e617073686f745f70726576696577310766645f72656164000016776173695f" +
+	"736e617073686f745f70726576696577310866645f7772697465000003020101" +
+	"0503010001071302066d656d6f72790200065f737461727400020a0501030000" +
+	"0b"
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestWASMExtractor(t *testing.T) {
+	ctx := context.Background()
+	extractor, err := NewWASMExtractor(ctx, "echo", mustDecodeHex(t, echoWASM))
+	if err != nil {
+		t.Fatalf("NewWASMExtractor failed: %v", err)
+	}
+	defer extractor.Close(ctx)
+	fields, err := extractor.Extract("http://localhost/foo", "application/json", []byte(`{"price": 10}`))
+	if err != nil {
+		t.Fatalf("WASMExtractor#Extract failed: %v", err)
+	}
+	expected := map[string]any{"price": float64(10)}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("WASMExtractor#Extract failed: expected %v got %v", expected, fields)
+	}
+	if _, err := extractor.Extract("http://localhost/foo", "text/html", []byte("<html>")); err == nil {
+		t.Errorf("WASMExtractor#Extract failed: expected an error on invalid output got nil")
+	}
+}
+
+func TestWASMExtractorTrap(t *testing.T) {
+	ctx := context.Background()
+	extractor, err := NewWASMExtractor(ctx, "trap", mustDecodeHex(t, trapWASM))
+	if err != nil {
+		t.Fatalf("NewWASMExtractor failed: %v", err)
+	}
+	defer extractor.Close(ctx)
+	if _, err := extractor.Extract("http://localhost/foo", "text/html", nil); err == nil {
+		t.Errorf("WASMExtractor#Extract failed: expected an error got nil")
+	}
+}
+
+func TestWASMExtractorReleasedByCrawls(t *testing.T) {
+	ctx := context.Background()
+	extractor, err := NewWASMExtractor(ctx, "echo", mustDecodeHex(t, echoWASM))
+	if err != nil {
+		t.Fatalf("NewWASMExtractor failed: %v", err)
+	}
+	defer extractor.Close(ctx)
+	extractor.Acquire()
+	extractor.Acquire()
+	if err := extractor.Release(ctx); err != nil || extractor.runtime == nil {
+		t.Errorf("WASMExtractor#Release failed: expected the runtime open while a crawl runs")
+	}
+	if err := extractor.Release(ctx); err != nil || extractor.runtime != nil {
+		t.Errorf("WASMExtractor#Release failed: expected the runtime closed after the last crawl")
+	}
+	// The command is compiled again on the next use
+	if _, err := extractor.Extract("http://localhost/foo", "application/json", []byte(`{}`)); err != nil {
+		t.Errorf("WASMExtractor#Extract failed: %v", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := extractor.ExtractContext(cancelled, "http://localhost/foo", "application/json", []byte(`{}`)); err == nil {
+		t.Errorf("WASMExtractor#ExtractContext failed: expected an error on a context done")
+	}
+}
+
+func TestLoadWASMExtractors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string][]byte{
+		"b.wasm":     mustDecodeHex(t, trapWASM),
+		"a.wasm":     mustDecodeHex(t, echoWASM),
+		"readme.txt": []byte("not an extractor"),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	extractors, err := LoadWASMExtractors(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("LoadWASMExtractors failed: %v", err)
+	}
+	if len(extractors) != 2 || extractors[0].(*WASMExtractor).name != "a.wasm" {
+		t.Errorf("LoadWASMExtractors failed: expected a.wasm and b.wasm got %v", extractors)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "c.wasm"), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadWASMExtractors(context.Background(), dir); err == nil {
+		t.Errorf("LoadWASMExtractors failed: expected an error got nil")
+	}
+}
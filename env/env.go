@@ -2,8 +2,11 @@
 package env
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Simple helper function to read an environment variable or return a default value
@@ -22,3 +25,130 @@ func GetEnvAsInt(key string, defaultVal int) int {
 	}
 	return defaultVal
 }
+
+// Simple helper function to read an environment variable into a slice of
+// strings split by a separator, or return a default value
+func GetEnvAsSlice(key string, sep string, defaultVal []string) []string {
+	valueStr, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultVal
+	}
+	return ParseSlice(valueStr, sep)
+}
+
+// Simple helper function to read an environment variable into a map of
+// strings or return a default value. The value is expected to be a list of
+// key=value pairs split by a separator, e.g. "a.com=agent1,b.com=agent2"
+func GetEnvAsMap(key string, sep string, defaultVal map[string]string) map[string]string {
+	valueStr, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultVal
+	}
+	return ParseMap(valueStr, sep)
+}
+
+// ParseSlice splits a string by a separator, each item is trimmed and empty
+// ones are discarded
+func ParseSlice(value string, sep string) []string {
+	values := []string{}
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// ParseMap splits a string of key=value pairs by a separator into a map,
+// pairs without a key are discarded
+func ParseMap(value string, sep string) map[string]string {
+	items := ParseSlice(value, sep)
+	values := make(map[string]string, len(items))
+	for _, item := range items {
+		pair := strings.SplitN(item, "=", 2)
+		k := strings.TrimSpace(pair[0])
+		if len(pair) != 2 || k == "" {
+			continue
+		}
+		values[k] = strings.TrimSpace(pair[1])
+	}
+	return values
+}
+
+// Reader reads typed values from environment variables, collecting an
+// error for each malformed or missing required one instead of silently
+// falling back to the default value
+type Reader struct {
+	errs []error
+}
+
+// String reads an environment variable or return a default value
+func (r *Reader) String(key string, defaultVal string) string {
+	return GetEnv(key, defaultVal)
+}
+
+// RequiredString reads an environment variable, recording an error if it's
+// not set or empty
+func (r *Reader) RequiredString(key string) string {
+	value := GetEnv(key, "")
+	if value == "" {
+		r.errs = append(r.errs, fmt.Errorf("%s is required", key))
+	}
+	return value
+}
+
+// Int reads an environment variable into an integer or return a default
+// value if not set
+func (r *Reader) Int(key string, defaultVal int) int {
+	valueStr, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultVal
+	}
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		r.Invalid(key, err)
+		return defaultVal
+	}
+	return value
+}
+
+// Float reads an environment variable into a float or return a default
+// value if not set
+func (r *Reader) Float(key string, defaultVal float64) float64 {
+	valueStr, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultVal
+	}
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		r.Invalid(key, err)
+		return defaultVal
+	}
+	return value
+}
+
+// Bool reads an environment variable into a boolean or return a default
+// value if not set, accepts the values understood by `strconv.ParseBool`
+func (r *Reader) Bool(key string, defaultVal bool) bool {
+	valueStr, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultVal
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		r.Invalid(key, err)
+		return defaultVal
+	}
+	return value
+}
+
+// Invalid records an error for an environment variable with an invalid
+// value, useful for validations beyond the type of the value
+func (r *Reader) Invalid(key string, err error) {
+	r.errs = append(r.errs, fmt.Errorf("invalid %s: %w", key, err))
+}
+
+// Err returns all the errors collected while reading, nil if none
+func (r *Reader) Err() error {
+	return errors.Join(r.errs...)
+}
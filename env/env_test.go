@@ -3,6 +3,7 @@ package env
 
 import (
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -36,3 +37,67 @@ func TestGetEnvAsInt(t *testing.T) {
 		t.Errorf("GetEnv failed: expected 6 got %d", value)
 	}
 }
+
+func TestGetEnvAsSlice(t *testing.T) {
+	unset := setupEnv("TEST_GETENV", ".png, .jpg,,.pdf ")
+	value := GetEnvAsSlice("TEST_GETENV", ",", nil)
+	expected := []string{".png", ".jpg", ".pdf"}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("GetEnvAsSlice failed: expected %v got %v", expected, value)
+	}
+	unset()
+	value = GetEnvAsSlice("TEST_GETENV", ",", []string{".gif"})
+	if !reflect.DeepEqual(value, []string{".gif"}) {
+		t.Errorf("GetEnvAsSlice failed: expected [.gif] got %v", value)
+	}
+}
+
+func TestGetEnvAsMap(t *testing.T) {
+	unset := setupEnv("TEST_GETENV", "a.com=http://proxy?x=1; b.com = direct;broken;=empty")
+	value := GetEnvAsMap("TEST_GETENV", ";", nil)
+	expected := map[string]string{"a.com": "http://proxy?x=1", "b.com": "direct"}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("GetEnvAsMap failed: expected %v got %v", expected, value)
+	}
+	unset()
+	value = GetEnvAsMap("TEST_GETENV", ";", map[string]string{"c.com": "agent"})
+	if !reflect.DeepEqual(value, map[string]string{"c.com": "agent"}) {
+		t.Errorf("GetEnvAsMap failed: expected default got %v", value)
+	}
+}
+
+func TestReader(t *testing.T) {
+	defer setupEnv("TEST_INT", "12")()
+	defer setupEnv("TEST_FLOAT", "0.5")()
+	defer setupEnv("TEST_BOOL", "true")()
+	r := &Reader{}
+	if value := r.Int("TEST_INT", 6); value != 12 {
+		t.Errorf("Reader#Int failed: expected 12 got %d", value)
+	}
+	if value := r.Float("TEST_FLOAT", 1); value != 0.5 {
+		t.Errorf("Reader#Float failed: expected 0.5 got %f", value)
+	}
+	if value := r.Bool("TEST_BOOL", false); !value {
+		t.Errorf("Reader#Bool failed: expected true got false")
+	}
+	if value := r.Int("TEST_UNSET", 6); value != 6 {
+		t.Errorf("Reader#Int failed: expected 6 got %d", value)
+	}
+	if err := r.Err(); err != nil {
+		t.Errorf("Reader#Err failed: expected nil got %v", err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	defer setupEnv("TEST_INT", "twelve")()
+	defer setupEnv("TEST_BOOL", "maybe")()
+	r := &Reader{}
+	if value := r.Int("TEST_INT", 6); value != 6 {
+		t.Errorf("Reader#Int failed: expected 6 got %d", value)
+	}
+	r.Bool("TEST_BOOL", false)
+	r.RequiredString("TEST_REQUIRED")
+	if err := r.Err(); err == nil || len(r.errs) != 3 {
+		t.Errorf("Reader#Err failed: expected 3 errors got %v", err)
+	}
+}
@@ -1,17 +1,22 @@
 module github.com/codepr/webcrawler
 
-go 1.20
+go 1.21
 
 require (
 	github.com/PuerkitoBio/goquery v1.5.1
 	github.com/PuerkitoBio/rehttp v1.0.0
+	github.com/go-zeromq/zmq4 v0.17.0
 	github.com/temoto/robotstxt v1.1.1
+	github.com/tetratelabs/wazero v1.8.2
+	golang.org/x/net v0.0.0-20200822124328-c89045814202
 )
 
 require (
 	github.com/andybalholm/cascadia v1.1.0 // indirect
 	github.com/aybabtme/iocontrol v0.0.0-20150809002002-ad15bcfc95a0 // indirect
 	github.com/benbjohnson/clock v1.0.3 // indirect
+	github.com/go-zeromq/goczmq/v4 v4.2.2 // indirect
 	github.com/stretchr/testify v1.6.1 // indirect
-	golang.org/x/net v0.0.0-20200822124328-c89045814202 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
 )
@@ -0,0 +1,72 @@
+// Package messaging contains middleware for communication with decoupled
+// services, could be RabbitMQ drivers as well as kafka or redis
+package messaging
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrAlreadyAcknowledged is returned when settling a delivery twice
+var ErrAlreadyAcknowledged = errors.New("delivery already acknowledged")
+
+// Acknowledger settles the deliveries of a queue, implemented by the queues
+// supporting acknowledgement, e.g. broker-backed ones
+type Acknowledger interface {
+	// Ack marks a payload as processed, it won't be delivered again
+	Ack(Delivery) error
+	// Nack marks a payload as failed for good, it's discarded or
+	// dead-lettered depending on the queue
+	Nack(Delivery) error
+	// Requeue gives a payload back to the queue to be delivered again
+	Requeue(Delivery) error
+}
+
+// Delivery is a payload consumed waiting to be settled by the handler, with
+// Ack on success, Nack or Requeue on failure, so that a failing handler
+// doesn't lose it. A delivery can be settled only once.
+type Delivery struct {
+	Body []byte
+	// Tag identifies the delivery for the queue it comes from
+	Tag uint64
+
+	acknowledger Acknowledger
+	settled      *int32
+}
+
+// NewDelivery creates a new Delivery of a payload, settled by an
+// Acknowledger
+func NewDelivery(body []byte, tag uint64, acknowledger Acknowledger) Delivery {
+	return Delivery{Body: body, Tag: tag, acknowledger: acknowledger, settled: new(int32)}
+}
+
+// settle runs a settlement once
+func (d Delivery) settle(fn func(Delivery) error) error {
+	if !atomic.CompareAndSwapInt32(d.settled, 0, 1) {
+		return ErrAlreadyAcknowledged
+	}
+	return fn(d)
+}
+
+// Ack marks the payload as processed
+func (d Delivery) Ack() error {
+	return d.settle(d.acknowledger.Ack)
+}
+
+// Nack marks the payload as failed for good
+func (d Delivery) Nack() error {
+	return d.settle(d.acknowledger.Nack)
+}
+
+// Requeue gives the payload back to the queue to be delivered again
+func (d Delivery) Requeue() error {
+	return d.settle(d.acknowledger.Requeue)
+}
+
+// AckConsumer defines a consumer with delivery acknowledgement, exposes a
+// single `ConsumeWithAck` method meant to connect to a queue blocking while
+// consuming incoming payloads, forwarding them as deliveries to settle into
+// a channel
+type AckConsumer interface {
+	ConsumeWithAck(chan<- Delivery) error
+}
@@ -0,0 +1,50 @@
+package messaging
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDiskQueueConsumeWithAck(t *testing.T) {
+	q, err := NewDiskQueue(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := q.Produce([]byte(fmt.Sprintf("payload-%d", i))); err != nil {
+			t.Fatalf("DiskQueue#Produce failed: %v", err)
+		}
+	}
+	deliveries := make(chan Delivery)
+	go func() {
+		_ = q.ConsumeWithAck(deliveries)
+		close(deliveries)
+	}()
+	received := []string{}
+	requeued := false
+	for d := range deliveries {
+		received = append(received, string(d.Body))
+		switch {
+		case string(d.Body) == "payload-1" && !requeued:
+			// The handler fails the first time, the payload comes back
+			requeued = true
+			if err := d.Requeue(); err != nil {
+				t.Fatalf("Delivery#Requeue failed: %v", err)
+			}
+		default:
+			if err := d.Ack(); err != nil {
+				t.Fatalf("Delivery#Ack failed: %v", err)
+			}
+			if err := d.Nack(); err != ErrAlreadyAcknowledged {
+				t.Errorf("Delivery#Nack failed: expected ErrAlreadyAcknowledged got %v", err)
+			}
+		}
+		if len(received) == 4 {
+			q.Close()
+		}
+	}
+	expected := "[payload-0 payload-1 payload-2 payload-1]"
+	if fmt.Sprint(received) != expected {
+		t.Errorf("DiskQueue#ConsumeWithAck failed: expected %s got %v", expected, received)
+	}
+}
@@ -0,0 +1,215 @@
+// Package messaging contains middleware for communication with decoupled
+// services, could be RabbitMQ drivers as well as kafka or redis
+package messaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Name of the file holding the payloads spilled to disk
+const diskQueueFile = "queue.spill"
+
+// Size of the length header of each payload on disk
+const recordHeaderSize = 4
+
+// ErrQueueClosed is returned when producing to a closed queue
+var ErrQueueClosed = errors.New("queue closed")
+
+// DiskQueue is a `ProducerConsumerCloser` implementation buffering up to a
+// capacity of payloads in memory, spilling the rest to a file on disk when
+// consumers fall behind and draining them back, in order, as they catch up.
+// Memory stays bounded whatever the pace of the consumers.
+//
+// Payloads spilled are delivered at least once, the ones left on disk by a
+// crash are delivered again by a queue opened on the same directory, some of
+// them may have been delivered already.
+type DiskQueue struct {
+	mutex sync.Mutex
+	// cond wakes up the drain loop on new spilled payloads and on close
+	cond   *sync.Cond
+	buffer chan []byte
+	file   *os.File
+	// readOffset and writeOffset delimit the payloads spilled not drained
+	// yet, spilled counts them
+	readOffset, writeOffset int64
+	spilled                 int
+	closed                  bool
+}
+
+// NewDiskQueue creates a new DiskQueue holding up to capacity payloads in
+// memory and spilling the rest to a file in dir, payloads found on disk are
+// delivered first
+func NewDiskQueue(dir string, capacity int) (*DiskQueue, error) {
+	if capacity < 0 {
+		return nil, fmt.Errorf("opening disk queue failed: negative capacity %d", capacity)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("opening disk queue failed: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, diskQueueFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening disk queue failed: %w", err)
+	}
+	q := &DiskQueue{buffer: make(chan []byte, capacity), file: file}
+	q.cond = sync.NewCond(&q.mutex)
+	if err := q.recover(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("opening disk queue failed: %w", err)
+	}
+	go q.drain()
+	return q, nil
+}
+
+// recover counts the payloads left on disk, a payload partially written is
+// discarded
+func (q *DiskQueue) recover() error {
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := q.file.ReadAt(header, q.writeOffset); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		info, err := q.file.Stat()
+		if err != nil {
+			return err
+		}
+		if q.writeOffset+recordHeaderSize+size > info.Size() {
+			break
+		}
+		q.writeOffset += recordHeaderSize + size
+		q.spilled++
+	}
+	return q.file.Truncate(q.writeOffset)
+}
+
+// Produce enqueues a payload, in memory if there's room and nothing is
+// waiting on disk, otherwise on disk
+func (q *DiskQueue) Produce(data []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	// Payloads go in memory only if none is waiting on disk, to keep them in
+	// order
+	if q.spilled == 0 {
+		select {
+		case q.buffer <- data:
+			return nil
+		default:
+		}
+	}
+	record := make([]byte, recordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	copy(record[recordHeaderSize:], data)
+	if _, err := q.file.WriteAt(record, q.writeOffset); err != nil {
+		return fmt.Errorf("spilling payload to disk failed: %w", err)
+	}
+	q.writeOffset += int64(len(record))
+	q.spilled++
+	q.cond.Signal()
+	return nil
+}
+
+// drain moves the payloads spilled back in memory as the consumers make
+// room, closing the buffer once the queue is closed and the disk is empty
+func (q *DiskQueue) drain() {
+	defer close(q.buffer)
+	defer q.file.Close()
+	for {
+		q.mutex.Lock()
+		for q.spilled == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.spilled == 0 {
+			q.mutex.Unlock()
+			return
+		}
+		data, err := q.read(q.readOffset)
+		q.mutex.Unlock()
+		if err != nil {
+			// The disk is unreadable, nothing else can be delivered
+			return
+		}
+		// The payload is still counted as spilled while waiting for room,
+		// so that new ones are queued behind it
+		q.buffer <- data
+		q.mutex.Lock()
+		q.readOffset += int64(recordHeaderSize + len(data))
+		q.spilled--
+		if q.spilled == 0 {
+			// All caught up, the file is reused from the start
+			q.readOffset, q.writeOffset = 0, 0
+			_ = q.file.Truncate(0)
+		}
+		q.mutex.Unlock()
+	}
+}
+
+// read returns the payload on disk at an offset
+func (q *DiskQueue) read(offset int64) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := q.file.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := q.file.ReadAt(data, offset+recordHeaderSize); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Consume forwards all the payloads, from memory and from disk, to a
+// push-only channel till the queue is closed and drained
+func (q *DiskQueue) Consume(events chan<- []byte) error {
+	for event := range q.buffer {
+		events <- event
+	}
+	return nil
+}
+
+// Close stops accepting new payloads, the ones already enqueued are still
+// delivered to the consumers
+func (q *DiskQueue) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// ConsumeWithAck forwards all the payloads as deliveries to a push-only
+// channel till the queue is closed and drained. Requeued payloads are
+// produced again at the end of the queue, nacked ones are discarded.
+func (q *DiskQueue) ConsumeWithAck(deliveries chan<- Delivery) error {
+	var tag uint64
+	for event := range q.buffer {
+		tag++
+		deliveries <- NewDelivery(event, tag, diskQueueAcknowledger{q})
+	}
+	return nil
+}
+
+// diskQueueAcknowledger settles the deliveries of a DiskQueue
+type diskQueueAcknowledger struct {
+	queue *DiskQueue
+}
+
+// Ack is a no-op, payloads consumed are already out of the queue
+func (a diskQueueAcknowledger) Ack(Delivery) error { return nil }
+
+// Nack is a no-op, the payload is discarded
+func (a diskQueueAcknowledger) Nack(Delivery) error { return nil }
+
+// Requeue produces the payload again, it fails if the queue is closed
+func (a diskQueueAcknowledger) Requeue(d Delivery) error {
+	return a.queue.Produce(d.Body)
+}
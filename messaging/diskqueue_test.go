@@ -0,0 +1,106 @@
+package messaging
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func consumeAll(q *DiskQueue) []string {
+	events := make(chan []byte)
+	go func() {
+		_ = q.Consume(events)
+		close(events)
+	}()
+	payloads := []string{}
+	for e := range events {
+		payloads = append(payloads, string(e))
+	}
+	return payloads
+}
+
+func TestDiskQueueSpillsInOrder(t *testing.T) {
+	q, err := NewDiskQueue(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	// No consumers yet, all but the first payloads are spilled to disk
+	for i := 0; i < 100; i++ {
+		if err := q.Produce([]byte(fmt.Sprintf("payload-%d", i))); err != nil {
+			t.Fatalf("DiskQueue#Produce failed: %v", err)
+		}
+	}
+	q.Close()
+	payloads := consumeAll(q)
+	if len(payloads) != 100 {
+		t.Fatalf("DiskQueue#Consume failed: expected 100 payloads got %d", len(payloads))
+	}
+	for i, payload := range payloads {
+		if expected := fmt.Sprintf("payload-%d", i); payload != expected {
+			t.Errorf("DiskQueue#Consume failed: expected %s got %s", expected, payload)
+		}
+	}
+	if err := q.Produce([]byte("late")); err != ErrQueueClosed {
+		t.Errorf("DiskQueue#Produce failed: expected ErrQueueClosed got %v", err)
+	}
+}
+
+func TestDiskQueueConcurrentConsumer(t *testing.T) {
+	q, err := NewDiskQueue(t.TempDir(), 4)
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	results := make(chan []string)
+	go func() { results <- consumeAll(q) }()
+	for i := 0; i < 1000; i++ {
+		if err := q.Produce([]byte(fmt.Sprintf("payload-%d", i))); err != nil {
+			t.Fatalf("DiskQueue#Produce failed: %v", err)
+		}
+	}
+	q.Close()
+	payloads := <-results
+	if len(payloads) != 1000 {
+		t.Fatalf("DiskQueue#Consume failed: expected 1000 payloads got %d", len(payloads))
+	}
+	for i, payload := range payloads {
+		if expected := fmt.Sprintf("payload-%d", i); payload != expected {
+			t.Fatalf("DiskQueue#Consume failed: expected %s got %s", expected, payload)
+		}
+	}
+}
+
+func TestDiskQueueRecover(t *testing.T) {
+	dir := t.TempDir()
+	// Two payloads and a torn one, left by a crash
+	record := func(payload string) []byte {
+		r := make([]byte, recordHeaderSize+len(payload))
+		binary.BigEndian.PutUint32(r, uint32(len(payload)))
+		copy(r[recordHeaderSize:], payload)
+		return r
+	}
+	data := append(record("first"), record("second")...)
+	data = append(data, record("torn")[:6]...)
+	if err := os.WriteFile(filepath.Join(dir, diskQueueFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewDiskQueue(dir, 1)
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	if err := q.Produce([]byte("third")); err != nil {
+		t.Fatalf("DiskQueue#Produce failed: %v", err)
+	}
+	q.Close()
+	payloads := consumeAll(q)
+	if fmt.Sprint(payloads) != "[first second third]" {
+		t.Errorf("DiskQueue#Consume failed: expected [first second third] got %v", payloads)
+	}
+}
+
+func TestNewDiskQueueErrors(t *testing.T) {
+	if _, err := NewDiskQueue(t.TempDir(), -1); err == nil {
+		t.Error("NewDiskQueue failed: expected error for negative capacity")
+	}
+}
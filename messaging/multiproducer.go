@@ -0,0 +1,53 @@
+// Package messaging contains middleware for communication with decoupled
+// services, could be RabbitMQ drivers as well as kafka or redis
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MultiProducer is a `Producer` duplicating each payload to several sinks,
+// e.g. a broker and a file archive. Sinks are isolated from each other, a
+// failing sink doesn't prevent the others from receiving the payload.
+type MultiProducer struct {
+	sinks []Producer
+}
+
+// NewMultiProducer creates a new MultiProducer duplicating the payloads to
+// the sinks passed in
+func NewMultiProducer(sinks ...Producer) *MultiProducer {
+	return &MultiProducer{sinks}
+}
+
+// Produce sends a payload to every sink concurrently, returns the errors of
+// all the sinks failing joined together, each one reporting the index of its
+// sink
+func (m *MultiProducer) Produce(data []byte) error {
+	errs := make([]error, len(m.sinks))
+	wg := sync.WaitGroup{}
+	for i, sink := range m.sinks {
+		wg.Add(1)
+		go func(i int, sink Producer) {
+			defer wg.Done()
+			if err := sink.Produce(data); err != nil {
+				errs[i] = fmt.Errorf("producing to sink %d failed: %w", i, err)
+			}
+		}(i, sink)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Flush flushes every sink buffering payloads, returns the errors of all the
+// sinks failing joined together
+func (m *MultiProducer) Flush() error {
+	var errs []error
+	for i, sink := range m.sinks {
+		if err := Flush(sink); err != nil {
+			errs = append(errs, fmt.Errorf("flushing sink %d failed: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,67 @@
+package messaging
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// sliceProducer records the payloads produced, failing if err is set
+type sliceProducer struct {
+	payloads [][]byte
+	err      error
+}
+
+func (p *sliceProducer) Produce(data []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.payloads = append(p.payloads, data)
+	return nil
+}
+
+func TestMultiProducer(t *testing.T) {
+	first, second := &sliceProducer{}, &sliceProducer{}
+	failing := &sliceProducer{err: errors.New("unavailable")}
+	m := NewMultiProducer(first, failing, second)
+	err := m.Produce([]byte("payload"))
+	if err == nil || !strings.Contains(err.Error(), "sink 1") || !errors.Is(err, failing.err) {
+		t.Errorf("MultiProducer#Produce failed: unexpected error %v", err)
+	}
+	for _, sink := range []*sliceProducer{first, second} {
+		if len(sink.payloads) != 1 || string(sink.payloads[0]) != "payload" {
+			t.Errorf("MultiProducer#Produce failed: unexpected payloads %q", sink.payloads)
+		}
+	}
+	if err := NewMultiProducer(first, second).Produce([]byte("payload")); err != nil {
+		t.Errorf("MultiProducer#Produce failed: %v", err)
+	}
+}
+
+// flushingProducer is a sliceProducer counting its flushes
+type flushingProducer struct {
+	sliceProducer
+	flushes  int
+	flushErr error
+}
+
+func (p *flushingProducer) Flush() error {
+	p.flushes++
+	return p.flushErr
+}
+
+func TestMultiProducerFlush(t *testing.T) {
+	flushing := &flushingProducer{}
+	failing := &flushingProducer{flushErr: errors.New("unavailable")}
+	m := NewMultiProducer(&sliceProducer{}, flushing, failing)
+	err := m.Flush()
+	if err == nil || !strings.Contains(err.Error(), "sink 2") || !errors.Is(err, failing.flushErr) {
+		t.Errorf("MultiProducer#Flush failed: unexpected error %v", err)
+	}
+	if flushing.flushes != 1 || failing.flushes != 1 {
+		t.Errorf("MultiProducer#Flush failed: expected 1 flush got %d %d", flushing.flushes, failing.flushes)
+	}
+	if err := Flush(&sliceProducer{}); err != nil {
+		t.Errorf("Flush failed: unexpected error %v", err)
+	}
+}
@@ -28,3 +28,17 @@ type ProducerConsumerCloser interface {
 	ProducerConsumer
 	Close()
 }
+
+// Flusher defines the behavior of a producer buffering payloads before
+// sending them, `Flush` blocks till all the payloads produced are sent
+type Flusher interface {
+	Flush() error
+}
+
+// Flush flushes a producer if it's a `Flusher`, it's a no-op otherwise
+func Flush(producer Producer) error {
+	if f, ok := producer.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Package messaging contains middleware for communication with decoupled
+// services, could be RabbitMQ drivers as well as kafka or redis
+package messaging
+
+import "sync"
+
+// RingQueue is an in-memory `ProducerConsumerCloser` implementation backed
+// by a ring buffer that never blocks the producers: when full the oldest
+// payload is dropped to make room, counting it. Meant for best-effort
+// pipelines, e.g. monitoring, where a slow consumer must not slow the crawl.
+type RingQueue struct {
+	mutex sync.Mutex
+	// cond wakes up the consumers on new payloads and on close
+	cond    *sync.Cond
+	buffer  [][]byte
+	head    int
+	size    int
+	dropped uint64
+	closed  bool
+}
+
+// NewRingQueue creates a new RingQueue holding up to capacity payloads, at
+// least one
+func NewRingQueue(capacity int) *RingQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	q := &RingQueue{buffer: make([][]byte, capacity)}
+	q.cond = sync.NewCond(&q.mutex)
+	return q
+}
+
+// Produce enqueues a payload, dropping the oldest one if the queue is full
+func (q *RingQueue) Produce(data []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.size == len(q.buffer) {
+		q.buffer[q.head] = data
+		q.head = (q.head + 1) % len(q.buffer)
+		q.dropped++
+	} else {
+		q.buffer[(q.head+q.size)%len(q.buffer)] = data
+		q.size++
+	}
+	q.cond.Signal()
+	return nil
+}
+
+// Consume forwards the payloads to a push-only channel, oldest first, till
+// the queue is closed and drained
+func (q *RingQueue) Consume(events chan<- []byte) error {
+	for {
+		q.mutex.Lock()
+		for q.size == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.size == 0 {
+			q.mutex.Unlock()
+			return nil
+		}
+		data := q.buffer[q.head]
+		q.buffer[q.head] = nil
+		q.head = (q.head + 1) % len(q.buffer)
+		q.size--
+		q.mutex.Unlock()
+		events <- data
+	}
+}
+
+// Dropped returns the number of payloads dropped to make room for new ones
+func (q *RingQueue) Dropped() uint64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.dropped
+}
+
+// Close stops accepting new payloads, the ones in the queue are still
+// delivered to the consumers
+func (q *RingQueue) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
@@ -0,0 +1,63 @@
+package messaging
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRingQueueDropsOldest(t *testing.T) {
+	q := NewRingQueue(3)
+	// No consumers, producing never blocks
+	for i := 0; i < 5; i++ {
+		if err := q.Produce([]byte(fmt.Sprintf("payload-%d", i))); err != nil {
+			t.Fatalf("RingQueue#Produce failed: %v", err)
+		}
+	}
+	if dropped := q.Dropped(); dropped != 2 {
+		t.Errorf("RingQueue#Dropped failed: expected 2 got %d", dropped)
+	}
+	q.Close()
+	if err := q.Produce([]byte("late")); err != ErrQueueClosed {
+		t.Errorf("RingQueue#Produce failed: expected ErrQueueClosed got %v",
+			err)
+	}
+	events := make(chan []byte, 5)
+	if err := q.Consume(events); err != nil {
+		t.Fatalf("RingQueue#Consume failed: %v", err)
+	}
+	close(events)
+	payloads := []string{}
+	for e := range events {
+		payloads = append(payloads, string(e))
+	}
+	expected := "[payload-2 payload-3 payload-4]"
+	if fmt.Sprint(payloads) != expected {
+		t.Errorf("RingQueue#Consume failed: expected %s got %v",
+			expected, payloads)
+	}
+}
+
+func TestRingQueueConcurrentConsumer(t *testing.T) {
+	q := NewRingQueue(1000)
+	events := make(chan []byte)
+	done := make(chan int)
+	go func() {
+		count := 0
+		for range events {
+			count++
+		}
+		done <- count
+	}()
+	go func() {
+		_ = q.Consume(events)
+		close(events)
+	}()
+	for i := 0; i < 500; i++ {
+		_ = q.Produce([]byte("payload"))
+	}
+	q.Close()
+	if count := <-done; count != 500 {
+		t.Errorf("RingQueue#Consume failed: expected 500 payloads got %d",
+			count)
+	}
+}
@@ -0,0 +1,56 @@
+// Package messaging contains middleware for communication with decoupled
+// services, could be RabbitMQ drivers as well as kafka or redis
+package messaging
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TopicProducer defines a producer able to route payloads to different
+// destinations by topic, e.g. the kind of the payload
+type TopicProducer interface {
+	Producer
+	ProduceTo(topic string, data []byte) error
+}
+
+// TopicRouter is a `TopicProducer` mapping topics to the producers of
+// different queues, payloads of topics with no route and the ones produced
+// with no topic go to a fallback producer
+type TopicRouter struct {
+	routes   map[string]Producer
+	fallback Producer
+}
+
+// NewTopicRouter creates a new TopicRouter with a fallback producer and the
+// routes of the topics
+func NewTopicRouter(fallback Producer,
+	routes map[string]Producer) *TopicRouter {
+	return &TopicRouter{routes: routes, fallback: fallback}
+}
+
+// Produce sends a payload to the fallback producer
+func (r *TopicRouter) Produce(data []byte) error {
+	return r.fallback.Produce(data)
+}
+
+// ProduceTo sends a payload to the producer of a topic, or to the fallback
+// one if the topic has no route
+func (r *TopicRouter) ProduceTo(topic string, data []byte) error {
+	if producer, ok := r.routes[topic]; ok {
+		return producer.Produce(data)
+	}
+	return r.fallback.Produce(data)
+}
+
+// Flush flushes the fallback producer and the producers of every topic
+// buffering payloads, returns their errors joined together
+func (r *TopicRouter) Flush() error {
+	errs := []error{Flush(r.fallback)}
+	for topic, producer := range r.routes {
+		if err := Flush(producer); err != nil {
+			errs = append(errs, fmt.Errorf("flushing topic %s failed: %w", topic, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,19 @@
+package messaging
+
+import "testing"
+
+func TestTopicRouter(t *testing.T) {
+	fallback, pages := &sliceProducer{}, &sliceProducer{}
+	r := NewTopicRouter(fallback, map[string]Producer{"page": pages})
+	_ = r.ProduceTo("page", []byte("page"))
+	_ = r.ProduceTo("error", []byte("error"))
+	_ = r.Produce([]byte("untyped"))
+	if len(pages.payloads) != 1 || string(pages.payloads[0]) != "page" {
+		t.Errorf("TopicRouter#ProduceTo failed: unexpected payloads %q",
+			pages.payloads)
+	}
+	if len(fallback.payloads) != 2 {
+		t.Errorf("TopicRouter#ProduceTo failed: unexpected fallback payloads %q",
+			fallback.payloads)
+	}
+}
@@ -0,0 +1,160 @@
+// Package messaging contains middleware for communication with decoupled
+// services, could be RabbitMQ drivers as well as kafka or redis
+package messaging
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Header carrying the HMAC-SHA256 signature of the payloads posted, as
+// sha256=<hex digest>
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+const (
+	// Default number of retries of a failed POST
+	defaultWebhookRetries int = 3
+	// Default wait before the first retry, doubled on every retry
+	defaultWebhookBackoff time.Duration = 500 * time.Millisecond
+	// Default number of concurrent POSTs
+	defaultWebhookConcurrency int = 4
+)
+
+// WebhookProducer is a `Producer` POSTing each payload, a single result or
+// a batch, to a webhook URL, e.g. a serverless endpoint. Payloads are
+// signed if a secret is set, failed POSTs are retried with an exponential
+// backoff and the number of concurrent POSTs is limited.
+type WebhookProducer struct {
+	url         string
+	client      *http.Client
+	contentType string
+	secret      []byte
+	retries     int
+	backoff     time.Duration
+	semaphore   chan struct{}
+}
+
+// WebhookOption is a type definition for option pattern while creating a
+// new WebhookProducer
+type WebhookOption func(*WebhookProducer)
+
+// WithWebhookSecret signs every payload with HMAC-SHA256 using a secret,
+// the signature is sent in the `WebhookSignatureHeader` header
+func WithWebhookSecret(secret []byte) WebhookOption {
+	return func(w *WebhookProducer) {
+		w.secret = secret
+	}
+}
+
+// WithWebhookRetries sets the number of retries of a failed POST and the
+// wait before the first one, doubled on every retry
+func WithWebhookRetries(retries int, backoff time.Duration) WebhookOption {
+	return func(w *WebhookProducer) {
+		w.retries = retries
+		w.backoff = backoff
+	}
+}
+
+// WithWebhookConcurrency sets the maximum number of concurrent POSTs, at
+// least one
+func WithWebhookConcurrency(n int) WebhookOption {
+	return func(w *WebhookProducer) {
+		if n < 1 {
+			n = 1
+		}
+		w.semaphore = make(chan struct{}, n)
+	}
+}
+
+// WithWebhookClient sets the HTTP client used to POST, by default one with
+// a 10 seconds timeout
+func WithWebhookClient(client *http.Client) WebhookOption {
+	return func(w *WebhookProducer) {
+		w.client = client
+	}
+}
+
+// WithWebhookContentType sets the Content-Type of the payloads, by default
+// application/json
+func WithWebhookContentType(contentType string) WebhookOption {
+	return func(w *WebhookProducer) {
+		w.contentType = contentType
+	}
+}
+
+// NewWebhookProducer creates a new WebhookProducer POSTing to an URL
+func NewWebhookProducer(url string, opts ...WebhookOption) *WebhookProducer {
+	w := &WebhookProducer{
+		url:         url,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		contentType: "application/json",
+		retries:     defaultWebhookRetries,
+		backoff:     defaultWebhookBackoff,
+		semaphore:   make(chan struct{}, defaultWebhookConcurrency),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Sign returns the signature of a payload with a secret, as sent in the
+// `WebhookSignatureHeader` header, receivers can compare it with
+// `hmac.Equal`
+func Sign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Produce POSTs a payload, retrying on network errors, 429 and 5xx
+// responses, other responses not in the 2xx range fail immediately
+func (w *WebhookProducer) Produce(data []byte) error {
+	w.semaphore <- struct{}{}
+	defer func() { <-w.semaphore }()
+	backoff := w.backoff
+	var err error
+	for attempt := 0; attempt <= w.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var retry bool
+		if retry, err = w.post(data); err == nil || !retry {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("posting to webhook %s failed: %w", w.url, err)
+	}
+	return nil
+}
+
+// post sends a payload once, returns whether the failure is worth a retry
+func (w *WebhookProducer) post(data []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", w.contentType)
+	if w.secret != nil {
+		req.Header.Set(WebhookSignatureHeader, Sign(w.secret, data))
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status %s", res.Status)
+}
@@ -0,0 +1,86 @@
+package messaging
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookProducer(t *testing.T) {
+	secret := []byte("secret")
+	var calls int32
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(WebhookSignatureHeader) != Sign(secret, body) {
+			t.Errorf("WebhookProducer#Produce failed: invalid signature")
+		}
+		// The first attempt fails, the retry succeeds
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- body
+	}))
+	defer server.Close()
+	w := NewWebhookProducer(server.URL, WithWebhookSecret(secret),
+		WithWebhookRetries(2, time.Millisecond))
+	if err := w.Produce([]byte(`{"url":"https://example.com"}`)); err != nil {
+		t.Fatalf("WebhookProducer#Produce failed: %v", err)
+	}
+	if body := <-received; string(body) != `{"url":"https://example.com"}` {
+		t.Errorf("WebhookProducer#Produce failed: unexpected body %s", body)
+	}
+}
+
+func TestWebhookProducerErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	w := NewWebhookProducer(server.URL, WithWebhookRetries(3, time.Millisecond))
+	if err := w.Produce([]byte("payload")); err == nil {
+		t.Error("WebhookProducer#Produce failed: expected error")
+	}
+	// Client errors are not retried
+	if calls != 1 {
+		t.Errorf("WebhookProducer#Produce failed: expected 1 call got %d", calls)
+	}
+}
+
+func TestWebhookProducerConcurrency(t *testing.T) {
+	var inflight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+	}))
+	defer server.Close()
+	w := NewWebhookProducer(server.URL, WithWebhookConcurrency(2))
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.Produce([]byte("payload")); err != nil {
+				t.Errorf("WebhookProducer#Produce failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak > 2 {
+		t.Errorf("WebhookProducer#Produce failed: expected at most 2 concurrent POSTs got %d", peak)
+	}
+}
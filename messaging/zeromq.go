@@ -0,0 +1,106 @@
+// Package messaging contains middleware for communication with decoupled
+// services, could be RabbitMQ drivers as well as kafka or redis
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+// ZeroMQProducer is a `Producer` pushing payloads on a ZeroMQ PUSH socket,
+// payloads are load-balanced across the PULL sockets connected, with no
+// broker in the middle
+type ZeroMQProducer struct {
+	socket zmq4.Socket
+}
+
+// NewZeroMQProducer creates a new ZeroMQProducer binding a PUSH socket to
+// an endpoint, e.g. tcp://*:5555 or ipc:///tmp/crawler, consumers connect
+// to it
+func NewZeroMQProducer(ctx context.Context, endpoint string) (*ZeroMQProducer, error) {
+	socket := zmq4.NewPush(ctx)
+	if err := socket.Listen(endpoint); err != nil {
+		socket.Close()
+		return nil, fmt.Errorf("binding PUSH socket to %s failed: %w", endpoint, err)
+	}
+	return &ZeroMQProducer{socket}, nil
+}
+
+// Produce pushes a payload, blocking till a consumer can take it
+func (p *ZeroMQProducer) Produce(data []byte) error {
+	return p.socket.Send(zmq4.NewMsg(data))
+}
+
+// Close closes the underlying socket
+func (p *ZeroMQProducer) Close() {
+	p.socket.Close()
+}
+
+// ZeroMQConsumer is a `Consumer` pulling payloads from a ZeroMQ PULL socket
+type ZeroMQConsumer struct {
+	socket zmq4.Socket
+	closed int32
+}
+
+// NewZeroMQConsumer creates a new ZeroMQConsumer connecting a PULL socket to
+// the endpoint of a producer
+func NewZeroMQConsumer(ctx context.Context, endpoint string) (*ZeroMQConsumer, error) {
+	socket := zmq4.NewPull(ctx)
+	if err := socket.Dial(endpoint); err != nil {
+		socket.Close()
+		return nil, fmt.Errorf("connecting PULL socket to %s failed: %w", endpoint, err)
+	}
+	return &ZeroMQConsumer{socket: socket}, nil
+}
+
+// Consume forwards all the payloads pulled to a push-only channel till the
+// consumer is closed
+func (c *ZeroMQConsumer) Consume(events chan<- []byte) error {
+	for {
+		msg, err := c.socket.Recv()
+		if err != nil {
+			if atomic.LoadInt32(&c.closed) == 1 {
+				return nil
+			}
+			return fmt.Errorf("receiving from PULL socket failed: %w", err)
+		}
+		events <- msg.Bytes()
+	}
+}
+
+// Close closes the underlying socket, ending Consume
+func (c *ZeroMQConsumer) Close() {
+	atomic.StoreInt32(&c.closed, 1)
+	c.socket.Close()
+}
+
+// ZeroMQQueue is a `ProducerConsumerCloser` made of a ZeroMQProducer and a
+// ZeroMQConsumer connected to it, for pipelines within the same process or
+// for testing. Processes usually own one end only.
+type ZeroMQQueue struct {
+	*ZeroMQProducer
+	*ZeroMQConsumer
+}
+
+// NewZeroMQQueue creates a new ZeroMQQueue on an endpoint
+func NewZeroMQQueue(ctx context.Context, endpoint string) (*ZeroMQQueue, error) {
+	producer, err := NewZeroMQProducer(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := NewZeroMQConsumer(ctx, endpoint)
+	if err != nil {
+		producer.Close()
+		return nil, err
+	}
+	return &ZeroMQQueue{producer, consumer}, nil
+}
+
+// Close closes both the sockets
+func (q *ZeroMQQueue) Close() {
+	q.ZeroMQConsumer.Close()
+	q.ZeroMQProducer.Close()
+}
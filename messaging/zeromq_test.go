@@ -0,0 +1,35 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestZeroMQQueue(t *testing.T) {
+	endpoint := "ipc://" + filepath.Join(t.TempDir(), "queue")
+	q, err := NewZeroMQQueue(context.Background(), endpoint)
+	if err != nil {
+		t.Fatalf("NewZeroMQQueue failed: %v", err)
+	}
+	events := make(chan []byte)
+	errCh := make(chan error, 1)
+	go func() { errCh <- q.Consume(events) }()
+	go func() {
+		for i := 0; i < 10; i++ {
+			if err := q.Produce([]byte(fmt.Sprintf("payload-%d", i))); err != nil {
+				t.Errorf("ZeroMQQueue#Produce failed: %v", err)
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if payload, expected := string(<-events), fmt.Sprintf("payload-%d", i); payload != expected {
+			t.Errorf("ZeroMQQueue#Consume failed: expected %s got %s", expected, payload)
+		}
+	}
+	q.Close()
+	if err := <-errCh; err != nil {
+		t.Errorf("ZeroMQQueue#Consume failed: %v", err)
+	}
+}